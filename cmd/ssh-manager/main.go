@@ -18,10 +18,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/treykane/ssh-manager/internal/cli"
+	"github.com/treykane/ssh-manager/internal/tunnel"
 )
 
 func main() {
@@ -34,7 +36,20 @@ func main() {
 	// subcommand routing, and help/usage output automatically.
 	// Any error returned by a RunE handler is printed to stderr
 	// and the process exits with a non-zero status code.
-	if err := cmd.Execute(); err != nil {
+	//
+	// "tunnel exec" reports its child's exit code as a cli.ExitCodeError,
+	// which is passed through as-is.
+	err := cmd.Execute()
+
+	// Let lifecycle hooks fired by the command finish; each one is bounded
+	// by its timeout.
+	tunnel.WaitHooks()
+
+	if err != nil {
+		var exitErr *cli.ExitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -16,10 +16,17 @@
 package appconfig
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync/atomic"
 
+	"github.com/treykane/ssh-manager/internal/health"
+	"github.com/treykane/ssh-manager/internal/model"
 	"gopkg.in/yaml.v3"
 )
 
@@ -38,6 +45,37 @@ const (
 	HostKeyPolicyStrict    = "strict"
 	HostKeyPolicyAcceptNew = "accept-new"
 	HostKeyPolicyInsecure  = "insecure"
+
+	RecordInputOff      = "off"
+	RecordInputRedacted = "redacted"
+	RecordInputFull     = "full"
+
+	// DefaultAutoPortMin and DefaultAutoPortMax are the default range for
+	// automatically allocated local ports.
+	DefaultAutoPortMin = 20000
+	DefaultAutoPortMax = 29999
+
+	// DefaultHookTimeoutSeconds and DefaultHookConcurrency bound lifecycle
+	// hook commands when config.yaml does not.
+	DefaultHookTimeoutSeconds = 10
+	DefaultHookConcurrency    = 4
+
+	// DefaultWebhookTimeoutSeconds and DefaultWebhookMaxAttempts apply to
+	// webhooks that set no timeout_seconds or max_attempts.
+	DefaultWebhookTimeoutSeconds = 5
+	DefaultWebhookMaxAttempts    = 8
+
+	// DefaultExecParallel and DefaultExecTimeoutSeconds bound
+	// "ssh-manager exec" when config.yaml does not.
+	DefaultExecParallel       = 10
+	DefaultExecTimeoutSeconds = 60
+
+	// DefaultHostHealthTimeoutSeconds bounds one remote host health check.
+	DefaultHostHealthTimeoutSeconds = 10
+
+	// DefaultRecordingRetentionDays is how long session recordings are
+	// kept when config.yaml does not say.
+	DefaultRecordingRetentionDays = 90
 )
 
 // SecurityConfig controls transport and tunnel safety defaults.
@@ -65,22 +103,287 @@ type TunnelConfig struct {
 	// RestartMaxAttempts is the maximum restart attempts before giving up.
 	RestartMaxAttempts int `yaml:"restart_max_attempts"`
 
-	// RestartBackoffSeconds is the delay before each restart attempt.
+	// RestartBackoffSeconds is the delay before the first restart attempt.
+	// Each further attempt doubles it, up to RestartBackoffMaxSeconds.
 	RestartBackoffSeconds int `yaml:"restart_backoff_seconds"`
 
+	// RestartBackoffMaxSeconds caps the exponential restart delay.
+	RestartBackoffMaxSeconds int `yaml:"restart_backoff_max_seconds"`
+
+	// RestartJitter randomizes each restart delay by up to this fraction
+	// (0-1) either way, so tunnels of one host do not retry in lockstep.
+	RestartJitter float64 `yaml:"restart_jitter"`
+
+	// BreakerThreshold is the number of consecutive failed restarts of a
+	// host's tunnels that opens its circuit breaker, pausing restarts for all
+	// of them. Zero disables the breaker.
+	BreakerThreshold int `yaml:"breaker_threshold"`
+
+	// BreakerCooldownSeconds is how long an open breaker pauses restarts
+	// before one tunnel is restarted as a probe.
+	BreakerCooldownSeconds int `yaml:"breaker_cooldown_seconds"`
+
 	// RestartStableWindowSeconds is the uptime window after which failure
 	// counters are reset back to zero.
 	RestartStableWindowSeconds int `yaml:"restart_stable_window_seconds"`
+
+	// ReadyTimeoutSeconds is how long a starting tunnel may take to accept
+	// connections on its local port before the start is reported as failed.
+	// Zero disables the readiness gate.
+	ReadyTimeoutSeconds int `yaml:"ready_timeout_seconds"`
+
+	// OnDemandIdleSeconds is how long an on-demand tunnel keeps ssh running
+	// after its last client disconnects before returning to "armed".
+	OnDemandIdleSeconds int `yaml:"on_demand_idle_seconds"`
+
+	// AutoPortMin and AutoPortMax bound the range automatic local ports are
+	// allocated from (--forward with local port "auto", --auto-port or a
+	// forwards entry with auto_port).
+	AutoPortMin int `yaml:"auto_port_min"`
+	AutoPortMax int `yaml:"auto_port_max"`
+
+	// TTLSeconds is the default maximum lifetime of a tunnel; it is stopped
+	// when it expires. Zero means no limit.
+	TTLSeconds int `yaml:"ttl_seconds"`
+
+	// IdleTimeoutSeconds is the default time a tunnel (other than on-demand
+	// ones) may go without client connections before it is stopped. Zero
+	// means no limit.
+	IdleTimeoutSeconds int `yaml:"idle_timeout_seconds"`
+
+	// Multiplex runs all forwards of a host over one ssh ControlMaster
+	// connection, adding and cancelling them with "ssh -O". Forwards can
+	// also opt in one by one (ForwardConfig.Multiplex).
+	Multiplex bool `yaml:"multiplex"`
+
+	// HookConcurrency is how many lifecycle hook commands may run at once;
+	// further events wait for a free slot.
+	HookConcurrency int `yaml:"hook_concurrency"`
+}
+
+// ExecConfig bounds "ssh-manager exec", which runs a command on many hosts.
+type ExecConfig struct {
+	// Parallel is how many hosts run the command at once.
+	Parallel int `yaml:"parallel"`
+
+	// TimeoutSeconds bounds the command on each host, including connecting.
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+}
+
+// HostHealthConfig controls remote host health checks, which run the
+// health command on a host over ssh ("ssh-manager health" and the
+// dashboard).
+type HostHealthConfig struct {
+	// Commands overrides default_health_command per host alias.
+	Commands map[string]string `yaml:"commands,omitempty"`
+
+	// TimeoutSeconds bounds one check, including connecting.
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+
+	// IntervalSeconds is how often the dashboard re-checks every host in
+	// the background. Zero disables background checks.
+	IntervalSeconds int `yaml:"interval_seconds"`
+}
+
+// RecordingConfig controls session recording: interactive sessions of the
+// matching hosts are written as asciicast v2 files under the config dir
+// (see internal/recording).
+type RecordingConfig struct {
+	// Enabled records every interactive session.
+	Enabled bool `yaml:"enabled"`
+
+	// Hosts and Tags record only the sessions of these host aliases, or of
+	// hosts whose host-wide (local_port 0) forwards entry carries one of
+	// the tags.
+	Hosts []string `yaml:"hosts,omitempty"`
+	Tags  []string `yaml:"tags,omitempty"`
+
+	// Input is what is kept of typed input: "off" (nothing, the default),
+	// "redacted" (keystroke timing with every character masked) or "full".
+	Input string `yaml:"input"`
+
+	// RetentionDays is how long recordings are kept. Zero keeps them
+	// forever.
+	RetentionDays int `yaml:"retention_days"`
+}
+
+// Records reports whether sessions of hostAlias, whose host-wide entry
+// carries tags, are recorded.
+func (r RecordingConfig) Records(hostAlias string, tags []string) bool {
+	if r.Enabled || slices.Contains(r.Hosts, hostAlias) {
+		return true
+	}
+	for _, tag := range tags {
+		if slices.Contains(r.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// HookConfig runs a local command when a tunnel event is recorded. The
+// event is passed as JSON on stdin and as SSHM_* environment variables.
+type HookConfig struct {
+	// Events lists the event types that trigger the hook (e.g.
+	// start_succeeded, unexpected_exit). Empty or "*" matches every event.
+	Events []string `yaml:"events,omitempty"`
+
+	// Hosts and Tags narrow the hook to tunnels of these host aliases or
+	// whose forward entry carries one of these tags. Empty matches all.
+	Hosts []string `yaml:"hosts,omitempty"`
+	Tags  []string `yaml:"tags,omitempty"`
+
+	// Command is the argv to run (no shell).
+	Command []string `yaml:"command"`
+
+	// TimeoutSeconds kills the command after this long.
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+}
+
+// WebhookConfig posts tunnel events as JSON to an HTTP endpoint.
+type WebhookConfig struct {
+	// URL is the http or https endpoint events are POSTed to.
+	URL string `yaml:"url"`
+
+	// Events and Hosts filter the events sent (empty or "*" = all).
+	Events []string `yaml:"events,omitempty"`
+	Hosts  []string `yaml:"hosts,omitempty"`
+
+	// Secret, or the environment variable named by SecretEnv, signs each
+	// body with HMAC-SHA256 in the X-SSHM-Signature header.
+	Secret    string `yaml:"secret,omitempty"`
+	SecretEnv string `yaml:"secret_env,omitempty"`
+
+	// TimeoutSeconds bounds one delivery attempt.
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty"`
+
+	// MaxAttempts is how often a delivery is tried before it is dropped.
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+}
+
+// SigningSecret returns the HMAC secret of the webhook, or "" if unsigned.
+func (w WebhookConfig) SigningSecret() string {
+	if w.SecretEnv != "" {
+		return os.Getenv(w.SecretEnv)
+	}
+	return w.Secret
+}
+
+// ForwardConfig attaches app-level settings to forwards of an SSH host.
+//
+// Entries are matched by host alias and local port. LocalPort 0 applies to
+// every forward of the host; an entry with an exact port wins over it.
+type ForwardConfig struct {
+	// Host is the SSH host alias the entry applies to.
+	Host string `yaml:"host"`
+
+	// LocalPort selects one forward by its local port (0 = all forwards).
+	LocalPort int `yaml:"local_port,omitempty"`
+
+	// HealthCheck is an application-level probe run against the local end.
+	HealthCheck *model.HealthCheck `yaml:"health_check,omitempty"`
+
+	// OnDemand arms the forward instead of starting ssh right away: the
+	// local port is held by ssh-manager and ssh starts on first connection.
+	OnDemand bool `yaml:"on_demand,omitempty"`
+
+	// Relay puts ssh-manager between clients and ssh to count connections
+	// and bytes (on-demand forwards are always counted).
+	Relay bool `yaml:"relay,omitempty"`
+
+	// IdleTimeoutSeconds overrides tunnel.on_demand_idle_seconds (on-demand
+	// forwards) or tunnel.idle_timeout_seconds (other forwards).
+	IdleTimeoutSeconds int `yaml:"idle_timeout_seconds,omitempty"`
+
+	// TTLSeconds overrides tunnel.ttl_seconds for this forward.
+	TTLSeconds int `yaml:"ttl_seconds,omitempty"`
+
+	// AutoPort allocates a free local port when the forward's declared one
+	// is taken. ssh_config cannot declare an "auto" port itself (ssh rejects
+	// it), so this is how an SSH config forward opts in.
+	AutoPort bool `yaml:"auto_port,omitempty"`
+
+	// Tags label the forward's tunnels, e.g. for scoping hooks.
+	Tags []string `yaml:"tags,omitempty"`
+
+	// Multiplex runs the forward over the host's shared ControlMaster
+	// connection (see TunnelConfig.Multiplex).
+	Multiplex bool `yaml:"multiplex,omitempty"`
+
+	// DependsOn names tunnels that must be up before this forward starts:
+	// "host" for all of a host's forwards or "host:local_port" for one.
+	DependsOn []string `yaml:"depends_on,omitempty"`
+
+	// Env maps environment variable names to templates exported by
+	// `tunnel env`, e.g. DATABASE_URL: postgres://{local}/app. See
+	// tunnel.RenderEnv for the placeholders.
+	Env map[string]string `yaml:"env,omitempty"`
+}
+
+// FindForwardConfig returns the entry in forwards for host and localPort,
+// preferring an exact port match over a host-wide (LocalPort 0) entry.
+func FindForwardConfig(forwards []ForwardConfig, host string, localPort int) (ForwardConfig, bool) {
+	var fallback *ForwardConfig
+	for i := range forwards {
+		fc := &forwards[i]
+		if fc.Host != host {
+			continue
+		}
+		if fc.LocalPort == localPort && localPort != 0 {
+			return *fc, true
+		}
+		if fc.LocalPort == 0 && fallback == nil {
+			fallback = fc
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return ForwardConfig{}, false
+}
+
+// ForwardTags returns the tags of the forward of host on localPort: those
+// of the entry FindForwardConfig picks. Tunnels use them for per-tag ssh
+// options and hooks.
+func ForwardTags(forwards []ForwardConfig, host string, localPort int) []string {
+	if fc, ok := FindForwardConfig(forwards, host, localPort); ok {
+		return fc.Tags
+	}
+	return nil
+}
+
+// HostTags returns the tags of host itself: those of its host-wide
+// (local_port 0) forwards entry. They select the host for "tag:" targets
+// and give its sessions and control masters per-tag ssh options and
+// recording, so a host is never selected by a tag whose options its
+// sessions do not get.
+func HostTags(forwards []ForwardConfig, host string) []string {
+	return ForwardTags(forwards, host, 0)
+}
+
+// HostsWithTag returns the hosts whose HostTags include tag, in the order
+// of their forwards entries.
+func HostsWithTag(forwards []ForwardConfig, tag string) []string {
+	var out []string
+	for _, fc := range forwards {
+		if !slices.Contains(out, fc.Host) && slices.Contains(HostTags(forwards, fc.Host), tag) {
+			out = append(out, fc.Host)
+		}
+	}
+	return out
 }
 
 // Config holds the top-level application configuration, loaded from config.yaml.
 // Fields map directly to YAML keys for straightforward editing by users.
 type Config struct {
 	// DefaultHealthCommand is the shell command executed on remote hosts to
-	// verify connectivity (e.g. "uptime"). This may be used in future health-check
-	// features. Defaults to "uptime" if empty or missing from the config file.
+	// verify connectivity (e.g. "uptime"); see HostHealth. Defaults to
+	// "uptime" if empty or missing from the config file.
 	DefaultHealthCommand string `yaml:"default_health_command"`
 
+	// HostHealth controls remote host health checks.
+	HostHealth HostHealthConfig `yaml:"host_health"`
+
 	// UI contains TUI-specific display and refresh settings.
 	UI UIConfig `yaml:"ui"`
 
@@ -89,6 +392,24 @@ type Config struct {
 
 	// Tunnel contains auto-restart behavior for tunnel processes.
 	Tunnel TunnelConfig `yaml:"tunnel"`
+
+	// SSH holds the ssh options passed to tunnels and interactive sessions.
+	SSH SSHConfig `yaml:"ssh"`
+
+	// Exec contains defaults for running commands on many hosts.
+	Exec ExecConfig `yaml:"exec"`
+
+	// Recording controls session recording.
+	Recording RecordingConfig `yaml:"recording"`
+
+	// Forwards holds per-forward settings such as health checks.
+	Forwards []ForwardConfig `yaml:"forwards,omitempty"`
+
+	// Hooks run local commands on tunnel lifecycle events.
+	Hooks []HookConfig `yaml:"hooks,omitempty"`
+
+	// Webhooks post tunnel lifecycle events to HTTP endpoints.
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty"`
 }
 
 // Default returns the default configuration values. These are used when:
@@ -112,11 +433,43 @@ func Default() Config {
 			AutoRestart:                true,
 			RestartMaxAttempts:         3,
 			RestartBackoffSeconds:      2,
+			RestartBackoffMaxSeconds:   60,
+			RestartJitter:              0.2,
+			BreakerThreshold:           5,
+			BreakerCooldownSeconds:     60,
 			RestartStableWindowSeconds: 30,
+			ReadyTimeoutSeconds:        10,
+			OnDemandIdleSeconds:        300,
+			AutoPortMin:                DefaultAutoPortMin,
+			AutoPortMax:                DefaultAutoPortMax,
+			HookConcurrency:            DefaultHookConcurrency,
+		},
+		SSH: SSHConfig{SSHOptions: SSHOptions{
+			ServerAliveInterval:  intPtr(30),
+			ServerAliveCountMax:  intPtr(3),
+			ExitOnForwardFailure: boolPtr(true),
+		}},
+		Exec: ExecConfig{
+			Parallel:       DefaultExecParallel,
+			TimeoutSeconds: DefaultExecTimeoutSeconds,
+		},
+		HostHealth: HostHealthConfig{TimeoutSeconds: DefaultHostHealthTimeoutSeconds},
+		Recording: RecordingConfig{
+			Input:         RecordInputOff,
+			RetentionDays: DefaultRecordingRetentionDays,
 		},
 	}
 }
 
+// HealthCommand returns the health command of host alias: its entry in
+// host_health.commands, or default_health_command.
+func (c Config) HealthCommand(alias string) string {
+	if cmd := c.HostHealth.Commands[alias]; cmd != "" {
+		return cmd
+	}
+	return c.DefaultHealthCommand
+}
+
 func NormalizeBindPolicy(policy string) string {
 	switch policy {
 	case BindPolicyAllowPublic:
@@ -137,6 +490,19 @@ func NormalizeHostKeyPolicy(policy string) string {
 	}
 }
 
+// NormalizeRecordInput maps recording.input to a known mode, defaulting to
+// RecordInputOff.
+func NormalizeRecordInput(mode string) string {
+	switch mode {
+	case RecordInputRedacted:
+		return RecordInputRedacted
+	case RecordInputFull:
+		return RecordInputFull
+	default:
+		return RecordInputOff
+	}
+}
+
 // ConfigDir returns the absolute path to the ssh-manager configuration directory.
 //
 // Resolution order:
@@ -156,17 +522,15 @@ func ConfigDir() (string, error) {
 	return filepath.Join(home, ".config", "ssh-manager"), nil
 }
 
-// RuntimeFilePath returns the full path to runtime.json, which is used by the
-// tunnel manager (internal/tunnel) to persist tunnel state across app restarts.
-//
-// The file is stored inside the config directory alongside config.yaml.
-// Example: ~/.config/ssh-manager/runtime.json
-func RuntimeFilePath() (string, error) {
-	d, err := ConfigDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(d, "runtime.json"), nil
+// readOnly makes Load and Save leave the config directory untouched (see
+// SetReadOnly).
+var readOnly atomic.Bool
+
+// SetReadOnly controls whether Load may create config.yaml and Save may
+// write it. --dry-run enables it (through state.SetReadOnly) so that a dry
+// run on a fresh machine does not create the config directory.
+func SetReadOnly(v bool) {
+	readOnly.Store(v)
 }
 
 // Load reads and parses config.yaml from the configuration directory.
@@ -178,6 +542,7 @@ func RuntimeFilePath() (string, error) {
 //   - Missing or invalid field values are replaced with sensible defaults:
 //     RefreshSeconds <= 0 is clamped to 3, empty DefaultHealthCommand becomes "uptime".
 //   - The config directory is created (with parents) if it doesn't already exist.
+//   - With SetReadOnly(true), nothing is created: a missing file yields Default().
 func Load() (Config, error) {
 	d, err := ConfigDir()
 	if err != nil {
@@ -185,14 +550,19 @@ func Load() (Config, error) {
 	}
 
 	// Ensure the config directory exists before attempting to read or write.
-	if err := os.MkdirAll(d, 0o700); err != nil {
-		return Config{}, err
+	if !readOnly.Load() {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return Config{}, err
+		}
 	}
 
 	path := filepath.Join(d, "config.yaml")
 	b, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
+			if readOnly.Load() {
+				return Default(), nil
+			}
 			// First run: create config.yaml with defaults so users can discover
 			// and edit the available settings.
 			cfg := Default()
@@ -228,9 +598,105 @@ func Load() (Config, error) {
 	if cfg.Tunnel.RestartBackoffSeconds <= 0 {
 		cfg.Tunnel.RestartBackoffSeconds = 2
 	}
+	if cfg.Tunnel.RestartBackoffMaxSeconds < cfg.Tunnel.RestartBackoffSeconds {
+		cfg.Tunnel.RestartBackoffMaxSeconds = max(60, cfg.Tunnel.RestartBackoffSeconds)
+	}
+	cfg.Tunnel.RestartJitter = min(max(cfg.Tunnel.RestartJitter, 0), 1)
+	if cfg.Tunnel.BreakerThreshold < 0 {
+		cfg.Tunnel.BreakerThreshold = 0
+	}
+	if cfg.Tunnel.BreakerCooldownSeconds <= 0 {
+		cfg.Tunnel.BreakerCooldownSeconds = 60
+	}
 	if cfg.Tunnel.RestartStableWindowSeconds <= 0 {
 		cfg.Tunnel.RestartStableWindowSeconds = 30
 	}
+	if cfg.Tunnel.ReadyTimeoutSeconds < 0 {
+		cfg.Tunnel.ReadyTimeoutSeconds = 0
+	}
+	if cfg.Tunnel.OnDemandIdleSeconds <= 0 {
+		cfg.Tunnel.OnDemandIdleSeconds = 300
+	}
+	if cfg.Tunnel.AutoPortMin < 1 || cfg.Tunnel.AutoPortMax > 65535 || cfg.Tunnel.AutoPortMin > cfg.Tunnel.AutoPortMax {
+		cfg.Tunnel.AutoPortMin = DefaultAutoPortMin
+		cfg.Tunnel.AutoPortMax = DefaultAutoPortMax
+	}
+	if cfg.Tunnel.TTLSeconds < 0 {
+		cfg.Tunnel.TTLSeconds = 0
+	}
+	if cfg.Tunnel.IdleTimeoutSeconds < 0 {
+		cfg.Tunnel.IdleTimeoutSeconds = 0
+	}
+	if cfg.Tunnel.HookConcurrency <= 0 {
+		cfg.Tunnel.HookConcurrency = DefaultHookConcurrency
+	}
+	if cfg.HostHealth.TimeoutSeconds <= 0 {
+		cfg.HostHealth.TimeoutSeconds = DefaultHostHealthTimeoutSeconds
+	}
+	if cfg.HostHealth.IntervalSeconds < 0 {
+		cfg.HostHealth.IntervalSeconds = 0
+	}
+	if cfg.Exec.Parallel <= 0 {
+		cfg.Exec.Parallel = DefaultExecParallel
+	}
+	if cfg.Exec.TimeoutSeconds <= 0 {
+		cfg.Exec.TimeoutSeconds = DefaultExecTimeoutSeconds
+	}
+	cfg.Recording.Input = NormalizeRecordInput(cfg.Recording.Input)
+	if cfg.Recording.RetentionDays < 0 {
+		cfg.Recording.RetentionDays = 0
+	}
+	hooks := cfg.Hooks[:0]
+	for _, h := range cfg.Hooks {
+		if len(h.Command) == 0 {
+			slog.Warn("ignoring hook without a command", "events", h.Events)
+			continue
+		}
+		if h.TimeoutSeconds <= 0 {
+			h.TimeoutSeconds = DefaultHookTimeoutSeconds
+		}
+		hooks = append(hooks, h)
+	}
+	cfg.Hooks = hooks
+	webhooks := cfg.Webhooks[:0]
+	for _, w := range cfg.Webhooks {
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			slog.Warn("ignoring webhook without a valid http(s) url", "url", w.URL)
+			continue
+		}
+		if w.TimeoutSeconds <= 0 {
+			w.TimeoutSeconds = DefaultWebhookTimeoutSeconds
+		}
+		if w.MaxAttempts <= 0 {
+			w.MaxAttempts = DefaultWebhookMaxAttempts
+		}
+		webhooks = append(webhooks, w)
+	}
+	cfg.Webhooks = webhooks
+	for i, fc := range cfg.Forwards {
+		if fc.HealthCheck == nil {
+			continue
+		}
+		if err := health.Validate(*fc.HealthCheck); err != nil {
+			slog.Warn("ignoring health check", "host", fc.Host, "local_port", fc.LocalPort, "reason", err)
+			cfg.Forwards[i].HealthCheck = nil
+		}
+	}
+	for _, reason := range cfg.SSH.validate() {
+		slog.Warn("ignoring ssh option", "scope", "global", "reason", reason)
+	}
+	for alias, o := range cfg.SSH.Hosts {
+		for _, reason := range o.validate() {
+			slog.Warn("ignoring ssh option", "scope", "host "+alias, "reason", reason)
+		}
+		cfg.SSH.Hosts[alias] = o
+	}
+	for tag, o := range cfg.SSH.Tags {
+		for _, reason := range o.validate() {
+			slog.Warn("ignoring ssh option", "scope", "tag "+tag, "reason", reason)
+		}
+		cfg.SSH.Tags[tag] = o
+	}
 
 	return cfg, nil
 }
@@ -240,6 +706,9 @@ func Load() (Config, error) {
 //
 // The file is written with 0600 permissions to keep local policy settings private.
 func Save(cfg Config) error {
+	if readOnly.Load() {
+		return errors.New("config is read-only (dry run)")
+	}
 	d, err := ConfigDir()
 	if err != nil {
 		return err
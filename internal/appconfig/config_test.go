@@ -3,6 +3,7 @@ package appconfig
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -28,6 +29,9 @@ func TestLoad_DefaultSecurityValues(t *testing.T) {
 	if cfg.Tunnel.RestartMaxAttempts != 3 {
 		t.Fatalf("unexpected restart max attempts: %d", cfg.Tunnel.RestartMaxAttempts)
 	}
+	if cfg.Tunnel.ReadyTimeoutSeconds != 10 {
+		t.Fatalf("unexpected ready timeout: %d", cfg.Tunnel.ReadyTimeoutSeconds)
+	}
 }
 
 func TestLoad_NormalizesSecurityPolicies(t *testing.T) {
@@ -65,7 +69,16 @@ func TestLoad_NormalizesTunnelRestartSettings(t *testing.T) {
 		"  auto_restart: true",
 		"  restart_max_attempts: -1",
 		"  restart_backoff_seconds: 0",
+		"  restart_backoff_max_seconds: 1",
+		"  restart_jitter: 3",
+		"  breaker_threshold: -2",
+		"  breaker_cooldown_seconds: 0",
 		"  restart_stable_window_seconds: 0",
+		"  ready_timeout_seconds: -5",
+		"  auto_port_min: 30000",
+		"  auto_port_max: 20000",
+		"  ttl_seconds: -1",
+		"  idle_timeout_seconds: -30",
 		"",
 	}, "\n"))
 	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), content, 0o600); err != nil {
@@ -81,7 +94,230 @@ func TestLoad_NormalizesTunnelRestartSettings(t *testing.T) {
 	if cfg.Tunnel.RestartBackoffSeconds != 2 {
 		t.Fatalf("expected default backoff seconds, got %d", cfg.Tunnel.RestartBackoffSeconds)
 	}
+	if cfg.Tunnel.RestartBackoffMaxSeconds != 60 || cfg.Tunnel.RestartJitter != 1 {
+		t.Fatalf("expected backoff cap reset and jitter clamped, got max=%d jitter=%v", cfg.Tunnel.RestartBackoffMaxSeconds, cfg.Tunnel.RestartJitter)
+	}
+	if cfg.Tunnel.BreakerThreshold != 0 || cfg.Tunnel.BreakerCooldownSeconds != 60 {
+		t.Fatalf("expected negative threshold to disable the breaker and default cooldown, got %d/%d", cfg.Tunnel.BreakerThreshold, cfg.Tunnel.BreakerCooldownSeconds)
+	}
 	if cfg.Tunnel.RestartStableWindowSeconds != 30 {
 		t.Fatalf("expected default stable window, got %d", cfg.Tunnel.RestartStableWindowSeconds)
 	}
+	if cfg.Tunnel.ReadyTimeoutSeconds != 0 {
+		t.Fatalf("expected negative ready timeout to disable the gate, got %d", cfg.Tunnel.ReadyTimeoutSeconds)
+	}
+	if cfg.Tunnel.AutoPortMin != DefaultAutoPortMin || cfg.Tunnel.AutoPortMax != DefaultAutoPortMax {
+		t.Fatalf("expected inverted auto port range to reset, got %d-%d", cfg.Tunnel.AutoPortMin, cfg.Tunnel.AutoPortMax)
+	}
+	if cfg.Tunnel.TTLSeconds != 0 || cfg.Tunnel.IdleTimeoutSeconds != 0 {
+		t.Fatalf("expected negative lifetime limits to disable them, got ttl=%d idle=%d", cfg.Tunnel.TTLSeconds, cfg.Tunnel.IdleTimeoutSeconds)
+	}
+}
+
+func TestLoad_ForwardHealthChecks(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	dir := filepath.Join(xdg, "ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(strings.Join([]string{
+		"forwards:",
+		"  - host: db",
+		"    health_check:",
+		"      type: tcp",
+		"  - host: db",
+		"    local_port: 15432",
+		"    health_check:",
+		"      type: postgres",
+		"      timeout_seconds: 2",
+		"  - host: api",
+		"    health_check:",
+		"      type: https",
+		"  - host: web",
+		"    health_check:",
+		"      type: https",
+		"      server_name: web.example.com",
+		"",
+	}, "\n"))
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc, ok := FindForwardConfig(cfg.Forwards, "db", 15432)
+	if !ok || fc.HealthCheck == nil || fc.HealthCheck.Type != "postgres" || fc.HealthCheck.TimeoutSeconds != 2 {
+		t.Fatalf("expected exact-port postgres check, got %+v", fc)
+	}
+	fc, ok = FindForwardConfig(cfg.Forwards, "db", 8080)
+	if !ok || fc.HealthCheck == nil || fc.HealthCheck.Type != "tcp" {
+		t.Fatalf("expected host-wide tcp check, got %+v", fc)
+	}
+	if fc, ok := FindForwardConfig(cfg.Forwards, "api", 8080); !ok || fc.HealthCheck != nil {
+		t.Fatalf("expected https check without server_name dropped, got %+v", fc)
+	}
+	if fc, ok := FindForwardConfig(cfg.Forwards, "web", 8443); !ok || fc.HealthCheck == nil || fc.HealthCheck.ServerName != "web.example.com" {
+		t.Fatalf("expected https check with server_name kept, got %+v", fc)
+	}
+	if _, ok := FindForwardConfig(cfg.Forwards, "cache", 8080); ok {
+		t.Fatal("expected no entry for cache")
+	}
+}
+
+func TestHostTagsUseHostWideEntry(t *testing.T) {
+	forwards := []ForwardConfig{
+		{Host: "api", Tags: []string{"prod"}},
+		{Host: "api", LocalPort: 8080, Tags: []string{"web"}},
+		{Host: "db", LocalPort: 5432, Tags: []string{"prod"}},
+	}
+	if got := HostsWithTag(forwards, "prod"); !slices.Equal(got, []string{"api"}) {
+		t.Fatalf("expected only the host-wide prod entry to tag a host, got %v", got)
+	}
+	if got := HostsWithTag(forwards, "web"); len(got) != 0 {
+		t.Fatalf("expected a port-specific tag not to tag the host, got %v", got)
+	}
+	if got := HostTags(forwards, "db"); len(got) != 0 {
+		t.Fatalf("expected db to have no host tags, got %v", got)
+	}
+	if got := ForwardTags(forwards, "db", 5432); !slices.Equal(got, []string{"prod"}) {
+		t.Fatalf("expected db's forward tagged prod, got %v", got)
+	}
+}
+
+func TestLoad_Hooks(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	dir := filepath.Join(xdg, "ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(strings.Join([]string{
+		"tunnel:",
+		"  hook_concurrency: 0",
+		"hooks:",
+		"  - events: [start_succeeded, quarantine]",
+		"    tags: [prod]",
+		"    command: [/usr/local/bin/notify, --quiet]",
+		"  - events: [unexpected_exit]",
+		"",
+	}, "\n"))
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Tunnel.HookConcurrency != DefaultHookConcurrency {
+		t.Fatalf("expected default hook concurrency, got %d", cfg.Tunnel.HookConcurrency)
+	}
+	if len(cfg.Hooks) != 1 {
+		t.Fatalf("expected the hook without a command to be dropped, got %+v", cfg.Hooks)
+	}
+	if h := cfg.Hooks[0]; h.TimeoutSeconds != DefaultHookTimeoutSeconds || len(h.Command) != 2 || h.Tags[0] != "prod" {
+		t.Fatalf("unexpected hook: %+v", h)
+	}
+}
+
+func TestLoad_Webhooks(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("SSHM_TEST_WEBHOOK_SECRET", "from-env")
+	dir := filepath.Join(xdg, "ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(strings.Join([]string{
+		"webhooks:",
+		"  - url: https://hooks.example.com/sshm",
+		"    events: [quarantine]",
+		"    secret_env: SSHM_TEST_WEBHOOK_SECRET",
+		"  - url: ftp://example.com/nope",
+		"  - events: [start_succeeded]",
+		"",
+	}, "\n"))
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Webhooks) != 1 {
+		t.Fatalf("expected webhooks without a valid url to be dropped, got %+v", cfg.Webhooks)
+	}
+	w := cfg.Webhooks[0]
+	if w.TimeoutSeconds != DefaultWebhookTimeoutSeconds || w.MaxAttempts != DefaultWebhookMaxAttempts {
+		t.Fatalf("expected webhook defaults, got %+v", w)
+	}
+	if w.SigningSecret() != "from-env" {
+		t.Fatalf("expected the secret from the environment, got %q", w.SigningSecret())
+	}
+}
+
+func TestLoad_SSHOptions(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	dir := filepath.Join(xdg, "ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte(strings.Join([]string{
+		"ssh:",
+		"  server_alive_interval: 15",
+		"  extra: [TCPKeepAlive=no, UserKnownHostsFile=/dev/null, ProxyCommand=nc %h %p, LogLevel=QUIET, bogus]",
+		"  hosts:",
+		"    prod:",
+		"      exit_on_forward_failure: false",
+		"      connect_timeout: -1",
+		"",
+	}, "\n"))
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *cfg.SSH.ServerAliveInterval != 15 || *cfg.SSH.ServerAliveCountMax != 3 || !*cfg.SSH.ExitOnForwardFailure {
+		t.Fatalf("expected configured and default keepalives, got %+v", cfg.SSH.SSHOptions)
+	}
+	if len(cfg.SSH.Extra) != 1 || cfg.SSH.Extra[0] != "TCPKeepAlive=no" {
+		t.Fatalf("expected options outside the allowlist dropped, got %v", cfg.SSH.Extra)
+	}
+	prod := cfg.SSH.For("prod", nil)
+	if *prod.ExitOnForwardFailure || prod.ConnectTimeout != nil || *prod.ServerAliveInterval != 15 {
+		t.Fatalf("unexpected prod options: %+v", prod)
+	}
+}
+
+func TestLoad_Recording(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	dir := filepath.Join(xdg, "ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("recording:\n  tags: [prod]\n  hosts: [bastion]\n  input: everything\n  retention_days: -5\n")
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Recording.Input != RecordInputOff || cfg.Recording.RetentionDays != 0 {
+		t.Fatalf("expected unknown input and negative retention normalized, got %+v", cfg.Recording)
+	}
+	if !cfg.Recording.Records("bastion", nil) || !cfg.Recording.Records("db", []string{"staging", "prod"}) {
+		t.Fatal("expected listed host and tagged host recorded")
+	}
+	if cfg.Recording.Records("db", []string{"staging"}) {
+		t.Fatal("expected untagged host not recorded")
+	}
+	if Default().Recording.RetentionDays != DefaultRecordingRetentionDays {
+		t.Fatalf("unexpected default retention: %+v", Default().Recording)
+	}
 }
@@ -0,0 +1,159 @@
+package appconfig
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SSHOptions are ssh client options ssh-manager passes to every ssh it runs
+// (tunnels, control masters and interactive sessions) with -o. Unset fields
+// leave ssh's own configuration in effect.
+type SSHOptions struct {
+	// ServerAliveInterval and ServerAliveCountMax make ssh probe an idle
+	// connection and exit once the server stops answering, so a dead tunnel
+	// ends instead of hanging.
+	ServerAliveInterval *int `yaml:"server_alive_interval,omitempty"`
+	ServerAliveCountMax *int `yaml:"server_alive_count_max,omitempty"`
+
+	// ExitOnForwardFailure ends ssh when a forward cannot be set up (for
+	// example its local port is taken) rather than running without it.
+	ExitOnForwardFailure *bool `yaml:"exit_on_forward_failure,omitempty"`
+
+	Compression    *bool `yaml:"compression,omitempty"`
+	ConnectTimeout *int  `yaml:"connect_timeout,omitempty"`
+
+	// Extra holds further "Key=Value" options. Only keys in
+	// AllowedSSHOptions are accepted.
+	Extra []string `yaml:"extra,omitempty"`
+}
+
+// SSHConfig is the ssh option policy: global options, overridden by the
+// options of matching tags and then of the host alias.
+type SSHConfig struct {
+	SSHOptions `yaml:",inline"`
+
+	// Hosts maps host aliases to their options.
+	Hosts map[string]SSHOptions `yaml:"hosts,omitempty"`
+
+	// Tags maps forward config tags to options. A tunnel gets the tags of
+	// its forward entry, an interactive session those of the host-wide
+	// (local_port 0) entry.
+	Tags map[string]SSHOptions `yaml:"tags,omitempty"`
+}
+
+// AllowedSSHOptions are the ssh options Extra may set, lower-cased. Options
+// that affect host key verification (StrictHostKeyChecking,
+// UserKnownHostsFile, ...), run local commands (ProxyCommand,
+// LocalCommand, ...) or control multiplexing are left out, so extra
+// options cannot bypass the host key policy or ssh-manager's own setup.
+// LogLevel is left out too: QUIET or FATAL would hide the stderr lines
+// failures are classified from.
+var AllowedSSHOptions = []string{
+	"addressfamily",
+	"batchmode",
+	"bindaddress",
+	"bindinterface",
+	"ciphers",
+	"compression",
+	"connectionattempts",
+	"connecttimeout",
+	"exitonforwardfailure",
+	"gssapiauthentication",
+	"identitiesonly",
+	"identityfile",
+	"ipqos",
+	"kbdinteractiveauthentication",
+	"kexalgorithms",
+	"macs",
+	"numberofpasswordprompts",
+	"passwordauthentication",
+	"preferredauthentications",
+	"pubkeyauthentication",
+	"rekeylimit",
+	"serveraliveinterval",
+	"serveralivecountmax",
+	"tcpkeepalive",
+}
+
+// ValidateSSHOption checks one "Key=Value" extra option against
+// AllowedSSHOptions.
+func ValidateSSHOption(opt string) error {
+	key, value, ok := strings.Cut(opt, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || strings.TrimSpace(value) == "" {
+		return fmt.Errorf("ssh option %q is not of the form Key=Value", opt)
+	}
+	if strings.ContainsAny(opt, "\r\n") {
+		return fmt.Errorf("ssh option %q contains a line break", opt)
+	}
+	if !slices.Contains(AllowedSSHOptions, strings.ToLower(key)) {
+		return fmt.Errorf("ssh option %s is not allowed", key)
+	}
+	return nil
+}
+
+// For returns the options that apply to hostAlias with the given tags:
+// global ones, overridden by each matching tag in order and then by the
+// host's entry. Extra options accumulate, later ones first so that they win
+// (ssh uses the first value given for an option).
+func (c SSHConfig) For(hostAlias string, tags []string) SSHOptions {
+	out := c.SSHOptions
+	for _, tag := range tags {
+		if o, ok := c.Tags[tag]; ok {
+			out = out.merge(o)
+		}
+	}
+	if o, ok := c.Hosts[hostAlias]; ok {
+		out = out.merge(o)
+	}
+	return out
+}
+
+// merge returns o with the fields set in over replacing its own.
+func (o SSHOptions) merge(over SSHOptions) SSHOptions {
+	if over.ServerAliveInterval != nil {
+		o.ServerAliveInterval = over.ServerAliveInterval
+	}
+	if over.ServerAliveCountMax != nil {
+		o.ServerAliveCountMax = over.ServerAliveCountMax
+	}
+	if over.ExitOnForwardFailure != nil {
+		o.ExitOnForwardFailure = over.ExitOnForwardFailure
+	}
+	if over.Compression != nil {
+		o.Compression = over.Compression
+	}
+	if over.ConnectTimeout != nil {
+		o.ConnectTimeout = over.ConnectTimeout
+	}
+	if len(over.Extra) > 0 {
+		o.Extra = append(slices.Clone(over.Extra), o.Extra...)
+	}
+	return o
+}
+
+// validate drops extra options that fail ValidateSSHOption and negative
+// numbers, returning what was dropped.
+func (o *SSHOptions) validate() []string {
+	var dropped []string
+	for _, p := range []**int{&o.ServerAliveInterval, &o.ServerAliveCountMax, &o.ConnectTimeout} {
+		if *p != nil && **p < 0 {
+			dropped = append(dropped, fmt.Sprintf("negative value %d", **p))
+			*p = nil
+		}
+	}
+	extra := o.Extra[:0]
+	for _, opt := range o.Extra {
+		if err := ValidateSSHOption(opt); err != nil {
+			dropped = append(dropped, err.Error())
+			continue
+		}
+		extra = append(extra, opt)
+	}
+	o.Extra = extra
+	return dropped
+}
+
+func intPtr(v int) *int    { return &v }
+func boolPtr(v bool) *bool { return &v }
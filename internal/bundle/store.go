@@ -3,11 +3,15 @@ package bundle
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
-	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/health"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/state"
+	"github.com/treykane/ssh-manager/internal/tunnel"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,6 +19,32 @@ import (
 type Entry struct {
 	HostAlias       string `yaml:"host_alias" json:"host_alias"`
 	ForwardSelector string `yaml:"forward_selector,omitempty" json:"forward_selector,omitempty"`
+
+	// HealthCheck overrides the app config health check for this entry's forwards.
+	HealthCheck *model.HealthCheck `yaml:"health_check,omitempty" json:"health_check,omitempty"`
+
+	// TTLSeconds and IdleTimeoutSeconds override the app config tunnel
+	// lifetime limits for this entry's forwards (0 = use the config).
+	TTLSeconds         int `yaml:"ttl_seconds,omitempty" json:"ttl_seconds,omitempty"`
+	IdleTimeoutSeconds int `yaml:"idle_timeout_seconds,omitempty" json:"idle_timeout_seconds,omitempty"`
+
+	// Relay counts client traffic through this entry's forwards.
+	Relay bool `yaml:"relay,omitempty" json:"relay,omitempty"`
+
+	// DependsOn names tunnels that must be up before this entry's forwards
+	// start ("host" or "host:local_port"). Run orders entries accordingly.
+	DependsOn []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+}
+
+// Options returns the tunnel start options of this entry's forwards.
+func (e Entry) Options() tunnel.ForwardOptions {
+	return tunnel.ForwardOptions{
+		HealthCheck: e.HealthCheck,
+		TTL:         time.Duration(e.TTLSeconds) * time.Second,
+		IdleTimeout: time.Duration(e.IdleTimeoutSeconds) * time.Second,
+		Relay:       e.Relay,
+		DependsOn:   e.DependsOn,
+	}
 }
 
 // Definition is a named sequence of bundle entries.
@@ -23,16 +53,54 @@ type Definition struct {
 	Entries []Entry `yaml:"entries" json:"entries"`
 }
 
-type fileModel struct {
-	Bundles map[string]Definition `yaml:"bundles"`
-}
+// Ordered returns the entries with each one after the entries it depends on,
+// otherwise keeping the saved order. Dependencies on hosts outside the bundle
+// are left to the tunnel manager. A dependency cycle is an error.
+func (d Definition) Ordered() ([]Entry, error) {
+	needs := make([][]int, len(d.Entries))
+	for i, e := range d.Entries {
+		for _, dep := range e.DependsOn {
+			host, _, err := tunnel.ParseDependency(dep)
+			if err != nil {
+				return nil, fmt.Errorf("bundle %s entry %s: %w", d.Name, e.HostAlias, err)
+			}
+			for j, other := range d.Entries {
+				if other.HostAlias == host && host != e.HostAlias {
+					needs[i] = append(needs[i], j)
+				}
+			}
+		}
+	}
 
-func filePath() (string, error) {
-	dir, err := appconfig.ConfigDir()
-	if err != nil {
-		return "", err
+	out := make([]Entry, 0, len(d.Entries))
+	placed := make([]bool, len(d.Entries))
+	for len(out) < len(d.Entries) {
+		progress := false
+		for i, e := range d.Entries {
+			if placed[i] || slices.ContainsFunc(needs[i], func(j int) bool { return !placed[j] }) {
+				continue
+			}
+			placed[i] = true
+			out = append(out, e)
+			progress = true
+		}
+		if !progress {
+			var stuck []string
+			for i, e := range d.Entries {
+				if !placed[i] {
+					stuck = append(stuck, e.HostAlias)
+				}
+			}
+			return nil, fmt.Errorf("bundle %s has a dependency cycle between %s", d.Name, strings.Join(stuck, ", "))
+		}
 	}
-	return filepath.Join(dir, "bundles.yaml"), nil
+	return out, nil
+}
+
+// fileModel is the on-disk layout of bundles.yaml (see state.Bundles).
+type fileModel struct {
+	Version int                   `yaml:"version"`
+	Bundles map[string]Definition `yaml:"bundles"`
 }
 
 // LoadAll returns all bundles sorted by name.
@@ -77,6 +145,19 @@ func Create(name string, entries []Entry) error {
 		if entries[i].HostAlias == "" {
 			return fmt.Errorf("bundle entry %d missing host alias", i)
 		}
+		for _, dep := range entries[i].DependsOn {
+			if _, _, err := tunnel.ParseDependency(dep); err != nil {
+				return fmt.Errorf("bundle entry %d: %w", i, err)
+			}
+		}
+		if hc := entries[i].HealthCheck; hc != nil {
+			if err := health.Validate(*hc); err != nil {
+				return fmt.Errorf("bundle entry %d: %w", i, err)
+			}
+		}
+	}
+	if _, err := (Definition{Name: name, Entries: entries}).Ordered(); err != nil {
+		return err
 	}
 
 	fm, err := loadFile()
@@ -101,11 +182,7 @@ func Delete(name string) error {
 }
 
 func loadFile() (fileModel, error) {
-	path, err := filePath()
-	if err != nil {
-		return fileModel{}, err
-	}
-	b, err := os.ReadFile(path)
+	b, err := state.Bundles.Read()
 	if err != nil {
 		if os.IsNotExist(err) {
 			return fileModel{Bundles: map[string]Definition{}}, nil
@@ -123,17 +200,10 @@ func loadFile() (fileModel, error) {
 }
 
 func saveFile(fm fileModel) error {
-	path, err := filePath()
-	if err != nil {
-		return err
-	}
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o700); err != nil {
-		return err
-	}
+	fm.Version = state.Bundles.Current
 	b, err := yaml.Marshal(fm)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, 0o600)
+	return state.Bundles.Write(b)
 }
@@ -1,6 +1,10 @@
 package bundle
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
 
 func TestCreateListGetDelete(t *testing.T) {
 	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
@@ -51,4 +55,39 @@ func TestCreateValidatesInput(t *testing.T) {
 	if err := Create("x", []Entry{{HostAlias: ""}}); err == nil {
 		t.Fatal("expected error for empty host alias")
 	}
+	if err := Create("x", []Entry{{HostAlias: "api", HealthCheck: &model.HealthCheck{Type: model.HealthCheckTLS}}}); err == nil {
+		t.Fatal("expected error for a tls check without server_name")
+	}
+}
+
+func TestOrderedPutsDependenciesFirst(t *testing.T) {
+	def := Definition{Name: "hops", Entries: []Entry{
+		{HostAlias: "db", DependsOn: []string{"jump:2222"}},
+		{HostAlias: "jump", DependsOn: []string{"bastion"}},
+		{HostAlias: "api"},
+		{HostAlias: "bastion", DependsOn: []string{"outside"}},
+	}}
+	got, err := def.Ordered()
+	if err != nil {
+		t.Fatalf("ordered: %v", err)
+	}
+	var order []string
+	for _, e := range got {
+		order = append(order, e.HostAlias)
+	}
+	want := []string{"api", "bastion", "jump", "db"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+
+	def.Entries[3].DependsOn = []string{"db"}
+	if _, err := def.Ordered(); err == nil {
+		t.Fatal("expected dependency cycle error")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := Create("hops", def.Entries); err == nil {
+		t.Fatal("expected create to reject a dependency cycle")
+	}
 }
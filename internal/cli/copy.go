@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/history"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/remoteexec"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+)
+
+// newCopyCmd creates the "cp" command, which copies files to or from hosts
+// with scp (or sftp) and can push one source to a group of hosts at once.
+func newCopyCmd() *cobra.Command {
+	var opts sshclient.CopyOptions
+	var parallel int
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "cp <src> <dst>",
+		Short: "Copy files to or from hosts with scp or sftp",
+		Long: "Copy files between this machine and a host. A remote side is written\n" +
+			"host:path; a path containing a colon can be given as ./name. The\n" +
+			"destination may also be tag:<name>:path or bundle:<name>:path to push the\n" +
+			"same source to every host of the group in parallel. Transfers use the host\n" +
+			"key and ssh option policy of ssh-manager's other ssh commands.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := sshclient.EnsureCopyBinary(opts); err != nil {
+				return err
+			}
+			cfg, err := appconfig.Load()
+			if err != nil {
+				return err
+			}
+			srcHosts, srcPath, srcGroup, err := parseCopyArg(cfg, args[0])
+			if err != nil {
+				return err
+			}
+			dstHosts, dstPath, dstGroup, err := parseCopyArg(cfg, args[1])
+			if err != nil {
+				return err
+			}
+			if srcGroup {
+				return errors.New("cannot copy from a group of hosts; name one host as the source")
+			}
+			client := sshclient.New()
+			client.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
+			client.SetSSHOptions(cfg.SSH, cfg.Forwards)
+
+			src := sshclient.CopyPath{Path: srcPath}
+			if len(srcHosts) > 0 {
+				src.Host = srcHosts[0]
+			}
+			if !dstGroup {
+				dst := sshclient.CopyPath{Path: dstPath}
+				if len(dstHosts) > 0 {
+					dst.Host = dstHosts[0]
+				}
+				return runCopy(cmd, client, src, dst, opts)
+			}
+			if src.Remote() {
+				return errors.New("copying between two remote hosts is not supported")
+			}
+			fanOut := remoteexec.Options{Parallel: cfg.Exec.Parallel, Timeout: -1}
+			if cmd.Flags().Changed("parallel") {
+				fanOut.Parallel = parallel
+			}
+			if timeout > 0 {
+				fanOut.Timeout = timeout
+			}
+			return runCopyFanOut(cmd, client, src, dstHosts, dstPath, opts, fanOut)
+		},
+	}
+	cmd.Flags().BoolVarP(&opts.Recursive, "recursive", "r", false, "copy directories recursively")
+	cmd.Flags().BoolVarP(&opts.Quiet, "quiet", "q", false, "do not show the progress meter")
+	cmd.Flags().BoolVar(&opts.SFTP, "sftp", false, "use sftp instead of scp")
+	cmd.Flags().IntVar(&parallel, "parallel", 0, "maximum number of hosts copied to at once (default from config)")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "per-host timeout when copying to a group (0 = none)")
+	return cmd
+}
+
+// parseCopyArg splits a cp operand into its hosts and path. Like scp, an
+// operand is remote when it has a colon with no slash before it:
+// "host:path", or "tag:<name>:path" and "bundle:<name>:path" for a group
+// (see resolveHostTargets). Local operands have no hosts.
+func parseCopyArg(cfg appconfig.Config, arg string) (hosts []model.HostEntry, path string, group bool, err error) {
+	target, path, ok := strings.Cut(arg, ":")
+	if !ok || target == "" || strings.Contains(target, "/") {
+		return nil, arg, false, nil
+	}
+	if target == "tag" || target == "bundle" {
+		name, rest, ok := strings.Cut(path, ":")
+		if !ok || name == "" {
+			return nil, "", false, fmt.Errorf("%s: expected %s:<name>:path", arg, target)
+		}
+		target, path, group = target+":"+name, rest, true
+	}
+	hosts, err = resolveHostTargets(cfg, []string{target})
+	if err != nil {
+		return nil, "", false, err
+	}
+	return hosts, path, group, nil
+}
+
+// runCopy copies src to dst with scp or sftp attached to the terminal, so
+// its progress meter and prompts work.
+func runCopy(cmd *cobra.Command, client *sshclient.Client, src, dst sshclient.CopyPath, opts sshclient.CopyOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	c, err := client.CopyCommand(ctx, src, dst, opts)
+	if err != nil {
+		return err
+	}
+	if isDryRun(cmd) {
+		printCopyPlan(c, src, dst, opts)
+		return nil
+	}
+	if c.Stdin == nil {
+		c.Stdin = os.Stdin
+	}
+	c.Stdout, c.Stderr = os.Stdout, os.Stderr
+	err = c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return &ExitCodeError{Code: exitErr.ExitCode()}
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range []sshclient.CopyPath{src, dst} {
+		if p.Remote() {
+			_ = history.Touch(p.Host.Alias)
+		}
+	}
+	return nil
+}
+
+// runCopyFanOut pushes src to dstPath on every host, reporting each host as
+// it finishes and a summary at the end.
+func runCopyFanOut(cmd *cobra.Command, client *sshclient.Client, src sshclient.CopyPath, hosts []model.HostEntry, dstPath string, opts sshclient.CopyOptions, fanOut remoteexec.Options) error {
+	// Progress meters of concurrent copies would garble each other.
+	opts.Quiet = true
+	jobs := make([]remoteexec.Job, len(hosts))
+	for i, h := range hosts {
+		dst := sshclient.CopyPath{Host: h, Path: dstPath}
+		if isDryRun(cmd) {
+			c, err := client.CopyCommand(context.Background(), src, dst, opts)
+			if err != nil {
+				return err
+			}
+			printCopyPlan(c, src, dst, opts)
+			continue
+		}
+		jobs[i] = remoteexec.Job{Host: h, Build: func(ctx context.Context) *exec.Cmd {
+			c, _ := client.CopyCommand(ctx, src, dst, opts)
+			return c
+		}}
+	}
+	if isDryRun(cmd) {
+		return nil
+	}
+
+	done := 0
+	fanOut.Stdout, fanOut.Stderr = os.Stdout, os.Stderr
+	fanOut.OnDone = func(r remoteexec.Result) {
+		done++
+		state := "ok"
+		switch {
+		case r.Error != "":
+			state = "failed: " + r.Error
+		case !r.OK():
+			state = fmt.Sprintf("failed (exit %d)", r.ExitCode)
+		}
+		fmt.Printf("[%d/%d] %s %s in %s\n", done, len(jobs), r.Host, state, time.Duration(r.DurationMS)*time.Millisecond)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results := remoteexec.RunJobs(ctx, nil, jobs, fanOut)
+
+	failed := 0
+	for _, r := range results {
+		if r.OK() {
+			_ = history.Touch(r.Host)
+		} else {
+			failed++
+		}
+	}
+	fmt.Printf("cp summary: ok=%d failed=%d\n", len(results)-failed, failed)
+	if failed > 0 {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
+
+// printCopyPlan prints the command a copy would run, and the sftp batch it
+// would be given.
+func printCopyPlan(c *exec.Cmd, src, dst sshclient.CopyPath, opts sshclient.CopyOptions) {
+	host := src.Host.Alias
+	if dst.Remote() {
+		host = dst.Host.Alias
+	}
+	fmt.Printf("[dry-run] %s\n  %s\n", host, formatArgv(c.Args))
+	if opts.SFTP {
+		for line := range strings.Lines(sshclient.SFTPBatch(src, dst, opts)) {
+			fmt.Printf("  # sftp> %s", line)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/state"
+	"github.com/treykane/ssh-manager/internal/tunnel"
+)
+
+// dryRunFlag is the global flag that makes mutating commands print the
+// commands they would run instead of running them. Nothing is started and
+// no state is written.
+const dryRunFlag = "dry-run"
+
+// isDryRun reports whether --dry-run was given.
+func isDryRun(cmd *cobra.Command) bool {
+	v, _ := cmd.Flags().GetBool(dryRunFlag)
+	return v
+}
+
+// beginDryRun switches state (and config.yaml) to read-only for a dry run,
+// so that loading them neither creates, migrates nor backs up any file. It
+// is called before each command runs and also resets the mode otherwise.
+func beginDryRun(cmd *cobra.Command) {
+	state.SetReadOnly(isDryRun(cmd))
+}
+
+// formatArgv renders argv as a shell command line, quoting the words that
+// need it.
+func formatArgv(argv []string) string {
+	words := make([]string, len(argv))
+	for i, a := range argv {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`|&;<>()*?[]{}~#!%") {
+			a = shellQuote(a)
+		}
+		words[i] = a
+	}
+	return strings.Join(words, " ")
+}
+
+// printPlan prints what starting one forward would run: the preflight
+// result, each argv, and notes on what is decided at start time.
+func printPlan(p tunnel.Plan) {
+	state := "PASS"
+	if !p.Preflight.OK {
+		state = "FAIL"
+	}
+	fmt.Printf("[dry-run] %s (preflight %s)\n", p.ID, state)
+	for _, f := range p.Preflight.Findings {
+		if !f.OK {
+			fmt.Printf("  - %-12s fail %s\n", f.Check, f.Message)
+		}
+	}
+	for _, argv := range p.Commands {
+		fmt.Printf("  %s\n", formatArgv(argv))
+	}
+	for _, note := range p.Notes {
+		fmt.Printf("  # %s\n", note)
+	}
+}
+
+// planRecover prints what "tunnel recover idOrHost" would run.
+func planRecover(mgr *tunnel.Manager, idOrHost string) error {
+	var targets []model.TunnelRuntime
+	for _, rt := range mgr.Snapshot() {
+		if rt.State != model.TunnelQuarantined {
+			continue
+		}
+		if rt.ID == idOrHost || (!strings.Contains(idOrHost, "|") && rt.HostAlias == idOrHost) {
+			targets = append(targets, rt)
+		}
+	}
+	if len(targets) == 0 {
+		if strings.Contains(idOrHost, "|") {
+			return fmt.Errorf("no quarantined tunnel %s", idOrHost)
+		}
+		return fmt.Errorf("no quarantined tunnel for host %s", idOrHost)
+	}
+	for _, rt := range targets {
+		p, err := mgr.PlanRuntime(rt)
+		if err != nil {
+			return err
+		}
+		printPlan(p)
+	}
+	return nil
+}
+
+// planStop prints the tunnels "tunnel down idOrHost" would stop.
+func planStop(mgr *tunnel.Manager, idOrHost string) error {
+	rts, err := mgr.PlanStop(idOrHost)
+	if err != nil {
+		return err
+	}
+	for _, rt := range rts {
+		fmt.Printf("[dry-run] would stop %s (%s, pid %d)\n", rt.ID, rt.State, rt.PID)
+	}
+	return nil
+}
+
+// planAdopt prints what "tunnel adopt" would import for pids.
+func planAdopt(candidates []tunnel.AdoptCandidate, pids []int) error {
+	for _, pid := range pids {
+		found := false
+		for _, c := range candidates {
+			if c.PID != pid {
+				continue
+			}
+			found = true
+			if !c.Adoptable {
+				fmt.Printf("[dry-run] pid %d: %s not adoptable: %s\n", pid, c.Spec, c.Reason)
+				continue
+			}
+			host := c.HostAlias
+			if host == "" {
+				host = c.Destination
+			}
+			fmt.Printf("[dry-run] would adopt pid %d: %s %s\n", pid, host, c.Spec)
+		}
+		if !found {
+			fmt.Printf("[dry-run] pid %d: not an unmanaged ssh tunnel\n", pid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/bundle"
+	"github.com/treykane/ssh-manager/internal/config"
+	"github.com/treykane/ssh-manager/internal/history"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/remoteexec"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// newExecCmd creates the "exec" command, which runs a remote command on
+// many hosts at once and summarizes how each one went.
+func newExecCmd() *cobra.Command {
+	var parallel int
+	var timeout time.Duration
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "exec <host|tag:name|bundle:name>... -- <remote command>",
+		Short: "Run a command on many hosts in parallel",
+		Long: "Run a remote command on every selected host through ssh, at most --parallel\n" +
+			"at a time, each bounded by --timeout. Targets are host aliases, tag:<name>\n" +
+			"for the hosts whose forwards in config.yaml carry the tag, or bundle:<name>\n" +
+			"for the hosts of a bundle. Output is streamed prefixed with the host alias\n" +
+			"and followed by a summary; the exit code is 1 if any host failed.",
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dash := cmd.ArgsLenAtDash()
+			if dash < 1 || dash == len(args) {
+				return fmt.Errorf("usage: exec <host|tag:name|bundle:name>... -- <remote command>")
+			}
+			if err := sshclient.EnsureSSHBinary(); err != nil {
+				return err
+			}
+			cfg, err := appconfig.Load()
+			if err != nil {
+				return err
+			}
+			hosts, err := resolveHostTargets(cfg, args[:dash])
+			if err != nil {
+				return err
+			}
+			command := args[dash:]
+			client := sshclient.New()
+			client.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
+			client.SetSSHOptions(cfg.SSH, cfg.Forwards)
+
+			if isDryRun(cmd) {
+				for _, h := range hosts {
+					fmt.Printf("[dry-run] %s\n  %s\n", h.Alias, formatArgv(client.ExecCommand(context.Background(), h, command).Args))
+				}
+				return nil
+			}
+
+			opts := remoteexec.Options{
+				Parallel: cfg.Exec.Parallel,
+				Timeout:  time.Duration(cfg.Exec.TimeoutSeconds) * time.Second,
+			}
+			if cmd.Flags().Changed("parallel") {
+				opts.Parallel = parallel
+			}
+			if cmd.Flags().Changed("timeout") {
+				opts.Timeout = timeout
+			}
+			if !jsonOut {
+				opts.Stdout, opts.Stderr = os.Stdout, os.Stderr
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			results := remoteexec.Run(ctx, client, hosts, command, opts)
+
+			failed := 0
+			for _, r := range results {
+				if r.OK() {
+					_ = history.Touch(r.Host)
+				} else {
+					failed++
+				}
+			}
+			if jsonOut {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return err
+				}
+			} else {
+				printExecSummary(results, failed)
+			}
+			if failed > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &ExitCodeError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&parallel, "parallel", 0, "maximum number of hosts running at once (default from config)")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "per-host timeout, including connecting (default from config)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print results as JSON instead of streaming output")
+	return cmd
+}
+
+// resolveHostTargets expands exec targets into hosts: a host alias,
+// "tag:<name>" for the hosts tagged in their host-wide forwards entry (see
+// appconfig.HostTags), or
+// "bundle:<name>" for the hosts of a bundle's entries. Hosts keep the order
+// they are first named in and appear once.
+func resolveHostTargets(cfg appconfig.Config, targets []string) ([]model.HostEntry, error) {
+	res, err := config.ParseDefault()
+	if err != nil {
+		return nil, err
+	}
+	byAlias := make(map[string]model.HostEntry, len(res.Hosts))
+	for _, h := range res.Hosts {
+		byAlias[h.Alias] = h
+	}
+
+	var out []model.HostEntry
+	seen := make(map[string]bool)
+	add := func(alias string) error {
+		h, ok := byAlias[alias]
+		if !ok {
+			return fmt.Errorf("host not found: %s", alias)
+		}
+		if !seen[alias] {
+			seen[alias] = true
+			out = append(out, h)
+		}
+		return nil
+	}
+	for _, target := range targets {
+		switch {
+		case strings.HasPrefix(target, "tag:"):
+			tag := strings.TrimPrefix(target, "tag:")
+			aliases := appconfig.HostsWithTag(cfg.Forwards, tag)
+			if len(aliases) == 0 {
+				return nil, fmt.Errorf("no host has tag %s", tag)
+			}
+			for _, alias := range aliases {
+				if err := add(alias); err != nil {
+					return nil, fmt.Errorf("tag %s: %w", tag, err)
+				}
+			}
+		case strings.HasPrefix(target, "bundle:"):
+			name := strings.TrimPrefix(target, "bundle:")
+			def, err := bundle.Get(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range def.Entries {
+				if err := add(e.HostAlias); err != nil {
+					return nil, fmt.Errorf("bundle %s: %w", name, err)
+				}
+			}
+		default:
+			if err := add(target); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// printExecSummary prints the exit code and duration of each host.
+func printExecSummary(results []remoteexec.Result, failed int) {
+	fmt.Println()
+	fmt.Printf("%-24s %-6s %-10s %s\n", "HOST", "EXIT", "DURATION", "ERROR")
+	for _, r := range results {
+		d := (time.Duration(r.DurationMS) * time.Millisecond).String()
+		fmt.Printf("%-24s %-6s %-10s %s\n", r.Host, exitLabel(r.ExitCode), d, util.EmptyDash(r.Error))
+	}
+	fmt.Printf("exec summary: ok=%d failed=%d\n", len(results)-failed, failed)
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/config"
+	"github.com/treykane/ssh-manager/internal/history"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/remoteexec"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// hostHealth is one host's row of "health --json".
+type hostHealth struct {
+	Host string `json:"host"`
+	history.HealthRecord
+}
+
+// newHealthCmd creates the "health" command, which runs each host's health
+// command over ssh and records the outcome in the host health history.
+func newHealthCmd() *cobra.Command {
+	var jsonOut bool
+	var showHistory bool
+	cmd := &cobra.Command{
+		Use:   "health [host|tag:name|bundle:name...]",
+		Short: "Check remote hosts by running their health command",
+		Long: "Run the health command (default_health_command, or host_health.commands\n" +
+			"for the host) on each host over ssh in BatchMode, bounded by\n" +
+			"host_health.timeout_seconds, and record exit code, latency and the first\n" +
+			"line of output. Without arguments every host in ~/.ssh/config is checked.\n" +
+			"The exit code is 1 if any host is unhealthy.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := appconfig.Load()
+			if err != nil {
+				return err
+			}
+			var hosts []model.HostEntry
+			if len(args) == 0 {
+				res, err := config.ParseDefault()
+				if err != nil {
+					return err
+				}
+				hosts = res.Hosts
+			} else if hosts, err = resolveHostTargets(cfg, args); err != nil {
+				return err
+			}
+			if showHistory {
+				return printHealthHistory(hosts, jsonOut)
+			}
+			if err := sshclient.EnsureSSHBinary(); err != nil {
+				return err
+			}
+			client := sshclient.New()
+			client.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
+			client.SetSSHOptions(cfg.SSH, cfg.Forwards)
+
+			if isDryRun(cmd) {
+				for _, h := range hosts {
+					argv := client.ExecCommand(context.Background(), h, []string{cfg.HealthCommand(h.Alias)}).Args
+					fmt.Printf("[dry-run] %s\n  %s\n", h.Alias, formatArgv(argv))
+				}
+				return nil
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			records, err := remoteexec.CheckHealth(ctx, client, cfg, hosts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "ssh-manager: record host health: %v\n", err)
+			}
+
+			rows := make([]hostHealth, 0, len(hosts))
+			failed := 0
+			for _, h := range hosts {
+				rec := records[h.Alias]
+				if rec.OK() {
+					_ = history.Touch(h.Alias)
+				} else {
+					failed++
+				}
+				rows = append(rows, hostHealth{Host: h.Alias, HealthRecord: rec})
+			}
+			if jsonOut {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(rows); err != nil {
+					return err
+				}
+			} else {
+				fmt.Printf("%-24s %-8s %-6s %-10s %s\n", "HOST", "STATUS", "EXIT", "LATENCY", "SUMMARY")
+				for _, r := range rows {
+					fmt.Printf("%-24s %-8s %-6s %-10s %s\n", r.Host, healthStatus(r.HealthRecord), exitLabel(r.ExitCode),
+						(time.Duration(r.LatencyMS) * time.Millisecond).String(), util.EmptyDash(r.Summary))
+				}
+				fmt.Printf("health summary: healthy=%d unhealthy=%d\n", len(rows)-failed, failed)
+			}
+			if failed > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &ExitCodeError{Code: 1}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print results as JSON")
+	cmd.Flags().BoolVar(&showHistory, "history", false, "print the recorded health history instead of checking")
+	return cmd
+}
+
+// printHealthHistory prints the recorded health checks of hosts, oldest
+// first.
+func printHealthHistory(hosts []model.HostEntry, jsonOut bool) error {
+	all, err := history.HealthHistory()
+	if err != nil {
+		return err
+	}
+	var rows []hostHealth
+	for _, h := range hosts {
+		for _, rec := range all[h.Alias] {
+			rows = append(rows, hostHealth{Host: h.Alias, HealthRecord: rec})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].At < rows[j].At })
+	if jsonOut {
+		if rows == nil {
+			rows = []hostHealth{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+	fmt.Printf("%-25s %-24s %-8s %-6s %-10s %s\n", "TIME", "HOST", "STATUS", "EXIT", "LATENCY", "SUMMARY")
+	for _, r := range rows {
+		fmt.Printf("%-25s %-24s %-8s %-6s %-10s %s\n", time.Unix(r.At, 0).Format(time.RFC3339), r.Host, healthStatus(r.HealthRecord),
+			exitLabel(r.ExitCode), (time.Duration(r.LatencyMS) * time.Millisecond).String(), util.EmptyDash(r.Summary))
+	}
+	return nil
+}
+
+func healthStatus(rec history.HealthRecord) string {
+	if rec.OK() {
+		return "ok"
+	}
+	return "fail"
+}
+
+// exitLabel renders an exit code for tables; -1 (did not exit) is "-".
+func exitLabel(code int) string {
+	if code < 0 {
+		return "-"
+	}
+	return fmt.Sprint(code)
+}
@@ -0,0 +1,533 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/config"
+	"github.com/treykane/ssh-manager/internal/hostkeys"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// hostKeyRow is one row of "hostkeys list --json".
+type hostKeyRow struct {
+	Host string `json:"host"`
+	hostkeys.Entry
+	Pinned bool `json:"pinned"`
+}
+
+// hostKeyVerification is one row of "hostkeys verify --json".
+type hostKeyVerification struct {
+	Host       string   `json:"host"`
+	Status     string   `json:"status"`
+	Source     string   `json:"source"`
+	Pinned     []string `json:"pinned,omitempty"`
+	Presented  []string `json:"presented,omitempty"`
+	Mismatched []string `json:"mismatched,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// newHostKeysCmd creates the "hostkeys" command group, which inspects and
+// repairs the known_hosts entries of configured hosts and keeps pinned
+// host key fingerprints.
+func newHostKeysCmd() *cobra.Command {
+	var knownHosts string
+	cmd := &cobra.Command{
+		Use:   "hostkeys",
+		Short: "Inspect, scan, remove and verify host keys in known_hosts",
+	}
+	cmd.PersistentFlags().StringVar(&knownHosts, "file", "", "known_hosts file (default ~/.ssh/known_hosts)")
+	knownHostsPath := func() (string, error) {
+		if knownHosts != "" {
+			return knownHosts, nil
+		}
+		return hostkeys.DefaultPath()
+	}
+
+	var jsonOut bool
+	list := &cobra.Command{
+		Use:   "list [host|tag:name|bundle:name...]",
+		Short: "List known_hosts entries of configured hosts, including hashed ones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := knownHostsPath()
+			if err != nil {
+				return err
+			}
+			hosts, err := hostsOrAll(args)
+			if err != nil {
+				return err
+			}
+			pins, err := hostkeys.Pins()
+			if err != nil {
+				return err
+			}
+			rows := []hostKeyRow{}
+			missing := []string{}
+			for _, h := range hosts {
+				name, port := hostkeys.Target(h)
+				entries, err := hostkeys.Lookup(path, name, port)
+				if err != nil {
+					return err
+				}
+				if len(entries) == 0 {
+					missing = append(missing, h.Alias)
+				}
+				for _, e := range entries {
+					rows = append(rows, hostKeyRow{Host: h.Alias, Entry: e, Pinned: hostkeys.Pinned(pins[h.Alias], e.Fingerprint)})
+				}
+			}
+			if jsonOut {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(rows)
+			}
+			fmt.Printf("%-24s %-6s %-20s %-52s %-7s %s\n", "HOST", "LINE", "TYPE", "FINGERPRINT", "PINNED", "HOSTS")
+			for _, r := range rows {
+				fmt.Printf("%-24s %-6d %-20s %-52s %-7s %s\n", r.Host, r.Line, markedType(r.Entry), r.Fingerprint, yesNo(r.Pinned), hostsField(r.Entry))
+			}
+			if len(missing) > 0 {
+				fmt.Printf("no entries: %s\n", strings.Join(missing, ", "))
+			}
+			return nil
+		},
+	}
+	list.Flags().BoolVar(&jsonOut, "json", false, "print entries as JSON")
+
+	var types []string
+	var yes, pin, hash bool
+	scan := &cobra.Command{
+		Use:   "scan <host|tag:name|bundle:name>",
+		Short: "Fetch host keys with ssh-keyscan and add them after confirming their fingerprints",
+		Long: "Run ssh-keyscan against each host and print the fingerprints it presents,\n" +
+			"next to what known_hosts and the pins already hold. After confirmation\n" +
+			"(or with --yes) new keys are appended to known_hosts and, with --pin, the\n" +
+			"fingerprints are pinned. A host whose known_hosts entry holds a different\n" +
+			"key, or whose keys do not match its pins, is refused: check the new key\n" +
+			"out of band, then use \"hostkeys remove\".",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := appconfig.Load()
+			if err != nil {
+				return err
+			}
+			hosts, err := resolveHostTargets(cfg, args)
+			if err != nil {
+				return err
+			}
+			path, err := knownHostsPath()
+			if err != nil {
+				return err
+			}
+			if isDryRun(cmd) {
+				for _, h := range hosts {
+					sc, err := hostkeys.ScanCommand(context.Background(), h, types)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("[dry-run] %s\n  %s\n", h.Alias, formatArgv(sc.Args))
+				}
+				return nil
+			}
+			if err := hostkeys.EnsureKeyscanBinary(); err != nil {
+				return err
+			}
+			pins, err := hostkeys.Pins()
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			in := bufio.NewReader(cmd.InOrStdin())
+			failed := 0
+			for _, h := range hosts {
+				if err := scanHost(ctx, in, path, h, types, pins[h.Alias], yes, pin, hash); err != nil {
+					fmt.Fprintf(os.Stderr, "ssh-manager: %s: %v\n", h.Alias, err)
+					failed++
+				}
+			}
+			if failed > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &ExitCodeError{Code: 1}
+			}
+			return nil
+		},
+	}
+	scan.Flags().StringSliceVarP(&types, "type", "t", nil, "key types to fetch (e.g. ed25519,rsa)")
+	scan.Flags().BoolVarP(&yes, "yes", "y", false, "add the keys without asking")
+	scan.Flags().BoolVar(&pin, "pin", false, "also pin the scanned fingerprints")
+	scan.Flags().BoolVar(&hash, "hash", false, "hash the host name of added entries (like HashKnownHosts)")
+
+	var removeYes bool
+	remove := &cobra.Command{
+		Use:   "remove <host|tag:name|bundle:name>",
+		Short: "Remove a host's known_hosts entries, keeping a backup",
+		Long: "Remove the known_hosts lines that apply to each host, e.g. after its\n" +
+			"key changed. The file is first copied to known_hosts.<time>.bak, and\n" +
+			"@cert-authority and @revoked lines are never removed.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := appconfig.Load()
+			if err != nil {
+				return err
+			}
+			hosts, err := resolveHostTargets(cfg, args)
+			if err != nil {
+				return err
+			}
+			path, err := knownHostsPath()
+			if err != nil {
+				return err
+			}
+			in := bufio.NewReader(cmd.InOrStdin())
+			for _, h := range hosts {
+				name, port := hostkeys.Target(h)
+				entries, err := hostkeys.Lookup(path, name, port)
+				if err != nil {
+					return err
+				}
+				var removable []hostkeys.Entry
+				for _, e := range entries {
+					if e.Marker == "" {
+						removable = append(removable, e)
+					}
+				}
+				if len(removable) == 0 {
+					fmt.Printf("%s: no known_hosts entries for %s\n", h.Alias, hostkeys.Name(name, port))
+					continue
+				}
+				fmt.Printf("%s (%s):\n", h.Alias, hostkeys.Name(name, port))
+				for _, e := range removable {
+					fmt.Printf("  line %-5d %-20s %s\n", e.Line, e.KeyType, e.Fingerprint)
+				}
+				if isDryRun(cmd) {
+					fmt.Printf("[dry-run] would remove %d line(s) from %s\n", len(removable), path)
+					continue
+				}
+				if !removeYes && !confirm(in, fmt.Sprintf("Remove %d line(s) from %s? [y/N] ", len(removable), path)) {
+					fmt.Println("skipped")
+					continue
+				}
+				removed, backup, err := hostkeys.Remove(path, name, port)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("removed %d line(s); backup at %s\n", len(removed), backup)
+			}
+			return nil
+		},
+	}
+	remove.Flags().BoolVarP(&removeYes, "yes", "y", false, "remove without asking")
+
+	var offline, verifyJSON bool
+	verify := &cobra.Command{
+		Use:   "verify [host|tag:name|bundle:name...]",
+		Short: "Compare host keys with pinned fingerprints",
+		Long: "Scan each host and compare the keys it presents with its pinned\n" +
+			"fingerprints; with --offline the known_hosts entries are compared\n" +
+			"instead. Without arguments every pinned host is verified. The exit code\n" +
+			"is 1 if any host does not match its pins or cannot be checked.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pins, err := hostkeys.Pins()
+			if err != nil {
+				return err
+			}
+			var hosts []model.HostEntry
+			if len(args) == 0 {
+				all, err := hostsOrAll(nil)
+				if err != nil {
+					return err
+				}
+				for _, h := range all {
+					if len(pins[h.Alias]) > 0 {
+						hosts = append(hosts, h)
+					}
+				}
+			} else if hosts, err = hostsOrAll(args); err != nil {
+				return err
+			}
+			path, err := knownHostsPath()
+			if err != nil {
+				return err
+			}
+			if !offline {
+				if err := hostkeys.EnsureKeyscanBinary(); err != nil {
+					return err
+				}
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			rows := []hostKeyVerification{}
+			failed := 0
+			for _, h := range hosts {
+				row := hostKeyVerification{Host: h.Alias, Source: "ssh-keyscan"}
+				for _, p := range pins[h.Alias] {
+					row.Pinned = append(row.Pinned, p.Fingerprint)
+				}
+				var keys []hostkeys.Entry
+				if offline {
+					row.Source = "known_hosts"
+					name, port := hostkeys.Target(h)
+					keys, err = hostkeys.Lookup(path, name, port)
+				} else {
+					keys, err = hostkeys.Scan(ctx, h, nil)
+				}
+				if err != nil {
+					row.Status, row.Error = hostkeys.StatusError, err.Error()
+				} else {
+					row.Status, row.Mismatched = hostkeys.Verify(pins[h.Alias], keys)
+				}
+				for _, k := range keys {
+					row.Presented = append(row.Presented, k.Fingerprint)
+				}
+				if row.Status == hostkeys.StatusMismatch || row.Status == hostkeys.StatusError {
+					failed++
+				}
+				rows = append(rows, row)
+			}
+			if verifyJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(rows); err != nil {
+					return err
+				}
+			} else {
+				fmt.Printf("%-24s %-9s %-12s %s\n", "HOST", "STATUS", "SOURCE", "DETAIL")
+				for _, r := range rows {
+					fmt.Printf("%-24s %-9s %-12s %s\n", r.Host, r.Status, r.Source, verificationDetail(r))
+				}
+				fmt.Printf("verify summary: ok=%d failed=%d\n", len(rows)-failed, failed)
+			}
+			if failed > 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &ExitCodeError{Code: 1}
+			}
+			return nil
+		},
+	}
+	verify.Flags().BoolVar(&offline, "offline", false, "compare known_hosts entries instead of scanning")
+	verify.Flags().BoolVar(&verifyJSON, "json", false, "print results as JSON")
+
+	var clearPins bool
+	pinCmd := &cobra.Command{
+		Use:   "pin <host|tag:name|bundle:name>",
+		Short: "Pin the fingerprints of a host's known_hosts entries",
+		Long: "Pin the fingerprints the host's known_hosts entries hold now, so\n" +
+			"\"hostkeys verify\" reports any other key. --clear removes the pins.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := appconfig.Load()
+			if err != nil {
+				return err
+			}
+			hosts, err := resolveHostTargets(cfg, args)
+			if err != nil {
+				return err
+			}
+			path, err := knownHostsPath()
+			if err != nil {
+				return err
+			}
+			for _, h := range hosts {
+				var pins []hostkeys.Pin
+				if !clearPins {
+					name, port := hostkeys.Target(h)
+					entries, err := hostkeys.Lookup(path, name, port)
+					if err != nil {
+						return err
+					}
+					pins = pinsFor(entries)
+					if len(pins) == 0 {
+						return fmt.Errorf("%s: no known_hosts entries to pin; run \"ssh-manager hostkeys scan %s --pin\"", h.Alias, h.Alias)
+					}
+				}
+				if isDryRun(cmd) {
+					fmt.Printf("[dry-run] %s: would pin %d fingerprint(s)\n", h.Alias, len(pins))
+					continue
+				}
+				if err := hostkeys.SetPins(h.Alias, pins); err != nil {
+					return err
+				}
+				if clearPins {
+					fmt.Printf("%s: unpinned\n", h.Alias)
+					continue
+				}
+				for _, p := range pins {
+					fmt.Printf("%s: pinned %s %s\n", h.Alias, p.KeyType, p.Fingerprint)
+				}
+			}
+			return nil
+		},
+	}
+	pinCmd.Flags().BoolVar(&clearPins, "clear", false, "remove the host's pins")
+
+	cmd.AddCommand(list, scan, remove, verify, pinCmd)
+	return cmd
+}
+
+// scanHost scans one host, shows its keys against known_hosts and its pins,
+// and adds the new ones once confirmed.
+func scanHost(ctx context.Context, in *bufio.Reader, path string, h model.HostEntry, types []string, pins []hostkeys.Pin, yes, pin, hash bool) error {
+	keys, err := hostkeys.Scan(ctx, h, types)
+	if err != nil {
+		return err
+	}
+	name, port := hostkeys.Target(h)
+	known, err := hostkeys.Lookup(path, name, port)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (%s):\n", h.Alias, hostkeys.Name(name, port))
+	var added []hostkeys.Entry
+	changed := false
+	for _, k := range keys {
+		status := "new"
+		for _, e := range known {
+			if e.Marker != "" || e.KeyType != k.KeyType {
+				continue
+			}
+			if e.Fingerprint == k.Fingerprint {
+				status = "known"
+				break
+			}
+			status = "CHANGED"
+		}
+		switch status {
+		case "new":
+			added = append(added, k)
+		case "CHANGED":
+			changed = true
+		}
+		if hostkeys.Pinned(pins, k.Fingerprint) {
+			status += ", pinned"
+		}
+		fmt.Printf("  %-20s %-52s %s\n", k.KeyType, k.Fingerprint, status)
+	}
+	if changed {
+		return fmt.Errorf("known_hosts holds a different key; verify the new one out of band, then run \"ssh-manager hostkeys remove %s\"", h.Alias)
+	}
+	if status, _ := hostkeys.Verify(pins, keys); status == hostkeys.StatusMismatch {
+		return fmt.Errorf("presented keys do not match the pinned fingerprints")
+	}
+	if len(added) == 0 && !pin {
+		fmt.Println("  already in known_hosts")
+		return nil
+	}
+	prompt := fmt.Sprintf("Add %d key(s) to %s? [y/N] ", len(added), path)
+	if pin {
+		prompt = fmt.Sprintf("Add %d key(s) to %s and pin %d fingerprint(s)? [y/N] ", len(added), path, len(keys))
+	}
+	if !yes && !confirm(in, prompt) {
+		fmt.Println("  skipped")
+		return nil
+	}
+	if hash {
+		for i := range added {
+			if added[i].Hosts, err = hostkeys.HashName(hostkeys.Name(name, port)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := hostkeys.Append(path, added); err != nil {
+		return err
+	}
+	if pin {
+		if err := hostkeys.SetPins(h.Alias, pinsFor(keys)); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("  added %d key(s)\n", len(added))
+	return nil
+}
+
+// pinsFor returns a pin for every key of entries.
+func pinsFor(entries []hostkeys.Entry) []hostkeys.Pin {
+	now := time.Now().Unix()
+	var pins []hostkeys.Pin
+	for _, e := range entries {
+		if e.Marker == "" && !hostkeys.Pinned(pins, e.Fingerprint) {
+			pins = append(pins, hostkeys.Pin{KeyType: e.KeyType, Fingerprint: e.Fingerprint, PinnedAt: now})
+		}
+	}
+	return pins
+}
+
+// hostsOrAll resolves host targets, or returns every host in ~/.ssh/config
+// when there are none.
+func hostsOrAll(targets []string) ([]model.HostEntry, error) {
+	if len(targets) == 0 {
+		res, err := config.ParseDefault()
+		if err != nil {
+			return nil, err
+		}
+		return res.Hosts, nil
+	}
+	cfg, err := appconfig.Load()
+	if err != nil {
+		return nil, err
+	}
+	return resolveHostTargets(cfg, targets)
+}
+
+// confirm asks prompt and reports whether the answer is yes.
+func confirm(in *bufio.Reader, prompt string) bool {
+	fmt.Print(prompt)
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func markedType(e hostkeys.Entry) string {
+	if e.Marker != "" {
+		return e.Marker + " " + e.KeyType
+	}
+	return e.KeyType
+}
+
+func hostsField(e hostkeys.Entry) string {
+	if e.Hashed {
+		return "(hashed)"
+	}
+	return e.Hosts
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func verificationDetail(r hostKeyVerification) string {
+	switch r.Status {
+	case hostkeys.StatusError:
+		return r.Error
+	case hostkeys.StatusMismatch:
+		if len(r.Mismatched) > 0 {
+			return "unpinned key " + strings.Join(r.Mismatched, ", ")
+		}
+		return "no presented key is pinned"
+	case hostkeys.StatusUnpinned:
+		return "no pinned fingerprints; pin with \"hostkeys pin\""
+	}
+	return util.EmptyDash(strings.Join(r.Presented, ", "))
+}
@@ -22,13 +22,19 @@ package cli
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"net"
 	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -41,6 +47,7 @@ import (
 	"github.com/treykane/ssh-manager/internal/model"
 	"github.com/treykane/ssh-manager/internal/security"
 	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/state"
 	"github.com/treykane/ssh-manager/internal/tunnel"
 	"github.com/treykane/ssh-manager/internal/ui"
 	"github.com/treykane/ssh-manager/internal/util"
@@ -64,16 +71,31 @@ func NewRootCommand() *cobra.Command {
 		Short: "Modern SSH config and tunnel manager",
 		// RunE is used (instead of Run) so errors can be propagated to main()
 		// and result in a non-zero exit code.
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			beginDryRun(cmd)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if isDryRun(cmd) {
+				return errors.New("--dry-run applies to subcommands, not the dashboard")
+			}
 			return ui.Run()
 		},
 	}
 
+	root.PersistentFlags().Bool(dryRunFlag, false, "print the ssh commands that would run, without running them or writing state")
+
 	root.AddCommand(newListCmd())
+	root.AddCommand(newConnectCmd())
+	root.AddCommand(newExecCmd())
+	root.AddCommand(newHealthCmd())
+	root.AddCommand(newCopyCmd())
+	root.AddCommand(newSessionsCmd())
+	root.AddCommand(newHostKeysCmd())
 	root.AddCommand(newTunnelCmd())
 	root.AddCommand(newBundleCmd())
 	root.AddCommand(newDoctorCmd())
 	root.AddCommand(newSecurityCmd())
+	root.AddCommand(newStateCmd())
 	return root
 }
 
@@ -86,6 +108,7 @@ func NewRootCommand() *cobra.Command {
 //   - PORT:     the SSH port (defaults to 22)
 //   - USER:     the SSH user (shown as "-" if not set)
 //   - FORWARDS: the count of LocalForward rules configured for this host
+//   - HEALTH:   the last recorded health check (see "health"), or "-"
 //
 // Any parse warnings (malformed lines, missing includes, etc.) are printed to
 // stderr after the host table so they don't interfere with stdout parsing by
@@ -107,10 +130,12 @@ func newListCmd() *cobra.Command {
 				hosts = history.SortHostsRecent(hosts, last)
 			}
 
-			// Print a formatted table header and rows.
-			fmt.Printf("%-24s %-24s %-8s %-16s %s\n", "ALIAS", "HOSTNAME", "PORT", "USER", "FORWARDS")
+			// Print a formatted table header and rows. HEALTH is the last
+			// recorded "ssh-manager health" result.
+			health, _ := history.LatestHealth()
+			fmt.Printf("%-24s %-24s %-8s %-16s %-9s %s\n", "ALIAS", "HOSTNAME", "PORT", "USER", "FORWARDS", "HEALTH")
 			for _, h := range hosts {
-				fmt.Printf("%-24s %-24s %-8d %-16s %d\n", h.Alias, h.DisplayTarget(), h.Port, util.EmptyDash(h.User), len(h.Forwards))
+				fmt.Printf("%-24s %-24s %-8d %-16s %-9d %s\n", h.Alias, h.DisplayTarget(), h.Port, util.EmptyDash(h.User), len(h.Forwards), health[h.Alias].Label())
 			}
 
 			if len(res.Warnings) > 0 {
@@ -126,11 +151,37 @@ func newListCmd() *cobra.Command {
 	return cmd
 }
 
+// newConnectCmd creates the "connect" command, which opens an interactive
+// SSH session to a host. With --dry-run it prints the ssh command instead.
+func newConnectCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "connect <host>",
+		Short: "Open an interactive SSH session to a host",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host, err := findHost(args[0])
+			if err != nil {
+				return err
+			}
+			if isDryRun(cmd) {
+				fmt.Printf("[dry-run] %s\n  %s\n", host.Alias, formatArgv(sessionClient().ConnectCommand(host).Args))
+				return nil
+			}
+			if err := ConnectOnce(host); err != nil {
+				return err
+			}
+			_ = history.Touch(host.Alias)
+			return nil
+		},
+	}
+}
+
 // newTunnelCmd creates the "tunnel" parent command and its subcommands (up, down, status).
 //
 // A single tunnel.Manager instance is created and shared across all tunnel
-// subcommands within a single CLI invocation. The manager loads persisted tunnel
-// state from runtime.json on construction so that "tunnel status" can display
+// subcommands within a single CLI invocation. The manager is built when a
+// tunnel subcommand runs (not when the command tree is constructed) and loads
+// persisted tunnel state from runtime.json so that "tunnel status" can display
 // tunnels started by previous invocations, and "tunnel down" can stop them.
 //
 // Subcommands:
@@ -145,33 +196,25 @@ func newListCmd() *cobra.Command {
 //	tunnel status           — Print a table of all managed tunnels, or emit
 //	                          JSON with --json for programmatic consumption.
 func newTunnelCmd() *cobra.Command {
-	// Create a shared SSH client and tunnel manager for all tunnel subcommands.
-	client := sshclient.New()
-	mgr := tunnel.NewManager(client)
-	cfg, cfgErr := appconfig.Load()
-	if cfgErr != nil {
-		slog.Warn("failed to load config, using defaults", "error", cfgErr)
-		cfg = appconfig.Default()
-	}
-	mgr.SetBindPolicy(cfg.Security.BindPolicy)
-	mgr.SetRedactErrors(cfg.Security.RedactErrors)
-	mgr.SetRestartPolicy(
-		cfg.Tunnel.AutoRestart,
-		cfg.Tunnel.RestartMaxAttempts,
-		cfg.Tunnel.RestartBackoffSeconds,
-		cfg.Tunnel.RestartStableWindowSeconds,
+	// Shared SSH client, tunnel manager and config for all tunnel subcommands,
+	// populated by PersistentPreRunE before any subcommand runs.
+	var (
+		client *sshclient.Client
+		mgr    *tunnel.Manager
+		cfg    appconfig.Config
 	)
-	client.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
 
-	// Restore persisted tunnel state from disk. This allows "tunnel status" to
-	// show tunnels that were started in a previous session (if their processes
-	// are still alive).
-	if err := mgr.LoadRuntime(); err != nil {
-		slog.Warn("failed to load tunnel runtime", "error", err)
+	var root = &cobra.Command{
+		Use:   "tunnel",
+		Short: "Manage SSH tunnels",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Replaces the root's pre-run, so it starts dry-run mode itself.
+			beginDryRun(cmd)
+			client, mgr, cfg = newTunnelManager(isDryRun(cmd))
+			return nil
+		},
 	}
 
-	var root = &cobra.Command{Use: "tunnel", Short: "Manage SSH tunnels"}
-
 	// --- tunnel up -----------------------------------------------------------
 
 	// forwardArg is the --forward flag value for the "up" subcommand. It can be:
@@ -181,6 +224,13 @@ func newTunnelCmd() *cobra.Command {
 	var forwardArg string
 	var allowPublicBind bool
 	var hostKeyPolicy string
+	var readyTimeout time.Duration
+	var onDemand bool
+	var idleTimeout, ttl time.Duration
+	var autoPort bool
+	var relayMode bool
+	var multiplex bool
+	var foreground bool
 
 	up := &cobra.Command{
 		Use:   "up <host>",
@@ -207,22 +257,57 @@ func newTunnelCmd() *cobra.Command {
 			}
 			mgr.SetAllowPublicBind(allowPublicBind)
 			client.SetHostKeyPolicy(effectiveHostKeyPolicy(cfg, hostKeyPolicy))
+			if cmd.Flags().Changed("ready-timeout") {
+				mgr.SetReadyTimeout(readyTimeout)
+			}
+
+			opts := tunnel.ForwardOptions{OnDemand: onDemand, IdleTimeout: idleTimeout, TTL: ttl, Relay: relayMode, AutoPort: autoPort, Multiplex: multiplex}
+			if isDryRun(cmd) {
+				for _, fwd := range forwards {
+					p, err := mgr.Plan(host, fwd, opts)
+					if err != nil {
+						return err
+					}
+					printPlan(p)
+				}
+				return nil
+			}
 
 			// Start each resolved forward as a separate tunnel.
+			var held, started []model.TunnelRuntime
 			for _, fwd := range forwards {
-				rt, err := mgr.Start(host, fwd)
+				rt, err := mgr.StartWithOptions(host, fwd, opts)
 				if err != nil {
+					stopHeld(mgr, held)
 					return fmt.Errorf("%s", security.UserMessage(err, cfg.Security.RedactErrors))
 				}
 				_ = history.Touch(host.Alias)
+				started = append(started, rt)
+				if needsHold(rt, foreground) {
+					held = append(held, rt)
+				}
+				if rt.State == model.TunnelArmed {
+					fmt.Printf("armed %s on %s -> %s (ssh starts on first connection)\n", rt.ID, rt.Local, rt.Remote)
+					continue
+				}
 				fmt.Printf("started %s pid=%d %s -> %s\n", rt.ID, rt.PID, rt.Local, rt.Remote)
 			}
+			noteUnheldLimits(started, foreground)
+			holdTunnels(mgr, held)
 			return nil
 		},
 	}
-	up.Flags().StringVar(&forwardArg, "forward", "", "forward index (0-based) or explicit spec localPort:remoteHost:remotePort")
+	up.Flags().StringVar(&forwardArg, "forward", "", "forward index (0-based) or explicit spec localPort:remoteHost:remotePort (localPort may be \"auto\")")
 	up.Flags().BoolVar(&allowPublicBind, "allow-public-bind", false, "allow 0.0.0.0/:: local binds for this command")
 	up.Flags().StringVar(&hostKeyPolicy, "host-key-policy", "", "host key policy override: strict, accept-new, insecure")
+	up.Flags().DurationVar(&readyTimeout, "ready-timeout", 0, "wait this long for the local port to accept connections (0 = don't wait; default from config)")
+	up.Flags().BoolVar(&onDemand, "on-demand", false, "listen on the local port and start ssh only when a client connects (runs in the foreground)")
+	up.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "stop the tunnel after this long without clients; with --on-demand, stop ssh and re-arm (default from config)")
+	up.Flags().DurationVar(&ttl, "ttl", 0, "stop the tunnel after this long regardless of use (default from config)")
+	up.Flags().BoolVar(&autoPort, "auto-port", false, "if the local port is taken, use a free one from the auto port range instead")
+	up.Flags().BoolVar(&relayMode, "relay", false, "relay clients through ssh-manager to count connections and bytes (runs in the foreground)")
+	up.Flags().BoolVar(&foreground, "foreground", false, "stay in the foreground, enforcing time limits, until the tunnels stop; Ctrl+C stops them")
+	up.Flags().BoolVar(&multiplex, "multiplex", false, "run the forwards over one shared ssh ControlMaster connection per host (default from config)")
 
 	// --- tunnel down ---------------------------------------------------------
 
@@ -233,6 +318,9 @@ func newTunnelCmd() *cobra.Command {
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			idOrHost := args[0]
+			if isDryRun(cmd) {
+				return planStop(mgr, idOrHost)
+			}
 
 			// Tunnel IDs contain "|" (e.g., "prod|127.0.0.1:8080|localhost:80"),
 			// so we use that as a heuristic to distinguish between a tunnel ID
@@ -284,27 +372,25 @@ func newTunnelCmd() *cobra.Command {
 				return fmt.Errorf("no tunnels found for %s", idOrHost)
 			}
 
-			hostCache := map[string]model.HostEntry{}
+			if cmd.Flags().Changed("ready-timeout") {
+				mgr.SetReadyTimeout(readyTimeout)
+			}
 			for _, rt := range targets {
-				if err := mgr.Stop(rt.ID); err != nil {
+				if _, err := forwardFromRuntime(rt); err != nil {
 					return err
 				}
-				host, ok := hostCache[rt.HostAlias]
-				if !ok {
-					var err error
-					host, err = findHost(rt.HostAlias)
+				mgr.SetAllowPublicBind(allowPublicBind)
+				client.SetHostKeyPolicy(effectiveHostKeyPolicy(cfg, hostKeyPolicy))
+				if isDryRun(cmd) {
+					p, err := mgr.PlanRuntime(rt)
 					if err != nil {
 						return err
 					}
-					hostCache[rt.HostAlias] = host
-				}
-				mgr.SetAllowPublicBind(allowPublicBind)
-				client.SetHostKeyPolicy(effectiveHostKeyPolicy(cfg, hostKeyPolicy))
-				forward, ferr := forwardFromRuntime(rt)
-				if ferr != nil {
-					return ferr
+					printPlan(p)
+					continue
 				}
-				next, err := mgr.Start(host, forward)
+				// Restart also restarts the tunnels that depend on this one.
+				next, err := mgr.Restart(rt.ID)
 				if err != nil {
 					return fmt.Errorf("%s", security.UserMessage(err, cfg.Security.RedactErrors))
 				}
@@ -315,6 +401,7 @@ func newTunnelCmd() *cobra.Command {
 	}
 	restart.Flags().BoolVar(&allowPublicBind, "allow-public-bind", false, "allow 0.0.0.0/:: local binds for this command")
 	restart.Flags().StringVar(&hostKeyPolicy, "host-key-policy", "", "host key policy override: strict, accept-new, insecure")
+	restart.Flags().DurationVar(&readyTimeout, "ready-timeout", 0, "wait this long for the local port to accept connections (0 = don't wait; default from config)")
 
 	recover := &cobra.Command{
 		Use:   "recover <tunnel-id|host>",
@@ -322,6 +409,9 @@ func newTunnelCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			idOrHost := args[0]
+			if isDryRun(cmd) {
+				return planRecover(mgr, idOrHost)
+			}
 			if strings.Contains(idOrHost, "|") {
 				rt, err := mgr.Recover(idOrHost)
 				if err != nil {
@@ -351,6 +441,7 @@ func newTunnelCmd() *cobra.Command {
 	var statusWatch bool
 	var statusInterval int
 	var statusSummary bool
+	var statusTree bool
 	var checkForwardArg string
 	var checkJSON bool
 	var eventsHost string
@@ -382,10 +473,25 @@ func newTunnelCmd() *cobra.Command {
 			}
 
 			render := func() error {
+				mgr.CheckHealth()
 				sn := mgr.Snapshot()
 				sort.Slice(sn, func(i, j int) bool { return sn[i].ID < sn[j].ID })
 				sn = filterTunnelSnapshot(sn, statusHost, stateFilter, statusLimit)
 
+				if statusTree {
+					tree := tunnel.DependencyTree(sn)
+					if jsonOut {
+						enc := json.NewEncoder(os.Stdout)
+						enc.SetIndent("", "  ")
+						return enc.Encode(tree)
+					}
+					printDependencyTree(tree, "")
+					if len(sn) == 0 {
+						fmt.Println("(none)")
+					}
+					return nil
+				}
+
 				if jsonOut {
 					enc := json.NewEncoder(os.Stdout)
 					enc.SetIndent("", "  ")
@@ -395,9 +501,9 @@ func newTunnelCmd() *cobra.Command {
 				if statusSummary {
 					printTunnelSummary(sn)
 				}
-				fmt.Printf("%-42s %-16s %-22s %-22s %-12s %-8s %-10s\n", "ID", "HOST", "LOCAL", "REMOTE", "STATE", "PID", "LAT(ms)")
+				fmt.Printf("%-42s %-16s %-22s %-22s %-12s %-8s %-10s %-10s %-10s\n", "ID", "HOST", "LOCAL", "REMOTE", "STATE", "PID", "LAT(ms)", "HEALTH", "REMAINING")
 				for _, rt := range sn {
-					fmt.Printf("%-42s %-16s %-22s %-22s %-12s %-8d %-10d\n", rt.ID, rt.HostAlias, rt.Local, rt.Remote, rt.State, rt.PID, rt.LatencyMS)
+					fmt.Printf("%-42s %-16s %-22s %-22s %-12s %-8d %-10d %-10s %-10s\n", rt.ID, rt.HostAlias, rt.Local, rt.Remote, rt.State, rt.PID, rt.LatencyMS, healthLabel(rt), util.Countdown(rt.RemainingSec))
 				}
 				if len(sn) == 0 {
 					fmt.Println("(none)")
@@ -426,11 +532,12 @@ func newTunnelCmd() *cobra.Command {
 	}
 	status.Flags().BoolVar(&jsonOut, "json", false, "output JSON")
 	status.Flags().StringVar(&statusHost, "host", "", "filter rows by host alias")
-	status.Flags().StringVar(&statusState, "state", "", "filter rows by state (up, down, error, quarantined, starting, stopping)")
+	status.Flags().StringVar(&statusState, "state", "", "filter rows by state (up, armed, down, error, quarantined, starting, stopping)")
 	status.Flags().IntVar(&statusLimit, "limit", 0, "max rows to display (0 = no limit)")
 	status.Flags().BoolVar(&statusWatch, "watch", false, "continuously refresh output until interrupted")
 	status.Flags().IntVar(&statusInterval, "interval", 3, "watch interval in seconds")
 	status.Flags().BoolVar(&statusSummary, "summary", false, "print state counts and non-healthy tunnels before table")
+	status.Flags().BoolVar(&statusTree, "tree", false, "show tunnels as a dependency tree")
 
 	check := &cobra.Command{
 		Use:   "check <host>",
@@ -505,14 +612,15 @@ func newTunnelCmd() *cobra.Command {
 				fmt.Println("(no events)")
 				return nil
 			}
-			fmt.Printf("%-25s %-18s %-16s %-12s %-8s %s\n", "TIMESTAMP", "EVENT", "HOST", "STATE", "PID", "MESSAGE")
+			fmt.Printf("%-25s %-18s %-16s %-12s %-8s %-22s %s\n", "TIMESTAMP", "EVENT", "HOST", "STATE", "PID", "CODE", "MESSAGE")
 			for _, evt := range recs {
-				fmt.Printf("%-25s %-18s %-16s %-12s %-8d %s\n",
+				fmt.Printf("%-25s %-18s %-16s %-12s %-8d %-22s %s\n",
 					evt.Timestamp.Format(time.RFC3339),
 					evt.EventType,
 					util.EmptyDash(evt.HostAlias),
 					util.EmptyDash(string(evt.State)),
 					evt.PID,
+					util.EmptyDash(evt.ErrorCode),
 					evt.Message,
 				)
 			}
@@ -526,10 +634,69 @@ func newTunnelCmd() *cobra.Command {
 	eventsCmd.Flags().IntVar(&eventsLimit, "limit", 100, "maximum number of events to return")
 	eventsCmd.Flags().BoolVar(&eventsJSON, "json", false, "output JSON")
 
+	var logsLines int
+	logsCmd := &cobra.Command{
+		Use:   "logs <tunnel-id|host>",
+		Short: "Show captured ssh stderr for a tunnel or all tunnels of a host",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			idOrHost := args[0]
+			var ids []string
+			if strings.Contains(idOrHost, "|") {
+				ids = []string{idOrHost}
+			} else {
+				for _, rt := range mgr.Snapshot() {
+					if rt.HostAlias == idOrHost {
+						ids = append(ids, rt.ID)
+					}
+				}
+				sort.Strings(ids)
+			}
+			if len(ids) == 0 {
+				return fmt.Errorf("no tunnels found for %s", idOrHost)
+			}
+			for i, id := range ids {
+				if len(ids) > 1 {
+					if i > 0 {
+						fmt.Println()
+					}
+					fmt.Printf("==> %s <==\n", id)
+				}
+				logID := id
+				if rt, err := mgr.Get(id); err == nil && rt.Multiplexed {
+					// Multiplexed forwards have no ssh of their own.
+					logID = tunnel.MasterLogID(rt.HostAlias)
+				}
+				path, err := tunnel.LogPath(logID)
+				if err != nil {
+					return err
+				}
+				b, err := os.ReadFile(path)
+				if errors.Is(err, os.ErrNotExist) {
+					fmt.Println("(no log)")
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				for _, line := range tailLines(string(b), logsLines) {
+					fmt.Println(line)
+				}
+			}
+			return nil
+		},
+	}
+	logsCmd.Flags().IntVar(&logsLines, "lines", 50, "number of most recent lines to show (0 = all)")
+
 	reconcile := &cobra.Command{
 		Use:   "reconcile",
 		Short: "Reconcile tunnel runtime state and quarantine suspicious entries",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if isDryRun(cmd) {
+				// Reconcile decides and applies in one pass (and --recover
+				// starts ssh), so there is nothing safe to preview.
+				return errors.New("tunnel reconcile does not support --dry-run; use tunnel status to inspect")
+			}
 			actions, err := mgr.Reconcile(strings.TrimSpace(reconcileHost), reconcileRecover)
 			if err != nil {
 				return err
@@ -539,13 +706,30 @@ func newTunnelCmd() *cobra.Command {
 				enc.SetIndent("", "  ")
 				return enc.Encode(actions)
 			}
-			if len(actions) == 0 {
+			var applied, adoptable []tunnel.ReconcileAction
+			for _, a := range actions {
+				if a.Adoptable {
+					adoptable = append(adoptable, a)
+				} else {
+					applied = append(applied, a)
+				}
+			}
+			if len(applied) == 0 {
 				fmt.Println("No runtime reconcile actions.")
-				return nil
+			} else {
+				fmt.Printf("%-42s %-16s %-14s %-14s %-10s %s\n", "ID", "HOST", "FROM", "TO", "RECOVERED", "REASON")
+				for _, a := range applied {
+					fmt.Printf("%-42s %-16s %-14s %-14s %-10t %s\n", a.ID, a.HostAlias, a.FromState, a.ToState, a.Recovered, a.Reason)
+				}
 			}
-			fmt.Printf("%-42s %-16s %-14s %-14s %-10s %s\n", "ID", "HOST", "FROM", "TO", "RECOVERED", "REASON")
-			for _, a := range actions {
-				fmt.Printf("%-42s %-16s %-14s %-14s %-10t %s\n", a.ID, a.HostAlias, a.FromState, a.ToState, a.Recovered, a.Reason)
+			if len(adoptable) > 0 {
+				fmt.Println()
+				fmt.Println("Unmanaged tunnels that can be adopted:")
+				fmt.Printf("%-8s %-42s %s\n", "PID", "ID", "HOST")
+				for _, a := range adoptable {
+					fmt.Printf("%-8d %-42s %s\n", a.PID, a.ID, a.HostAlias)
+				}
+				fmt.Println("Run `ssh-manager tunnel adopt <pid>` to manage them.")
 			}
 			return nil
 		},
@@ -554,17 +738,108 @@ func newTunnelCmd() *cobra.Command {
 	reconcile.Flags().BoolVar(&reconcileJSON, "json", false, "output JSON")
 	reconcile.Flags().BoolVar(&reconcileRecover, "recover", false, "attempt recover for newly quarantined entries")
 
+	var adoptAll bool
+	var adoptHost string
+	var adoptJSON bool
+	adopt := &cobra.Command{
+		Use:   "adopt [pid...]",
+		Short: "Import ssh tunnels started outside ssh-manager",
+		Long: "Scans for ssh processes with -L/-R/-D forwards that ssh-manager is not tracking.\n" +
+			"Without arguments the candidates are listed; pass PIDs or --all to adopt them.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			candidates, err := mgr.Unmanaged(strings.TrimSpace(adoptHost))
+			if err != nil {
+				return err
+			}
+			var pids []int
+			if adoptAll {
+				for _, c := range candidates {
+					if c.Adoptable && !slices.Contains(pids, c.PID) {
+						pids = append(pids, c.PID)
+					}
+				}
+			}
+			for _, arg := range args {
+				pid, err := strconv.Atoi(arg)
+				if err != nil || pid <= 0 {
+					return fmt.Errorf("invalid pid %q", arg)
+				}
+				pids = append(pids, pid)
+			}
+
+			if len(pids) == 0 {
+				if adoptJSON {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetIndent("", "  ")
+					return enc.Encode(candidates)
+				}
+				if len(candidates) == 0 {
+					fmt.Println("No unmanaged ssh tunnels found.")
+					return nil
+				}
+				fmt.Printf("%-8s %-16s %-8s %-32s %s\n", "PID", "HOST", "KIND", "FORWARD", "ADOPTABLE")
+				for _, c := range candidates {
+					host := c.HostAlias
+					if host == "" {
+						host = c.Destination
+					}
+					note := "yes"
+					if !c.Adoptable {
+						note = "no: " + c.Reason
+					}
+					fmt.Printf("%-8d %-16s %-8s %-32s %s\n", c.PID, host, c.Kind, c.Spec, note)
+				}
+				fmt.Println("Run `ssh-manager tunnel adopt <pid>` or `ssh-manager tunnel adopt --all` to manage them.")
+				return nil
+			}
+
+			if isDryRun(cmd) {
+				return planAdopt(candidates, pids)
+			}
+
+			var adopted []model.TunnelRuntime
+			var failed []string
+			for _, pid := range pids {
+				rts, err := mgr.Adopt(pid)
+				if err != nil {
+					failed = append(failed, security.UserMessage(err, cfg.Security.RedactErrors))
+					continue
+				}
+				adopted = append(adopted, rts...)
+			}
+			if adoptJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(adopted); err != nil {
+					return err
+				}
+			} else {
+				for _, rt := range adopted {
+					fmt.Printf("adopted %s (pid %d)\n", rt.ID, rt.PID)
+				}
+			}
+			if len(failed) > 0 {
+				return fmt.Errorf("%s", strings.Join(failed, "; "))
+			}
+			return nil
+		},
+	}
+	adopt.Flags().BoolVar(&adoptAll, "all", false, "adopt every adoptable tunnel")
+	adopt.Flags().StringVar(&adoptHost, "host", "", "only consider tunnels of this host alias")
+	adopt.Flags().BoolVar(&adoptJSON, "json", false, "output JSON")
+
 	metricsCmd := &cobra.Command{
 		Use:   "metrics",
 		Short: "Show tunnel reliability metrics and restart diagnostics",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			report := buildMetricsReport(mgr.Snapshot(), mgr.RestartStats(), strings.TrimSpace(metricsHost))
+			mgr.CheckHealth()
+			report := buildMetricsReport(mgr.Snapshot(), mgr.RestartStats(), mgr.Breakers(), strings.TrimSpace(metricsHost))
 			if metricsJSON {
 				enc := json.NewEncoder(os.Stdout)
 				enc.SetIndent("", "  ")
 				return enc.Encode(report)
 			}
-			fmt.Printf("global: total=%d up=%d down=%d error=%d quarantined=%d starting=%d stopping=%d restart_rate=%.2f%% latency_avg=%.1fms latency_p95=%dms\n",
+			fmt.Printf("global: total=%d up=%d down=%d error=%d quarantined=%d starting=%d stopping=%d restart_rate=%.2f%% latency_avg=%.1fms latency_p95=%dms healthy=%d unhealthy=%d breakers_open=%d\n",
 				report.Global.Total,
 				report.Global.StateCounts[string(model.TunnelUp)],
 				report.Global.StateCounts[string(model.TunnelDown)],
@@ -575,15 +850,18 @@ func newTunnelCmd() *cobra.Command {
 				report.Global.RestartSuccessRate,
 				report.Global.LatencyAvgMS,
 				report.Global.LatencyP95MS,
+				report.Global.HealthHealthy,
+				report.Global.HealthUnhealthy,
+				report.Global.BreakersOpen,
 			)
 			if len(report.Hosts) == 0 {
 				fmt.Println("(no host metrics)")
 				return nil
 			}
-			fmt.Printf("%-16s %-6s %-8s %-8s %-8s %-8s %-8s %-8s %-12s %-10s %-10s\n",
-				"HOST", "TOTAL", "UP", "DOWN", "ERROR", "QUAR", "START", "STOP", "RESTART(%)", "AVG(ms)", "P95(ms)")
+			fmt.Printf("%-16s %-6s %-8s %-8s %-8s %-8s %-8s %-8s %-12s %-10s %-10s %-9s %-9s %-10s\n",
+				"HOST", "TOTAL", "UP", "DOWN", "ERROR", "QUAR", "START", "STOP", "RESTART(%)", "AVG(ms)", "P95(ms)", "HEALTHY", "UNHEALTHY", "BREAKER")
 			for _, h := range report.Hosts {
-				fmt.Printf("%-16s %-6d %-8d %-8d %-8d %-8d %-8d %-8d %-12.2f %-10.1f %-10d\n",
+				fmt.Printf("%-16s %-6d %-8d %-8d %-8d %-8d %-8d %-8d %-12.2f %-10.1f %-10d %-9d %-9d %-10s\n",
 					h.HostAlias,
 					h.Total,
 					h.StateCounts[string(model.TunnelUp)],
@@ -595,18 +873,255 @@ func newTunnelCmd() *cobra.Command {
 					h.RestartSuccessRate,
 					h.LatencyAvgMS,
 					h.LatencyP95MS,
+					h.HealthHealthy,
+					h.HealthUnhealthy,
+					util.EmptyDash(h.Breaker),
 				)
 			}
+			if len(report.Traffic) > 0 {
+				fmt.Printf("\n%-42s %-8s %-8s %-10s %-10s\n", "TUNNEL", "CONNS", "ACTIVE", "IN", "OUT")
+				for _, tr := range report.Traffic {
+					fmt.Printf("%-42s %-8d %-8d %-10s %-10s\n", tr.ID, tr.Connections, tr.Active, util.Bytes(tr.BytesIn), util.Bytes(tr.BytesOut))
+				}
+			}
 			return nil
 		},
 	}
 	metricsCmd.Flags().StringVar(&metricsHost, "host", "", "filter metrics to one host alias")
 	metricsCmd.Flags().BoolVar(&metricsJSON, "json", false, "output JSON")
 
-	root.AddCommand(up, down, status, restart, recover, reconcile, check, eventsCmd, metricsCmd)
+	var envFormat string
+	envCmd := &cobra.Command{
+		Use:   "env <host|bundle>",
+		Short: "Print environment variables for running tunnels of a host or bundle",
+		Long: "Print the env templates configured for forwards in config.yaml, rendered\n" +
+			"against the running tunnels' actual local endpoints, e.g.\n\n" +
+			"  eval \"$(ssh-manager tunnel env dev)\"",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch envFormat {
+			case "export", "dotenv", "json":
+			default:
+				return fmt.Errorf("invalid --format %q (want export, dotenv or json)", envFormat)
+			}
+			tunnels, err := targetTunnels(mgr, args[0])
+			if err != nil {
+				return err
+			}
+			env, err := tunnelEnv(mgr, tunnels)
+			if err != nil {
+				return err
+			}
+			if len(env) == 0 {
+				return fmt.Errorf("no env configured for the running tunnels of %s (see forwards[].env in config.yaml)", args[0])
+			}
+			if envFormat == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(env)
+			}
+			names := make([]string, 0, len(env))
+			for name := range env {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if envFormat == "dotenv" {
+					fmt.Printf("%s=%s\n", name, dotenvQuote(env[name]))
+				} else {
+					fmt.Printf("export %s=%s\n", name, shellQuote(env[name]))
+				}
+			}
+			return nil
+		},
+	}
+	envCmd.Flags().StringVar(&envFormat, "format", "export", "output format: export, dotenv, json")
+
+	var execForward string
+	var execReadyTimeout time.Duration
+	execCmd := &cobra.Command{
+		Use:   "exec <host|bundle> [--forward ...] -- <command> [args...]",
+		Short: "Run a command with tunnels up, then stop the tunnels it started",
+		Long: "Start the forwards of a host (or bundle), wait until they accept connections,\n" +
+			"run the command with the tunnels' env (see `tunnel env`) added to its\n" +
+			"environment, then stop the tunnels this command started. Tunnels that were\n" +
+			"already running are used but left running. Signals are forwarded to the\n" +
+			"command and its exit code is returned.",
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.ArgsLenAtDash() != 1 {
+				return fmt.Errorf("usage: tunnel exec <host|bundle> [--forward ...] -- <command> [args...]")
+			}
+			if err := sshclient.EnsureSSHBinary(); err != nil {
+				return err
+			}
+			targets, err := execTargets(args[0], execForward)
+			if err != nil {
+				return err
+			}
+			if isDryRun(cmd) {
+				for _, tg := range targets {
+					p, err := mgr.Plan(tg.host, tg.fwd, tg.opts)
+					if err != nil {
+						return err
+					}
+					printPlan(p)
+				}
+				fmt.Printf("then: %s\n", formatArgv(args[1:]))
+				return nil
+			}
+			switch {
+			case cmd.Flags().Changed("ready-timeout"):
+				mgr.SetReadyTimeout(execReadyTimeout)
+			case cfg.Tunnel.ReadyTimeoutSeconds == 0:
+				// The command must not start before its tunnels work.
+				mgr.SetReadyTimeout(time.Duration(appconfig.Default().Tunnel.ReadyTimeoutSeconds) * time.Second)
+			}
+
+			// started lists every tunnel this command brought up, including
+			// dependencies started on the way, in start order.
+			var used []model.TunnelRuntime
+			var started []string
+			stopStarted := func() {
+				for i := len(started) - 1; i >= 0; i-- {
+					if err := mgr.Stop(started[i]); err != nil {
+						fmt.Fprintf(os.Stderr, "ssh-manager: stop %s: %v\n", started[i], err)
+					}
+				}
+			}
+			for _, tg := range targets {
+				id := tunnel.RuntimeID(tg.host.Alias, tg.fwd)
+				before := activeTunnelIDs(mgr)
+				rt, err := mgr.StartWithOptions(tg.host, tg.fwd, tg.opts)
+				// Dependencies may be up even when the target failed.
+				started = append(started, newlyStarted(mgr, before, id)...)
+				if err != nil {
+					stopStarted()
+					return fmt.Errorf("%s: %s", id, security.UserMessage(err, cfg.Security.RedactErrors))
+				}
+				_ = history.Touch(tg.host.Alias)
+				used = append(used, rt)
+			}
+
+			env, err := tunnelEnv(mgr, used)
+			if err != nil {
+				stopStarted()
+				return err
+			}
+			if len(used) == 1 {
+				host, port, _ := net.SplitHostPort(used[0].Local)
+				env["SSHM_LOCAL_HOST"] = host
+				env["SSHM_LOCAL_PORT"] = port
+			}
+			code, err := runWithSignals(args[1:], env)
+			stopStarted()
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+				return &ExitCodeError{Code: code}
+			}
+			return nil
+		},
+	}
+	execCmd.Flags().StringVar(&execForward, "forward", "", "forward index (0-based) or explicit spec (host targets only)")
+	execCmd.Flags().DurationVar(&execReadyTimeout, "ready-timeout", 0, "wait this long for each tunnel to accept connections (default from config, at least 10s)")
+
+	root.AddCommand(up, down, status, restart, recover, reconcile, adopt, check, eventsCmd, logsCmd, metricsCmd, envCmd, execCmd)
 	return root
 }
 
+// activeTunnelIDs returns the tunnels of mgr that hold a process or
+// listener.
+func activeTunnelIDs(mgr *tunnel.Manager) map[string]bool {
+	ids := map[string]bool{}
+	for _, rt := range mgr.Snapshot() {
+		switch rt.State {
+		case model.TunnelUp, model.TunnelArmed, model.TunnelStarting, model.TunnelError:
+			ids[rt.ID] = true
+		}
+	}
+	return ids
+}
+
+// newlyStarted returns the tunnels that became active since before, in
+// start order: dependencies by start time, then target (when it started).
+func newlyStarted(mgr *tunnel.Manager, before map[string]bool, target string) []string {
+	var deps []model.TunnelRuntime
+	targetStarted := false
+	for id := range activeTunnelIDs(mgr) {
+		if before[id] {
+			continue
+		}
+		if id == target {
+			targetStarted = true
+			continue
+		}
+		if rt, err := mgr.Get(id); err == nil {
+			deps = append(deps, rt)
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].StartedAt.Before(deps[j].StartedAt) })
+	var out []string
+	for _, rt := range deps {
+		out = append(out, rt.ID)
+	}
+	if targetStarted {
+		out = append(out, target)
+	}
+	return out
+}
+
+// newTunnelManager builds an SSH client and tunnel manager configured from
+// config.yaml and restores persisted tunnel state from runtime.json, so that
+// tunnels started by previous invocations (whose processes are still alive)
+// can be shown and stopped. With dryRun, runtime.json is only read and no
+// hooks or webhooks are set up, so nothing is written.
+func newTunnelManager(dryRun bool) (*sshclient.Client, *tunnel.Manager, appconfig.Config) {
+	client := sshclient.New()
+	mgr := tunnel.NewManager(client)
+	cfg, cfgErr := appconfig.Load()
+	if cfgErr != nil {
+		slog.Warn("failed to load config, using defaults", "error", cfgErr)
+		cfg = appconfig.Default()
+	}
+	mgr.SetBindPolicy(cfg.Security.BindPolicy)
+	mgr.SetRedactErrors(cfg.Security.RedactErrors)
+	mgr.SetRestartPolicy(
+		cfg.Tunnel.AutoRestart,
+		cfg.Tunnel.RestartMaxAttempts,
+		cfg.Tunnel.RestartBackoffSeconds,
+		cfg.Tunnel.RestartStableWindowSeconds,
+	)
+	mgr.SetRestartBackoff(time.Duration(cfg.Tunnel.RestartBackoffMaxSeconds)*time.Second, cfg.Tunnel.RestartJitter)
+	mgr.SetCircuitBreaker(cfg.Tunnel.BreakerThreshold, time.Duration(cfg.Tunnel.BreakerCooldownSeconds)*time.Second)
+	mgr.SetForwardConfigs(cfg.Forwards)
+	mgr.SetReadyTimeout(time.Duration(cfg.Tunnel.ReadyTimeoutSeconds) * time.Second)
+	mgr.SetOnDemandIdle(time.Duration(cfg.Tunnel.OnDemandIdleSeconds) * time.Second)
+	mgr.SetAutoPortRange(cfg.Tunnel.AutoPortMin, cfg.Tunnel.AutoPortMax)
+	mgr.SetLifetimeDefaults(
+		time.Duration(cfg.Tunnel.TTLSeconds)*time.Second,
+		time.Duration(cfg.Tunnel.IdleTimeoutSeconds)*time.Second,
+	)
+	mgr.SetMultiplex(cfg.Tunnel.Multiplex)
+	client.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
+	client.SetSSHOptions(cfg.SSH, cfg.Forwards)
+	if dryRun {
+		if err := mgr.InspectRuntime(); err != nil {
+			slog.Warn("failed to read tunnel runtime", "error", err)
+		}
+		return client, mgr, cfg
+	}
+	mgr.SetHooks(cfg.Hooks, cfg.Tunnel.HookConcurrency)
+	mgr.SetWebhooks(cfg.Webhooks)
+	if err := mgr.LoadRuntime(); err != nil {
+		slog.Warn("failed to load tunnel runtime", "error", err)
+	}
+	return client, mgr, cfg
+}
+
 func parseSince(s string) (time.Time, error) {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -641,9 +1156,78 @@ func filterTunnelSnapshot(in []model.TunnelRuntime, host, state string, limit in
 	return out
 }
 
+// needsHold reports whether rt depends on this process staying alive: the
+// listener of an on-demand or relayed tunnel lives here. With foreground
+// (--foreground) every tunnel is held.
+func needsHold(rt model.TunnelRuntime, foreground bool) bool {
+	return foreground || rt.OnDemand || rt.Relay
+}
+
+// noteUnheldLimits tells the user, once, who enforces the TTL and idle
+// timeouts of tunnels this process leaves running.
+func noteUnheldLimits(rts []model.TunnelRuntime, foreground bool) {
+	for _, rt := range rts {
+		if !needsHold(rt, foreground) && (rt.TTLSec > 0 || rt.IdleTimeoutSec > 0) {
+			fmt.Fprintln(os.Stderr, "note: time limits are enforced while an ssh-manager process runs (the dashboard, tunnel up --foreground, or any later tunnel command)")
+			return
+		}
+	}
+}
+
+// holdPollInterval is how often holdTunnels checks whether its tunnels ended.
+var holdPollInterval = time.Second
+
+// holdTunnels keeps the process alive until every held tunnel has stopped
+// (for example when its TTL expires), and stops them on SIGINT, SIGTERM or
+// SIGHUP (the terminal going away).
+func holdTunnels(mgr *tunnel.Manager, held []model.TunnelRuntime) {
+	if len(held) == 0 {
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+	fmt.Printf("holding %d tunnel(s); press Ctrl+C to stop\n", len(held))
+	tick := time.NewTicker(holdPollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			stopHeld(mgr, held)
+			return
+		case <-tick.C:
+		}
+		live := 0
+		for _, h := range held {
+			rt, err := mgr.Get(h.ID)
+			if err != nil {
+				continue
+			}
+			switch rt.State {
+			case model.TunnelUp, model.TunnelStarting, model.TunnelArmed:
+				live++
+			default:
+				if rt.LastError != "" {
+					fmt.Printf("%s: %s\n", rt.ID, rt.LastError)
+				}
+			}
+		}
+		if live == 0 {
+			return
+		}
+	}
+}
+
+func stopHeld(mgr *tunnel.Manager, held []model.TunnelRuntime) {
+	for _, rt := range held {
+		if err := mgr.Stop(rt.ID); err == nil {
+			fmt.Printf("stopped %s\n", rt.ID)
+		}
+	}
+}
+
 func isKnownTunnelState(v string) bool {
 	switch model.TunnelState(v) {
-	case model.TunnelUp, model.TunnelDown, model.TunnelError, model.TunnelQuarantined, model.TunnelStarting, model.TunnelStopping:
+	case model.TunnelUp, model.TunnelDown, model.TunnelError, model.TunnelQuarantined, model.TunnelStarting, model.TunnelStopping, model.TunnelArmed:
 		return true
 	default:
 		return false
@@ -658,12 +1242,14 @@ func printTunnelSummary(sn []model.TunnelRuntime) {
 		model.TunnelQuarantined: 0,
 		model.TunnelStarting:    0,
 		model.TunnelStopping:    0,
+		model.TunnelArmed:       0,
 	}
 	for _, rt := range sn {
 		counts[rt.State]++
 	}
-	fmt.Printf("summary: up=%d down=%d error=%d quarantined=%d starting=%d stopping=%d total=%d\n",
+	fmt.Printf("summary: up=%d armed=%d down=%d error=%d quarantined=%d starting=%d stopping=%d total=%d\n",
 		counts[model.TunnelUp],
+		counts[model.TunnelArmed],
 		counts[model.TunnelDown],
 		counts[model.TunnelError],
 		counts[model.TunnelQuarantined],
@@ -673,12 +1259,227 @@ func printTunnelSummary(sn []model.TunnelRuntime) {
 	)
 	for _, rt := range sn {
 		if rt.State == model.TunnelError || rt.State == model.TunnelQuarantined || rt.State == model.TunnelStarting || rt.State == model.TunnelStopping {
-			fmt.Printf("  non-healthy: %s state=%s pid=%d error=%s\n", rt.ID, rt.State, rt.PID, util.EmptyDash(rt.LastError))
+			fmt.Printf("  non-healthy: %s state=%s pid=%d code=%s error=%s\n", rt.ID, rt.State, rt.PID, util.EmptyDash(rt.ErrorCode), util.EmptyDash(rt.LastError))
+		}
+		if rt.Health != nil && rt.Health.Status == model.HealthUnhealthy {
+			fmt.Printf("  unhealthy: %s check=%s error=%s\n", rt.ID, rt.Health.Check, util.EmptyDash(rt.Health.Message))
 		}
 	}
 	fmt.Println()
 }
 
+// printDependencyTree prints each tunnel under the tunnel it depends on.
+func printDependencyTree(nodes []tunnel.DependencyNode, indent string) {
+	for _, n := range nodes {
+		rt := n.Tunnel
+		branch := ""
+		if indent != "" {
+			branch = "└─ "
+		}
+		fmt.Printf("%s%s%s [%s] %s -> %s\n", indent, branch, rt.ID, rt.State, rt.Local, rt.Remote)
+		printDependencyTree(n.Dependents, indent+"   ")
+	}
+}
+
+// targetTunnels returns the running (up or armed) tunnels of a bundle or, when
+// no bundle has that name, of a host alias, sorted by ID. Bundle entries with
+// a forward selector only contribute the selected forwards.
+func targetTunnels(mgr *tunnel.Manager, target string) ([]model.TunnelRuntime, error) {
+	match := func(rt model.TunnelRuntime) bool { return rt.HostAlias == target }
+	if def, err := bundle.Get(target); err == nil {
+		allForwards := map[string]bool{}
+		ids := map[string]bool{}
+		for _, entry := range def.Entries {
+			if entry.ForwardSelector == "" {
+				allForwards[entry.HostAlias] = true
+				continue
+			}
+			host, err := findHost(entry.HostAlias)
+			if err != nil {
+				return nil, err
+			}
+			forwards, err := resolveForwards(host, entry.ForwardSelector)
+			if err != nil {
+				return nil, fmt.Errorf("bundle %s entry %s: %w", def.Name, entry.HostAlias, err)
+			}
+			for _, fwd := range forwards {
+				ids[tunnel.RuntimeID(host.Alias, fwd)] = true
+			}
+		}
+		match = func(rt model.TunnelRuntime) bool { return allForwards[rt.HostAlias] || ids[rt.ID] }
+	}
+
+	var out []model.TunnelRuntime
+	for _, rt := range mgr.Snapshot() {
+		if (rt.State == model.TunnelUp || rt.State == model.TunnelArmed) && match(rt) {
+			out = append(out, rt)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no running tunnels for %s", target)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// tunnelEnv merges the rendered env of each tunnel. Two tunnels setting the
+// same variable to different values is an error rather than a silent pick.
+func tunnelEnv(mgr *tunnel.Manager, tunnels []model.TunnelRuntime) (map[string]string, error) {
+	env := map[string]string{}
+	owner := map[string]string{}
+	for _, rt := range tunnels {
+		vars, err := mgr.Env(rt)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range vars {
+			if prev, ok := env[name]; ok && prev != value {
+				return nil, fmt.Errorf("%s is set by both %s and %s", name, owner[name], rt.ID)
+			}
+			env[name] = value
+			owner[name] = rt.ID
+		}
+	}
+	return env, nil
+}
+
+// ExitCodeError carries the exit code of a child process (see "tunnel exec").
+// main exits with Code without printing anything further.
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// execTarget is one forward "tunnel exec" starts.
+type execTarget struct {
+	host model.HostEntry
+	fwd  model.ForwardSpec
+	opts tunnel.ForwardOptions
+}
+
+// execTargets resolves the forwards of a bundle or, when no bundle has that
+// name, of a host alias (optionally narrowed by forwardArg).
+func execTargets(target, forwardArg string) ([]execTarget, error) {
+	if def, err := bundle.Get(target); err == nil {
+		if strings.TrimSpace(forwardArg) != "" {
+			return nil, fmt.Errorf("--forward cannot be used with bundle %s", def.Name)
+		}
+		entries, err := def.Ordered()
+		if err != nil {
+			return nil, err
+		}
+		var out []execTarget
+		for _, entry := range entries {
+			host, err := findHost(entry.HostAlias)
+			if err != nil {
+				return nil, err
+			}
+			forwards, err := resolveForwards(host, entry.ForwardSelector)
+			if err != nil {
+				return nil, fmt.Errorf("bundle %s entry %s: %w", def.Name, entry.HostAlias, err)
+			}
+			for _, fwd := range forwards {
+				out = append(out, execTarget{host: host, fwd: fwd, opts: entry.Options()})
+			}
+		}
+		return out, nil
+	}
+	host, err := findHost(target)
+	if err != nil {
+		return nil, err
+	}
+	forwards, err := resolveForwards(host, forwardArg)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]execTarget, 0, len(forwards))
+	for _, fwd := range forwards {
+		out = append(out, execTarget{host: host, fwd: fwd})
+	}
+	return out, nil
+}
+
+// runWithSignals runs argv with extra variables added to the environment and
+// stdio attached, forwarding SIGINT, SIGTERM, SIGHUP and SIGQUIT to it. It
+// returns the child's exit code; a child killed by a signal yields 128+signal
+// as in a shell.
+func runWithSignals(argv []string, extra map[string]string) (int, error) {
+	child := exec.Command(argv[0], argv[1:]...)
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+	child.Env = os.Environ()
+	for name, value := range extra {
+		child.Env = append(child.Env, name+"="+value)
+	}
+
+	// Catch signals before starting so none can kill ssh-manager (and leak
+	// its tunnels) while the child runs.
+	sigs := make(chan os.Signal, 4)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(sigs)
+
+	if err := child.Start(); err != nil {
+		return 0, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				_ = child.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// shellQuote quotes s for a POSIX shell using single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// dotenvQuote renders s as a double-quoted dotenv value.
+func dotenvQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// tailLines returns the last n non-empty lines of s (all of them when n <= 0).
+func tailLines(s string, n int) []string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// healthLabel renders the application-level health of a tunnel for tables.
+func healthLabel(rt model.TunnelRuntime) string {
+	if rt.Health == nil {
+		return "-"
+	}
+	return string(rt.Health.Status)
+}
+
 type metricsBucket struct {
 	HostAlias          string         `json:"host_alias,omitempty"`
 	Total              int            `json:"total"`
@@ -689,14 +1490,35 @@ type metricsBucket struct {
 	RestartSuccessRate float64        `json:"restart_success_rate"`
 	LatencyAvgMS       float64        `json:"latency_avg_ms"`
 	LatencyP95MS       int64          `json:"latency_p95_ms"`
+	HealthHealthy      int            `json:"health_healthy"`
+	HealthUnhealthy    int            `json:"health_unhealthy"`
+	Connections        int64          `json:"connections"`
+	ActiveConnections  int64          `json:"active_connections"`
+	BytesIn            int64          `json:"bytes_in"`
+	BytesOut           int64          `json:"bytes_out"`
+
+	// Breaker is the host's auto-restart circuit breaker state (host
+	// buckets only); BreakersOpen counts open or half-open breakers.
+	Breaker      string    `json:"breaker,omitempty"`
+	BreakerTrips int       `json:"breaker_trips"`
+	BreakerRetry time.Time `json:"breaker_retry_at,omitzero"`
+	BreakersOpen int       `json:"breakers_open"`
+}
+
+// tunnelTraffic is the client traffic of one relayed or on-demand tunnel.
+type tunnelTraffic struct {
+	ID        string `json:"id"`
+	HostAlias string `json:"host_alias"`
+	model.TrafficStats
 }
 
 type metricsReport struct {
-	Global metricsBucket   `json:"global"`
-	Hosts  []metricsBucket `json:"hosts"`
+	Global  metricsBucket   `json:"global"`
+	Hosts   []metricsBucket `json:"hosts"`
+	Traffic []tunnelTraffic `json:"traffic"`
 }
 
-func buildMetricsReport(sn []model.TunnelRuntime, restart map[string]tunnel.RestartStats, hostFilter string) metricsReport {
+func buildMetricsReport(sn []model.TunnelRuntime, restart map[string]tunnel.RestartStats, breakers map[string]tunnel.BreakerStats, hostFilter string) metricsReport {
 	hostFilter = strings.TrimSpace(hostFilter)
 	filtered := make([]model.TunnelRuntime, 0, len(sn))
 	for _, rt := range sn {
@@ -718,9 +1540,23 @@ func buildMetricsReport(sn []model.TunnelRuntime, restart map[string]tunnel.Rest
 		}
 		hb.Total++
 		hb.StateCounts[string(rt.State)]++
+		if rt.Health != nil {
+			switch rt.Health.Status {
+			case model.HealthHealthy:
+				hb.HealthHealthy++
+			case model.HealthUnhealthy:
+				hb.HealthUnhealthy++
+			}
+		}
 		if rt.State == model.TunnelUp {
 			hb.LatencyAvgMS += float64(rt.LatencyMS)
 		}
+		if rt.Traffic != nil {
+			hb.Connections += rt.Traffic.Connections
+			hb.ActiveConnections += rt.Traffic.Active
+			hb.BytesIn += rt.Traffic.BytesIn
+			hb.BytesOut += rt.Traffic.BytesOut
+		}
 	}
 
 	for id, st := range restart {
@@ -741,6 +1577,19 @@ func buildMetricsReport(sn []model.TunnelRuntime, restart map[string]tunnel.Rest
 		hb.RestartFailures += st.Failures
 	}
 
+	for host, b := range breakers {
+		hb := hostBuckets[host]
+		if hb == nil || b.State == "" {
+			continue
+		}
+		hb.Breaker = b.State
+		hb.BreakerTrips = b.Trips
+		if b.State != tunnel.BreakerClosed {
+			hb.BreakerRetry = b.RetryAt
+			hb.BreakersOpen = 1
+		}
+	}
+
 	hosts := make([]metricsBucket, 0, len(hostBuckets))
 	for _, hb := range hostBuckets {
 		lat := latenciesForHost(filtered, hb.HostAlias)
@@ -759,6 +1608,14 @@ func buildMetricsReport(sn []model.TunnelRuntime, restart map[string]tunnel.Rest
 		global.RestartAttempts += h.RestartAttempts
 		global.RestartSuccesses += h.RestartSuccesses
 		global.RestartFailures += h.RestartFailures
+		global.HealthHealthy += h.HealthHealthy
+		global.HealthUnhealthy += h.HealthUnhealthy
+		global.BreakerTrips += h.BreakerTrips
+		global.BreakersOpen += h.BreakersOpen
+		global.Connections += h.Connections
+		global.ActiveConnections += h.ActiveConnections
+		global.BytesIn += h.BytesIn
+		global.BytesOut += h.BytesOut
 	}
 	allLat := make([]int64, 0, len(filtered))
 	for _, rt := range filtered {
@@ -769,7 +1626,15 @@ func buildMetricsReport(sn []model.TunnelRuntime, restart map[string]tunnel.Rest
 	global.LatencyAvgMS, global.LatencyP95MS = latencyAgg(allLat)
 	global.RestartSuccessRate = successRate(global.RestartSuccesses, global.RestartAttempts)
 
-	return metricsReport{Global: global, Hosts: hosts}
+	traffic := make([]tunnelTraffic, 0)
+	for _, rt := range filtered {
+		if rt.Traffic != nil {
+			traffic = append(traffic, tunnelTraffic{ID: rt.ID, HostAlias: rt.HostAlias, TrafficStats: *rt.Traffic})
+		}
+	}
+	sort.Slice(traffic, func(i, j int) bool { return traffic[i].ID < traffic[j].ID })
+
+	return metricsReport{Global: global, Hosts: hosts, Traffic: traffic}
 }
 
 func zeroStateCounts() map[string]int {
@@ -822,11 +1687,9 @@ func latencyAgg(vals []int64) (float64, int64) {
 }
 
 func forwardFromRuntime(rt model.TunnelRuntime) (model.ForwardSpec, error) {
-	if rt.Forward.LocalPort > 0 && rt.Forward.RemotePort > 0 {
-		return rt.Forward, nil
-	}
-	// Rehydrate from stable local/remote endpoint strings loaded from runtime.json.
-	fwd, err := tunnel.ParseForwardArg(fmt.Sprintf("%s:%s", rt.Local, rt.Remote))
+	// Entries loaded from runtime.json are rehydrated from their stable
+	// local/remote endpoint strings; auto-port tunnels keep their declared port.
+	fwd, err := tunnel.RequestedForward(rt)
 	if err != nil {
 		return model.ForwardSpec{}, fmt.Errorf("cannot reconstruct forward for %s: %w", rt.ID, err)
 	}
@@ -898,8 +1761,9 @@ func resolveForwards(host model.HostEntry, forwardArg string) ([]model.ForwardSp
 // ConnectOnce establishes an interactive SSH session to the given host.
 //
 // This function is available for programmatic use by the TUI when the user
-// presses Enter on a selected host. It creates a fresh sshclient.Client and
-// runs an interactive PTY-based SSH session.
+// presses Enter on a selected host. It creates a fresh sshclient.Client with
+// the host key and ssh option policy of config.yaml and runs an interactive
+// PTY-based SSH session.
 //
 // The session has a generous 24-hour timeout to accommodate long-running
 // interactive work. The context timeout acts as a safety net — in practice,
@@ -910,8 +1774,19 @@ func ConnectOnce(host model.HostEntry) error {
 	// Use a long timeout for interactive sessions (user may work for hours).
 	ctx, cancel := context.WithTimeout(context.Background(), 24*time.Hour)
 	defer cancel()
+	return sessionClient().RunInteractive(ctx, host)
+}
+
+// sessionClient returns an ssh client with the host key, ssh option and
+// session recording policy of config.yaml.
+func sessionClient() *sshclient.Client {
 	c := sshclient.New()
-	return c.RunInteractive(ctx, host)
+	if cfg, err := appconfig.Load(); err == nil {
+		c.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
+		c.SetSSHOptions(cfg.SSH, cfg.Forwards)
+		c.SetRecording(cfg.Recording)
+	}
+	return c
 }
 
 func effectiveHostKeyPolicy(cfg appconfig.Config, override string) string {
@@ -949,6 +1824,9 @@ func newBundleCmd() *cobra.Command {
 
 	var createHosts []string
 	var createForwards []string
+	var createTTL, createIdle time.Duration
+	var createRelay bool
+	var createDependsOn []string
 	create := &cobra.Command{
 		Use:   "create <name>",
 		Short: "Create or replace a bundle",
@@ -957,13 +1835,39 @@ func newBundleCmd() *cobra.Command {
 			if len(createHosts) == 0 {
 				return fmt.Errorf("at least one --host is required")
 			}
+			dependsOn := map[string][]string{}
+			for _, spec := range createDependsOn {
+				host, dep, ok := strings.Cut(spec, "=")
+				if !ok || strings.TrimSpace(host) == "" || strings.TrimSpace(dep) == "" {
+					return fmt.Errorf("invalid --depends-on %q: want host=dependency", spec)
+				}
+				host = strings.TrimSpace(host)
+				if !slices.Contains(createHosts, host) {
+					return fmt.Errorf("--depends-on %q: host %s is not a --host entry", spec, host)
+				}
+				dependsOn[host] = append(dependsOn[host], strings.TrimSpace(dep))
+			}
 			entries := make([]bundle.Entry, 0, len(createHosts))
 			for i, host := range createHosts {
 				fwd := ""
 				if i < len(createForwards) {
 					fwd = createForwards[i]
 				}
-				entries = append(entries, bundle.Entry{HostAlias: host, ForwardSelector: fwd})
+				entries = append(entries, bundle.Entry{
+					HostAlias:          host,
+					ForwardSelector:    fwd,
+					TTLSeconds:         int(createTTL / time.Second),
+					IdleTimeoutSeconds: int(createIdle / time.Second),
+					Relay:              createRelay,
+					DependsOn:          dependsOn[host],
+				})
+			}
+			if isDryRun(cmd) {
+				fmt.Printf("[dry-run] would save bundle %s with %d entries\n", args[0], len(entries))
+				for _, e := range entries {
+					fmt.Printf("  %s %s\n", e.HostAlias, util.EmptyDash(e.ForwardSelector))
+				}
+				return nil
 			}
 			if err := bundle.Create(args[0], entries); err != nil {
 				return err
@@ -974,7 +1878,12 @@ func newBundleCmd() *cobra.Command {
 	}
 	create.Flags().StringArrayVar(&createHosts, "host", nil, "host alias entry (repeatable)")
 	create.Flags().StringArrayVar(&createForwards, "forward", nil, "forward selector aligned by index to --host (optional, repeatable)")
+	create.Flags().DurationVar(&createTTL, "ttl", 0, "stop each entry's tunnels after this long (default from config)")
+	create.Flags().DurationVar(&createIdle, "idle-timeout", 0, "stop each entry's tunnels after this long without clients (default from config)")
+	create.Flags().BoolVar(&createRelay, "relay", false, "relay each entry's tunnels to count client traffic")
+	create.Flags().StringArrayVar(&createDependsOn, "depends-on", nil, "host=dependency: start the dependency (host or host:local_port) before host's tunnels (repeatable)")
 
+	var runForeground bool
 	run := &cobra.Command{
 		Use:   "run <name>",
 		Short: "Run a bundle and start its tunnels",
@@ -984,27 +1893,17 @@ func newBundleCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			client := sshclient.New()
-			mgr := tunnel.NewManager(client)
-			cfg, cfgErr := appconfig.Load()
-			if cfgErr != nil {
-				slog.Warn("failed to load config, using defaults", "error", cfgErr)
-				cfg = appconfig.Default()
-			}
-			mgr.SetBindPolicy(cfg.Security.BindPolicy)
-			mgr.SetRedactErrors(cfg.Security.RedactErrors)
-			mgr.SetRestartPolicy(
-				cfg.Tunnel.AutoRestart,
-				cfg.Tunnel.RestartMaxAttempts,
-				cfg.Tunnel.RestartBackoffSeconds,
-				cfg.Tunnel.RestartStableWindowSeconds,
-			)
-			client.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
-			_ = mgr.LoadRuntime()
+			entries, err := def.Ordered()
+			if err != nil {
+				return err
+			}
+			dryRun := isDryRun(cmd)
+			_, mgr, cfg := newTunnelManager(dryRun)
 
 			started := 0
 			failed := 0
-			for _, entry := range def.Entries {
+			var held, all []model.TunnelRuntime
+			for _, entry := range entries {
 				host, err := findHost(entry.HostAlias)
 				if err != nil {
 					failed++
@@ -1018,29 +1917,60 @@ func newBundleCmd() *cobra.Command {
 					continue
 				}
 				for _, fwd := range forwards {
-					rt, err := mgr.Start(host, fwd)
+					if dryRun {
+						p, err := mgr.Plan(host, fwd, entry.Options())
+						if err != nil {
+							failed++
+							fmt.Printf("failed %s: %v\n", host.Alias, err)
+							continue
+						}
+						printPlan(p)
+						continue
+					}
+					rt, err := mgr.StartWithOptions(host, fwd, entry.Options())
 					if err != nil {
 						failed++
-						fmt.Printf("failed %s %s:%d -> %s:%d: %s\n",
-							host.Alias, fwd.LocalString(), fwd.LocalPort, fwd.RemoteString(), fwd.RemotePort,
+						fmt.Printf("failed %s %s:%s -> %s:%d: %s\n",
+							host.Alias, fwd.LocalString(), fwd.LocalPortString(), fwd.RemoteString(), fwd.RemotePort,
 							security.UserMessage(err, cfg.Security.RedactErrors))
 						continue
 					}
 					_ = history.Touch(host.Alias)
 					started++
+					all = append(all, rt)
+					if needsHold(rt, runForeground) {
+						held = append(held, rt)
+					}
+					if rt.State == model.TunnelArmed {
+						fmt.Printf("armed %s on %s\n", rt.ID, rt.Local)
+						continue
+					}
 					fmt.Printf("started %s pid=%d\n", rt.ID, rt.PID)
 				}
 			}
+			if dryRun {
+				return nil
+			}
 			fmt.Printf("bundle %s summary: started=%d failed=%d\n", def.Name, started, failed)
+			noteUnheldLimits(all, runForeground)
+			holdTunnels(mgr, held)
 			return nil
 		},
 	}
+	run.Flags().BoolVar(&runForeground, "foreground", false, "stay in the foreground, enforcing time limits, until the tunnels stop; Ctrl+C stops them")
 
 	del := &cobra.Command{
 		Use:   "delete <name>",
 		Short: "Delete a bundle",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if isDryRun(cmd) {
+				if _, err := bundle.Get(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("[dry-run] would delete bundle %s\n", args[0])
+				return nil
+			}
 			if err := bundle.Delete(args[0]); err != nil {
 				return err
 			}
@@ -1088,6 +2018,58 @@ func newSecurityCmd() *cobra.Command {
 	return cmd
 }
 
+func newStateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Inspect and migrate persisted state files",
+	}
+
+	var jsonOut bool
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade state files to the current schema versions (see --dry-run)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun := isDryRun(cmd)
+			plans, err := state.Migrate(dryRun)
+			if jsonOut {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if encErr := enc.Encode(plans); encErr != nil {
+					return encErr
+				}
+				return err
+			}
+			fmt.Printf("%-22s %-9s %-9s %s\n", "FILE", "VERSION", "ACTION", "DETAIL")
+			for _, p := range plans {
+				version := "-"
+				if p.Action != state.ActionMissing && p.Action != state.ActionInvalid {
+					version = fmt.Sprintf("%d", p.Found)
+					if p.Action == state.ActionMigrate {
+						version = fmt.Sprintf("%d->%d", p.Found, p.Current)
+					}
+				}
+				detail := ""
+				switch p.Action {
+				case state.ActionMigrate:
+					detail = strings.Join(p.Steps, "; ")
+				case state.ActionNewer:
+					detail = fmt.Sprintf("newer than supported version %d; read-only", p.Current)
+				case state.ActionInvalid:
+					detail = p.Error
+				}
+				fmt.Printf("%-22s %-9s %-9s %s\n", p.File, version, p.Action, util.EmptyDash(detail))
+			}
+			if dryRun {
+				fmt.Println("dry run: no files were modified")
+			}
+			return err
+		},
+	}
+	migrate.Flags().BoolVar(&jsonOut, "json", false, "output JSON")
+	cmd.AddCommand(migrate)
+	return cmd
+}
+
 func newDoctorCmd() *cobra.Command {
 	var jsonOut bool
 	cmd := &cobra.Command{
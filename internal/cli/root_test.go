@@ -1,18 +1,28 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/treykane/ssh-manager/internal/appconfig"
 	"github.com/treykane/ssh-manager/internal/bundle"
 	"github.com/treykane/ssh-manager/internal/events"
 	"github.com/treykane/ssh-manager/internal/history"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/recording"
 	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/state"
+	"github.com/treykane/ssh-manager/internal/tunnel"
 )
 
 func TestTunnelCheckTextOutput(t *testing.T) {
@@ -170,11 +180,14 @@ func TestListRecentOrdering(t *testing.T) {
 
 func TestTunnelEventsJSONOutput(t *testing.T) {
 	setupSSHConfigForCLI(t)
+	// Use a host alias no other test starts tunnels for: watcher goroutines
+	// leaked by earlier tests can append "api" events into this test's
+	// config dir.
 	store := events.NewStore()
 	if err := store.Append(events.Event{
 		Timestamp: time.Now().UTC(),
-		TunnelID:  "api|127.0.0.1:9501|localhost:80",
-		HostAlias: "api",
+		TunnelID:  "events-api|127.0.0.1:9501|localhost:80",
+		HostAlias: "events-api",
 		EventType: "start_succeeded",
 		Message:   "started",
 	}); err != nil {
@@ -182,7 +195,7 @@ func TestTunnelEventsJSONOutput(t *testing.T) {
 	}
 
 	cmd := NewRootCommand()
-	cmd.SetArgs([]string{"tunnel", "events", "--host", "api", "--json"})
+	cmd.SetArgs([]string{"tunnel", "events", "--host", "events-api", "--json"})
 	out, err := captureStdout(func() error { return cmd.Execute() })
 	if err != nil {
 		t.Fatalf("events json: %v", err)
@@ -239,6 +252,39 @@ func TestTunnelStatusJSONFilters(t *testing.T) {
 	}
 }
 
+func TestTunnelStatusTree(t *testing.T) {
+	setupSSHConfigForCLI(t)
+	writeRuntimeForCLI(t, []map[string]any{
+		{
+			"id":         "api|127.0.0.1:9501|localhost:80",
+			"host_alias": "api",
+			"local":      "127.0.0.1:9501",
+			"remote":     "localhost:80",
+			"state":      "down",
+			"depends_on": []string{"db|127.0.0.1:9502|localhost:80"},
+		},
+		{
+			"id":         "db|127.0.0.1:9502|localhost:80",
+			"host_alias": "db",
+			"local":      "127.0.0.1:9502",
+			"remote":     "localhost:80",
+			"state":      "down",
+		},
+	})
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"tunnel", "status", "--tree"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("status tree: %v", err)
+	}
+	want := "db|127.0.0.1:9502|localhost:80 [down] 127.0.0.1:9502 -> localhost:80\n" +
+		"   └─ api|127.0.0.1:9501|localhost:80 [down] 127.0.0.1:9501 -> localhost:80\n"
+	if out != want {
+		t.Fatalf("unexpected tree output:\n%s", out)
+	}
+}
+
 func TestTunnelStatusInvalidState(t *testing.T) {
 	setupSSHConfigForCLI(t)
 	cmd := NewRootCommand()
@@ -304,6 +350,8 @@ func TestTunnelMetricsJSONOutput(t *testing.T) {
 			"pid":            0,
 			"uptime_seconds": 0,
 			"latency_ms":     0,
+			"relay":          true,
+			"traffic":        map[string]any{"connections": 3, "active": 0, "bytes_in": 10, "bytes_out": 20},
 		},
 	})
 	cmd := NewRootCommand()
@@ -322,6 +370,14 @@ func TestTunnelMetricsJSONOutput(t *testing.T) {
 	if _, ok := payload["hosts"]; !ok {
 		t.Fatalf("expected hosts in metrics output: %s", out)
 	}
+	global, _ := payload["global"].(map[string]any)
+	if global["connections"] != float64(3) || global["bytes_out"] != float64(20) {
+		t.Fatalf("expected traffic totals in global metrics: %s", out)
+	}
+	traffic, _ := payload["traffic"].([]any)
+	if len(traffic) != 1 {
+		t.Fatalf("expected one tunnel in traffic: %s", out)
+	}
 }
 
 func captureStdout(fn func() error) (string, error) {
@@ -343,6 +399,8 @@ func captureStdout(fn func() error) (string, error) {
 
 func setupSSHConfigForCLI(t *testing.T) {
 	t.Helper()
+	// A --dry-run command leaves state read-only for the rest of the process.
+	t.Cleanup(func() { state.SetReadOnly(false) })
 	home := t.TempDir()
 	t.Setenv("HOME", home)
 	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
@@ -382,3 +440,484 @@ func writeRuntimeForCLI(t *testing.T, rows []map[string]any) {
 		t.Fatalf("write runtime: %v", err)
 	}
 }
+
+func TestTunnelUpDryRunPrintsArgvWithoutState(t *testing.T) {
+	setupSSHConfigForCLI(t)
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"--dry-run", "tunnel", "up", "api", "--forward", "0"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(out, "[dry-run] api|127.0.0.1:9501|localhost:80") {
+		t.Fatalf("expected plan header, got: %s", out)
+	}
+	if !strings.Contains(out, "ssh -N") || !strings.Contains(out, "127.0.0.1:9501:localhost:80") || !strings.Contains(out, " api") {
+		t.Fatalf("expected ssh argv, got: %s", out)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ssh-manager")); !os.IsNotExist(err) {
+		t.Fatalf("dry run created the config directory: %v", err)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"connect", "api", "--dry-run"})
+	out, err = captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if !strings.Contains(out, "[dry-run] api") || !strings.Contains(out, "ssh ") {
+		t.Fatalf("expected connect argv, got: %s", out)
+	}
+}
+
+func TestExecDryRunResolvesTargets(t *testing.T) {
+	if err := sshclient.EnsureSSHBinary(); err != nil {
+		t.Skip("ssh binary not available in test environment")
+	}
+	setupSSHConfigForCLI(t)
+	cfgPath := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ssh-manager", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// staging is only on a port-specific entry, so it does not tag the host.
+	forwards := "forwards:\n  - host: api\n    tags: [prod]\n  - host: api\n    local_port: 9501\n    tags: [staging]\n"
+	if err := os.WriteFile(cfgPath, []byte(forwards), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.Create("daily", []bundle.Entry{{HostAlias: "api"}}); err != nil {
+		t.Fatalf("create bundle: %v", err)
+	}
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"exec", "--dry-run", "api", "tag:prod", "bundle:daily", "--", "df", "-h"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if strings.Count(out, "[dry-run] api") != 1 {
+		t.Fatalf("expected api once, got: %s", out)
+	}
+	if !strings.Contains(out, "-o BatchMode=yes") || !strings.Contains(out, "api df -h") {
+		t.Fatalf("expected exec argv, got: %s", out)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"exec", "--dry-run", "tag:staging", "--", "uptime"})
+	if _, err := captureStdout(func() error { return cmd.Execute() }); err == nil || !strings.Contains(err.Error(), "no host has tag staging") {
+		t.Fatalf("expected unknown tag error, got %v", err)
+	}
+}
+
+func TestCopyDryRunPushesToGroup(t *testing.T) {
+	if err := sshclient.EnsureCopyBinary(sshclient.CopyOptions{}); err != nil {
+		t.Skip("scp binary not available in test environment")
+	}
+	setupSSHConfigForCLI(t)
+	cfgPath := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ssh-manager", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfgPath, []byte("forwards:\n  - host: api\n    tags: [prod]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"cp", "--dry-run", "-r", "./dist", "tag:prod:/srv/app"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !strings.Contains(out, "[dry-run] api") || !strings.Contains(out, "scp -r -q") || !strings.Contains(out, "./dist api:/srv/app") {
+		t.Fatalf("expected scp argv, got: %s", out)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"cp", "--dry-run", "tag:prod:/etc/hosts", "./hosts"})
+	if _, err := captureStdout(func() error { return cmd.Execute() }); err == nil || !strings.Contains(err.Error(), "cannot copy from a group") {
+		t.Fatalf("expected group source error, got %v", err)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"cp", "--dry-run", "./a", "./dir/b:c"})
+	if _, err := captureStdout(func() error { return cmd.Execute() }); err == nil || !strings.Contains(err.Error(), "must be remote") {
+		t.Fatalf("expected local-only error, got %v", err)
+	}
+}
+
+func TestDryRunDownAndBundleLeaveStateUntouched(t *testing.T) {
+	setupSSHConfigForCLI(t)
+	writeRuntimeForCLI(t, []map[string]any{
+		{"id": "api|127.0.0.1:9501|localhost:80", "host_alias": "api", "state": "up", "pid": 4242, "local": "127.0.0.1:9501", "remote": "localhost:80"},
+	})
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ssh-manager")
+	before, err := os.ReadFile(filepath.Join(dir, "runtime.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"--dry-run", "tunnel", "down", "api"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("tunnel down: %v", err)
+	}
+	if !strings.Contains(out, "[dry-run] would stop api|127.0.0.1:9501|localhost:80 (up, pid 4242)") {
+		t.Fatalf("expected stop plan, got: %s", out)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"--dry-run", "bundle", "create", "daily", "--host", "api"})
+	out, err = captureStdout(func() error { return cmd.Execute() })
+	if err != nil || !strings.Contains(out, "[dry-run] would save bundle daily with 1 entries") {
+		t.Fatalf("bundle create: %v: %s", err, out)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"--dry-run", "tunnel", "reconcile"})
+	cmd.SilenceErrors, cmd.SilenceUsage = true, true
+	if _, err := captureStdout(func() error { return cmd.Execute() }); err == nil {
+		t.Fatal("expected reconcile to refuse --dry-run")
+	}
+
+	// Nothing was migrated, backed up or created.
+	after, _ := os.ReadFile(filepath.Join(dir, "runtime.json"))
+	if string(after) != string(before) {
+		t.Fatalf("dry run modified runtime.json: %s", after)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected only runtime.json in %s, got %v", dir, entries)
+	}
+}
+
+func TestStateMigrateDryRunLeavesLegacyRuntime(t *testing.T) {
+	setupSSHConfigForCLI(t)
+	writeRuntimeForCLI(t, []map[string]any{
+		{"id": "api|127.0.0.1:9501|localhost:80", "host_alias": "api", "state": "down"},
+	})
+	path := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ssh-manager", "runtime.json")
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"state", "migrate", "--dry-run", "--json"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("state migrate: %v", err)
+	}
+	var plans []map[string]any
+	if err := json.Unmarshal([]byte(out), &plans); err != nil {
+		t.Fatalf("invalid migrate json: %v", err)
+	}
+	found := false
+	for _, p := range plans {
+		if p["file"] == "runtime.json" {
+			found = true
+			if p["action"] != "migrate" || p["found_version"] != float64(0) {
+				t.Fatalf("unexpected runtime plan: %+v", p)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected runtime.json in plan, got %s", out)
+	}
+	after, _ := os.ReadFile(path)
+	if string(after) != string(before) {
+		t.Fatalf("dry run modified runtime.json: %s", after)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"state", "migrate"})
+	if _, err := captureStdout(func() error { return cmd.Execute() }); err != nil {
+		t.Fatalf("state migrate: %v", err)
+	}
+	after, _ = os.ReadFile(path)
+	if !strings.Contains(string(after), `"version": 1`) {
+		t.Fatalf("expected versioned runtime.json, got %s", after)
+	}
+}
+
+func TestTunnelLogsTailsLogFile(t *testing.T) {
+	setupSSHConfigForCLI(t)
+	id := "api|127.0.0.1:9501|localhost:80"
+	path, err := tunnel.LogPath(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("line one\nline two\nPermission denied (publickey).\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"tunnel", "logs", id, "--lines", "2"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("tunnel logs: %v", err)
+	}
+	if strings.Contains(out, "line one") || !strings.Contains(out, "line two") || !strings.Contains(out, "Permission denied") {
+		t.Fatalf("unexpected logs output: %q", out)
+	}
+}
+
+func TestTunnelEnvRendersConfiguredTemplates(t *testing.T) {
+	setupSSHConfigForCLI(t)
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	cfg := strings.Join([]string{
+		"forwards:",
+		"  - host: api",
+		"    env:",
+		"      DATABASE_URL: postgres://{local_host}:{local_port}/app",
+		"      API_ADDR: \"{local}\"",
+		"",
+	}, "\n")
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// An armed on-demand tunnel held by a live process (our parent) is
+	// restored as running without a PID check.
+	writeRuntimeForCLI(t, []map[string]any{
+		{
+			"id":                   "api|127.0.0.1:0|localhost:80",
+			"host_alias":           "api",
+			"local":                "127.0.0.1:20123",
+			"remote":               "localhost:80",
+			"state":                "armed",
+			"on_demand":            true,
+			"owner_pid":            os.Getppid(),
+			"auto_port":            true,
+			"requested_local_port": 0,
+		},
+	})
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"tunnel", "env", "api"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("tunnel env: %v", err)
+	}
+	want := "export API_ADDR='127.0.0.1:20123'\nexport DATABASE_URL='postgres://127.0.0.1:20123/app'\n"
+	if out != want {
+		t.Fatalf("unexpected export output:\n%s", out)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"tunnel", "env", "api", "--format", "json"})
+	out, err = captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("tunnel env json: %v", err)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(out), &payload); err != nil || payload["API_ADDR"] != "127.0.0.1:20123" {
+		t.Fatalf("unexpected json output %q (%v)", out, err)
+	}
+}
+
+func TestShellAndDotenvQuoting(t *testing.T) {
+	if got := shellQuote("it's $HOME"); got != `'it'\''s $HOME'` {
+		t.Fatalf("unexpected shell quoting: %s", got)
+	}
+	if got := dotenvQuote("a \"b\" $c"); got != `"a \"b\" \$c"` {
+		t.Fatalf("unexpected dotenv quoting: %s", got)
+	}
+}
+
+func TestRunWithSignalsPropagatesExitCodeAndEnv(t *testing.T) {
+	code, err := runWithSignals([]string{"sh", "-c", `test "$DATABASE_URL" = "postgres://127.0.0.1:20123/app" || exit 9; exit 3`},
+		map[string]string{"DATABASE_URL": "postgres://127.0.0.1:20123/app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Fatalf("expected child exit code 3, got %d", code)
+	}
+	code, err = runWithSignals([]string{"sh", "-c", "kill -TERM $$"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 128+15 {
+		t.Fatalf("expected 143 for a child killed by SIGTERM, got %d", code)
+	}
+}
+
+func TestTunnelExecRequiresCommandAfterDash(t *testing.T) {
+	setupSSHConfigForCLI(t)
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"tunnel", "exec", "api", "echo", "hi"})
+	_, err := captureStdout(func() error { return cmd.Execute() })
+	if err == nil || !strings.Contains(err.Error(), "usage: tunnel exec") {
+		t.Fatalf("expected usage error without --, got %v", err)
+	}
+}
+
+// listenStarter stands in for ssh: it binds the forward's local port and
+// runs sleep, both until the tunnel is stopped.
+type listenStarter struct{}
+
+func (listenStarter) StartTunnel(ctx context.Context, host model.HostEntry, fwd model.ForwardSpec) (*sshclient.TunnelProcess, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", fwd.LocalAddr, fwd.LocalPort))
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "sleep", "30")
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	return &sshclient.TunnelProcess{Cmd: cmd, Stderr: stderr}, nil
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestNewlyStartedIncludesDependencies(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	depPort, appPort := freePort(t), freePort(t)
+	cfg := fmt.Sprintf("Host bastion\n  HostName 127.0.0.1\n  LocalForward 127.0.0.1:%d localhost:22\n"+
+		"Host app\n  HostName 127.0.0.1\n  LocalForward 127.0.0.1:%d localhost:80\n", depPort, appPort)
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "config"), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := tunnel.NewManager(listenStarter{})
+	defer mgr.StopAll()
+	mgr.SetForwardConfigs([]appconfig.ForwardConfig{{Host: "app", DependsOn: []string{fmt.Sprintf("bastion:%d", depPort)}}})
+	app := model.HostEntry{Alias: "app", HostName: "127.0.0.1", Port: 22}
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: appPort, RemoteAddr: "localhost", RemotePort: 80}
+	id := tunnel.RuntimeID("app", fwd)
+
+	before := activeTunnelIDs(mgr)
+	if _, err := mgr.Start(app, fwd); err != nil {
+		t.Fatal(err)
+	}
+	started := newlyStarted(mgr, before, id)
+	dep := tunnel.RuntimeID("bastion", model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: depPort, RemoteAddr: "localhost", RemotePort: 22})
+	if len(started) != 2 || started[0] != dep || started[1] != id {
+		t.Fatalf("expected dependency then target, got %v", started)
+	}
+
+	// Running tunnels are not reported again.
+	if again := newlyStarted(mgr, activeTunnelIDs(mgr), id); len(again) != 0 {
+		t.Fatalf("expected nothing new, got %v", again)
+	}
+}
+
+func TestSessionsListAndPlay(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	rec, err := recording.Start(appconfig.RecordingConfig{}, "api", 80, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rec.Output().Write([]byte("uptime 42 days\r\n"))
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"sessions", "list", "--json"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	var rows []recording.Info
+	if err := json.Unmarshal([]byte(out), &rows); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+	if len(rows) != 1 || rows[0].Host != "api" || !strings.HasPrefix(rows[0].ID, "api/") {
+		t.Fatalf("unexpected sessions: %+v", rows)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"sessions", "play", rows[0].ID})
+	out, err = captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if out != "uptime 42 days\r\n" {
+		t.Fatalf("unexpected playback: %q", out)
+	}
+}
+
+func TestHostKeysListPinVerifyRemove(t *testing.T) {
+	setupSSHConfigForCLI(t)
+	knownHosts := filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+	content := "127.0.0.1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIEpUHHh5Drk3E7gbOpLSOLSt87EZk9A9SLumUVEWioWh\n"
+	if err := os.WriteFile(knownHosts, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	const fp = "SHA256:oo4vOoMQHoMIeRX/7Mjlu9UHMq4Qgn66+W6sfHT2/NE"
+
+	cmd := NewRootCommand()
+	cmd.SetArgs([]string{"hostkeys", "pin", "api"})
+	if _, err := captureStdout(func() error { return cmd.Execute() }); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"hostkeys", "list", "--json"})
+	out, err := captureStdout(func() error { return cmd.Execute() })
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var rows []hostKeyRow
+	if err := json.Unmarshal([]byte(out), &rows); err != nil {
+		t.Fatalf("decode %q: %v", out, err)
+	}
+	if len(rows) != 1 || rows[0].Host != "api" || rows[0].Fingerprint != fp || !rows[0].Pinned {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"hostkeys", "verify", "--offline"})
+	out, err = captureStdout(func() error { return cmd.Execute() })
+	if err != nil || !strings.Contains(out, "verify summary: ok=1 failed=0") {
+		t.Fatalf("expected pinned key verified, got %q (%v)", out, err)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"hostkeys", "remove", "api", "--yes"})
+	out, err = captureStdout(func() error { return cmd.Execute() })
+	if err != nil || !strings.Contains(out, "removed 1 line(s); backup at "+knownHosts+".") {
+		t.Fatalf("unexpected remove output %q (%v)", out, err)
+	}
+	if b, _ := os.ReadFile(knownHosts); len(b) != 0 {
+		t.Fatalf("expected entry removed, got %q", b)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetArgs([]string{"hostkeys", "verify", "--offline", "api"})
+	_, err = captureStdout(func() error { return cmd.Execute() })
+	var exitErr *ExitCodeError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 {
+		t.Fatalf("expected verify to fail without the pinned key, got %v", err)
+	}
+}
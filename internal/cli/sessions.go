@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/spf13/cobra"
+	"github.com/treykane/ssh-manager/internal/recording"
+)
+
+// newSessionsCmd creates the "sessions" command group, which lists and
+// replays recorded interactive sessions (see recording in config.yaml).
+func newSessionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "List and replay recorded ssh sessions",
+	}
+
+	var jsonOut bool
+	list := &cobra.Command{
+		Use:   "list [host]",
+		Short: "List recorded sessions, newest first",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := recording.Dir()
+			if err != nil {
+				return err
+			}
+			all, err := recording.List(dir)
+			if err != nil {
+				return err
+			}
+			rows := []recording.Info{}
+			for _, info := range all {
+				if len(args) == 0 || info.Host == args[0] {
+					rows = append(rows, info)
+				}
+			}
+			if jsonOut {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(rows)
+			}
+			fmt.Printf("%-40s %-24s %-25s %-10s %-9s %s\n", "ID", "HOST", "STARTED", "DURATION", "SIZE", "TERMINAL")
+			for _, r := range rows {
+				fmt.Printf("%-40s %-24s %-25s %-10s %-9s %dx%d\n", r.ID, r.Host, r.Started.Format(time.RFC3339),
+					(time.Duration(r.DurationMS) * time.Millisecond).Round(time.Second).String(), formatSize(r.Size), r.Width, r.Height)
+			}
+			return nil
+		},
+	}
+	list.Flags().BoolVar(&jsonOut, "json", false, "print recordings as JSON")
+
+	var speed float64
+	var idleLimit time.Duration
+	play := &cobra.Command{
+		Use:   "play <id|file.cast>",
+		Short: "Replay a recorded session in the terminal",
+		Long: "Replay the output of a recorded session with its original timing. Pauses\n" +
+			"longer than --idle-limit are shortened. Interrupt with Ctrl-C.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := recording.Dir()
+			if err != nil {
+				return err
+			}
+			info, err := recording.Find(dir, args[0])
+			if err != nil {
+				return err
+			}
+			if size, err := pty.GetsizeFull(os.Stdout); err == nil && (int(size.Cols) < info.Width || int(size.Rows) < info.Height) {
+				fmt.Fprintf(os.Stderr, "ssh-manager: recorded at %dx%d, terminal is %dx%d; output may wrap\n",
+					info.Width, info.Height, size.Cols, size.Rows)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err = recording.Play(ctx, info.Path, os.Stdout, recording.PlayOptions{Speed: speed, IdleLimit: idleLimit})
+			if ctx.Err() != nil {
+				// Interrupted: leave the terminal on a fresh line.
+				fmt.Println()
+				return nil
+			}
+			return err
+		},
+	}
+	play.Flags().Float64Var(&speed, "speed", 1, "playback speed multiplier")
+	play.Flags().DurationVar(&idleLimit, "idle-limit", 2*time.Second, "longest pause between outputs (0 keeps recorded pauses)")
+
+	cmd.AddCommand(list, play)
+	return cmd
+}
+
+// formatSize renders a byte count for tables, e.g. "12.3KiB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -392,49 +392,34 @@ func parseLocalForward(v string) (model.ForwardSpec, bool) {
 //   - local=true  → default address is "127.0.0.1" (bind to loopback only)
 //   - local=false → default address is "localhost"
 //
+// Automatic local ports ("auto" or 0) are not accepted here: ssh reads the
+// same file and rejects such a LocalForward, so they are only offered through
+// --forward and ssh-manager's own config.
+//
 // Returns (address, port, ok). Returns ok=false if the port is not a valid integer.
 func parseEndpoint(s string, local bool) (string, int, bool) {
+	addr, portStr := "", s
 	// If no colon is present, the entire string should be a port number.
-	if !strings.Contains(s, ":") {
-		p, err := strconv.Atoi(s)
-		if err != nil {
-			return "", 0, false
-		}
-		if err := util.ValidatePort(p); err != nil {
-			return "", 0, false
-		}
-		if local {
-			return "127.0.0.1", p, true
+	if strings.Contains(s, ":") {
+		if strings.HasPrefix(s, "[") {
+			var err error
+			addr, portStr, err = net.SplitHostPort(s)
+			if err != nil {
+				return "", 0, false
+			}
+		} else {
+			if strings.Count(s, ":") > 1 {
+				// Require bracketed IPv6 to avoid ambiguous parsing.
+				return "", 0, false
+			}
+			idx := strings.LastIndex(s, ":")
+			addr, portStr = s[:idx], s[idx+1:]
 		}
-		return "localhost", p, true
 	}
 
-	var (
-		addr string
-		p    int
-		err  error
-	)
-	if strings.HasPrefix(s, "[") {
-		var portStr string
-		addr, portStr, err = net.SplitHostPort(s)
-		if err != nil {
-			return "", 0, false
-		}
-		p, err = strconv.Atoi(portStr)
-		if err != nil {
-			return "", 0, false
-		}
-	} else {
-		if strings.Count(s, ":") > 1 {
-			// Require bracketed IPv6 to avoid ambiguous parsing.
-			return "", 0, false
-		}
-		idx := strings.LastIndex(s, ":")
-		addr = s[:idx]
-		p, err = strconv.Atoi(s[idx+1:])
-		if err != nil {
-			return "", 0, false
-		}
+	p, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, false
 	}
 	if err := util.ValidatePort(p); err != nil {
 		return "", 0, false
@@ -186,3 +186,27 @@ Host db
 		t.Fatalf("expected invalid forward to be skipped, got %+v", res.Hosts[0].Forwards)
 	}
 }
+
+func TestParseFile_LocalForwardRejectsAutoPort(t *testing.T) {
+	d := t.TempDir()
+	path := filepath.Join(d, "config")
+	cfg := `
+Host db
+  HostName db.internal
+  LocalForward auto localhost:5432
+  LocalForward 127.0.0.1:0 localhost:6379
+  LocalForward 8080 localhost:auto
+  LocalForward 15432 localhost:5432
+`
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ssh itself rejects these lines, so only the explicit forward is kept.
+	if len(res.Hosts) != 1 || len(res.Hosts[0].Forwards) != 1 || res.Hosts[0].Forwards[0].LocalPort != 15432 {
+		t.Fatalf("expected only the explicit forward, got %+v", res.Hosts)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/treykane/ssh-manager/internal/model"
 	"github.com/treykane/ssh-manager/internal/security"
 	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/state"
 	"github.com/treykane/ssh-manager/internal/tunnel"
 	"github.com/treykane/ssh-manager/internal/util"
 )
@@ -60,6 +61,18 @@ func Run() (Report, error) {
 		issues = append(issues, duplicateBindIssues(res.Hosts)...)
 	}
 
+	for _, f := range state.All() {
+		if p := f.Inspect(); p.Action == state.ActionNewer {
+			issues = append(issues, Issue{
+				Severity:       SeverityMedium,
+				Check:          "state-version",
+				Target:         p.Path,
+				Message:        fmt.Sprintf("schema version %d is newer than supported version %d; file is read-only", p.Found, p.Current),
+				Recommendation: "upgrade ssh-manager to the build that wrote this file",
+			})
+		}
+	}
+
 	mgr := tunnel.NewManager(sshclient.New())
 	if err := mgr.LoadRuntime(); err == nil {
 		for _, rt := range mgr.Snapshot() {
@@ -7,7 +7,7 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/state"
 )
 
 func TestRunIncludesDuplicateBindIssue(t *testing.T) {
@@ -62,7 +62,7 @@ func TestRunJSONShapeDeterministic(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	path, err := appconfig.RuntimeFilePath()
+	path, err := state.Runtime.Path()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -2,6 +2,7 @@ package events
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -9,18 +10,20 @@ import (
 	"strings"
 	"time"
 
-	"github.com/treykane/ssh-manager/internal/appconfig"
 	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/state"
 )
 
 // Event is one tunnel lifecycle record persisted to events.jsonl.
 type Event struct {
+	Version   int               `json:"version,omitempty"`
 	Timestamp time.Time         `json:"timestamp"`
 	TunnelID  string            `json:"tunnel_id,omitempty"`
 	HostAlias string            `json:"host_alias,omitempty"`
 	EventType string            `json:"event_type"`
 	State     model.TunnelState `json:"state,omitempty"`
 	Message   string            `json:"message,omitempty"`
+	ErrorCode string            `json:"error_code,omitempty"`
 	PID       int               `json:"pid,omitempty"`
 }
 
@@ -40,23 +43,20 @@ func NewStore() *Store {
 	return &Store{}
 }
 
-func filePath() (string, error) {
-	dir, err := appconfig.ConfigDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(dir, "events.jsonl"), nil
-}
-
-// Append writes a single event as one JSON line.
+// Append writes a single event as one JSON line. Appending is refused when
+// the journal was last written by a newer schema version (see state.Events).
 func (s *Store) Append(evt Event) error {
-	path, err := filePath()
+	if err := state.Events.CheckWritable(); err != nil {
+		return err
+	}
+	path, err := state.Events.Path()
 	if err != nil {
 		return err
 	}
 	if evt.Timestamp.IsZero() {
 		evt.Timestamp = time.Now().UTC()
 	}
+	evt.Version = state.Events.Current
 	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
 		return err
 	}
@@ -78,21 +78,16 @@ func (s *Store) Append(evt Event) error {
 
 // Read returns events in append order, filtered by query, with optional limit.
 func (s *Store) Read(q Query) ([]Event, error) {
-	path, err := filePath()
-	if err != nil {
-		return nil, err
-	}
-	f, err := os.Open(path)
+	b, err := state.Events.Read()
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
-	defer f.Close()
 
 	var out []Event
-	sc := bufio.NewScanner(f)
+	sc := bufio.NewScanner(bytes.NewReader(b))
 	for sc.Scan() {
 		line := strings.TrimSpace(sc.Text())
 		if line == "" {
@@ -0,0 +1,298 @@
+// Package health runs application-level health checks against the local end
+// of a tunnel forward.
+//
+// A TCP dial only proves that ssh is listening on the local port; it says
+// nothing about the service on the far side. The checks here speak just
+// enough of each protocol to get a response from the remote service:
+//
+//	tcp       — connect only
+//	http(s)   — GET Path, compare status with ExpectStatus (default 2xx/3xx)
+//	postgres  — SSLRequest; any 'S' or 'N' reply means the server is alive
+//	redis     — PING; +PONG (or an auth error) means the server is alive
+//	mysql     — read the server greeting packet
+//	tls       — complete a TLS handshake
+//	command   — run argv locally; exit status 0 is healthy
+package health
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// DefaultTimeout bounds a single check when HealthCheck.TimeoutSeconds is unset.
+const DefaultTimeout = 3 * time.Second
+
+// Validate reports whether a check definition is usable. https and tls
+// checks connect to the local end of a forward, whose address is never the
+// name on the service's certificate, so they need server_name to verify
+// against or an explicit insecure_skip_verify.
+func Validate(check model.HealthCheck) error {
+	switch check.Type {
+	case model.HealthCheckTCP, model.HealthCheckHTTP,
+		model.HealthCheckPostgres, model.HealthCheckRedis, model.HealthCheckMySQL:
+		return nil
+	case model.HealthCheckHTTPS, model.HealthCheckTLS:
+		if strings.TrimSpace(check.ServerName) == "" && !check.InsecureSkipVerify {
+			return fmt.Errorf("%s health check requires server_name or insecure_skip_verify", check.Type)
+		}
+		return nil
+	case model.HealthCheckCommand:
+		if len(check.Command) == 0 || strings.TrimSpace(check.Command[0]) == "" {
+			return errors.New("command health check requires a non-empty command")
+		}
+		return nil
+	case "":
+		return errors.New("health check type is required")
+	default:
+		return fmt.Errorf("unknown health check type %q", check.Type)
+	}
+}
+
+// Timeout returns the effective timeout for check.
+func Timeout(check model.HealthCheck) time.Duration {
+	if check.TimeoutSeconds > 0 {
+		return time.Duration(check.TimeoutSeconds) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// Run executes check against the local endpoint addr ("host:port") and
+// returns the result. It never returns an error; failures are reported as
+// HealthUnhealthy with a message.
+func Run(ctx context.Context, check model.HealthCheck, addr string) model.HealthResult {
+	ctx, cancel := context.WithTimeout(ctx, Timeout(check))
+	defer cancel()
+
+	start := time.Now()
+	err := Validate(check)
+	if err == nil {
+		err = run(ctx, check, addr)
+	}
+	res := model.HealthResult{
+		Status:    model.HealthHealthy,
+		Check:     check.Type,
+		LatencyMS: time.Since(start).Milliseconds(),
+		CheckedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		res.Status = model.HealthUnhealthy
+		res.Message = err.Error()
+	}
+	return res
+}
+
+func run(ctx context.Context, check model.HealthCheck, addr string) error {
+	switch check.Type {
+	case model.HealthCheckTCP:
+		conn, err := dial(ctx, addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case model.HealthCheckHTTP, model.HealthCheckHTTPS:
+		return checkHTTP(ctx, check, addr)
+	case model.HealthCheckPostgres:
+		return checkPostgres(ctx, addr)
+	case model.HealthCheckRedis:
+		return checkRedis(ctx, addr)
+	case model.HealthCheckMySQL:
+		return checkMySQL(ctx, addr)
+	case model.HealthCheckTLS:
+		return checkTLS(ctx, check, addr)
+	case model.HealthCheckCommand:
+		return checkCommand(ctx, check, addr)
+	}
+	return fmt.Errorf("unknown health check type %q", check.Type)
+}
+
+func dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+func tlsConfig(check model.HealthCheck) *tls.Config {
+	return &tls.Config{
+		ServerName:         check.ServerName,
+		InsecureSkipVerify: check.InsecureSkipVerify,
+	}
+}
+
+func checkHTTP(ctx context.Context, check model.HealthCheck, addr string) error {
+	path := check.Path
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := fmt.Sprintf("%s://%s%s", check.Type, addr, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if check.ServerName != "" {
+		req.Host = check.ServerName
+	}
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig(check), DisableKeepAlives: true},
+		// Report redirects as-is instead of following them off the tunnel.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if check.ExpectStatus != 0 {
+		if resp.StatusCode != check.ExpectStatus {
+			return fmt.Errorf("http status %d, expected %d", resp.StatusCode, check.ExpectStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkPostgres sends an SSLRequest, which every PostgreSQL server answers
+// with a single 'S' or 'N' byte before any authentication takes place.
+func checkPostgres(ctx context.Context, addr string) error {
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], 80877103)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("postgres: no SSLRequest reply: %w", err)
+	}
+	switch reply[0] {
+	case 'S', 'N':
+		return nil
+	case 'E':
+		return errors.New("postgres: server returned an error")
+	default:
+		return fmt.Errorf("postgres: unexpected reply byte 0x%02x", reply[0])
+	}
+}
+
+// checkRedis sends PING. An authentication error still proves the server is
+// answering, so NOAUTH/WRONGPASS replies count as healthy.
+func checkRedis(ctx context.Context, addr string) error {
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("redis: no PING reply: %w", err)
+	}
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "+PONG":
+		return nil
+	case strings.HasPrefix(line, "-NOAUTH"), strings.HasPrefix(line, "-WRONGPASS"):
+		return nil
+	default:
+		return fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// checkMySQL reads the initial handshake packet the server sends on connect.
+func checkMySQL(ctx context.Context, addr string) error {
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("mysql: no greeting: %w", err)
+	}
+	size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if size == 0 {
+		return errors.New("mysql: empty greeting")
+	}
+	if size > 64*1024 {
+		size = 64 * 1024
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return fmt.Errorf("mysql: short greeting: %w", err)
+	}
+	switch payload[0] {
+	case 10, 9:
+		return nil
+	case 0xff:
+		msg := ""
+		if len(payload) > 3 {
+			msg = strings.TrimSpace(string(payload[3:]))
+		}
+		return fmt.Errorf("mysql: server error %s", msg)
+	default:
+		return fmt.Errorf("mysql: unexpected protocol version %d", payload[0])
+	}
+}
+
+func checkTLS(ctx context.Context, check model.HealthCheck, addr string) error {
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	tc := tls.Client(conn, tlsConfig(check))
+	defer tc.Close()
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	return nil
+}
+
+func checkCommand(ctx context.Context, check model.HealthCheck, addr string) error {
+	host, port, _ := net.SplitHostPort(addr)
+	cmd := exec.CommandContext(ctx, check.Command[0], check.Command[1:]...)
+	cmd.Env = append(os.Environ(), "SSHM_LOCAL_HOST="+host, "SSHM_LOCAL_PORT="+port, "SSHM_LOCAL_ADDR="+addr)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if len(msg) > 200 {
+			msg = msg[:200]
+		}
+		if msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// serveOnce accepts one connection and hands it to fn.
+func serveOnce(t *testing.T, fn func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fn(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestHTTPCheckExpectStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	res := Run(context.Background(), model.HealthCheck{Type: model.HealthCheckHTTP, Path: "/healthz", ExpectStatus: 204}, addr)
+	if res.Status != model.HealthHealthy {
+		t.Fatalf("expected healthy, got %+v", res)
+	}
+	res = Run(context.Background(), model.HealthCheck{Type: model.HealthCheckHTTP, Path: "/"}, addr)
+	if res.Status != model.HealthUnhealthy || !strings.Contains(res.Message, "503") {
+		t.Fatalf("expected unhealthy 503, got %+v", res)
+	}
+}
+
+func TestPostgresCheck(t *testing.T) {
+	addr := serveOnce(t, func(c net.Conn) {
+		buf := make([]byte, 8)
+		if _, err := c.Read(buf); err == nil {
+			_, _ = c.Write([]byte("N"))
+		}
+	})
+	if res := Run(context.Background(), model.HealthCheck{Type: model.HealthCheckPostgres}, addr); res.Status != model.HealthHealthy {
+		t.Fatalf("expected healthy, got %+v", res)
+	}
+}
+
+func TestRedisCheck(t *testing.T) {
+	addr := serveOnce(t, func(c net.Conn) {
+		buf := make([]byte, 64)
+		if _, err := c.Read(buf); err == nil {
+			_, _ = c.Write([]byte("+PONG\r\n"))
+		}
+	})
+	if res := Run(context.Background(), model.HealthCheck{Type: model.HealthCheckRedis}, addr); res.Status != model.HealthHealthy {
+		t.Fatalf("expected healthy, got %+v", res)
+	}
+
+	addr = serveOnce(t, func(c net.Conn) {
+		buf := make([]byte, 64)
+		if _, err := c.Read(buf); err == nil {
+			_, _ = c.Write([]byte("-ERR unknown command\r\n"))
+		}
+	})
+	if res := Run(context.Background(), model.HealthCheck{Type: model.HealthCheckRedis}, addr); res.Status != model.HealthUnhealthy {
+		t.Fatalf("expected unhealthy, got %+v", res)
+	}
+}
+
+func TestMySQLCheck(t *testing.T) {
+	addr := serveOnce(t, func(c net.Conn) {
+		payload := append([]byte{10}, []byte("8.0.36\x00")...)
+		_, _ = c.Write(append([]byte{byte(len(payload)), 0, 0, 0}, payload...))
+	})
+	if res := Run(context.Background(), model.HealthCheck{Type: model.HealthCheckMySQL}, addr); res.Status != model.HealthHealthy {
+		t.Fatalf("expected healthy, got %+v", res)
+	}
+}
+
+func TestCommandCheck(t *testing.T) {
+	ok := model.HealthCheck{Type: model.HealthCheckCommand, Command: []string{"sh", "-c", `test "$SSHM_LOCAL_PORT" = 5432`}}
+	if res := Run(context.Background(), ok, "127.0.0.1:5432"); res.Status != model.HealthHealthy {
+		t.Fatalf("expected healthy, got %+v", res)
+	}
+	if res := Run(context.Background(), ok, "127.0.0.1:6543"); res.Status != model.HealthUnhealthy {
+		t.Fatalf("expected unhealthy, got %+v", res)
+	}
+}
+
+func TestValidateRejectsUnknownType(t *testing.T) {
+	if err := Validate(model.HealthCheck{Type: "ftp"}); err == nil {
+		t.Fatal("expected error for unknown type")
+	}
+	if err := Validate(model.HealthCheck{Type: model.HealthCheckCommand}); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+	if err := Validate(model.HealthCheck{Type: model.HealthCheckHTTPS}); err == nil {
+		t.Fatal("expected error for https without server_name")
+	}
+	if err := Validate(model.HealthCheck{Type: model.HealthCheckTLS, ServerName: "db.example.com"}); err != nil {
+		t.Fatalf("expected tls with server_name accepted, got %v", err)
+	}
+	if err := Validate(model.HealthCheck{Type: model.HealthCheckHTTPS, InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("expected https with insecure_skip_verify accepted, got %v", err)
+	}
+}
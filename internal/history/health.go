@@ -0,0 +1,139 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/state"
+)
+
+// MaxHealthRecords is how many health checks are kept per host.
+const MaxHealthRecords = 20
+
+// maxHealthSummary bounds HealthRecord.Summary.
+const maxHealthSummary = 120
+
+// HealthRecord is one run of a host's health command.
+type HealthRecord struct {
+	At        int64  `json:"at"`
+	Command   string `json:"command"`
+	ExitCode  int    `json:"exit_code"`
+	LatencyMS int64  `json:"latency_ms"`
+
+	// Summary is the first line of output (stderr when the check failed),
+	// or why the command did not run.
+	Summary string `json:"summary,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	// ErrorCode classifies an ssh failure of the check (e.g.
+	// "host_key_changed"); see sshclient.ErrorCode.
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// OK reports whether the health command ran and exited 0.
+func (r HealthRecord) OK() bool {
+	return r.ExitCode == 0 && r.Error == ""
+}
+
+// Label renders the record for tables: "ok 42ms", "fail(3)" or "-".
+func (r HealthRecord) Label() string {
+	switch {
+	case r.At == 0:
+		return "-"
+	case r.OK():
+		return "ok " + (time.Duration(r.LatencyMS) * time.Millisecond).String()
+	case r.ExitCode < 0:
+		return "fail"
+	default:
+		return "fail(" + strconv.Itoa(r.ExitCode) + ")"
+	}
+}
+
+// HealthSummary returns the first non-empty line of output, shortened for
+// display.
+func HealthSummary(output string) string {
+	for line := range strings.Lines(output) {
+		if line = strings.TrimSpace(line); line != "" {
+			if len(line) > maxHealthSummary {
+				line = line[:maxHealthSummary-3] + "..."
+			}
+			return line
+		}
+	}
+	return ""
+}
+
+// healthStore is the on-disk layout of host_health.json (see
+// state.HostHealth). Each host's records are oldest first.
+type healthStore struct {
+	Version int                       `json:"version"`
+	Hosts   map[string][]HealthRecord `json:"hosts"`
+}
+
+// RecordHealth appends one health record per host alias, keeping the last
+// MaxHealthRecords of each host.
+func RecordHealth(records map[string]HealthRecord) error {
+	st, err := loadHealth()
+	if err != nil {
+		return err
+	}
+	for alias, rec := range records {
+		recs := append(st.Hosts[alias], rec)
+		if len(recs) > MaxHealthRecords {
+			recs = recs[len(recs)-MaxHealthRecords:]
+		}
+		st.Hosts[alias] = recs
+	}
+	st.Version = state.HostHealth.Current
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.HostHealth.Write(b)
+}
+
+// HealthHistory returns the recorded health checks by host alias, oldest
+// first.
+func HealthHistory() (map[string][]HealthRecord, error) {
+	st, err := loadHealth()
+	if err != nil {
+		return nil, err
+	}
+	return st.Hosts, nil
+}
+
+// LatestHealth returns the most recent health check of each host.
+func LatestHealth() (map[string]HealthRecord, error) {
+	st, err := loadHealth()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]HealthRecord, len(st.Hosts))
+	for alias, recs := range st.Hosts {
+		if len(recs) > 0 {
+			out[alias] = recs[len(recs)-1]
+		}
+	}
+	return out, nil
+}
+
+func loadHealth() (healthStore, error) {
+	b, err := state.HostHealth.Read()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return healthStore{Hosts: map[string][]HealthRecord{}}, nil
+		}
+		return healthStore{}, err
+	}
+	var st healthStore
+	if err := json.Unmarshal(b, &st); err != nil {
+		return healthStore{Hosts: map[string][]HealthRecord{}}, nil
+	}
+	if st.Hosts == nil {
+		st.Hosts = map[string][]HealthRecord{}
+	}
+	return st, nil
+}
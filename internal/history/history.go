@@ -3,26 +3,19 @@ package history
 import (
 	"encoding/json"
 	"os"
-	"path/filepath"
 	"sort"
 	"time"
 
-	"github.com/treykane/ssh-manager/internal/appconfig"
 	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/state"
 )
 
+// store is the on-disk layout of history.json (see state.History).
 type store struct {
+	Version  int              `json:"version"`
 	LastUsed map[string]int64 `json:"last_used"`
 }
 
-func filePath() (string, error) {
-	dir, err := appconfig.ConfigDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(dir, "history.json"), nil
-}
-
 // Touch records successful activity for a host alias.
 func Touch(alias string) error {
 	st, err := load()
@@ -60,11 +53,7 @@ func SortHostsRecent(hosts []model.HostEntry, lastUsed map[string]int64) []model
 }
 
 func load() (store, error) {
-	path, err := filePath()
-	if err != nil {
-		return store{}, err
-	}
-	b, err := os.ReadFile(path)
+	b, err := state.History.Read()
 	if err != nil {
 		if os.IsNotExist(err) {
 			return store{LastUsed: map[string]int64{}}, nil
@@ -82,16 +71,10 @@ func load() (store, error) {
 }
 
 func save(st store) error {
-	path, err := filePath()
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
-		return err
-	}
+	st.Version = state.History.Current
 	b, err := json.MarshalIndent(st, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, 0o600)
+	return state.History.Write(b)
 }
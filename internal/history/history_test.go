@@ -1,6 +1,7 @@
 package history
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -36,3 +37,47 @@ func TestSortHostsRecent(t *testing.T) {
 		t.Fatalf("expected api first, got %s", sorted[0].Alias)
 	}
 }
+
+func TestRecordHealthKeepsRecentRecords(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for i := range MaxHealthRecords + 5 {
+		if err := RecordHealth(map[string]HealthRecord{
+			"api": {At: int64(i + 1), Command: "uptime", LatencyMS: int64(i)},
+		}); err != nil {
+			t.Fatalf("record health: %v", err)
+		}
+	}
+	if err := RecordHealth(map[string]HealthRecord{"db": {At: 1, ExitCode: 255, Summary: "Permission denied"}}); err != nil {
+		t.Fatalf("record health: %v", err)
+	}
+
+	all, err := HealthHistory()
+	if err != nil {
+		t.Fatalf("health history: %v", err)
+	}
+	if len(all["api"]) != MaxHealthRecords || all["api"][0].At != 6 {
+		t.Fatalf("expected the last %d api records, got %+v", MaxHealthRecords, all["api"])
+	}
+	latest, err := LatestHealth()
+	if err != nil {
+		t.Fatalf("latest health: %v", err)
+	}
+	if got := latest["api"].Label(); got != "ok 24ms" {
+		t.Fatalf("unexpected api label %q", got)
+	}
+	if got := latest["db"].Label(); got != "fail(255)" {
+		t.Fatalf("unexpected db label %q", got)
+	}
+	if got := latest["cache"].Label(); got != "-" {
+		t.Fatalf("unexpected label for unchecked host %q", got)
+	}
+}
+
+func TestHealthSummary(t *testing.T) {
+	if got := HealthSummary("\n  10:00 up 3 days, load 0.1  \nmore\n"); got != "10:00 up 3 days, load 0.1" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+	if got := HealthSummary(strings.Repeat("x", 200)); len(got) != maxHealthSummary || !strings.HasSuffix(got, "...") {
+		t.Fatalf("expected a shortened summary, got %q", got)
+	}
+}
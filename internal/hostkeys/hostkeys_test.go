@@ -0,0 +1,153 @@
+package hostkeys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	keyA = "AAAAC3NzaC1lZDI1NTE5AAAAIEpUHHh5Drk3E7gbOpLSOLSt87EZk9A9SLumUVEWioWh"
+	fpA  = "SHA256:oo4vOoMQHoMIeRX/7Mjlu9UHMq4Qgn66+W6sfHT2/NE"
+	keyB = "AAAAC3NzaC1lZDI1NTE5AAAAIHAT2O6+8N9koRrzn95l6rSHBld1uNQI2cy+HkB5RJhY"
+	fpB  = "SHA256:N2ISS0PlHVSmAYksB0SU6DMSfhUj29DcW5/gWTnVP5g"
+)
+
+func TestParseAndMatch(t *testing.T) {
+	hashed, err := HashName("[db.internal]:2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Join([]string{
+		"# comment",
+		"api.example.com,10.0.0.5 ssh-ed25519 " + keyA + " ops@laptop",
+		"*.internal,!secret.internal ssh-ed25519 " + keyB,
+		hashed + " ssh-ed25519 " + keyB,
+		"@revoked * ssh-ed25519 " + keyB,
+		"not a key line",
+		"[cache.internal]:2222 ssh-ed25519 " + keyA,
+		"[*.internal]:22?? ssh-ed25519 " + keyA,
+		"",
+	}, "\n")
+	entries, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 6 {
+		t.Fatalf("expected 6 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Line != 2 || e.Fingerprint != fpA || e.Comment != "ops@laptop" || e.Hashed {
+		t.Fatalf("unexpected first entry: %+v", e)
+	}
+	if e := entries[2]; !e.Hashed || e.Fingerprint != fpB || e.String() != hashed+" ssh-ed25519 "+keyB {
+		t.Fatalf("unexpected hashed entry: %+v", e)
+	}
+	if entries[3].Marker != "@revoked" {
+		t.Fatalf("expected marker parsed, got %+v", entries[3])
+	}
+
+	cases := []struct {
+		entry int
+		host  string
+		port  int
+		want  bool
+	}{
+		{0, "API.example.com", 22, true},
+		{0, "10.0.0.5", 22, true},
+		{0, "api.example.com", 2222, false},
+		{1, "cache.internal", 22, true},
+		{1, "secret.internal", 22, false},
+		{2, "db.internal", 2222, true},
+		{2, "db.internal", 22, false},
+		{4, "cache.internal", 2222, true},
+		{4, "cache.internal", 22, false},
+		{4, "c", 2222, false},
+		{5, "db.internal", 2201, true},
+		{5, "db.internal", 22, false},
+		{5, "db.example.com", 2201, false},
+	}
+	for _, c := range cases {
+		if got := entries[c.entry].Matches(c.host, c.port); got != c.want {
+			t.Errorf("entry %d matches %s:%d = %v, want %v", c.entry, c.host, c.port, got, c.want)
+		}
+	}
+}
+
+func TestRemoveKeepsBackupAndMarkers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	content := "api.example.com ssh-ed25519 " + keyA + "\n" +
+		"other.example.com ssh-ed25519 " + keyB + "\n" +
+		"@cert-authority api.example.com ssh-ed25519 " + keyB + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	removed, backup, err := Remove(path, "api.example.com", 22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].Line != 1 || removed[0].Fingerprint != fpA {
+		t.Fatalf("unexpected removed entries: %+v", removed)
+	}
+	if b, err := os.ReadFile(backup); err != nil || string(b) != content {
+		t.Fatalf("expected backup of the original file, got %q (%v)", b, err)
+	}
+	left, err := Read(path)
+	if err != nil || len(left) != 2 || left[0].Hosts != "other.example.com" || left[1].Marker != "@cert-authority" {
+		t.Fatalf("unexpected remaining entries: %+v (%v)", left, err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected permissions kept, got %v (%v)", fi, err)
+	}
+
+	if err := Append(path, []Entry{{Hosts: "api.example.com", KeyType: "ssh-ed25519", Key: keyB}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Lookup(path, "api.example.com", 22)
+	if err != nil || len(got) != 2 || got[1].Marker != "" || got[1].Fingerprint != fpB || got[1].Line != 3 {
+		t.Fatalf("unexpected entries after append: %+v (%v)", got, err)
+	}
+
+	// A plain entry for a non-standard port is written "[host]:port".
+	if err := Append(path, []Entry{{Hosts: Name("db.internal", 2222), KeyType: "ssh-ed25519", Key: keyA}}); err != nil {
+		t.Fatal(err)
+	}
+	removed, _, err = Remove(path, "db.internal", 2222)
+	if err != nil || len(removed) != 1 || removed[0].Hosts != "[db.internal]:2222" {
+		t.Fatalf("expected port 2222 entry removed, got %+v (%v)", removed, err)
+	}
+}
+
+func TestPinsAndVerify(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := SetPins("api", []Pin{{KeyType: "ssh-ed25519", Fingerprint: fpA}}); err != nil {
+		t.Fatal(err)
+	}
+	pins, err := Pins()
+	if err != nil || len(pins["api"]) != 1 {
+		t.Fatalf("unexpected pins: %+v (%v)", pins, err)
+	}
+
+	a := Entry{KeyType: "ssh-ed25519", Fingerprint: fpA}
+	b := Entry{KeyType: "ssh-ed25519", Fingerprint: fpB}
+	rsa := Entry{KeyType: "ssh-rsa", Fingerprint: "SHA256:rsa"}
+	if status, _ := Verify(pins["api"], []Entry{a, rsa}); status != StatusOK {
+		t.Fatalf("expected ok with an unpinned key type, got %s", status)
+	}
+	if status, mismatched := Verify(pins["api"], []Entry{b}); status != StatusMismatch || len(mismatched) != 1 || mismatched[0] != fpB {
+		t.Fatalf("expected mismatch for a changed key, got %s %v", status, mismatched)
+	}
+	if status, _ := Verify(pins["api"], []Entry{rsa}); status != StatusMismatch {
+		t.Fatalf("expected mismatch when no key is pinned, got %s", status)
+	}
+	if status, _ := Verify(nil, []Entry{a}); status != StatusUnpinned {
+		t.Fatalf("expected unpinned, got %s", status)
+	}
+
+	if err := SetPins("api", nil); err != nil {
+		t.Fatal(err)
+	}
+	if pins, _ := Pins(); len(pins) != 0 {
+		t.Fatalf("expected host unpinned, got %+v", pins)
+	}
+}
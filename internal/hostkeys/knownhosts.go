@@ -0,0 +1,322 @@
+// Package hostkeys reads and edits OpenSSH known_hosts files, scans host
+// keys with ssh-keyscan and keeps pinned host key fingerprints per host
+// alias (host_key_pins.json).
+//
+// Only the user's known_hosts file is edited. Lines are matched the way ssh
+// looks a host up: by "host" for port 22 and "[host]:port" otherwise,
+// against plain, wildcard and hashed ("|1|salt|hash") host fields.
+package hostkeys
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is one key line of a known_hosts file.
+type Entry struct {
+	// Line is the 1-based line number in the file; 0 for scanned keys.
+	Line int `json:"line,omitempty"`
+
+	// Marker is "@cert-authority" or "@revoked" when the line has one.
+	Marker string `json:"marker,omitempty"`
+
+	// Hosts is the raw host field: comma-separated patterns, or one hashed
+	// name.
+	Hosts       string `json:"hosts"`
+	Hashed      bool   `json:"hashed"`
+	KeyType     string `json:"key_type"`
+	Key         string `json:"-"`
+	Comment     string `json:"comment,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// String renders e as a known_hosts line.
+func (e Entry) String() string {
+	fields := []string{e.Hosts, e.KeyType, e.Key}
+	if e.Marker != "" {
+		fields = append([]string{e.Marker}, fields...)
+	}
+	if e.Comment != "" {
+		fields = append(fields, e.Comment)
+	}
+	return strings.Join(fields, " ")
+}
+
+// DefaultPath returns the user's known_hosts file, ~/.ssh/known_hosts.
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// Name returns the name ssh looks host up by in known_hosts: the host
+// itself on port 22, "[host]:port" otherwise.
+func Name(host string, port int) string {
+	if port == 0 || port == 22 {
+		return host
+	}
+	return "[" + host + "]:" + strconv.Itoa(port)
+}
+
+// ParseLine parses one known_hosts line. It reports false for blank lines,
+// comments and lines it does not understand.
+func ParseLine(line string) (Entry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return Entry{}, false
+	}
+	var e Entry
+	if strings.HasPrefix(fields[0], "@") {
+		e.Marker = fields[0]
+		fields = fields[1:]
+	}
+	if len(fields) < 3 {
+		return Entry{}, false
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		return Entry{}, false
+	}
+	e.Hosts = fields[0]
+	e.Hashed = strings.HasPrefix(e.Hosts, "|1|")
+	e.KeyType = fields[1]
+	e.Key = fields[2]
+	e.Comment = strings.Join(fields[3:], " ")
+	e.Fingerprint = Fingerprint(blob)
+	return e, true
+}
+
+// Parse returns the key lines of a known_hosts file.
+func Parse(r io.Reader) ([]Entry, error) {
+	var out []Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		if e, ok := ParseLine(sc.Text()); ok {
+			e.Line = n
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
+
+// Read returns the key lines of the known_hosts file at path; none when it
+// does not exist.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Lookup returns the entries of the known_hosts file at path that apply to
+// host on port.
+func Lookup(path, host string, port int) ([]Entry, error) {
+	all, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []Entry
+	for _, e := range all {
+		if e.Matches(host, port) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// Matches reports whether e applies to host on port. Like ssh, a matching
+// negated pattern ("!name") excludes the host.
+func (e Entry) Matches(host string, port int) bool {
+	name := Name(host, port)
+	if e.Hashed {
+		return hashedMatch(e.Hosts, name)
+	}
+	matched := false
+	for _, pattern := range strings.Split(e.Hosts, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if !wildcardMatch(strings.ToLower(pattern), strings.ToLower(name)) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// wildcardMatch matches name against a known_hosts host pattern the way ssh
+// does: "*" matches any run of characters and "?" any one character.
+// Everything else, including the brackets of "[host]:port", is literal.
+func wildcardMatch(pattern, name string) bool {
+	// Backtracking over the last "*" is enough for patterns with only "*"
+	// and "?" wildcards.
+	p, n := 0, 0
+	star, resume := -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case p < len(pattern) && pattern[p] == '*':
+			star, resume = p, n
+			p++
+		case star >= 0:
+			resume++
+			p, n = star+1, resume
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// hashedMatch checks name against a "|1|salt|hash" host field, where hash
+// is HMAC-SHA1 of the name keyed with salt.
+func hashedMatch(field, name string) bool {
+	parts := strings.Split(field, "|")
+	if len(parts) != 4 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// HashName hashes name the way "ssh-keygen -H" and HashKnownHosts do, with
+// a random salt, for a host field that does not reveal the host.
+func HashName(name string) (string, error) {
+	salt := make([]byte, sha1.Size)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Fingerprint returns the SHA256 fingerprint of a public key blob as ssh
+// prints it ("SHA256:" and unpadded base64).
+func Fingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Remove deletes the lines of the known_hosts file at path that apply to
+// host on port, after copying the file to a timestamped backup next to
+// it. @cert-authority and @revoked lines are kept. It returns the removed
+// entries and the backup path; nothing is written when no line matches.
+func Remove(path, host string, port int) ([]Entry, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var kept bytes.Buffer
+	var removed []Entry
+	for n, line := range strings.SplitAfter(string(b), "\n") {
+		if e, ok := ParseLine(line); ok && e.Marker == "" && e.Matches(host, port) {
+			e.Line = n + 1
+			removed = append(removed, e)
+			continue
+		}
+		kept.WriteString(line)
+	}
+	if len(removed) == 0 {
+		return nil, "", nil
+	}
+	backup := path + "." + time.Now().Format("20060102-150405") + ".bak"
+	if err := os.WriteFile(backup, b, fi.Mode().Perm()); err != nil {
+		return nil, "", fmt.Errorf("back up %s: %w", path, err)
+	}
+	if err := writeAtomic(path, kept.Bytes(), fi.Mode().Perm()); err != nil {
+		return nil, backup, err
+	}
+	return removed, backup, nil
+}
+
+// Append adds entries to the known_hosts file at path, creating it (and
+// ~/.ssh) when needed.
+func Append(path string, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var buf bytes.Buffer
+	if len(b) > 0 && !bytes.HasSuffix(b, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	for _, e := range entries {
+		buf.WriteString(e.String() + "\n")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	return errors.Join(err, f.Close())
+}
+
+// writeAtomic replaces path with b through a temporary file in the same
+// directory, so a failed write never leaves a truncated known_hosts.
+func writeAtomic(path string, b []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,74 @@
+package hostkeys
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+
+	"github.com/treykane/ssh-manager/internal/state"
+)
+
+// Pin is a host key fingerprint a host is expected to present.
+type Pin struct {
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint"`
+	PinnedAt    int64  `json:"pinned_at"`
+}
+
+// pinStore is the on-disk layout of host_key_pins.json (see
+// state.HostKeyPins).
+type pinStore struct {
+	Version int              `json:"version"`
+	Hosts   map[string][]Pin `json:"hosts"`
+}
+
+// Pins returns the pinned fingerprints by host alias.
+func Pins() (map[string][]Pin, error) {
+	st, err := loadPins()
+	if err != nil {
+		return nil, err
+	}
+	return st.Hosts, nil
+}
+
+// SetPins replaces the pins of host alias. No pins unpins the host.
+func SetPins(alias string, pins []Pin) error {
+	st, err := loadPins()
+	if err != nil {
+		return err
+	}
+	if len(pins) == 0 {
+		delete(st.Hosts, alias)
+	} else {
+		st.Hosts[alias] = pins
+	}
+	st.Version = state.HostKeyPins.Current
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.HostKeyPins.Write(b)
+}
+
+// Pinned reports whether fingerprint is one of pins.
+func Pinned(pins []Pin, fingerprint string) bool {
+	return slices.ContainsFunc(pins, func(p Pin) bool { return p.Fingerprint == fingerprint })
+}
+
+func loadPins() (pinStore, error) {
+	b, err := state.HostKeyPins.Read()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pinStore{Hosts: map[string][]Pin{}}, nil
+		}
+		return pinStore{}, err
+	}
+	var st pinStore
+	if err := json.Unmarshal(b, &st); err != nil {
+		return pinStore{}, err
+	}
+	if st.Hosts == nil {
+		st.Hosts = map[string][]Pin{}
+	}
+	return st, nil
+}
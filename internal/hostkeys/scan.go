@@ -0,0 +1,83 @@
+package hostkeys
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// ScanTimeoutSeconds bounds ssh-keyscan's wait for a host.
+const ScanTimeoutSeconds = 5
+
+// EnsureKeyscanBinary checks that ssh-keyscan is on PATH.
+func EnsureKeyscanBinary() error {
+	if _, err := exec.LookPath("ssh-keyscan"); err != nil {
+		return fmt.Errorf("ssh-keyscan binary not found in PATH")
+	}
+	return nil
+}
+
+// Target returns the host name and port ssh connects host with, which is
+// what its known_hosts entries are keyed by.
+func Target(host model.HostEntry) (string, int) {
+	name := host.HostName
+	if name == "" {
+		name = host.Alias
+	}
+	port := host.Port
+	if port == 0 {
+		port = 22
+	}
+	return name, port
+}
+
+// ScanCommand returns the ssh-keyscan command for host, optionally limited
+// to key types (e.g. "ed25519"):
+//
+//	ssh-keyscan -T 5 [-p port] [-t types] <hostname>
+//
+// Hosts reached through ProxyJump cannot be scanned directly, since
+// ssh-keyscan has no jump host support.
+func ScanCommand(ctx context.Context, host model.HostEntry, types []string) (*exec.Cmd, error) {
+	if host.ProxyJump != "" {
+		return nil, fmt.Errorf("%s is reached through ProxyJump %s; ssh-keyscan cannot scan it", host.Alias, host.ProxyJump)
+	}
+	name, port := Target(host)
+	args := []string{"-T", strconv.Itoa(ScanTimeoutSeconds)}
+	if port != 22 {
+		args = append(args, "-p", strconv.Itoa(port))
+	}
+	if len(types) > 0 {
+		args = append(args, "-t", strings.Join(types, ","))
+	}
+	args = append(args, name)
+	return exec.CommandContext(ctx, "ssh-keyscan", args...), nil
+}
+
+// Scan runs ssh-keyscan against host and returns the keys it presents, in
+// known_hosts form.
+func Scan(ctx context.Context, host model.HostEntry, types []string) ([]Entry, error) {
+	cmd, err := ScanCommand(ctx, host, types)
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("ssh-keyscan %s: %w: %s", host.Alias, err, strings.TrimSpace(stderr.String()))
+	}
+	keys, _ := Parse(bytes.NewReader(out))
+	for i := range keys {
+		keys[i].Line = 0
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("ssh-keyscan %s: no host keys returned", host.Alias)
+	}
+	return keys, nil
+}
@@ -0,0 +1,41 @@
+package hostkeys
+
+import "slices"
+
+// Verification statuses.
+const (
+	// StatusOK: the keys agree with the host's pins.
+	StatusOK = "ok"
+	// StatusMismatch: a key of a pinned type is not pinned, or no key
+	// matches a pin.
+	StatusMismatch = "mismatch"
+	// StatusUnpinned: the host has no pins to compare with.
+	StatusUnpinned = "unpinned"
+	// StatusError: the keys could not be read.
+	StatusError = "error"
+)
+
+// Verify compares the keys a host presents (or known_hosts holds for it)
+// with its pins. It returns the status and the fingerprints that are not
+// pinned although their key type is. Keys of types without a pin are
+// ignored, but at least one key must match a pin.
+func Verify(pins []Pin, keys []Entry) (string, []string) {
+	if len(pins) == 0 {
+		return StatusUnpinned, nil
+	}
+	var mismatched []string
+	matched := false
+	for _, k := range keys {
+		if Pinned(pins, k.Fingerprint) {
+			matched = true
+			continue
+		}
+		if slices.ContainsFunc(pins, func(p Pin) bool { return p.KeyType == k.KeyType }) {
+			mismatched = append(mismatched, k.Fingerprint)
+		}
+	}
+	if len(mismatched) > 0 || !matched {
+		return StatusMismatch, mismatched
+	}
+	return StatusOK, nil
+}
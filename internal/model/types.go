@@ -11,7 +11,10 @@
 // between the packages that produce and consume them.
 package model
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
 // ForwardSpec defines a single local-to-remote SSH port forwarding rule.
 // It corresponds to an OpenSSH "LocalForward" directive, which binds a local
@@ -51,6 +54,15 @@ func (f ForwardSpec) LocalString() string {
 	return f.LocalAddr
 }
 
+// LocalPortString returns the local port for display, or "auto" when the port
+// is allocated by ssh-manager at start.
+func (f ForwardSpec) LocalPortString() string {
+	if f.LocalPort == 0 {
+		return "auto"
+	}
+	return strconv.Itoa(f.LocalPort)
+}
+
 // RemoteString returns a human-readable remote address string for display purposes.
 // Returns "localhost" as a fallback if RemoteAddr is empty.
 func (f ForwardSpec) RemoteString() string {
@@ -126,6 +138,9 @@ func (h HostEntry) DisplayTarget() string {
 //	                        \-> TunnelError (on start failure)
 //	              TunnelUp --\-> TunnelError (on unexpected process exit)
 //	              TunnelUp --\-> TunnelDown  (on clean process exit)
+//
+// On-demand tunnels start in TunnelArmed and move to TunnelStarting when the
+// first client connects, then back to TunnelArmed after an idle period.
 type TunnelState string
 
 const (
@@ -156,6 +171,11 @@ const (
 	// TunnelQuarantined indicates a runtime entry was restored from disk but
 	// could not be confidently matched to a managed ssh process.
 	TunnelQuarantined TunnelState = "quarantined"
+
+	// TunnelArmed indicates an on-demand tunnel whose local port is held by
+	// ssh-manager while no ssh process runs. The first client connection
+	// starts ssh; the tunnel returns here after the idle timeout.
+	TunnelArmed TunnelState = "armed"
 )
 
 // TunnelRuntime tracks the runtime state of an active or historical SSH tunnel.
@@ -191,6 +211,13 @@ type TunnelRuntime struct {
 	// Set to 0 when the tunnel is not running.
 	PID int `json:"pid,omitempty"`
 
+	// Argv and ProcStart identify the process behind PID: the exact argv it
+	// runs and, on Linux, its start time in clock ticks since boot (from
+	// /proc/<pid>/stat). A PID whose process does not match them may have
+	// been reused and is never signalled.
+	Argv      []string `json:"argv,omitempty"`
+	ProcStart uint64   `json:"proc_start,omitempty"`
+
 	// State is the current lifecycle state of this tunnel (down/starting/up/error/stopping).
 	State TunnelState `json:"state"`
 
@@ -212,7 +239,145 @@ type TunnelRuntime struct {
 	// has occurred.
 	LastError string `json:"last_error,omitempty"`
 
+	// ErrorCode classifies the most relevant ssh stderr failure for this
+	// tunnel (e.g. "auth_failed", "port_in_use"); see sshclient.ErrorCode.
+	// Empty when ssh has not reported a recognised failure.
+	ErrorCode string `json:"error_code,omitempty"`
+
+	// OnDemand marks a tunnel whose local listener is owned by ssh-manager
+	// and whose ssh process only runs while clients are connected.
+	OnDemand bool `json:"on_demand,omitempty"`
+
+	// IdleTimeoutSec is how long a tunnel may go without client connections.
+	// An on-demand tunnel then stops ssh and re-arms; any other tunnel is
+	// stopped.
+	IdleTimeoutSec int64 `json:"idle_timeout_seconds,omitempty"`
+
+	// TTLSec is the maximum lifetime the tunnel was started with, and
+	// ExpiresAt the moment it is stopped (zero when no TTL applies).
+	TTLSec    int64     `json:"ttl_seconds,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+	// LastActiveAt is when a client connection through the local port was
+	// last seen; the idle timeout counts from it.
+	LastActiveAt time.Time `json:"last_active_at,omitzero"`
+
+	// RemainingSec is the time left until the TTL or idle timeout stops the
+	// tunnel, whichever comes first. Computed in Get() and Snapshot().
+	RemainingSec int64 `json:"remaining_seconds,omitempty"`
+
+	// Relay marks a tunnel whose local listener is owned by ssh-manager and
+	// relayed into ssh on the internal Backend address, so its client
+	// traffic can be counted.
+	Relay   bool   `json:"relay,omitempty"`
+	Backend string `json:"backend,omitempty"`
+
+	// Traffic holds the client counters of a relayed or on-demand tunnel.
+	// Nil for tunnels whose listener belongs to ssh.
+	Traffic *TrafficStats `json:"traffic,omitempty"`
+
+	// OwnerPID is the ssh-manager process holding an on-demand or relayed
+	// tunnel's listener. Other ssh-manager processes show the tunnel while
+	// the owner is alive but cannot stop it.
+	OwnerPID int `json:"owner_pid,omitempty"`
+
+	// AutoPort marks a tunnel whose local port was allocated by ssh-manager
+	// (Local holds the allocated address). RequestedLocalPort is the port the
+	// forward declared: 0 for "auto", or the busy port that --auto-port
+	// replaced.
+	AutoPort           bool `json:"auto_port,omitempty"`
+	RequestedLocalPort int  `json:"requested_local_port,omitempty"`
+
+	// Adopted marks a tunnel whose ssh process was started outside
+	// ssh-manager and imported with "tunnel adopt". Several adopted tunnels
+	// may share one process.
+	Adopted bool `json:"adopted,omitempty"`
+
+	// Multiplexed marks a tunnel whose forward was added to a shared
+	// ControlMaster connection (listening on ControlPath) rather than run by
+	// its own ssh; PID is then the master's, shared by the host's other
+	// multiplexed tunnels.
+	Multiplexed bool   `json:"multiplexed,omitempty"`
+	ControlPath string `json:"control_path,omitempty"`
+
+	// DependsOn lists the runtime IDs of the tunnels this one was started
+	// through. Stopping or restarting any of them cascades to this tunnel.
+	DependsOn []string `json:"depends_on,omitempty"`
+
 	// StatusMsg is a transient human-readable status message for UI display.
 	// Not persisted to JSON.
 	StatusMsg string `json:"-"`
+
+	// HealthCheck is the application-level check configured for this forward
+	// (from app config or a bundle entry). Nil when no check is configured.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+
+	// Health is the most recent application-level health check result. It is
+	// independent of State: a tunnel can be "up" while its remote service is
+	// unhealthy. Nil when no check is configured or the tunnel is not up.
+	Health *HealthResult `json:"health,omitempty"`
+}
+
+// TrafficStats counts client connections through a tunnel's listener.
+// BytesIn is client-to-remote traffic, BytesOut remote-to-client.
+type TrafficStats struct {
+	Connections int64 `json:"connections"`
+	Active      int64 `json:"active"`
+	BytesIn     int64 `json:"bytes_in"`
+	BytesOut    int64 `json:"bytes_out"`
+}
+
+// Health check types supported by HealthCheck.Type.
+const (
+	HealthCheckTCP      = "tcp"
+	HealthCheckHTTP     = "http"
+	HealthCheckHTTPS    = "https"
+	HealthCheckPostgres = "postgres"
+	HealthCheckRedis    = "redis"
+	HealthCheckMySQL    = "mysql"
+	HealthCheckTLS      = "tls"
+	HealthCheckCommand  = "command"
+)
+
+// HealthCheck describes an application-level probe run against the local end
+// of a forward. Only the fields relevant to Type are used.
+type HealthCheck struct {
+	// Type selects the probe: tcp, http, https, postgres, redis, mysql, tls, command.
+	Type string `yaml:"type" json:"type"`
+
+	// Path is the HTTP(S) request path. Defaults to "/".
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// ExpectStatus is the required HTTP status code. Zero accepts any 2xx/3xx.
+	ExpectStatus int `yaml:"expect_status,omitempty" json:"expect_status,omitempty"`
+
+	// ServerName is the TLS SNI / verification name for https and tls checks.
+	ServerName string `yaml:"server_name,omitempty" json:"server_name,omitempty"`
+
+	// InsecureSkipVerify disables TLS certificate verification.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+
+	// Command is the argv for command checks. It is executed directly (no
+	// shell) with SSHM_LOCAL_HOST and SSHM_LOCAL_PORT in the environment.
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+
+	// TimeoutSeconds bounds a single check. Zero uses the default (3s).
+	TimeoutSeconds int `yaml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"`
+}
+
+// HealthStatus is the outcome of an application-level health check.
+type HealthStatus string
+
+const (
+	HealthHealthy   HealthStatus = "healthy"
+	HealthUnhealthy HealthStatus = "unhealthy"
+)
+
+// HealthResult records one application-level health check run.
+type HealthResult struct {
+	Status    HealthStatus `json:"status"`
+	Check     string       `json:"check"`
+	Message   string       `json:"message,omitempty"`
+	LatencyMS int64        `json:"latency_ms"`
+	CheckedAt time.Time    `json:"checked_at"`
 }
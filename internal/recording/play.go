@@ -0,0 +1,69 @@
+package recording
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// PlayOptions controls playback.
+type PlayOptions struct {
+	// Speed scales playback; 2 plays twice as fast. Zero or less means 1.
+	Speed float64
+
+	// IdleLimit caps the pause between two events, so a session left idle
+	// does not stall playback. Zero keeps the recorded pauses.
+	IdleLimit time.Duration
+}
+
+// Play writes the output of the recording at path to w with its recorded
+// timing. Typed input is not replayed. It returns ctx.Err() when ctx ends
+// first.
+func Play(ctx context.Context, path string, w io.Writer, opts PlayOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if _, err := readHeader(r); err != nil {
+		return err
+	}
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var prev time.Duration
+	for {
+		ev, err := readEvent(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if ev.code != "o" {
+			continue
+		}
+		wait := ev.at - prev
+		prev = ev.at
+		if opts.IdleLimit > 0 {
+			wait = min(wait, opts.IdleLimit)
+		}
+		if wait > 0 {
+			timer.Reset(time.Duration(float64(wait) / speed))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if _, err := io.WriteString(w, ev.data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package recording writes interactive ssh sessions as asciicast v2 files
+// (https://docs.asciinema.org/manual/asciicast/v2/) and reads them back for
+// listing and playback.
+//
+// A recording is one JSON header line followed by one line per event:
+//
+//	{"version": 2, "width": 120, "height": 40, "timestamp": 1760000000, ...}
+//	[0.248501, "o", "Last login: ..."]
+//	[1.902113, "i", "l"]
+//
+// "o" events carry terminal output, "r" events terminal resizes and "i"
+// events typed input, which is only kept when recording.input asks for it. Recordings live under
+// <config dir>/recordings/<host alias>/ and are pruned by age when a new one
+// starts.
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+)
+
+// Header is the first line of an asciicast v2 file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder appends the events of one session to a .cast file. Its
+// writers never fail: once the file cannot be written the recording stops
+// and Close reports the error, so a full disk does not end the session.
+type Recorder struct {
+	mu    sync.Mutex
+	w     io.WriteCloser
+	start time.Time
+	input string
+	err   error
+
+	// tail holds the incomplete UTF-8 sequence a chunk ended in, per
+	// event code, until the next chunk completes it.
+	tail map[string][]byte
+}
+
+// Start creates a recording of a session to hostAlias with a width x
+// height terminal under Dir, first removing recordings older than
+// cfg.RetentionDays.
+func Start(cfg appconfig.RecordingConfig, hostAlias string, width, height int) (*Recorder, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.RetentionDays > 0 {
+		_, _ = Prune(dir, time.Duration(cfg.RetentionDays)*24*time.Hour)
+	}
+	hostDir := filepath.Join(dir, hostDirName(hostAlias))
+	if err := os.MkdirAll(hostDir, 0o700); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	f, err := createCast(hostDir, now)
+	if err != nil {
+		return nil, err
+	}
+	hdr := Header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: now.Unix(),
+		Title:     "ssh " + hostAlias,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	}
+	r, err := New(f, hdr, cfg.Input)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// New writes hdr to w and returns a recorder appending to it. input is a
+// recording.input mode (appconfig.RecordInputOff, ...).
+func New(w io.WriteCloser, hdr Header, input string) (*Recorder, error) {
+	b, err := json.Marshal(hdr)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return nil, fmt.Errorf("write recording header: %w", err)
+	}
+	return &Recorder{
+		w:     w,
+		start: time.Now(),
+		input: appconfig.NormalizeRecordInput(input),
+		tail:  map[string][]byte{},
+	}, nil
+}
+
+// Output returns a writer that records what it is given as terminal
+// output.
+func (r *Recorder) Output() io.Writer {
+	return eventWriter{r: r, code: "o"}
+}
+
+// Input returns a writer that records typed input as recording.input
+// says: not at all, masked, or as typed.
+func (r *Recorder) Input() io.Writer {
+	if r.input == appconfig.RecordInputOff {
+		return io.Discard
+	}
+	return eventWriter{r: r, code: "i"}
+}
+
+// Resize records that the terminal changed to cols x rows.
+func (r *Recorder) Resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close flushes any incomplete UTF-8 sequence and closes the file. It
+// returns the first error writing the recording hit.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, code := range []string{"o", "i"} {
+		if t := r.tail[code]; len(t) > 0 {
+			r.tail[code] = nil
+			r.writeEvent(code, string(t))
+		}
+	}
+	if err := r.w.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+type eventWriter struct {
+	r    *Recorder
+	code string
+}
+
+func (e eventWriter) Write(p []byte) (int, error) {
+	e.r.record(e.code, p)
+	return len(p), nil
+}
+
+func (r *Recorder) record(code string, p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := append(r.tail[code], p...)
+	b, r.tail[code] = splitUTF8(b)
+	if len(b) == 0 {
+		return
+	}
+	data := string(b)
+	if code == "i" && r.input == appconfig.RecordInputRedacted {
+		data = redact(data)
+	}
+	r.writeEvent(code, data)
+}
+
+// writeEvent appends one event line. Callers hold r.mu.
+func (r *Recorder) writeEvent(code, data string) {
+	if r.err != nil {
+		return
+	}
+	at := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	b, err := json.Marshal([]any{max(at, 0), code, data})
+	if err != nil {
+		r.err = err
+		return
+	}
+	if _, err := r.w.Write(append(b, '\n')); err != nil {
+		r.err = fmt.Errorf("write recording: %w", err)
+	}
+}
+
+// splitUTF8 splits b before a UTF-8 sequence it ends in the middle of.
+func splitUTF8(b []byte) (whole, rest []byte) {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if !utf8.RuneStart(b[len(b)-i]) {
+			continue
+		}
+		if !utf8.FullRune(b[len(b)-i:]) {
+			return b[:len(b)-i], append([]byte(nil), b[len(b)-i:]...)
+		}
+		break
+	}
+	return b, nil
+}
+
+// redact masks every typed character but line breaks, keeping the shape
+// and timing of the input without its content.
+func redact(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return r
+		}
+		return '*'
+	}, s)
+}
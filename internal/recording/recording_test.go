@@ -0,0 +1,151 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+)
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func decodeEvents(t *testing.T, b []byte) (Header, [][3]any) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	var hdr Header
+	if err := json.Unmarshal([]byte(lines[0]), &hdr); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	var events [][3]any
+	for _, l := range lines[1:] {
+		var ev [3]any
+		if err := json.Unmarshal([]byte(l), &ev); err != nil {
+			t.Fatalf("event %q: %v", l, err)
+		}
+		events = append(events, ev)
+	}
+	return hdr, events
+}
+
+func TestRecorderWritesAsciicast(t *testing.T) {
+	buf := nopCloser{&bytes.Buffer{}}
+	r, err := New(buf, Header{Version: 2, Width: 100, Height: 30, Timestamp: 1}, appconfig.RecordInputRedacted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	euro := []byte("€")
+	_, _ = r.Output().Write(append([]byte("price: "), euro[:1]...))
+	_, _ = r.Output().Write(euro[1:])
+	_, _ = r.Input().Write([]byte("hunter2\r"))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	hdr, events := decodeEvents(t, buf.Bytes())
+	if hdr.Version != 2 || hdr.Width != 100 || hdr.Height != 30 {
+		t.Fatalf("unexpected header: %+v", hdr)
+	}
+	want := [][2]string{{"o", "price: "}, {"o", "€"}, {"i", "*******\r"}}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), events)
+	}
+	for i, w := range want {
+		if events[i][1] != w[0] || events[i][2] != w[1] {
+			t.Fatalf("event %d: expected %v, got %v", i, w, events[i])
+		}
+	}
+}
+
+func TestRecorderInputOff(t *testing.T) {
+	buf := nopCloser{&bytes.Buffer{}}
+	r, err := New(buf, Header{Version: 2, Width: 80, Height: 24}, appconfig.RecordInputOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = r.Input().Write([]byte("secret\r"))
+	_, _ = r.Output().Write([]byte("$ "))
+	_ = r.Close()
+	if _, events := decodeEvents(t, buf.Bytes()); len(events) != 1 || events[0][1] != "o" {
+		t.Fatalf("expected only output recorded, got %v", events)
+	}
+}
+
+func TestStartListPlayAndPrune(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	r, err := Start(appconfig.RecordingConfig{RetentionDays: 30}, "prod/db", 120, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = r.Output().Write([]byte("hello "))
+	time.Sleep(20 * time.Millisecond)
+	_, _ = r.Output().Write([]byte("world\n"))
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := List(dir)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one recording, got %v (%v)", list, err)
+	}
+	info := list[0]
+	if info.Host != "prod/db" || !strings.HasPrefix(info.ID, "prod_db/") || info.Width != 120 || info.DurationMS < 20 {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if fi, err := os.Stat(info.Path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected private recording file, got %v (%v)", fi, err)
+	}
+	if found, err := Find(dir, info.ID); err != nil || found.Path != info.Path {
+		t.Fatalf("find %s: %+v (%v)", info.ID, found, err)
+	}
+
+	var out bytes.Buffer
+	if err := Play(context.Background(), info.Path, &out, PlayOptions{Speed: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello world\n" {
+		t.Fatalf("unexpected playback: %q", out.String())
+	}
+
+	old := time.Now().Add(-31 * 24 * time.Hour)
+	if err := os.Chtimes(info.Path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Prune(dir, 30*24*time.Hour); err != nil || n != 1 {
+		t.Fatalf("expected one recording pruned, got %d (%v)", n, err)
+	}
+	if _, err := os.Stat(filepath.Dir(info.Path)); !os.IsNotExist(err) {
+		t.Fatalf("expected empty host directory removed, got %v", err)
+	}
+}
+
+func TestPlayStopsWhenCancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.cast")
+	content := "{\"version\":2,\"width\":80,\"height\":24,\"timestamp\":1}\n[0.0,\"o\",\"a\"]\n[60.0,\"o\",\"b\"]\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	if err := Play(ctx, path, &out, PlayOptions{}); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if out.String() != "a" {
+		t.Fatalf("unexpected playback: %q", out.String())
+	}
+	if info, err := Stat(path); err != nil || info.DurationMS != 60000 {
+		t.Fatalf("unexpected stat: %+v (%v)", info, err)
+	}
+}
@@ -0,0 +1,234 @@
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+)
+
+// castExt is the file extension of recordings.
+const castExt = ".cast"
+
+// stampLayout names recordings by the local time they started.
+const stampLayout = "20060102-150405"
+
+// Info describes one recording.
+type Info struct {
+	// ID is "<host>/<started>", e.g. "api/20261018-152044".
+	ID      string    `json:"id"`
+	Host    string    `json:"host"`
+	Path    string    `json:"path"`
+	Started time.Time `json:"started"`
+
+	// DurationMS is the time of the last event.
+	DurationMS int64 `json:"duration_ms"`
+	Width      int   `json:"width"`
+	Height     int   `json:"height"`
+	Size       int64 `json:"size"`
+}
+
+// Dir returns the directory recordings are stored in.
+func Dir() (string, error) {
+	d, err := appconfig.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "recordings"), nil
+}
+
+// List returns the recordings in dir, newest first. Files that are not
+// readable asciicast v2 recordings are skipped.
+func List(dir string) ([]Info, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*"+castExt))
+	if err != nil {
+		return nil, err
+	}
+	var out []Info
+	for _, p := range paths {
+		info, err := Stat(p)
+		if err != nil {
+			continue
+		}
+		info.ID = filepath.Base(filepath.Dir(p)) + "/" + strings.TrimSuffix(filepath.Base(p), castExt)
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Started.Equal(out[j].Started) {
+			return out[i].Started.After(out[j].Started)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// Find returns the recording in dir with the given ID, or at the given
+// path.
+func Find(dir, idOrPath string) (Info, error) {
+	if strings.HasSuffix(idOrPath, castExt) {
+		if _, err := os.Stat(idOrPath); err == nil {
+			info, err := Stat(idOrPath)
+			info.ID = idOrPath
+			return info, err
+		}
+	}
+	list, err := List(dir)
+	if err != nil {
+		return Info{}, err
+	}
+	for _, info := range list {
+		if info.ID == idOrPath {
+			return info, nil
+		}
+	}
+	return Info{}, fmt.Errorf("recording %q not found", idOrPath)
+}
+
+// Stat reads the header and last event time of the recording at path.
+func Stat(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Info{}, err
+	}
+	r := bufio.NewReader(f)
+	hdr, err := readHeader(r)
+	if err != nil {
+		return Info{}, fmt.Errorf("%s: %w", path, err)
+	}
+	info := Info{
+		Host:    strings.TrimPrefix(hdr.Title, "ssh "),
+		Path:    path,
+		Started: time.Unix(hdr.Timestamp, 0),
+		Width:   hdr.Width,
+		Height:  hdr.Height,
+		Size:    fi.Size(),
+	}
+	if info.Host == "" {
+		info.Host = filepath.Base(filepath.Dir(path))
+	}
+	for {
+		ev, err := readEvent(r)
+		if err != nil {
+			break
+		}
+		info.DurationMS = ev.at.Milliseconds()
+	}
+	return info, nil
+}
+
+// Prune removes recordings in dir last written more than maxAge ago and
+// returns how many it removed.
+func Prune(dir string, maxAge time.Duration) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*"+castExt))
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	var errs []error
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil || !fi.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+		_ = os.Remove(filepath.Dir(p)) // only succeeds once the host has no recordings left
+	}
+	return removed, errors.Join(errs...)
+}
+
+// createCast creates a new recording file in dir named after started,
+// adding a counter when a session started in the same second.
+func createCast(dir string, started time.Time) (*os.File, error) {
+	base := started.Format(stampLayout)
+	name := base
+	for n := 2; ; n++ {
+		f, err := os.OpenFile(filepath.Join(dir, name+castExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if !os.IsExist(err) {
+			return f, err
+		}
+		name = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// hostDirName turns a host alias into a directory name.
+func hostDirName(alias string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, alias)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// event is one decoded asciicast event.
+type event struct {
+	at   time.Duration
+	code string
+	data string
+}
+
+func readHeader(r *bufio.Reader) (Header, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return Header{}, err
+	}
+	var hdr Header
+	if err := json.Unmarshal(line, &hdr); err != nil {
+		return Header{}, fmt.Errorf("parse header: %w", err)
+	}
+	if hdr.Version != 2 {
+		return Header{}, fmt.Errorf("unsupported asciicast version %d", hdr.Version)
+	}
+	return hdr, nil
+}
+
+// readEvent returns the next event of r, skipping blank lines. It returns
+// io.EOF at the end and stops at a line that is not an event, which is
+// what a recording cut off mid-write ends in.
+func readEvent(r *bufio.Reader) (event, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err != nil {
+				return event{}, err
+			}
+			continue
+		}
+		var raw [3]json.RawMessage
+		if jerr := json.Unmarshal(line, &raw); jerr != nil {
+			return event{}, fmt.Errorf("parse event: %w", jerr)
+		}
+		var ev event
+		var secs float64
+		if jerr := errors.Join(json.Unmarshal(raw[0], &secs), json.Unmarshal(raw[1], &ev.code), json.Unmarshal(raw[2], &ev.data)); jerr != nil {
+			return event{}, fmt.Errorf("parse event: %w", jerr)
+		}
+		ev.at = time.Duration(secs * float64(time.Second))
+		return ev, nil
+	}
+}
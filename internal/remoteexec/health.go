@@ -0,0 +1,64 @@
+package remoteexec
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/history"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+)
+
+// CheckHealth runs the health command of each host (see
+// appconfig.Config.HealthCommand), bounded by host_health.timeout_seconds,
+// and records the outcomes in the host health history. The records are
+// returned by host alias even when recording them fails.
+func CheckHealth(ctx context.Context, c Commander, cfg appconfig.Config, hosts []model.HostEntry) (map[string]history.HealthRecord, error) {
+	jobs := make([]Job, len(hosts))
+	for i, h := range hosts {
+		jobs[i] = Job{Host: h, Command: []string{cfg.HealthCommand(h.Alias)}}
+	}
+	now := time.Now().Unix()
+	results := RunJobs(ctx, c, jobs, Options{
+		Parallel: cfg.Exec.Parallel,
+		Timeout:  time.Duration(cfg.HostHealth.TimeoutSeconds) * time.Second,
+	})
+	records := make(map[string]history.HealthRecord, len(results))
+	for i, r := range results {
+		rec := history.HealthRecord{
+			At:        now,
+			Command:   jobs[i].Command[0],
+			ExitCode:  r.ExitCode,
+			LatencyMS: r.DurationMS,
+			Error:     r.Error,
+		}
+		switch {
+		case r.Error != "":
+			rec.Summary = r.Error
+		case r.OK():
+			rec.Summary = history.HealthSummary(r.Stdout)
+		default:
+			rec.Summary = history.HealthSummary(r.Stderr + "\n" + r.Stdout)
+			if code := fatalCode(r.Stderr); code != "" {
+				// ssh's own failure, e.g. a changed host key, whose first
+				// line is a banner rather than the cause.
+				rec.ErrorCode = string(code)
+				rec.Summary = code.Describe()
+			}
+		}
+		records[r.Host] = rec
+	}
+	return records, history.RecordHealth(records)
+}
+
+// fatalCode returns the first fatal ssh failure classified in stderr.
+func fatalCode(stderr string) sshclient.ErrorCode {
+	for line := range strings.Lines(stderr) {
+		if code := sshclient.ClassifyStderr(line); code.Fatal() {
+			return code
+		}
+	}
+	return ""
+}
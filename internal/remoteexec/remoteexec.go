@@ -0,0 +1,261 @@
+// Package remoteexec runs one command on many hosts at once through the
+// system ssh binary.
+//
+// Each host gets its own ssh process. At most Options.Parallel run at a
+// time and each is killed after Options.Timeout. Output can be streamed
+// line by line, prefixed with the host alias, while it is also captured
+// for the per-host Result.
+package remoteexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// Defaults used when Options leaves Parallel or Timeout unset.
+const (
+	DefaultParallel = 10
+	DefaultTimeout  = 60 * time.Second
+)
+
+// MaxCapture bounds the output kept per stream and host in a Result.
+// Streamed output is not limited.
+const MaxCapture = 1 << 20
+
+// Commander builds the ssh command that runs command on host
+// (*sshclient.Client does).
+type Commander interface {
+	ExecCommand(ctx context.Context, host model.HostEntry, command []string) *exec.Cmd
+}
+
+// Options controls a Run.
+type Options struct {
+	// Parallel is how many hosts run at once.
+	Parallel int
+
+	// Timeout bounds each host's command, including connecting. Zero
+	// means DefaultTimeout and a negative value no limit.
+	Timeout time.Duration
+
+	// Stdout and Stderr, when set, receive each host's output as it
+	// arrives, every line prefixed with the host alias.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// OnDone, when set, is called with each host's result as it finishes.
+	// Calls do not overlap each other or streamed lines.
+	OnDone func(Result)
+}
+
+// Result is the outcome of the command on one host.
+type Result struct {
+	Host string `json:"host"`
+
+	// ExitCode is the exit status of ssh: the remote command's, or 255 when
+	// ssh itself failed. It is -1 when ssh could not run or was killed.
+	ExitCode   int   `json:"exit_code"`
+	DurationMS int64 `json:"duration_ms"`
+	TimedOut   bool  `json:"timed_out,omitempty"`
+
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"`
+
+	// Error describes why ssh did not run to completion.
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether the command ran and exited 0.
+func (r Result) OK() bool {
+	return r.ExitCode == 0 && r.Error == ""
+}
+
+// Job is a command to run on one host.
+type Job struct {
+	Host    model.HostEntry
+	Command []string
+
+	// Build, when set, builds the process for Host instead of the
+	// Commander (for example scp for "cp"). Command is then unused.
+	Build func(ctx context.Context) *exec.Cmd
+}
+
+// Run runs command on every host and returns their results in the order of
+// hosts. Cancelling ctx kills the commands still running and skips the
+// hosts not yet started.
+func Run(ctx context.Context, c Commander, hosts []model.HostEntry, command []string, opts Options) []Result {
+	jobs := make([]Job, len(hosts))
+	for i, h := range hosts {
+		jobs[i] = Job{Host: h, Command: command}
+	}
+	return RunJobs(ctx, c, jobs, opts)
+}
+
+// RunJobs is Run for a command per host. c may be nil when every job sets
+// Build.
+func RunJobs(ctx context.Context, c Commander, jobs []Job, opts Options) []Result {
+	if opts.Parallel <= 0 {
+		opts.Parallel = DefaultParallel
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	width := 0
+	for _, j := range jobs {
+		width = max(width, len(j.Host.Alias))
+	}
+
+	var mu sync.Mutex // serializes streamed lines
+	results := make([]Result, len(jobs))
+	sem := make(chan struct{}, opts.Parallel)
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = Result{Host: j.Host.Alias, ExitCode: -1, Error: ctx.Err().Error()}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			prefix := fmt.Sprintf("%-*s | ", width, j.Host.Alias)
+			results[i] = runOne(ctx, c, j, opts, prefix, &mu)
+			if opts.OnDone != nil {
+				mu.Lock()
+				opts.OnDone(results[i])
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func runOne(ctx context.Context, c Commander, j Job, opts Options, prefix string, mu *sync.Mutex) Result {
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	res := Result{Host: j.Host.Alias}
+	stdout := &capture{limit: MaxCapture}
+	stderr := &capture{limit: MaxCapture}
+	outW, errW := io.Writer(stdout), io.Writer(stderr)
+	var streams []*lineWriter
+	if opts.Stdout != nil {
+		lw := &lineWriter{w: opts.Stdout, prefix: prefix, mu: mu}
+		streams = append(streams, lw)
+		outW = io.MultiWriter(stdout, lw)
+	}
+	if opts.Stderr != nil {
+		lw := &lineWriter{w: opts.Stderr, prefix: prefix, mu: mu}
+		streams = append(streams, lw)
+		errW = io.MultiWriter(stderr, lw)
+	}
+
+	var cmd *exec.Cmd
+	if j.Build != nil {
+		cmd = j.Build(ctx)
+	} else {
+		cmd = c.ExecCommand(ctx, j.Host, j.Command)
+	}
+	cmd.Stdout = outW
+	cmd.Stderr = errW
+	// A remote command that leaves a child holding the pipes open must not
+	// keep the host running past its timeout.
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	res.DurationMS = time.Since(start).Milliseconds()
+	for _, lw := range streams {
+		lw.flush()
+	}
+	res.Stdout, res.Stderr = stdout.String(), stderr.String()
+	res.Truncated = stdout.truncated || stderr.truncated
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		res.ExitCode = -1
+		res.TimedOut = true
+		res.Error = fmt.Sprintf("timed out after %s", opts.Timeout)
+	case ctx.Err() != nil:
+		res.ExitCode = -1
+		res.Error = ctx.Err().Error()
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		res.ExitCode = -1
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// capture keeps the first limit bytes written to it.
+type capture struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	if room := c.limit - c.buf.Len(); room < len(p) {
+		c.truncated = true
+		c.buf.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+func (c *capture) String() string { return c.buf.String() }
+
+// lineWriter writes complete lines to w, each prefixed with prefix. Lines
+// of all hosts share mu so that they never interleave.
+type lineWriter struct {
+	w      io.Writer
+	prefix string
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.emit(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush writes a final line that had no newline.
+func (l *lineWriter) flush() {
+	if len(l.buf) > 0 {
+		l.emit(string(l.buf))
+		l.buf = nil
+	}
+}
+
+func (l *lineWriter) emit(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintln(l.w, l.prefix+strings.TrimSuffix(line, "\r"))
+}
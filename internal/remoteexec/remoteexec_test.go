@@ -0,0 +1,134 @@
+package remoteexec
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/history"
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// shCommander runs each host's script locally with sh instead of ssh.
+type shCommander map[string]string
+
+func (s shCommander) ExecCommand(ctx context.Context, host model.HostEntry, command []string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", s[host.Alias])
+}
+
+func TestRunCollectsResultsAndPrefixesOutput(t *testing.T) {
+	c := shCommander{
+		"web1": "echo up; echo warn >&2",
+		"db":   "printf 'partial'; exit 3",
+		"slow": "sleep 5",
+	}
+	hosts := []model.HostEntry{{Alias: "web1"}, {Alias: "db"}, {Alias: "slow"}}
+	var stdout, stderr bytes.Buffer
+	results := Run(context.Background(), c, hosts, []string{"ignored"}, Options{
+		Parallel: 2,
+		Timeout:  300 * time.Millisecond,
+		Stdout:   &stdout,
+		Stderr:   &stderr,
+	})
+
+	if len(results) != 3 || results[0].Host != "web1" || results[1].Host != "db" || results[2].Host != "slow" {
+		t.Fatalf("results not in host order: %+v", results)
+	}
+	if !results[0].OK() || results[0].Stdout != "up\n" || results[0].Stderr != "warn\n" {
+		t.Fatalf("unexpected web1 result: %+v", results[0])
+	}
+	if results[1].OK() || results[1].ExitCode != 3 || results[1].Stdout != "partial" {
+		t.Fatalf("unexpected db result: %+v", results[1])
+	}
+	if !results[2].TimedOut || results[2].ExitCode != -1 || results[2].DurationMS >= 5000 {
+		t.Fatalf("expected slow to time out: %+v", results[2])
+	}
+
+	out := stdout.String()
+	if !strings.Contains(out, "web1 | up\n") || !strings.Contains(out, "db   | partial\n") {
+		t.Fatalf("unexpected streamed stdout:\n%s", out)
+	}
+	if !strings.Contains(stderr.String(), "web1 | warn\n") {
+		t.Fatalf("unexpected streamed stderr:\n%s", stderr.String())
+	}
+}
+
+func TestRunLimitsParallelism(t *testing.T) {
+	dir := t.TempDir()
+	// Each script records itself as running, fails if another host is
+	// running at the same time, and then removes its marker.
+	script := `for f in ` + dir + `/*.run; do [ -e "$f" ] && exit 9; done; touch ` + dir + `/$$.run; sleep 0.05; rm ` + dir + `/$$.run`
+	c := shCommander{"a": script, "b": script, "c": script}
+	hosts := []model.HostEntry{{Alias: "a"}, {Alias: "b"}, {Alias: "c"}}
+	for _, r := range Run(context.Background(), c, hosts, nil, Options{Parallel: 1}) {
+		if !r.OK() {
+			t.Fatalf("host %s ran concurrently or failed: %+v", r.Host, r)
+		}
+	}
+}
+
+func TestCaptureTruncates(t *testing.T) {
+	c := &capture{limit: 4}
+	c.Write([]byte("abc"))
+	c.Write([]byte("def"))
+	if c.String() != "abcd" || !c.truncated {
+		t.Fatalf("got %q truncated=%v", c.String(), c.truncated)
+	}
+}
+
+func TestCheckHealthRecordsHistory(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg := appconfig.Default()
+	cfg.HostHealth.Commands = map[string]string{"db": "pg_isready"}
+	c := shCommander{
+		"api": "echo ' 10:00 up 3 days'",
+		"db":  "echo 'no response' >&2; exit 2",
+		"web": "printf '@@@@@@\\n@ WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED! @\\n' >&2; exit 255",
+	}
+	var got []string
+	rec := recordingCommander{shCommander: c, mu: &sync.Mutex{}, got: &got}
+	records, err := CheckHealth(context.Background(), rec, cfg, []model.HostEntry{{Alias: "api"}, {Alias: "db"}, {Alias: "web"}})
+	if err != nil {
+		t.Fatalf("check health: %v", err)
+	}
+	slices.Sort(got)
+	if strings.Join(got, ",") != "api:uptime,db:pg_isready,web:uptime" {
+		t.Fatalf("unexpected health commands %v", got)
+	}
+	if !records["api"].OK() || records["api"].Summary != "10:00 up 3 days" || records["api"].Command != "uptime" {
+		t.Fatalf("unexpected api record: %+v", records["api"])
+	}
+	if records["db"].OK() || records["db"].ExitCode != 2 || records["db"].Summary != "no response" || records["db"].ErrorCode != "" {
+		t.Fatalf("unexpected db record: %+v", records["db"])
+	}
+	if web := records["web"]; web.ErrorCode != "host_key_changed" || web.Summary != "remote host key has changed" {
+		t.Fatalf("expected changed host key classified, got %+v", web)
+	}
+	latest, err := history.LatestHealth()
+	if err != nil {
+		t.Fatalf("latest health: %v", err)
+	}
+	if latest["db"].ExitCode != 2 || latest["api"].At == 0 {
+		t.Fatalf("records not persisted: %+v", latest)
+	}
+}
+
+// recordingCommander notes the command each host is asked to run.
+type recordingCommander struct {
+	shCommander
+	mu  *sync.Mutex
+	got *[]string
+}
+
+func (r recordingCommander) ExecCommand(ctx context.Context, host model.HostEntry, command []string) *exec.Cmd {
+	r.mu.Lock()
+	*r.got = append(*r.got, host.Alias+":"+strings.Join(command, " "))
+	r.mu.Unlock()
+	return r.shCommander.ExecCommand(ctx, host, command)
+}
@@ -0,0 +1,132 @@
+package sshclient
+
+import "strings"
+
+// ErrorCode is a stable, machine-readable classification of an ssh failure
+// reported on stderr. It is stored on tunnel runtimes and events so scripts
+// can react to the cause of a failure without parsing ssh's wording.
+type ErrorCode string
+
+// Error codes returned by ClassifyStderr.
+const (
+	// CodeAuthFailed: the server rejected every offered credential
+	// ("Permission denied (publickey)").
+	CodeAuthFailed ErrorCode = "auth_failed"
+
+	// CodeHostKeyChanged: the server's host key differs from known_hosts
+	// ("REMOTE HOST IDENTIFICATION HAS CHANGED").
+	CodeHostKeyChanged ErrorCode = "host_key_changed"
+
+	// CodeHostKeyUnverified: the host key could not be verified, e.g. an
+	// unknown host under StrictHostKeyChecking=yes.
+	CodeHostKeyUnverified ErrorCode = "host_key_unverified"
+
+	// CodePortInUse: ssh could not bind the local end of the forward
+	// ("bind: Address already in use").
+	CodePortInUse ErrorCode = "port_in_use"
+
+	// CodeBindFailed: ssh could not bind the local end of the forward for
+	// another reason, e.g. a privileged port ("bind [127.0.0.1]:80:
+	// Permission denied").
+	CodeBindFailed ErrorCode = "bind_failed"
+
+	// CodeDNSFailed: the ssh host name did not resolve.
+	CodeDNSFailed ErrorCode = "dns_failed"
+
+	// CodeConnectFailed: the TCP connection to the ssh server failed
+	// ("ssh: connect to host ... Connection refused").
+	CodeConnectFailed ErrorCode = "connect_failed"
+
+	// CodeConnectionClosed: an established ssh connection was dropped.
+	CodeConnectionClosed ErrorCode = "connection_closed"
+
+	// CodeRemoteConnectFailed: the server could not reach the forward's
+	// remote target ("connect_to localhost port 5432: failed").
+	CodeRemoteConnectFailed ErrorCode = "remote_connect_failed"
+
+	// CodeAdminProhibited: the server refused the forward
+	// ("administratively prohibited"), e.g. AllowTcpForwarding=no.
+	CodeAdminProhibited ErrorCode = "admin_prohibited"
+)
+
+// stderrSignatures maps ssh stderr fragments to error codes. Order matters:
+// channel failures mention "connect failed" too, so they are matched before
+// the generic connection errors, and a local bind failure can end in
+// "Permission denied", so the auth signatures are anchored on the list of
+// methods ssh prints after it.
+var stderrSignatures = []struct {
+	fragment string
+	code     ErrorCode
+}{
+	{"administratively prohibited", CodeAdminProhibited},
+	{"open failed", CodeRemoteConnectFailed},
+	{"connect_to ", CodeRemoteConnectFailed},
+	{"REMOTE HOST IDENTIFICATION HAS CHANGED", CodeHostKeyChanged},
+	{"Host key verification failed", CodeHostKeyUnverified},
+	{"Address already in use", CodePortInUse},
+	{"bind [", CodeBindFailed},
+	{"bind: ", CodeBindFailed},
+	{"cannot listen to port", CodeBindFailed},
+	{"Could not request local forwarding", CodeBindFailed},
+	{"Permission denied (", CodeAuthFailed},
+	{"Permission denied, please try again", CodeAuthFailed},
+	{"Too many authentication failures", CodeAuthFailed},
+	{"Could not resolve hostname", CodeDNSFailed},
+	{"Name or service not known", CodeDNSFailed},
+	{"ssh: connect to host", CodeConnectFailed},
+	{"Connection closed by", CodeConnectionClosed},
+	{"Connection reset by", CodeConnectionClosed},
+	{"Broken pipe", CodeConnectionClosed},
+	{"Timeout, server", CodeConnectionClosed},
+}
+
+// ClassifyStderr returns the error code for one line of ssh stderr, or ""
+// when the line matches no known failure signature.
+func ClassifyStderr(line string) ErrorCode {
+	for _, sig := range stderrSignatures {
+		if strings.Contains(line, sig.fragment) {
+			return sig.code
+		}
+	}
+	return ""
+}
+
+// Fatal reports whether the failure means the tunnel cannot work at all.
+// Non-fatal codes describe a single forwarded connection failing while the
+// ssh session itself stays up.
+func (c ErrorCode) Fatal() bool {
+	switch c {
+	case CodeAuthFailed, CodeHostKeyChanged, CodeHostKeyUnverified,
+		CodePortInUse, CodeBindFailed, CodeDNSFailed, CodeConnectFailed:
+		return true
+	}
+	return false
+}
+
+// Describe returns a short user-facing description of the code. It never
+// includes host names or addresses, so it is safe to show with redaction on.
+func (c ErrorCode) Describe() string {
+	switch c {
+	case CodeAuthFailed:
+		return "authentication failed"
+	case CodeHostKeyChanged:
+		return "remote host key has changed"
+	case CodeHostKeyUnverified:
+		return "host key verification failed"
+	case CodePortInUse:
+		return "local port already in use"
+	case CodeBindFailed:
+		return "could not bind local port"
+	case CodeDNSFailed:
+		return "could not resolve ssh host"
+	case CodeConnectFailed:
+		return "could not connect to ssh server"
+	case CodeConnectionClosed:
+		return "ssh connection closed"
+	case CodeRemoteConnectFailed:
+		return "remote forward target unreachable"
+	case CodeAdminProhibited:
+		return "forwarding prohibited by server"
+	}
+	return string(c)
+}
@@ -0,0 +1,35 @@
+package sshclient
+
+import "testing"
+
+func TestClassifyStderr(t *testing.T) {
+	cases := []struct {
+		line  string
+		code  ErrorCode
+		fatal bool
+	}{
+		{"git@example.com: Permission denied (publickey).", CodeAuthFailed, true},
+		{"@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @", CodeHostKeyChanged, true},
+		{"Host key verification failed.", CodeHostKeyUnverified, true},
+		{"bind [127.0.0.1]:5432: Address already in use", CodePortInUse, true},
+		{"bind [127.0.0.1]:80: Permission denied", CodeBindFailed, true},
+		{"channel_setup_fwd_listener_tcpip: cannot listen to port: 80", CodeBindFailed, true},
+		{"Permission denied, please try again.", CodeAuthFailed, true},
+		{"ssh: Could not resolve hostname db.internal: Name or service not known", CodeDNSFailed, true},
+		{"ssh: connect to host 10.0.0.5 port 22: Connection refused", CodeConnectFailed, true},
+		{"connect_to localhost port 5432: failed.", CodeRemoteConnectFailed, false},
+		{"channel 2: open failed: connect failed: Connection refused", CodeRemoteConnectFailed, false},
+		{"channel 3: open failed: administratively prohibited: open failed", CodeAdminProhibited, false},
+		{"Connection closed by 10.0.0.5 port 22", CodeConnectionClosed, false},
+		{"Warning: Permanently added 'db' (ED25519) to the list of known hosts.", "", false},
+	}
+	for _, tc := range cases {
+		got := ClassifyStderr(tc.line)
+		if got != tc.code {
+			t.Errorf("ClassifyStderr(%q) = %q, want %q", tc.line, got, tc.code)
+		}
+		if got.Fatal() != tc.fatal {
+			t.Errorf("%q: Fatal() = %v, want %v", tc.line, got.Fatal(), tc.fatal)
+		}
+	}
+}
@@ -28,11 +28,15 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 
 	"github.com/creack/pty"
 	"github.com/treykane/ssh-manager/internal/appconfig"
 	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/recording"
 	"github.com/treykane/ssh-manager/internal/util"
 )
 
@@ -63,6 +67,14 @@ type TunnelProcess struct {
 // The zero value is not useful; use New() to create a Client instance.
 type Client struct {
 	hostKeyPolicy string
+
+	// sshOptions is the -o option policy; forwards supplies the tags that
+	// select per-tag options (see SetSSHOptions).
+	sshOptions appconfig.SSHConfig
+	forwards   []appconfig.ForwardConfig
+
+	// recording selects the interactive sessions RunInteractive records.
+	recording appconfig.RecordingConfig
 }
 
 // New creates a new SSH client.
@@ -78,6 +90,27 @@ func (c *Client) SetHostKeyPolicy(policy string) {
 	c.hostKeyPolicy = appconfig.NormalizeHostKeyPolicy(policy)
 }
 
+// SetSSHOptions configures the ssh options (keepalives,
+// ExitOnForwardFailure, extra -o options) passed to every ssh the client
+// runs. Per-tag options use the tags of the matching forwards entry: the
+// forward's own for tunnels, the host-wide one for sessions and masters.
+func (c *Client) SetSSHOptions(opts appconfig.SSHConfig, forwards []appconfig.ForwardConfig) {
+	c.sshOptions = opts
+	c.forwards = append([]appconfig.ForwardConfig(nil), forwards...)
+}
+
+// SetRecording configures which interactive sessions RunInteractive
+// records. Per-tag recording uses the tags of the host-wide forwards entry,
+// as ssh options do.
+func (c *Client) SetRecording(cfg appconfig.RecordingConfig) {
+	c.recording = cfg
+}
+
+// Records reports whether RunInteractive records sessions to host.
+func (c *Client) Records(host model.HostEntry) bool {
+	return c.recording.Records(host.Alias, appconfig.HostTags(c.forwards, host.Alias))
+}
+
 // EnsureSSHBinary checks that the "ssh" binary is available on the system PATH.
 //
 // This should be called early during startup (before any connect or tunnel
@@ -111,7 +144,8 @@ func (c *Client) ConnectCommand(host model.HostEntry) *exec.Cmd {
 	if host.IsAdHoc {
 		return c.ConnectAdHocCommand(host)
 	}
-	args := append(c.hostKeyArgs(), host.Alias)
+	args := append(c.hostKeyArgs(), c.optionArgs(host.Alias, 0)...)
+	args = append(args, host.Alias)
 	return exec.Command("ssh", args...)
 }
 
@@ -124,6 +158,7 @@ func (c *Client) ConnectCommand(host model.HostEntry) *exec.Cmd {
 func (c *Client) ConnectAdHocCommand(host model.HostEntry) *exec.Cmd {
 	var args []string
 	args = append(args, c.hostKeyArgs()...)
+	args = append(args, c.optionArgs(host.Alias, 0)...)
 
 	if host.Port != 0 && host.Port != 22 {
 		args = append(args, "-p", strconv.Itoa(host.Port))
@@ -144,59 +179,109 @@ func (c *Client) ConnectAdHocCommand(host model.HostEntry) *exec.Cmd {
 	return exec.Command("ssh", args...)
 }
 
-// RunInteractive starts an interactive SSH session in a pseudo-terminal (PTY).
+// RunInteractive starts an interactive SSH session in a pseudo-terminal (PTY)
+// and proxies the user's terminal to it.
 //
 // This method:
 //  1. Creates an exec.Cmd for the SSH connection via ConnectCommand().
-//  2. Allocates a PTY and starts the SSH process attached to it.
-//  3. Pipes the user's stdin to the PTY (so keystrokes reach the remote shell).
-//  4. Pipes the PTY output to the user's stdout (so remote output is displayed).
-//  5. Waits for the SSH process to exit.
+//  2. Starts the SSH process in a PTY sized like the user's terminal.
+//  3. Puts the user's terminal into raw mode, so keystrokes such as Ctrl-C,
+//     arrow keys and tab reach the remote shell unprocessed and are echoed
+//     once, by the remote side. The previous mode is restored on return.
+//  4. Pipes stdin to the PTY and the PTY output to stdout, and copies the
+//     terminal size to the PTY on every SIGWINCH.
+//  5. Waits for the SSH process to exit, then stops the stdin copy so no
+//     goroutine keeps reading the terminal after the session.
 //
-// The PTY is necessary for interactive SSH sessions because SSH expects a
-// terminal for features like password prompts, remote shell line editing,
-// and terminal resizing.
+// When the host is recorded (see SetRecording) the output, and typed input
+// if recording.input allows, is also written to an asciicast file. A
+// recording that cannot be created fails the session rather than running
+// it unrecorded.
 //
-// The ctx parameter can be used to cancel the session. If the context is
-// cancelled while the session is active, the SSH process is killed.
+// The ctx parameter can be used to cancel the session: the SSH process is
+// killed when ctx ends. SIGINT, SIGTERM and SIGHUP sent to ssh-manager are
+// passed on to the SSH process, which ends the session cleanly instead of
+// leaving the terminal in raw mode.
 //
 // Returns nil on clean exit, or an error if the SSH process fails.
 //
-// Note: This method blocks until the SSH session ends. In the TUI, it is
-// typically invoked via tea.ExecProcess, which suspends the Bubble Tea
-// program and gives the SSH process full control of the terminal.
+// Note: This method blocks until the SSH session ends. In the TUI, recorded
+// sessions run it via tea.Exec, which suspends the Bubble Tea program and
+// releases the terminal first.
 func (c *Client) RunInteractive(ctx context.Context, host model.HostEntry) error {
 	cmd := c.ConnectCommand(host)
+	size := terminalSize(os.Stdin)
+
+	var out io.Writer = os.Stdout
+	inTee := io.Discard
+	onResize := func(cols, rows int) {}
+	if c.Records(host) {
+		rec, err := recording.Start(c.recording, host.Alias, int(size.Cols), int(size.Rows))
+		if err != nil {
+			return fmt.Errorf("start session recording: %w", err)
+		}
+		defer rec.Close()
+		out = io.MultiWriter(os.Stdout, rec.Output())
+		inTee = rec.Input()
+		onResize = rec.Resize
+	}
 
-	// Start the SSH process inside a PTY. The pty.Start function allocates
-	// a new pseudo-terminal, sets it as the process's controlling terminal,
-	// and returns the master side file descriptor.
-	f, err := pty.Start(cmd)
+	// Start the SSH process inside a PTY. pty.StartWithSize allocates a
+	// new pseudo-terminal of the given size, sets it as the process's
+	// controlling terminal, and returns the master side file descriptor.
+	f, err := pty.StartWithSize(cmd, size)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	// Forward user input (os.Stdin) into the PTY master. This runs in a
-	// goroutine because io.Copy blocks until EOF (i.e., until the PTY closes).
-	// The goroutine will naturally terminate when the PTY file descriptor is
-	// closed after the SSH process exits.
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	defer restore()
+
+	stopResize := watchResize(os.Stdin, f, onResize)
+	defer stopResize()
+
+	// Pass termination signals on to ssh and kill it when ctx ends. The
+	// goroutine exits with the session.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	exited := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		_, _ = io.Copy(f, os.Stdin)
+		defer wg.Done()
+		for {
+			select {
+			case sig := <-sigs:
+				_ = cmd.Process.Signal(sig)
+			case <-ctx.Done():
+				_ = cmd.Process.Kill()
+				return
+			case <-exited:
+				return
+			}
+		}
 	}()
 
+	// Forward user input into the PTY master until the session ends.
+	stopInput := copyInput(f, os.Stdin, inTee)
+
 	// Forward PTY output to the user's terminal (os.Stdout). This blocks
 	// until the SSH process exits and the PTY master returns EOF.
-	_, _ = io.Copy(os.Stdout, f)
-
-	// If the context was cancelled (e.g., user quit the TUI), ensure the
-	// SSH process is killed rather than left orphaned.
-	if ctx.Err() != nil {
-		_ = cmd.Process.Kill()
-	}
+	_, _ = io.Copy(out, f)
 
 	// Wait for the process to fully exit and collect its exit status.
-	return cmd.Wait()
+	err = cmd.Wait()
+	close(exited)
+	wg.Wait()
+	stopInput()
+	return err
 }
 
 // StartTunnel starts an SSH tunnel process in the background.
@@ -225,23 +310,9 @@ func (c *Client) RunInteractive(ctx context.Context, host model.HostEntry) error
 // an error if the process could not be started (e.g., SSH binary not found,
 // port already in use at the OS level, etc.).
 func (c *Client) StartTunnel(ctx context.Context, host model.HostEntry, fwd model.ForwardSpec) (*TunnelProcess, error) {
-	// Build the -L argument: localAddr:localPort:remoteAddr:remotePort
-	// NormalizeAddr fills in default addresses ("127.0.0.1" for local,
-	// "localhost" for remote) when the ForwardSpec has empty address fields.
-	args := []string{
-		"-N",
-	}
-	args = append(args, c.hostKeyArgs()...)
-	args = append(args,
-		"-L",
-		fmt.Sprintf("%s:%d:%s:%d",
-			util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"),
-			fwd.LocalPort,
-			util.NormalizeAddr(fwd.RemoteAddr, "localhost"),
-			fwd.RemotePort,
-		),
-		host.Alias,
-	)
+	// The argv is built by BuildTunnelArgs so that what is started is
+	// exactly what tunnel.Manager records (and later verifies) for the PID.
+	args := c.BuildTunnelArgs(host.Alias, fwd)
 
 	// Use CommandContext so that cancelling the context automatically sends
 	// a kill signal to the SSH process. This ties the tunnel's lifetime to
@@ -278,12 +349,13 @@ func (c *Client) StartTunnel(ctx context.Context, host model.HostEntry, fwd mode
 //
 // The returned slice is suitable for passing to exec.Command("ssh", args...).
 //
-// Example output: ["-N", "-L", "127.0.0.1:8080:localhost:80", "prod-db"]
+// Example output: ["-N", "-o", "ServerAliveInterval=30", "-L", "127.0.0.1:8080:localhost:80", "prod-db"]
 func (c *Client) BuildTunnelArgs(hostAlias string, fwd model.ForwardSpec) []string {
 	args := []string{
 		"-N",
 	}
 	args = append(args, c.hostKeyArgs()...)
+	args = append(args, c.optionArgs(hostAlias, fwd.LocalPort)...)
 	args = append(args,
 		"-L",
 		fmt.Sprintf("%s:%d:%s:%d",
@@ -307,3 +379,41 @@ func (c *Client) hostKeyArgs() []string {
 		return nil
 	}
 }
+
+// optionArgs returns the -o arguments of the ssh option policy for
+// hostAlias and its forward on localPort (0 for sessions and masters). They
+// follow hostKeyArgs: ssh keeps the first value of an option, so the host
+// key policy always wins, and extra options are re-checked against
+// appconfig.AllowedSSHOptions.
+func (c *Client) optionArgs(hostAlias string, localPort int) []string {
+	o := c.sshOptions.For(hostAlias, appconfig.ForwardTags(c.forwards, hostAlias, localPort))
+	var args []string
+	if o.ServerAliveInterval != nil {
+		args = append(args, "-o", "ServerAliveInterval="+strconv.Itoa(*o.ServerAliveInterval))
+	}
+	if o.ServerAliveCountMax != nil {
+		args = append(args, "-o", "ServerAliveCountMax="+strconv.Itoa(*o.ServerAliveCountMax))
+	}
+	if o.ExitOnForwardFailure != nil {
+		args = append(args, "-o", "ExitOnForwardFailure="+yesNo(*o.ExitOnForwardFailure))
+	}
+	if o.Compression != nil {
+		args = append(args, "-o", "Compression="+yesNo(*o.Compression))
+	}
+	if o.ConnectTimeout != nil {
+		args = append(args, "-o", "ConnectTimeout="+strconv.Itoa(*o.ConnectTimeout))
+	}
+	for _, opt := range o.Extra {
+		if appconfig.ValidateSSHOption(opt) == nil {
+			args = append(args, "-o", opt)
+		}
+	}
+	return args
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
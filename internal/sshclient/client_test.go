@@ -22,10 +22,20 @@
 package sshclient
 
 import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/treykane/ssh-manager/internal/appconfig"
 	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/recording"
 )
 
 // TestBuildTunnelArgs verifies that BuildTunnelArgs produces the correct SSH
@@ -181,3 +191,202 @@ func TestConnectCommandDispatch(t *testing.T) {
 		t.Fatalf("ad-hoc host args mismatch\nwant=%v\n got=%v", wantAdHoc, cmd.Args)
 	}
 }
+
+func TestBuildMasterAndControlArgs(t *testing.T) {
+	c := New()
+	c.SetHostKeyPolicy("accept-new")
+	got := c.BuildMasterArgs("prod", "/tmp/cm/prod.sock")
+	want := []string{"-N", "-M", "-S", "/tmp/cm/prod.sock", "-o", "ControlPersist=no", "-o", "StrictHostKeyChecking=accept-new", "prod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("master args mismatch\nwant=%v\n got=%v", want, got)
+	}
+
+	got = BuildControlArgs(OpCancel, "prod", "/tmp/cm/prod.sock", model.ForwardSpec{LocalPort: 8080, RemotePort: 80})
+	want = []string{"-S", "/tmp/cm/prod.sock", "-O", "cancel", "-L", "127.0.0.1:8080:localhost:80", "prod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("control args mismatch\nwant=%v\n got=%v", want, got)
+	}
+}
+
+func TestBuildExecArgs(t *testing.T) {
+	c := New()
+	c.SetHostKeyPolicy("accept-new")
+	got := c.BuildExecArgs("prod", []string{"df", "-h", "/"})
+	want := []string{"-T", "-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=accept-new", "prod", "df", "-h", "/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("exec args mismatch\nwant=%v\n got=%v", want, got)
+	}
+}
+
+func TestBuildCopyArgs(t *testing.T) {
+	c := New()
+	c.SetHostKeyPolicy("accept-new")
+	prod := model.HostEntry{Alias: "prod"}
+
+	got, err := c.BuildCopyArgs(CopyPath{Path: "./dist"}, CopyPath{Host: prod, Path: "/srv/app"}, CopyOptions{Recursive: true, Quiet: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-r", "-q", "-o", "StrictHostKeyChecking=accept-new", "./dist", "prod:/srv/app"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("scp args mismatch\nwant=%v\n got=%v", want, got)
+	}
+
+	adHoc := model.HostEntry{Alias: "::1", HostName: "::1", User: "deploy", Port: 2222, IsAdHoc: true}
+	src, dst := CopyPath{Host: adHoc, Path: "logs"}, CopyPath{Path: "out dir"}
+	got, err = c.BuildCopyArgs(src, dst, CopyOptions{SFTP: true, Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"-b", "-", "-o", "StrictHostKeyChecking=accept-new", "-P", "2222", "deploy@[::1]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sftp args mismatch\nwant=%v\n got=%v", want, got)
+	}
+	if batch := SFTPBatch(src, dst, CopyOptions{Recursive: true}); batch != "progress\nget -R \"logs\" \"out dir\"\n" {
+		t.Fatalf("unexpected sftp batch %q", batch)
+	}
+
+	if _, err := c.BuildCopyArgs(CopyPath{Path: "a"}, CopyPath{Path: "b"}, CopyOptions{}); err == nil {
+		t.Fatal("expected an error for a local-only copy")
+	}
+}
+
+func TestBuildTunnelArgs_SSHOptions(t *testing.T) {
+	c := New()
+	c.SetHostKeyPolicy("accept-new")
+	interval, timeout, yes, no := 30, 5, true, false
+	c.SetSSHOptions(appconfig.SSHConfig{
+		SSHOptions: appconfig.SSHOptions{
+			ServerAliveInterval:  &interval,
+			ExitOnForwardFailure: &yes,
+			Extra:                []string{"TCPKeepAlive=yes", "StrictHostKeyChecking=no"},
+		},
+		Hosts: map[string]appconfig.SSHOptions{"prod": {Compression: &no}},
+		Tags:  map[string]appconfig.SSHOptions{"slow": {ConnectTimeout: &timeout, Extra: []string{"ConnectionAttempts=3"}}},
+	}, []appconfig.ForwardConfig{{Host: "prod", LocalPort: 8080, Tags: []string{"slow"}}})
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 8080, RemoteAddr: "localhost", RemotePort: 80}
+
+	got := c.BuildTunnelArgs("prod", fwd)
+	want := []string{"-N",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "ServerAliveInterval=30",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "Compression=no",
+		"-o", "ConnectTimeout=5",
+		"-o", "ConnectionAttempts=3",
+		"-o", "TCPKeepAlive=yes",
+		"-L", "127.0.0.1:8080:localhost:80", "prod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tunnel args mismatch\nwant=%v\n got=%v", want, got)
+	}
+
+	// Sessions get the global and host options, not the forward's tags.
+	cmd := c.ConnectCommand(model.HostEntry{Alias: "prod"})
+	want = []string{"ssh",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "ServerAliveInterval=30",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "Compression=no",
+		"-o", "TCPKeepAlive=yes",
+		"prod"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Fatalf("session args mismatch\nwant=%v\n got=%v", want, cmd.Args)
+	}
+}
+
+func TestRecordsUsesHostTags(t *testing.T) {
+	c := New()
+	c.SetSSHOptions(appconfig.SSHConfig{}, []appconfig.ForwardConfig{
+		{Host: "api", Tags: []string{"prod"}},
+		{Host: "db", LocalPort: 5432, Tags: []string{"prod"}},
+	})
+	c.SetRecording(appconfig.RecordingConfig{Tags: []string{"prod"}})
+	if !c.Records(model.HostEntry{Alias: "api"}) {
+		t.Fatal("expected sessions to a host tagged prod recorded")
+	}
+	if c.Records(model.HostEntry{Alias: "db"}) {
+		t.Fatal("expected a port-specific tag not to record sessions")
+	}
+}
+
+func TestRunInteractiveProxiesPTY(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\nstty size\nread line\necho \"got $line\"\nexit 3\n"
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldIn, oldOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = inR, outW
+	defer func() { os.Stdin, os.Stdout = oldIn, oldOut }()
+	defer inW.Close()
+
+	c := New()
+	c.SetRecording(appconfig.RecordingConfig{Enabled: true, Input: appconfig.RecordInputFull})
+	if _, err := inW.Write([]byte("hi\n")); err != nil {
+		t.Fatal(err)
+	}
+	// stdin stays open: RunInteractive must stop reading it on its own.
+	err = c.RunInteractive(context.Background(), model.HostEntry{Alias: "api"})
+	_ = outW.Close()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected exit code 3, got %v", err)
+	}
+	out, _ := io.ReadAll(outR)
+	if !strings.Contains(string(out), "24 80") || !strings.Contains(string(out), "got hi") {
+		t.Fatalf("expected default PTY size and echoed input, got %q", out)
+	}
+
+	dir, err := recording.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := recording.List(dir)
+	if err != nil || len(list) != 1 || list[0].Width != 80 || list[0].Height != 24 {
+		t.Fatalf("expected one 80x24 recording, got %+v (%v)", list, err)
+	}
+	cast, err := os.ReadFile(list[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cast), `"i","hi\n"`) || !strings.Contains(string(cast), "got hi") {
+		t.Fatalf("expected input and output recorded, got %s", cast)
+	}
+}
+
+func TestRunInteractiveKillsOnCancel(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte("#!/bin/sh\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	oldIn := os.Stdin
+	os.Stdin = devNull
+	defer func() { os.Stdin = oldIn }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := New().RunInteractive(ctx, model.HostEntry{Alias: "api"}); err == nil {
+		t.Fatal("expected killed session to fail")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("session outlived its context: %s", time.Since(start))
+	}
+}
@@ -0,0 +1,80 @@
+package sshclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// Control operations accepted by Control (ssh -O).
+const (
+	OpForward = "forward"
+	OpCancel  = "cancel"
+)
+
+// StartMaster starts a ControlMaster connection to host listening on
+// controlPath. It runs in the foreground (no -f) so the caller can watch it
+// like a tunnel process; ControlPersist=no ends it when it is killed rather
+// than leaving a detached master behind.
+//
+//	ssh -N -M -S <controlPath> -o ControlPersist=no <hostAlias>
+//
+// Forwards are then added and removed with Control. The master creates the
+// control socket once it has authenticated.
+func (c *Client) StartMaster(ctx context.Context, host model.HostEntry, controlPath string) (*TunnelProcess, error) {
+	cmd := exec.CommandContext(ctx, "ssh", c.BuildMasterArgs(host.Alias, controlPath)...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = io.Discard
+	cmd.Stdin = nil
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &TunnelProcess{Cmd: cmd, Stderr: stderr}, nil
+}
+
+// BuildMasterArgs constructs the arguments of StartMaster.
+func (c *Client) BuildMasterArgs(hostAlias, controlPath string) []string {
+	args := []string{"-N", "-M", "-S", controlPath, "-o", "ControlPersist=no"}
+	args = append(args, c.hostKeyArgs()...)
+	args = append(args, c.optionArgs(hostAlias, 0)...)
+	return append(args, hostAlias)
+}
+
+// Control asks the master on controlPath to add (OpForward) or remove
+// (OpCancel) a local forward. It returns once the master has answered; a
+// forward that cannot be bound is reported as an error with ssh's message.
+func (c *Client) Control(ctx context.Context, op string, host model.HostEntry, controlPath string, fwd model.ForwardSpec) error {
+	out, err := exec.CommandContext(ctx, "ssh", BuildControlArgs(op, host.Alias, controlPath, fwd)...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("ssh -O %s: %s", op, msg)
+		}
+		return fmt.Errorf("ssh -O %s: %w", op, err)
+	}
+	return nil
+}
+
+// BuildControlArgs constructs the arguments of Control.
+//
+// Example output: ["-S", "<path>", "-O", "forward", "-L", "127.0.0.1:8080:localhost:80", "prod-db"]
+func BuildControlArgs(op, hostAlias, controlPath string, fwd model.ForwardSpec) []string {
+	return []string{
+		"-S", controlPath,
+		"-O", op,
+		"-L", fmt.Sprintf("%s:%d:%s:%d",
+			util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"),
+			fwd.LocalPort,
+			util.NormalizeAddr(fwd.RemoteAddr, "localhost"),
+			fwd.RemotePort,
+		),
+		hostAlias,
+	}
+}
@@ -0,0 +1,171 @@
+package sshclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// CopyPath is one side of a file copy: Path on Host, or a local path when
+// Host has no alias.
+type CopyPath struct {
+	Host model.HostEntry
+	Path string
+}
+
+// Remote reports whether p is on a remote host.
+func (p CopyPath) Remote() bool {
+	return p.Host.Alias != ""
+}
+
+// CopyOptions controls CopyCommand.
+type CopyOptions struct {
+	// Recursive copies directories.
+	Recursive bool
+
+	// Quiet turns off the progress meter.
+	Quiet bool
+
+	// SFTP runs sftp in batch mode instead of scp, for servers that only
+	// offer the sftp subsystem.
+	SFTP bool
+}
+
+// EnsureCopyBinary checks that the binary CopyCommand runs with opts (scp
+// or sftp) is available on the system PATH.
+func EnsureCopyBinary(opts CopyOptions) error {
+	bin := "scp"
+	if opts.SFTP {
+		bin = "sftp"
+	}
+	if _, err := exec.LookPath(bin); err != nil {
+		return fmt.Errorf("%s binary not found in PATH", bin)
+	}
+	return nil
+}
+
+// CopyCommand creates an exec.Cmd that copies src to dst, exactly one of
+// which must be remote. It runs scp, or sftp with a batch of commands on
+// stdin when opts.SFTP is set:
+//
+//	scp [-r] [-q] [hostkey][options] <src> <dst>
+//	sftp -b - [hostkey][options] <host>   (stdin: [progress] put|get [-R] <src> <dst>)
+//
+// Both use the host key and ssh option policy of ssh sessions. Ad-hoc hosts
+// are reached with their explicit port, identity file and jump host.
+func (c *Client) CopyCommand(ctx context.Context, src, dst CopyPath, opts CopyOptions) (*exec.Cmd, error) {
+	args, err := c.BuildCopyArgs(src, dst, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.SFTP {
+		return exec.CommandContext(ctx, "scp", args...), nil
+	}
+	cmd := exec.CommandContext(ctx, "sftp", args...)
+	cmd.Stdin = strings.NewReader(SFTPBatch(src, dst, opts))
+	return cmd, nil
+}
+
+// BuildCopyArgs constructs the arguments of CopyCommand.
+func (c *Client) BuildCopyArgs(src, dst CopyPath, opts CopyOptions) ([]string, error) {
+	if src.Remote() == dst.Remote() {
+		if src.Remote() {
+			return nil, errors.New("copying between two remote hosts is not supported")
+		}
+		return nil, errors.New("one side of a copy must be remote (host:path)")
+	}
+	remote := src
+	if dst.Remote() {
+		remote = dst
+	}
+	var args []string
+	if opts.SFTP {
+		args = append(args, "-b", "-")
+	} else {
+		if opts.Recursive {
+			args = append(args, "-r")
+		}
+		if opts.Quiet {
+			args = append(args, "-q")
+		}
+	}
+	args = append(args, c.hostKeyArgs()...)
+	args = append(args, c.optionArgs(remote.Host.Alias, 0)...)
+	if h := remote.Host; h.IsAdHoc {
+		if h.Port != 0 && h.Port != 22 {
+			args = append(args, "-P", strconv.Itoa(h.Port))
+		}
+		if h.IdentityFile != "" {
+			args = append(args, "-i", h.IdentityFile)
+		}
+		if h.ProxyJump != "" {
+			args = append(args, "-J", h.ProxyJump)
+		}
+	}
+	if opts.SFTP {
+		return append(args, copyDest(remote.Host)), nil
+	}
+	return append(args, copyArg(src), copyArg(dst)), nil
+}
+
+// SFTPBatch returns the sftp batch commands that copy src to dst.
+func SFTPBatch(src, dst CopyPath, opts CopyOptions) string {
+	var b strings.Builder
+	if !opts.Quiet {
+		// Batch mode starts with the progress meter off.
+		b.WriteString("progress\n")
+	}
+	op := "put"
+	if src.Remote() {
+		op = "get"
+	}
+	b.WriteString(op)
+	if opts.Recursive {
+		b.WriteString(" -R")
+	}
+	b.WriteString(" " + sftpQuote(remotePath(src.Path, src.Remote())) + " " + sftpQuote(remotePath(dst.Path, dst.Remote())) + "\n")
+	return b.String()
+}
+
+// copyDest is the scp/sftp destination of host: its alias, or
+// [user@]hostname for ad-hoc hosts.
+func copyDest(h model.HostEntry) string {
+	if !h.IsAdHoc {
+		return h.Alias
+	}
+	dest := h.HostName
+	if strings.Contains(dest, ":") {
+		dest = "[" + dest + "]"
+	}
+	if h.User != "" {
+		dest = h.User + "@" + dest
+	}
+	return dest
+}
+
+// copyArg renders p as an scp operand.
+func copyArg(p CopyPath) string {
+	if !p.Remote() {
+		return p.Path
+	}
+	return copyDest(p.Host) + ":" + p.Path
+}
+
+// remotePath returns path, or "." (the login directory) when a remote path
+// is empty, as scp treats "host:".
+func remotePath(path string, remote bool) string {
+	if remote && path == "" {
+		return "."
+	}
+	return path
+}
+
+// sftpQuote quotes a path for an sftp batch command.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
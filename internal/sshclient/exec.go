@@ -0,0 +1,31 @@
+package sshclient
+
+import (
+	"context"
+	"os/exec"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// ExecCommand creates an exec.Cmd that runs command on host and exits. It
+// is killed when ctx ends.
+//
+//	ssh -T -o BatchMode=yes [hostkey][options] <hostAlias> <command...>
+//
+// Like ssh itself, the remote side joins the command words with spaces and
+// runs them with the user's login shell.
+func (c *Client) ExecCommand(ctx context.Context, host model.HostEntry, command []string) *exec.Cmd {
+	return exec.CommandContext(ctx, "ssh", c.BuildExecArgs(host.Alias, command)...)
+}
+
+// BuildExecArgs constructs the arguments of ExecCommand. BatchMode keeps ssh
+// from prompting for passwords or passphrases, which nobody could answer
+// when many hosts run at once; it comes first so that the ssh option policy
+// cannot turn it off. -T asks for no remote terminal.
+func (c *Client) BuildExecArgs(hostAlias string, command []string) []string {
+	args := []string{"-T", "-o", "BatchMode=yes"}
+	args = append(args, c.hostKeyArgs()...)
+	args = append(args, c.optionArgs(hostAlias, 0)...)
+	args = append(args, hostAlias)
+	return append(args, command...)
+}
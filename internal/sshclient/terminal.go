@@ -0,0 +1,92 @@
+package sshclient
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/creack/pty"
+	"github.com/muesli/cancelreader"
+)
+
+// terminalSize returns the size of the terminal on f, or 80x24 when f is not
+// a terminal.
+func terminalSize(f *os.File) *pty.Winsize {
+	if size, err := pty.GetsizeFull(f); err == nil && size.Cols > 0 && size.Rows > 0 {
+		return size
+	}
+	return &pty.Winsize{Cols: 80, Rows: 24}
+}
+
+// makeRaw puts the terminal on f into raw mode and returns the function
+// restoring its previous state. It does nothing when f is not a terminal.
+func makeRaw(f *os.File) (restore func(), err error) {
+	if !term.IsTerminal(f.Fd()) {
+		return func() {}, nil
+	}
+	state, err := term.MakeRaw(f.Fd())
+	if err != nil {
+		return nil, fmt.Errorf("set terminal raw mode: %w", err)
+	}
+	return func() { _ = term.Restore(f.Fd(), state) }, nil
+}
+
+// watchResize copies the size of tty to ptmx on every SIGWINCH and reports
+// it to onResize, until the returned function is called. It does nothing
+// when tty is not a terminal.
+func watchResize(tty, ptmx *os.File, onResize func(cols, rows int)) (stop func()) {
+	if !term.IsTerminal(tty.Fd()) {
+		return func() {}
+	}
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-winch:
+				size, err := pty.GetsizeFull(tty)
+				if err != nil || pty.Setsize(ptmx, size) != nil {
+					continue
+				}
+				onResize(int(size.Cols), int(size.Rows))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(done)
+		<-stopped
+	}
+}
+
+// copyInput copies src to dst, and everything read also to tee, until the
+// returned function is called. That function interrupts the pending read
+// and waits for the copy to end, so the terminal is not read after the
+// session; a src that cannot be watched (a regular file) is left to reach
+// EOF on its own.
+func copyInput(dst io.Writer, src *os.File, tee io.Writer) (stop func()) {
+	r, err := cancelreader.NewReader(src)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var in io.Reader = src
+		if err == nil {
+			in = r
+		}
+		_, _ = io.Copy(dst, io.TeeReader(in, tee))
+	}()
+	return func() {
+		if err == nil && r.Cancel() {
+			<-done
+			_ = r.Close()
+		}
+	}
+}
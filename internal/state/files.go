@@ -0,0 +1,203 @@
+package state
+
+import "fmt"
+
+// Runtime is runtime.json, the last-known tunnel runtime owned by
+// internal/tunnel.
+//
+//	v0: bare JSON array of tunnel records
+//	v1: {"version": 1, "tunnels": [...]}
+var Runtime = &File{
+	Name:    "runtime.json",
+	Format:  FormatJSON,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "wrap tunnel array in a versioned object", Apply: wrapList("tunnels")},
+	},
+}
+
+// RestartStats is restart_metrics.json, the per-tunnel auto-restart counters
+// owned by internal/tunnel.
+//
+//	v0: JSON object keyed by tunnel ID
+//	v1: {"version": 1, "stats": {...}}
+var RestartStats = &File{
+	Name:    "restart_metrics.json",
+	Format:  FormatJSON,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "move per-tunnel stats under \"stats\"", Apply: wrapObject("stats")},
+	},
+}
+
+// Bundles is bundles.yaml, the named tunnel bundles owned by internal/bundle.
+//
+//	v0: {bundles: {...}}
+//	v1: {version: 1, bundles: {...}}
+var Bundles = &File{
+	Name:    "bundles.yaml",
+	Format:  FormatYAML,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "add version key", Apply: setVersion(1)},
+	},
+}
+
+// History is history.json, the host last-used timestamps owned by
+// internal/history.
+//
+//	v0: {"last_used": {...}}
+//	v1: {"version": 1, "last_used": {...}}
+var History = &File{
+	Name:    "history.json",
+	Format:  FormatJSON,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "add version key", Apply: setVersion(1)},
+	},
+}
+
+// Events is events.jsonl, the tunnel lifecycle journal owned by
+// internal/events. Each record carries its own version.
+//
+//	v0: records without a version key
+//	v1: records with "version": 1
+var Events = &File{
+	Name:    "events.jsonl",
+	Format:  FormatJSONL,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "add version key to each record", Apply: eachRecord(0, setVersion(1))},
+	},
+}
+
+// Ports is ports.json, the automatic local port assignments per tunnel ID
+// owned by internal/tunnel.
+//
+//	v0: {"ports": {...}}
+//	v1: {"version": 1, "ports": {...}}
+var Ports = &File{
+	Name:    "ports.json",
+	Format:  FormatJSON,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "add version key", Apply: setVersion(1)},
+	},
+}
+
+// Webhooks is webhook_queue.json, the pending webhook deliveries owned by
+// internal/webhook.
+//
+//	v0: {"deliveries": [...]}
+//	v1: {"version": 1, "deliveries": [...]}
+var Webhooks = &File{
+	Name:    "webhook_queue.json",
+	Format:  FormatJSON,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "add version key", Apply: setVersion(1)},
+	},
+}
+
+// HostHealth is host_health.json, the remote host health check history
+// owned by internal/history.
+//
+//	v0: {"hosts": {...}}
+//	v1: {"version": 1, "hosts": {...}}
+var HostHealth = &File{
+	Name:    "host_health.json",
+	Format:  FormatJSON,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "add version key", Apply: setVersion(1)},
+	},
+}
+
+// HostKeyPins is host_key_pins.json, the pinned host key fingerprints per
+// host alias owned by internal/hostkeys.
+//
+//	v0: {"hosts": {...}}
+//	v1: {"version": 1, "hosts": {...}}
+var HostKeyPins = &File{
+	Name:    "host_key_pins.json",
+	Format:  FormatJSON,
+	Current: 1,
+	Migrations: []Migration{
+		{From: 0, Description: "add version key", Apply: setVersion(1)},
+	},
+}
+
+// All returns every versioned file in a stable order.
+func All() []*File {
+	return []*File{Runtime, RestartStats, Bundles, History, Events, Ports, Webhooks, HostHealth, HostKeyPins}
+}
+
+// wrapList moves a legacy top-level array under key in a versioned object.
+func wrapList(key string) func(any) (any, error) {
+	return func(doc any) (any, error) {
+		switch v := doc.(type) {
+		case nil:
+			return map[string]any{"version": 1, key: []any{}}, nil
+		case []any:
+			return map[string]any{"version": 1, key: v}, nil
+		case map[string]any:
+			v["version"] = 1
+			if _, ok := v[key]; !ok {
+				v[key] = []any{}
+			}
+			return v, nil
+		default:
+			return nil, fmt.Errorf("unexpected document type %T", doc)
+		}
+	}
+}
+
+// wrapObject moves a legacy top-level object under key in a versioned object.
+func wrapObject(key string) func(any) (any, error) {
+	return func(doc any) (any, error) {
+		switch v := doc.(type) {
+		case nil:
+			return map[string]any{"version": 1, key: map[string]any{}}, nil
+		case map[string]any:
+			return map[string]any{"version": 1, key: v}, nil
+		default:
+			return nil, fmt.Errorf("unexpected document type %T", doc)
+		}
+	}
+}
+
+// setVersion stamps version n on an object document.
+func setVersion(n int) func(any) (any, error) {
+	return func(doc any) (any, error) {
+		switch v := doc.(type) {
+		case nil:
+			return map[string]any{"version": n}, nil
+		case map[string]any:
+			v["version"] = n
+			return v, nil
+		default:
+			return nil, fmt.Errorf("unexpected document type %T", doc)
+		}
+	}
+}
+
+// eachRecord applies fn to every record of a JSONL document that is still at
+// version from. Records already past it are left as they are.
+func eachRecord(from int, fn func(any) (any, error)) func(any) (any, error) {
+	return func(doc any) (any, error) {
+		recs, _ := doc.([]any)
+		out := make([]any, 0, len(recs))
+		for _, rec := range recs {
+			if versionOf(rec) > from {
+				out = append(out, rec)
+				continue
+			}
+			next, err := fn(rec)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, next)
+		}
+		return out, nil
+	}
+}
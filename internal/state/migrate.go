@@ -0,0 +1,95 @@
+package state
+
+import (
+	"errors"
+	"os"
+)
+
+// Plan actions reported by Inspect.
+const (
+	ActionMissing = "missing"
+	ActionCurrent = "current"
+	ActionMigrate = "migrate"
+	ActionNewer   = "newer"
+	ActionInvalid = "invalid"
+)
+
+// Plan describes what a migration run would do (or did) to one file.
+type Plan struct {
+	File    string   `json:"file"`
+	Path    string   `json:"path"`
+	Found   int      `json:"found_version"`
+	Current int      `json:"current_version"`
+	Action  string   `json:"action"`
+	Steps   []string `json:"steps,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Inspect reports the on-disk version of f and the migrations needed to
+// bring it to the current version. It never modifies the file.
+func (f *File) Inspect() Plan {
+	p := Plan{File: f.Name, Current: f.Current}
+	path, err := f.Path()
+	if err != nil {
+		p.Action = ActionInvalid
+		p.Error = err.Error()
+		return p
+	}
+	p.Path = path
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			p.Action = ActionMissing
+			return p
+		}
+		p.Action = ActionInvalid
+		p.Error = err.Error()
+		return p
+	}
+	doc, minVer, maxVer, err := f.decode(raw)
+	if err != nil {
+		p.Action = ActionInvalid
+		p.Error = err.Error()
+		return p
+	}
+	switch {
+	case maxVer > f.Current:
+		p.Found = maxVer
+		p.Action = ActionNewer
+	case minVer < f.Current:
+		p.Found = minVer
+		p.Action = ActionMigrate
+		if _, steps, err := f.migrate(doc, minVer); err != nil {
+			p.Action = ActionInvalid
+			p.Error = err.Error()
+		} else {
+			p.Steps = steps
+		}
+	default:
+		p.Found = minVer
+		p.Action = ActionCurrent
+	}
+	return p
+}
+
+// Migrate upgrades every registered file that is behind the current version.
+// With dryRun set nothing is written and the returned plans describe the
+// pending work.
+func Migrate(dryRun bool) ([]Plan, error) {
+	var plans []Plan
+	var errs []error
+	for _, f := range All() {
+		p := f.Inspect()
+		if p.Action == ActionMigrate && !dryRun && !isReadOnly() {
+			if _, err := f.Read(); err != nil {
+				p.Action = ActionInvalid
+				p.Error = err.Error()
+			}
+		}
+		if p.Error != "" {
+			errs = append(errs, errors.New(p.File+": "+p.Error))
+		}
+		plans = append(plans, p)
+	}
+	return plans, errors.Join(errs...)
+}
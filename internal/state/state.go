@@ -0,0 +1,397 @@
+// Package state versions the files ssh-manager persists under its config
+// directory and upgrades older layouts on load.
+//
+// Every persisted file is described by a File: its name, on-disk format, the
+// schema version this build reads and writes, and an ordered list of
+// migrations. Owning packages (internal/tunnel, internal/bundle,
+// internal/history, internal/events) read through File.Read, which detects
+// the on-disk version, backs up the original, applies migrations, and writes
+// the upgraded document back before returning it. Writes go through
+// File.Write or File.CheckWritable so that a file produced by a newer
+// ssh-manager build is never overwritten by an older one.
+//
+// Version placement depends on the format:
+//
+//	JSON / YAML  — a top-level "version" key (missing means version 0)
+//	JSONL        — a "version" key on every record (missing means version 0)
+//
+// Migrations operate on generic decoded documents (map[string]any, []any) so
+// this package does not need to import the owning packages' types.
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies how a persisted file is encoded.
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+	FormatJSONL Format = "jsonl"
+)
+
+// Migration upgrades a decoded document from version From to From+1.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(doc any) (any, error)
+}
+
+// File describes one versioned file under the config directory.
+type File struct {
+	// Name is the file name relative to the config directory.
+	Name string
+
+	// Format is the on-disk encoding.
+	Format Format
+
+	// Current is the schema version this build reads and writes.
+	Current int
+
+	// Migrations is ordered by From and must cover every version below Current.
+	Migrations []Migration
+}
+
+// NewerVersionError reports a file written by a newer ssh-manager build.
+type NewerVersionError struct {
+	File      string
+	Found     int
+	Supported int
+}
+
+func (e *NewerVersionError) Error() string {
+	return fmt.Sprintf("%s has schema version %d but this build supports up to %d; refusing to overwrite", e.File, e.Found, e.Supported)
+}
+
+// ErrNewerVersion is matched by errors.Is for any *NewerVersionError.
+var ErrNewerVersion = errors.New("state file has a newer schema version")
+
+func (e *NewerVersionError) Is(target error) bool {
+	return target == ErrNewerVersion
+}
+
+var (
+	readOnlyMu sync.Mutex
+	readOnly   bool
+)
+
+// ErrReadOnly is returned by Write and CheckWritable while SetReadOnly is on.
+var ErrReadOnly = errors.New("state is read-only (dry run)")
+
+// SetReadOnly controls whether state may be written. When enabled, Read
+// applies migrations in memory only (no backups, no rewrite), Write and
+// CheckWritable refuse with ErrReadOnly, and appconfig.Load no longer
+// creates config.yaml. --dry-run enables it for the whole command.
+func SetReadOnly(v bool) {
+	readOnlyMu.Lock()
+	readOnly = v
+	readOnlyMu.Unlock()
+	appconfig.SetReadOnly(v)
+}
+
+func isReadOnly() bool {
+	readOnlyMu.Lock()
+	defer readOnlyMu.Unlock()
+	return readOnly
+}
+
+// Path returns the absolute path of the file inside the config directory.
+func (f *File) Path() (string, error) {
+	dir, err := appconfig.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, f.Name), nil
+}
+
+// Read returns the file contents upgraded to the current schema version.
+//
+// If the file does not exist, the returned error satisfies
+// errors.Is(err, os.ErrNotExist). Files with a newer version than Current are
+// returned unchanged so callers can read known fields on a best-effort basis;
+// subsequent writes are refused by Write and CheckWritable.
+func (f *File) Read() ([]byte, error) {
+	path, err := f.Path()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, minVer, maxVer, err := f.decode(raw)
+	if err != nil {
+		// Leave undecodable files to the owner's own error handling.
+		return raw, nil
+	}
+	if maxVer > f.Current {
+		slog.Warn("state file is newer than supported; reading best-effort", "file", f.Name, "version", maxVer, "supported", f.Current)
+		return raw, nil
+	}
+	if minVer >= f.Current {
+		return raw, nil
+	}
+
+	migrated, _, err := f.migrate(doc, minVer)
+	if err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", f.Name, err)
+	}
+	out, err := f.encode(migrated)
+	if err != nil {
+		return nil, err
+	}
+	if isReadOnly() {
+		return out, nil
+	}
+	if err := backup(path, raw, minVer); err != nil {
+		return nil, fmt.Errorf("backup %s: %w", f.Name, err)
+	}
+	if err := os.WriteFile(path, out, 0o600); err != nil {
+		return nil, err
+	}
+	slog.Info("migrated state file", "file", f.Name, "from", minVer, "to", f.Current)
+	return out, nil
+}
+
+// CheckWritable returns a *NewerVersionError if the file on disk was written
+// by a newer schema version, or ErrReadOnly in read-only mode. Missing files
+// are writable.
+func (f *File) CheckWritable() error {
+	if isReadOnly() {
+		return ErrReadOnly
+	}
+	path, err := f.Path()
+	if err != nil {
+		return err
+	}
+	var found int
+	if f.Format == FormatJSONL {
+		found, err = lastRecordVersion(path)
+	} else {
+		var raw []byte
+		raw, err = os.ReadFile(path)
+		if err == nil {
+			_, _, found, err = f.decode(raw)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		// Unreadable or corrupt files are replaced by the owner as before.
+		return nil
+	}
+	if found > f.Current {
+		return &NewerVersionError{File: f.Name, Found: found, Supported: f.Current}
+	}
+	return nil
+}
+
+// Write replaces the file with b after verifying it is not owned by a newer
+// schema version. The config directory is created if needed.
+func (f *File) Write(b []byte) error {
+	if err := f.CheckWritable(); err != nil {
+		return err
+	}
+	path, err := f.Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func (f *File) migrate(doc any, from int) (any, []string, error) {
+	var steps []string
+	for v := from; v < f.Current; v++ {
+		m, ok := f.migration(v)
+		if !ok {
+			return nil, steps, fmt.Errorf("no migration registered from version %d", v)
+		}
+		next, err := m.Apply(doc)
+		if err != nil {
+			return nil, steps, fmt.Errorf("v%d->v%d: %w", v, v+1, err)
+		}
+		doc = next
+		steps = append(steps, fmt.Sprintf("v%d->v%d: %s", v, v+1, m.Description))
+	}
+	return doc, steps, nil
+}
+
+func (f *File) migration(from int) (Migration, bool) {
+	for _, m := range f.Migrations {
+		if m.From == from {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+// decode parses raw into a generic document and reports the lowest and
+// highest schema versions present. For JSON and YAML both are the top-level
+// version; for JSONL they span all records.
+func (f *File) decode(raw []byte) (any, int, int, error) {
+	switch f.Format {
+	case FormatYAML:
+		var doc any
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return nil, 0, 0, err
+		}
+		v := versionOf(doc)
+		return doc, v, v, nil
+	case FormatJSONL:
+		var recs []any
+		minVer, maxVer := -1, 0
+		sc := bufio.NewScanner(bytes.NewReader(raw))
+		sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" {
+				continue
+			}
+			rec, err := decodeJSON([]byte(line))
+			if err != nil {
+				// Corrupt lines are skipped by readers; drop them here too.
+				continue
+			}
+			v := versionOf(rec)
+			if minVer == -1 || v < minVer {
+				minVer = v
+			}
+			if v > maxVer {
+				maxVer = v
+			}
+			recs = append(recs, rec)
+		}
+		if err := sc.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+		if minVer == -1 {
+			minVer = f.Current
+		}
+		return recs, minVer, maxVer, nil
+	default:
+		doc, err := decodeJSON(raw)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		v := versionOf(doc)
+		return doc, v, v, nil
+	}
+}
+
+func (f *File) encode(doc any) ([]byte, error) {
+	switch f.Format {
+	case FormatYAML:
+		return yaml.Marshal(doc)
+	case FormatJSONL:
+		recs, _ := doc.([]any)
+		var buf bytes.Buffer
+		for _, rec := range recs {
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(b)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	default:
+		return json.MarshalIndent(doc, "", "  ")
+	}
+}
+
+func decodeJSON(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// versionOf reads the "version" key from a decoded object. Anything else
+// (arrays, objects without the key) is a pre-versioning layout: version 0.
+func versionOf(doc any) int {
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return 0
+	}
+	switch v := obj["version"].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return 0
+		}
+		return int(n)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// lastRecordVersion reads the version of the final record of a JSONL file
+// without scanning the whole journal.
+func lastRecordVersion(path string) (int, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fh.Close()
+	st, err := fh.Stat()
+	if err != nil {
+		return 0, err
+	}
+	const tail = 64 * 1024
+	off := st.Size() - tail
+	if off < 0 {
+		off = 0
+	}
+	if _, err := fh.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	b, err := io.ReadAll(fh)
+	if err != nil {
+		return 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		rec, err := decodeJSON([]byte(line))
+		if err != nil {
+			continue
+		}
+		return versionOf(rec), nil
+	}
+	return 0, nil
+}
+
+func backup(path string, raw []byte, from int) error {
+	name := fmt.Sprintf("%s.v%d.%s.bak", path, from, time.Now().UTC().Format("20060102T150405"))
+	return os.WriteFile(name, raw, 0o600)
+}
@@ -0,0 +1,187 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+)
+
+func writeStateFile(t *testing.T, name, body string) string {
+	t.Helper()
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "ssh-manager")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestReadMigratesLegacyRuntimeWithBackup(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := writeStateFile(t, "runtime.json", `[{"id":"api|127.0.0.1:9000|localhost:80","pid":42}]`)
+
+	b, err := Runtime.Read()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var doc struct {
+		Version int              `json:"version"`
+		Tunnels []map[string]any `json:"tunnels"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("decode migrated: %v", err)
+	}
+	if doc.Version != 1 || len(doc.Tunnels) != 1 || doc.Tunnels[0]["pid"] != float64(42) {
+		t.Fatalf("unexpected migrated runtime: %s", b)
+	}
+
+	onDisk, _ := os.ReadFile(path)
+	if string(onDisk) != string(b) {
+		t.Fatalf("expected migrated runtime to be written back")
+	}
+	backups, _ := filepath.Glob(path + ".v0.*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("expected one v0 backup, got %v", backups)
+	}
+}
+
+func TestReadOnlyDoesNotRewrite(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	SetReadOnly(true)
+	defer SetReadOnly(false)
+	path := writeStateFile(t, "history.json", `{"last_used":{"api":1}}`)
+
+	b, err := History.Read()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(b), `"version": 1`) {
+		t.Fatalf("expected migrated document in memory, got %s", b)
+	}
+	onDisk, _ := os.ReadFile(path)
+	if string(onDisk) != `{"last_used":{"api":1}}` {
+		t.Fatalf("expected file untouched in read-only mode, got %s", onDisk)
+	}
+	if err := History.Write([]byte(`{"version":1}`)); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected write refused in read-only mode, got %v", err)
+	}
+	if _, err := appconfig.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "config.yaml")); !os.IsNotExist(err) {
+		t.Fatalf("expected config.yaml not created in read-only mode: %v", err)
+	}
+}
+
+func TestNewerVersionRefusesWrite(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	body := `{"version":99,"last_used":{"api":1},"future":true}`
+	path := writeStateFile(t, "history.json", body)
+
+	b, err := History.Read()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != body {
+		t.Fatalf("expected newer file returned unchanged, got %s", b)
+	}
+	err = History.Write([]byte(`{"version":1}`))
+	var nv *NewerVersionError
+	if !errors.As(err, &nv) || !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("expected newer version error, got %v", err)
+	}
+	if nv.Found != 99 || nv.Supported != History.Current {
+		t.Fatalf("unexpected error details: %+v", nv)
+	}
+	onDisk, _ := os.ReadFile(path)
+	if string(onDisk) != body {
+		t.Fatalf("expected newer file untouched, got %s", onDisk)
+	}
+}
+
+func TestEventsMigrationVersionsEachRecord(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := writeStateFile(t, "events.jsonl", "{\"event_type\":\"start\"}\nnot-json\n{\"event_type\":\"stop\",\"version\":1}\n")
+
+	if _, err := Events.Read(); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	onDisk, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(onDisk)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", onDisk)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"version":1`) {
+			t.Fatalf("expected versioned record, got %s", line)
+		}
+	}
+
+	writeStateFile(t, "events.jsonl", "{\"event_type\":\"start\",\"version\":7}\n")
+	if err := Events.CheckWritable(); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("expected newer journal to be refused, got %v", err)
+	}
+}
+
+func TestMigrateDryRunReportsPlan(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := writeStateFile(t, "restart_metrics.json", `{"api|127.0.0.1:9000|localhost:80":{"attempts":2}}`)
+	writeStateFile(t, "bundles.yaml", "version: 1\nbundles: {}\n")
+
+	plans, err := Migrate(true)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	byFile := map[string]Plan{}
+	for _, p := range plans {
+		byFile[p.File] = p
+	}
+	if p := byFile["restart_metrics.json"]; p.Action != ActionMigrate || p.Found != 0 || len(p.Steps) != 1 {
+		t.Fatalf("unexpected restart metrics plan: %+v", p)
+	}
+	if p := byFile["bundles.yaml"]; p.Action != ActionCurrent {
+		t.Fatalf("unexpected bundles plan: %+v", p)
+	}
+	if p := byFile["runtime.json"]; p.Action != ActionMissing {
+		t.Fatalf("unexpected runtime plan: %+v", p)
+	}
+	onDisk, _ := os.ReadFile(path)
+	if strings.Contains(string(onDisk), "version") {
+		t.Fatalf("dry run must not modify files, got %s", onDisk)
+	}
+
+	if _, err := Migrate(false); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if p := RestartStats.Inspect(); p.Action != ActionCurrent {
+		t.Fatalf("expected restart metrics migrated, got %+v", p)
+	}
+}
+
+func TestEveryFileMigratesFromVersionZero(t *testing.T) {
+	for _, f := range All() {
+		for v := 0; v < f.Current; v++ {
+			if _, ok := f.migration(v); !ok {
+				t.Errorf("%s: no migration from version %d", f.Name, v)
+			}
+		}
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	writeStateFile(t, "ports.json", `{"ports":{"api|127.0.0.1:9000|localhost:80":9000}}`)
+	b, err := Ports.Read()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.Contains(string(b), `"version": 1`) || !strings.Contains(string(b), `9000`) {
+		t.Fatalf("unexpected migrated ports: %s", b)
+	}
+}
@@ -0,0 +1,382 @@
+package tunnel
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/config"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// procRoot is where ssh processes are looked for. Tests point it at a fake
+// tree of <pid>/cmdline files.
+var procRoot = "/proc"
+
+// adoptedPollInterval is how often the process of an adopted tunnel is
+// checked. It is not a child of ssh-manager, so its exit cannot be waited on.
+var adoptedPollInterval = 2 * time.Second
+
+// sshArgFlags are the ssh options that take a value ("-L spec" or "-Lspec").
+const sshArgFlags = "BbcDEeFIiJLlmOoPpRSWw"
+
+// Forward kinds of an AdoptCandidate.
+const (
+	ForwardLocal   = "local"
+	ForwardRemote  = "remote"
+	ForwardDynamic = "dynamic"
+)
+
+// AdoptCandidate is one forward of an ssh process ssh-manager did not start.
+type AdoptCandidate struct {
+	PID         int    `json:"pid"`
+	Destination string `json:"destination"`
+	// HostAlias is the configured host the destination resolved to.
+	HostAlias string `json:"host_alias,omitempty"`
+	Kind      string `json:"kind"`
+	// Spec is the -L/-R/-D argument as given to ssh.
+	Spec string `json:"spec"`
+	// ID is the runtime ID the forward gets once adopted.
+	ID        string `json:"id,omitempty"`
+	Adoptable bool   `json:"adoptable"`
+	// Reason says why a forward cannot be adopted.
+	Reason  string `json:"reason,omitempty"`
+	Command string `json:"command"`
+
+	fwd  model.ForwardSpec
+	argv []string
+}
+
+// sshInvocation is what ssh-manager cares about in an ssh command line.
+type sshInvocation struct {
+	destination string
+	forwards    []sshForward
+	control     bool // ssh -O: a request to a control master, not a tunnel
+}
+
+type sshForward struct {
+	kind string
+	spec string
+}
+
+// parseSSHCommand extracts the destination and forwards from an ssh argv.
+// ok is false when argv is not an ssh invocation.
+func parseSSHCommand(argv []string) (inv sshInvocation, ok bool) {
+	if len(argv) == 0 || filepath.Base(argv[0]) != "ssh" {
+		return sshInvocation{}, false
+	}
+	for i := 1; i < len(argv) && inv.destination == ""; i++ {
+		arg := argv[i]
+		if arg == "--" {
+			if i+1 < len(argv) {
+				inv.destination = argv[i+1]
+			}
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || len(arg) < 2 {
+			inv.destination = arg
+			break
+		}
+		// Flags may be grouped ("-fNL8080:db:5432"); the first one that
+		// takes a value consumes the rest of the word or the next word.
+		for j := 1; j < len(arg); j++ {
+			c := arg[j]
+			if strings.IndexByte(sshArgFlags, c) < 0 {
+				continue
+			}
+			val := arg[j+1:]
+			if val == "" && i+1 < len(argv) {
+				i++
+				val = argv[i]
+			}
+			switch c {
+			case 'L':
+				inv.forwards = append(inv.forwards, sshForward{kind: ForwardLocal, spec: val})
+			case 'R':
+				inv.forwards = append(inv.forwards, sshForward{kind: ForwardRemote, spec: val})
+			case 'D':
+				inv.forwards = append(inv.forwards, sshForward{kind: ForwardDynamic, spec: val})
+			case 'O':
+				inv.control = true
+			}
+			break
+		}
+	}
+	return inv, true
+}
+
+// destinationHost strips the user and port from an ssh destination
+// ("user@host", "ssh://user@host:2222").
+func destinationHost(dest string) string {
+	if rest, ok := strings.CutPrefix(dest, "ssh://"); ok {
+		dest = rest
+		if i := strings.LastIndex(dest, "@"); i >= 0 {
+			dest = dest[i+1:]
+		}
+		if strings.HasPrefix(dest, "[") {
+			if end := strings.Index(dest, "]"); end > 0 {
+				return dest[1:end]
+			}
+		}
+		host, _, _ := strings.Cut(dest, ":")
+		return host
+	}
+	if i := strings.LastIndex(dest, "@"); i >= 0 {
+		dest = dest[i+1:]
+	}
+	return dest
+}
+
+// matchHost finds the configured host an ssh destination refers to, by
+// alias first and then by HostName.
+func matchHost(hosts []model.HostEntry, dest string) (model.HostEntry, bool) {
+	name := destinationHost(dest)
+	for _, h := range hosts {
+		if h.Alias == name {
+			return h, true
+		}
+	}
+	for _, h := range hosts {
+		if h.HostName != "" && strings.EqualFold(h.HostName, name) {
+			return h, true
+		}
+	}
+	return model.HostEntry{}, false
+}
+
+// ownProcess reports whether pid belongs to the current user; other users'
+// tunnels could not be stopped anyway.
+func ownProcess(pid int) bool {
+	fi, err := os.Stat(filepath.Join(procRoot, strconv.Itoa(pid)))
+	if err != nil {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
+
+// Unmanaged lists the forwards of ssh processes that ssh-manager is not
+// tracking, such as "ssh -fN -L ..." started by hand, and whether each can
+// be adopted. hostAlias, when set, limits the result to that host.
+func (m *Manager) Unmanaged(hostAlias string) ([]AdoptCandidate, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("scan processes: %w", err)
+	}
+	var hosts []model.HostEntry
+	if res, err := config.ParseDefault(); err == nil {
+		hosts = res.Hosts
+	} else {
+		slog.Warn("failed to parse ssh config while scanning for tunnels", "error", err)
+	}
+
+	m.mu.Lock()
+	tracked := make(map[int]bool)
+	known := make(map[string]bool)
+	for id, rt := range m.runtime {
+		if rt.PID > 0 {
+			tracked[rt.PID] = true
+		}
+		if activeState(rt.State) {
+			known[id] = true
+		}
+	}
+	m.mu.Unlock()
+
+	var out []AdoptCandidate
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() || tracked[pid] || !ownProcess(pid) {
+			continue
+		}
+		argv := readCmdline(pid)
+		inv, ok := parseSSHCommand(argv)
+		if !ok || inv.control || inv.destination == "" || len(inv.forwards) == 0 {
+			continue
+		}
+		host, hostOK := matchHost(hosts, inv.destination)
+		if hostAlias != "" && (!hostOK || host.Alias != hostAlias) {
+			continue
+		}
+		for _, f := range inv.forwards {
+			c := AdoptCandidate{
+				PID:         pid,
+				Destination: inv.destination,
+				Kind:        f.kind,
+				Spec:        f.spec,
+				Command:     strings.Join(argv, " "),
+				argv:        argv,
+			}
+			if hostOK {
+				c.HostAlias = host.Alias
+			}
+			switch {
+			case f.kind != ForwardLocal:
+				c.Reason = f.kind + " forwards are not managed by ssh-manager"
+			case !hostOK:
+				c.Reason = "no configured host matches " + inv.destination
+			default:
+				fwd, err := ParseForwardArg(f.spec)
+				if err != nil {
+					c.Reason = err.Error()
+					break
+				}
+				c.fwd = fwd
+				c.ID = RuntimeID(host.Alias, fwd)
+				if known[c.ID] {
+					c.Reason = "a managed tunnel with this forward is already active"
+					break
+				}
+				c.Adoptable = true
+			}
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].PID < out[j].PID })
+	return out, nil
+}
+
+// Adopt imports the local forwards of ssh process pid as tunnels, so they
+// are listed, health checked and stopped like the ones ssh-manager started.
+// A process carrying several forwards becomes one tunnel per forward;
+// stopping any of them ends the process and so all of them.
+func (m *Manager) Adopt(pid int) ([]model.TunnelRuntime, error) {
+	candidates, err := m.Unmanaged("")
+	if err != nil {
+		return nil, err
+	}
+	var picked []AdoptCandidate
+	reason := ""
+	for _, c := range candidates {
+		if c.PID != pid {
+			continue
+		}
+		if c.Adoptable {
+			picked = append(picked, c)
+		} else if reason == "" {
+			reason = c.Reason
+		}
+	}
+	if len(picked) == 0 {
+		if reason != "" {
+			return nil, fmt.Errorf("process %d cannot be adopted: %s", pid, reason)
+		}
+		return nil, fmt.Errorf("process %d is not an unmanaged ssh tunnel", pid)
+	}
+
+	now := time.Now()
+	out := make([]model.TunnelRuntime, 0, len(picked))
+	m.mu.Lock()
+	for _, c := range picked {
+		rt := model.TunnelRuntime{
+			ID:        c.ID,
+			HostAlias: c.HostAlias,
+			Forward:   c.fwd,
+			Local:     fmt.Sprintf("%s:%d", util.NormalizeAddr(c.fwd.LocalAddr, "127.0.0.1"), c.fwd.LocalPort),
+			Remote:    fmt.Sprintf("%s:%d", util.NormalizeAddr(c.fwd.RemoteAddr, "localhost"), c.fwd.RemotePort),
+			PID:       pid,
+			State:     model.TunnelUp,
+			StartedAt: now,
+			Adopted:   true,
+		}
+		recordProcess(&rt, c.argv)
+		m.runtime[rt.ID] = rt
+		delete(m.health, rt.ID)
+		out = append(out, rt)
+	}
+	m.mu.Unlock()
+
+	for _, rt := range out {
+		m.recordEvent("adopted", rt, "adopted ssh process "+strconv.Itoa(pid))
+		go m.watchAdopted(rt.ID, pid, adoptedPollInterval)
+	}
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel state after adopt", "error", err)
+	}
+	return out, nil
+}
+
+// adoptedProcessMatches reports whether argv is the ssh command an adopted
+// tunnel was taken from. It covers entries recorded before argv was stored.
+func adoptedProcessMatches(argv []string, rt model.TunnelRuntime) bool {
+	inv, ok := parseSSHCommand(argv)
+	if !ok || inv.control {
+		return false
+	}
+	for _, f := range inv.forwards {
+		if f.kind != ForwardLocal {
+			continue
+		}
+		if fwd, err := ParseForwardArg(f.spec); err == nil && RuntimeID(rt.HostAlias, fwd) == rt.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// watchAdopted marks an adopted tunnel as failed once its process is gone.
+// It returns when the tunnel is stopped or handed to another process.
+func (m *Manager) watchAdopted(id string, pid int, every time.Duration) {
+	for {
+		time.Sleep(every)
+		m.mu.Lock()
+		rt, ok := m.runtime[id]
+		m.mu.Unlock()
+		if !ok || rt.PID != pid || rt.State != model.TunnelUp {
+			return
+		}
+		if sameProcess(rt) {
+			continue
+		}
+		m.mu.Lock()
+		rt, ok = m.runtime[id]
+		if !ok || rt.PID != pid || rt.State != model.TunnelUp {
+			m.mu.Unlock()
+			return
+		}
+		rt.State = model.TunnelError
+		rt.PID = 0
+		rt.LastError = "adopted ssh process exited"
+		m.runtime[id] = rt
+		m.mu.Unlock()
+		m.recordEvent("unexpected_exit", rt, rt.LastError)
+		if err := m.persist(); err != nil {
+			slog.Warn("failed to persist tunnel state after adopted process exit", "error", err)
+		}
+		return
+	}
+}
+
+// stopAdoptedSiblings marks the other tunnels adopted from process pid as
+// down; they ended with it.
+func (m *Manager) stopAdoptedSiblings(id string, pid int) {
+	m.mu.Lock()
+	var stopped []model.TunnelRuntime
+	ids := make([]string, 0)
+	for other, rt := range m.runtime {
+		if other != id && rt.Adopted && rt.PID == pid {
+			ids = append(ids, other)
+		}
+	}
+	slices.Sort(ids)
+	for _, other := range ids {
+		rt := m.runtime[other]
+		rt.State = model.TunnelDown
+		rt.PID = 0
+		m.runtime[other] = rt
+		m.endLifetime(other)
+		stopped = append(stopped, rt)
+	}
+	m.mu.Unlock()
+	for _, rt := range stopped {
+		m.recordEvent("stop_succeeded", rt, "tunnel stopped with its shared ssh process")
+	}
+}
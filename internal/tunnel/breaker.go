@@ -0,0 +1,178 @@
+package tunnel
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// Circuit breaker states of a host.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerStats is the auto-restart circuit breaker of one host. Consecutive
+// failed restarts of any of the host's tunnels open it; while open, restarts
+// of all its tunnels wait. After the cooldown one restart runs as a
+// half-open probe: success closes the breaker, failure opens it again.
+type BreakerStats struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Trips               int       `json:"trips"`
+	OpenedAt            time.Time `json:"opened_at,omitzero"`
+	RetryAt             time.Time `json:"retry_at,omitzero"`
+}
+
+// breakerPollInterval is how often a restart waiting on a half-open breaker
+// checks whether the probe has finished.
+var breakerPollInterval = 500 * time.Millisecond
+
+// SetRestartBackoff sets the cap of the exponential restart delay and the
+// jitter fraction (0-1) applied to each delay.
+func (m *Manager) SetRestartBackoff(maxDelay time.Duration, jitter float64) {
+	m.mu.Lock()
+	m.restartBackoffMax = maxDelay
+	m.restartJitter = min(max(jitter, 0), 1)
+	m.mu.Unlock()
+}
+
+// SetCircuitBreaker sets how many consecutive failed restarts open a host's
+// breaker (0 disables it) and how long it stays open before a probe.
+func (m *Manager) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	m.mu.Lock()
+	m.breakerThreshold = max(threshold, 0)
+	m.breakerCooldown = cooldown
+	m.mu.Unlock()
+}
+
+// Breakers returns the circuit breaker of every host that has one.
+func (m *Manager) Breakers() map[string]BreakerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]BreakerStats, len(m.breakers))
+	for host, b := range m.breakers {
+		out[host] = b
+	}
+	return out
+}
+
+// restartDelay returns the wait before restart attempt n (1-based): the base
+// backoff doubled per attempt, capped, with jitter applied.
+func (m *Manager) restartDelay(attempt int) time.Duration {
+	m.mu.Lock()
+	base, ceil, jitter := m.restartBackoff, m.restartBackoffMax, m.restartJitter
+	m.mu.Unlock()
+	return backoffDelay(base, ceil, jitter, attempt, rand.Float64())
+}
+
+// backoffDelay computes base*2^(attempt-1), capped at ceil (when ceil > 0),
+// scaled by a factor in [1-jitter, 1+jitter] chosen by r in [0, 1).
+func backoffDelay(base, ceil time.Duration, jitter float64, attempt int, r float64) time.Duration {
+	d := base
+	for i := 1; i < attempt && (ceil <= 0 || d < ceil); i++ {
+		d *= 2
+	}
+	if ceil > 0 && d > ceil {
+		d = ceil
+	}
+	return time.Duration(float64(d) * (1 + jitter*(2*r-1)))
+}
+
+// awaitBreaker blocks a restart of tunnel id while its host's breaker is open.
+// It reports whether this restart is the half-open probe, and proceed=false
+// when the tunnel was stopped while waiting.
+func (m *Manager) awaitBreaker(id, host string) (probe, proceed bool) {
+	announced := false
+	for {
+		m.mu.Lock()
+		rt, ok := m.runtime[id]
+		if !ok || rt.State == model.TunnelStopping || rt.State == model.TunnelDown {
+			m.mu.Unlock()
+			return false, false
+		}
+		b, tracked := m.breakers[host]
+		if !tracked || b.State == BreakerClosed {
+			m.mu.Unlock()
+			return false, true
+		}
+		now := time.Now()
+		if b.State == BreakerOpen && !now.Before(b.RetryAt) {
+			b.State = BreakerHalfOpen
+			m.breakers[host] = b
+			m.mu.Unlock()
+			m.recordEvent("breaker_half_open", rt, fmt.Sprintf("probing host %s with one restart", host))
+			_ = m.persistRestartStats()
+			return true, true
+		}
+		wait := breakerPollInterval
+		if b.State == BreakerOpen {
+			wait = b.RetryAt.Sub(now)
+		}
+		m.mu.Unlock()
+		if !announced {
+			m.recordEvent("restart_paused", rt, fmt.Sprintf("circuit breaker for host %s is %s; restart paused", host, b.State))
+			announced = true
+		}
+		time.Sleep(min(wait, breakerPollInterval))
+	}
+}
+
+// noteRestartResult feeds a restart outcome for a tunnel of host into its
+// breaker. Any failure while the breaker is half-open fails the probe.
+func (m *Manager) noteRestartResult(host string, rt model.TunnelRuntime, ok bool) {
+	m.mu.Lock()
+	threshold, cooldown := m.breakerThreshold, m.breakerCooldown
+	b := m.breakers[host]
+	prev := b.State
+	switch {
+	case ok:
+		if prev == "" || (prev == BreakerClosed && b.ConsecutiveFailures == 0) {
+			m.mu.Unlock()
+			return
+		}
+		b.State = BreakerClosed
+		b.ConsecutiveFailures = 0
+		b.RetryAt = time.Time{}
+	case threshold <= 0:
+		m.mu.Unlock()
+		return
+	default:
+		b.ConsecutiveFailures++
+		switch {
+		case prev == BreakerHalfOpen || (prev != BreakerOpen && b.ConsecutiveFailures >= threshold):
+			b.State = BreakerOpen
+			b.Trips++
+			b.OpenedAt = time.Now().UTC()
+			b.RetryAt = b.OpenedAt.Add(cooldown)
+		case prev == "":
+			b.State = BreakerClosed
+		}
+	}
+	m.breakers[host] = b
+	m.mu.Unlock()
+
+	switch {
+	case b.State == BreakerOpen && prev != BreakerOpen:
+		m.recordEvent("breaker_open", rt, fmt.Sprintf("circuit breaker for host %s opened after %d consecutive restart failures; retrying in %s",
+			host, b.ConsecutiveFailures, cooldown))
+	case b.State == BreakerClosed && prev != BreakerClosed && prev != "":
+		m.recordEvent("breaker_closed", rt, fmt.Sprintf("circuit breaker for host %s closed; restarts resumed", host))
+	}
+	_ = m.persistRestartStats()
+}
+
+// abandonProbe reopens a half-open breaker whose probe never ran (its tunnel
+// was stopped), so the next waiting restart probes right away.
+func (m *Manager) abandonProbe(host string) {
+	m.mu.Lock()
+	if b, ok := m.breakers[host]; ok && b.State == BreakerHalfOpen {
+		b.State = BreakerOpen
+		b.RetryAt = time.Now().UTC()
+		m.breakers[host] = b
+	}
+	m.mu.Unlock()
+}
@@ -0,0 +1,330 @@
+package tunnel
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// dependencyWaitTimeout bounds how long a start waits for a dependency to
+// accept connections, including one that is already starting or restarting.
+var dependencyWaitTimeout = 30 * time.Second
+
+// dependencyPollInterval is how often a start re-checks a pending dependency.
+var dependencyPollInterval = 100 * time.Millisecond
+
+// ParseDependency splits a depends_on entry into a host alias and a local
+// port: "bastion" selects all of the host's forwards (port 0) and
+// "bastion:2222" the forward with that local port.
+func ParseDependency(s string) (host string, localPort int, err error) {
+	s = strings.TrimSpace(s)
+	host, port, hasPort := strings.Cut(s, ":")
+	if host == "" || strings.ContainsAny(host, " \t|") {
+		return "", 0, fmt.Errorf("invalid dependency %q: want host or host:local_port", s)
+	}
+	if !hasPort {
+		return host, 0, nil
+	}
+	localPort, err = strconv.Atoi(port)
+	if err != nil || localPort <= 0 || localPort > 65535 {
+		return "", 0, fmt.Errorf("invalid dependency %q: bad local port", s)
+	}
+	return host, localPort, nil
+}
+
+// resolveDependency returns the host and forwards selected by a depends_on
+// entry. Runtime IDs (as stored in TunnelRuntime.DependsOn) are accepted too.
+func resolveDependency(sel string) (model.HostEntry, []model.ForwardSpec, error) {
+	if strings.Contains(sel, "|") {
+		host, err := findHostByAlias(hostOfID(sel))
+		if err != nil {
+			return model.HostEntry{}, nil, err
+		}
+		for _, fwd := range host.Forwards {
+			if RuntimeID(host.Alias, fwd) == sel {
+				return host, []model.ForwardSpec{fwd}, nil
+			}
+		}
+		// Not (or no longer) declared in the SSH config: rebuild it from the ID.
+		_, spec, _ := strings.Cut(sel, "|")
+		local, remote, _ := strings.Cut(spec, "|")
+		fwd, err := ParseForwardArg(local + ":" + remote)
+		if err != nil {
+			return model.HostEntry{}, nil, err
+		}
+		return host, []model.ForwardSpec{fwd}, nil
+	}
+
+	alias, port, err := ParseDependency(sel)
+	if err != nil {
+		return model.HostEntry{}, nil, err
+	}
+	host, err := findHostByAlias(alias)
+	if err != nil {
+		return model.HostEntry{}, nil, err
+	}
+	var out []model.ForwardSpec
+	for _, fwd := range host.Forwards {
+		if port == 0 || fwd.LocalPort == port {
+			out = append(out, fwd)
+		}
+	}
+	if len(out) == 0 {
+		return model.HostEntry{}, nil, fmt.Errorf("host %s has no matching LocalForward for %q", alias, sel)
+	}
+	return host, out, nil
+}
+
+// startDependencies brings up the tunnels selected by deps before tunnel id
+// starts and returns their runtime IDs. chain lists the tunnels whose start
+// is waiting on id; reaching one of them again is a cycle.
+func (m *Manager) startDependencies(id string, deps, chain []string) ([]string, error) {
+	if len(deps) == 0 {
+		return nil, nil
+	}
+	chain = append(slices.Clone(chain), id)
+	var ids []string
+	for _, sel := range deps {
+		host, forwards, err := resolveDependency(sel)
+		if err != nil {
+			return nil, fmt.Errorf("tunnel %s: dependency %s: %w", id, sel, err)
+		}
+		for _, fwd := range forwards {
+			depID := RuntimeID(host.Alias, fwd)
+			if i := slices.Index(chain, depID); i >= 0 {
+				return nil, fmt.Errorf("dependency cycle: %s", strings.Join(append(chain[i:], depID), " -> "))
+			}
+			if slices.Contains(ids, depID) {
+				continue
+			}
+			if err := m.ensureDependency(host, fwd, depID, chain); err != nil {
+				return nil, fmt.Errorf("tunnel %s: dependency %s: %w", id, depID, err)
+			}
+			ids = append(ids, depID)
+		}
+	}
+	return ids, nil
+}
+
+// ensureDependency starts dependency id unless it is already running, starting
+// or awaiting an auto-restart, then waits until it accepts connections.
+func (m *Manager) ensureDependency(host model.HostEntry, fwd model.ForwardSpec, id string, chain []string) error {
+	m.mu.Lock()
+	rt, ok := m.runtime[id]
+	restarting := m.autoRestart && m.restartAttempts[id] > 0
+	m.mu.Unlock()
+	switch {
+	case ok && rt.State == model.TunnelQuarantined:
+		return fmt.Errorf("dependency is quarantined")
+	case ok && (rt.State == model.TunnelUp || rt.State == model.TunnelArmed || rt.State == model.TunnelStarting):
+	case ok && rt.State == model.TunnelError && restarting:
+		// An auto-restart is already scheduled; wait for it.
+	default:
+		if _, err := m.StartWithOptions(host, fwd, ForwardOptions{chain: chain}); err != nil {
+			return err
+		}
+	}
+	return m.awaitDependency(id)
+}
+
+// awaitDependency waits until dependency id is armed, or up with its local
+// port accepting connections.
+func (m *Manager) awaitDependency(id string) error {
+	deadline := time.Now().Add(dependencyWaitTimeout)
+	for {
+		rt, err := m.Get(id)
+		if err != nil {
+			return err
+		}
+		switch rt.State {
+		case model.TunnelArmed:
+			return nil
+		case model.TunnelUp:
+			if portAccepting(rt.Local) {
+				return nil
+			}
+		case model.TunnelDown, model.TunnelQuarantined:
+			return fmt.Errorf("dependency is %s", rt.State)
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("dependency not ready after %s (state %s)", dependencyWaitTimeout, rt.State)
+		}
+		time.Sleep(dependencyPollInterval)
+	}
+}
+
+// activeDependents returns the tunnels that depend directly on tunnel id and
+// may still hold a process or listener. Callers hold m.mu.
+func (m *Manager) activeDependents(id string) []model.TunnelRuntime {
+	var out []model.TunnelRuntime
+	for _, rt := range m.runtime {
+		if !slices.Contains(rt.DependsOn, id) {
+			continue
+		}
+		switch rt.State {
+		case model.TunnelUp, model.TunnelStarting, model.TunnelArmed, model.TunnelError:
+			out = append(out, rt)
+		}
+	}
+	slices.SortFunc(out, func(a, b model.TunnelRuntime) int { return strings.Compare(a.ID, b.ID) })
+	return out
+}
+
+// dependentTree returns the running (up or armed) tunnels that depend on
+// tunnel id directly or transitively, each after the dependents it depends
+// on. Callers hold m.mu.
+func (m *Manager) dependentTree(id string) []model.TunnelRuntime {
+	seen := map[string]bool{id: true}
+	var out []model.TunnelRuntime
+	queue := []string{id}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, rt := range m.activeDependents(cur) {
+			if seen[rt.ID] || (rt.State != model.TunnelUp && rt.State != model.TunnelArmed) {
+				continue
+			}
+			seen[rt.ID] = true
+			out = append(out, rt)
+			queue = append(queue, rt.ID)
+		}
+	}
+	return out
+}
+
+// stopDependents stops the tunnels that depend on tunnel id, which is being
+// stopped. Each Stop cascades further down the graph.
+func (m *Manager) stopDependents(id string) {
+	m.mu.Lock()
+	deps := m.activeDependents(id)
+	m.mu.Unlock()
+	for _, rt := range deps {
+		m.recordEvent("dependency_stop", rt, "stopping: dependency "+id+" is stopping")
+		if err := m.Stop(rt.ID); err != nil {
+			slog.Warn("failed to stop dependent tunnel", "id", rt.ID, "dependency", id, "error", err)
+		}
+	}
+}
+
+// Restart stops tunnel id and starts it again with the options it was
+// started with, then restarts the tunnels that depend on it.
+func (m *Manager) Restart(id string) (model.TunnelRuntime, error) {
+	m.mu.Lock()
+	rt, ok := m.runtime[id]
+	tree := m.dependentTree(id)
+	m.mu.Unlock()
+	if !ok {
+		return model.TunnelRuntime{}, fmt.Errorf("tunnel not found: %s", id)
+	}
+	if err := m.Stop(id); err != nil {
+		return model.TunnelRuntime{}, err
+	}
+	next, err := m.startFrom(rt, OptionsFromRuntime(rt))
+	if err != nil {
+		return next, err
+	}
+	m.startDependents(id, tree)
+	return next, nil
+}
+
+// restartDependents restarts the dependents of tunnel id after id itself was
+// auto-restarted: their connections went through the old process. Dependents
+// that already restarted on their own since are left alone.
+func (m *Manager) restartDependents(id string, since time.Time) {
+	m.mu.Lock()
+	var stale []model.TunnelRuntime
+	for _, rt := range m.dependentTree(id) {
+		if rt.StartedAt.Before(since) {
+			stale = append(stale, rt)
+		}
+	}
+	m.mu.Unlock()
+	if len(stale) == 0 {
+		return
+	}
+	for _, rt := range stale {
+		if slices.Contains(rt.DependsOn, id) {
+			m.recordEvent("dependency_restart", rt, "restarting: dependency "+id+" was restarted")
+			_ = m.Stop(rt.ID)
+		}
+	}
+	m.startDependents(id, stale)
+}
+
+// startDependents starts the stopped dependents of tunnel id in tree order,
+// keeping each one's options and TTL deadline.
+func (m *Manager) startDependents(id string, tree []model.TunnelRuntime) {
+	for _, rt := range tree {
+		opts := OptionsFromRuntime(rt)
+		opts.Deadline = rt.ExpiresAt
+		if _, err := m.startFrom(rt, opts); err != nil {
+			slog.Warn("failed to restart dependent tunnel", "id", rt.ID, "dependency", id, "error", err)
+		}
+	}
+}
+
+// startFrom starts the tunnel described by a previous runtime entry.
+func (m *Manager) startFrom(rt model.TunnelRuntime, opts ForwardOptions) (model.TunnelRuntime, error) {
+	host, err := findHostByAlias(rt.HostAlias)
+	if err != nil {
+		return model.TunnelRuntime{}, err
+	}
+	fwd, err := RequestedForward(rt)
+	if err != nil {
+		return model.TunnelRuntime{}, err
+	}
+	return m.StartWithOptions(host, fwd, opts)
+}
+
+// DependencyNode is a tunnel with the tunnels that depend on it.
+type DependencyNode struct {
+	Tunnel     model.TunnelRuntime `json:"tunnel"`
+	Dependents []DependencyNode    `json:"dependents,omitempty"`
+}
+
+// DependencyTree arranges tunnels by their DependsOn links. Roots are the
+// tunnels without a dependency in tunnels; a tunnel with several
+// dependencies appears under each of them.
+func DependencyTree(tunnels []model.TunnelRuntime) []DependencyNode {
+	byID := make(map[string]bool, len(tunnels))
+	for _, rt := range tunnels {
+		byID[rt.ID] = true
+	}
+	children := map[string][]model.TunnelRuntime{}
+	var roots []model.TunnelRuntime
+	for _, rt := range tunnels {
+		root := true
+		for _, dep := range rt.DependsOn {
+			if byID[dep] && dep != rt.ID {
+				children[dep] = append(children[dep], rt)
+				root = false
+			}
+		}
+		if root {
+			roots = append(roots, rt)
+		}
+	}
+
+	var build func(rt model.TunnelRuntime, path []string) DependencyNode
+	build = func(rt model.TunnelRuntime, path []string) DependencyNode {
+		node := DependencyNode{Tunnel: rt}
+		path = append(path, rt.ID)
+		for _, child := range children[rt.ID] {
+			if slices.Contains(path, child.ID) {
+				continue // a cycle left over in runtime state
+			}
+			node.Dependents = append(node.Dependents, build(child, path))
+		}
+		return node
+	}
+	out := make([]DependencyNode, 0, len(roots))
+	for _, rt := range roots {
+		out = append(out, build(rt, nil))
+	}
+	return out
+}
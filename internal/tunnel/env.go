@@ -0,0 +1,75 @@
+package tunnel
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+var (
+	envNamePattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envPlaceholderExpr = regexp.MustCompile(`\{[^{}]*\}`)
+)
+
+// RenderEnv expands the env templates of a forward config entry for a
+// running tunnel. Templates may use these placeholders, all taken from the
+// tunnel's actual endpoints (so allocated ports are reflected):
+//
+//	{local_host}  {local_port}  {local}   local bind host, port, host:port
+//	{remote_host} {remote_port} {remote}  remote target host, port, host:port
+//	{host}                                ssh host alias
+//
+// Unknown placeholders and invalid variable names are errors.
+func RenderEnv(rt model.TunnelRuntime, templates map[string]string) (map[string]string, error) {
+	localHost, localPort, err := splitHostPortString(rt.Local)
+	if err != nil {
+		return nil, fmt.Errorf("tunnel %s: invalid local endpoint %q: %w", rt.ID, rt.Local, err)
+	}
+	remoteHost, remotePort, err := splitHostPortString(rt.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("tunnel %s: invalid remote endpoint %q: %w", rt.ID, rt.Remote, err)
+	}
+	values := map[string]string{
+		"{local_host}":  localHost,
+		"{local_port}":  localPort,
+		"{local}":       rt.Local,
+		"{remote_host}": remoteHost,
+		"{remote_port}": remotePort,
+		"{remote}":      rt.Remote,
+		"{host}":        rt.HostAlias,
+	}
+
+	out := make(map[string]string, len(templates))
+	for name, tmpl := range templates {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		var unknown string
+		out[name] = envPlaceholderExpr.ReplaceAllStringFunc(tmpl, func(ph string) string {
+			v, ok := values[ph]
+			if !ok && unknown == "" {
+				unknown = ph
+			}
+			return v
+		})
+		if unknown != "" {
+			return nil, fmt.Errorf("%s: unknown placeholder %s", name, unknown)
+		}
+	}
+	return out, nil
+}
+
+// Env returns the environment variables configured for a tunnel's forward,
+// rendered against its actual endpoints. It returns nil when the forward has
+// no env entries.
+func (m *Manager) Env(rt model.TunnelRuntime) (map[string]string, error) {
+	m.mu.Lock()
+	fc, ok := appconfig.FindForwardConfig(m.forwardConfigs, rt.HostAlias, localPortOf(rt))
+	m.mu.Unlock()
+	if !ok || len(fc.Env) == 0 {
+		return nil, nil
+	}
+	return RenderEnv(rt, fc.Env)
+}
@@ -0,0 +1,166 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/events"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/state"
+	"github.com/treykane/ssh-manager/internal/webhook"
+)
+
+// hookRuns counts the hook commands of this process that have not finished.
+var hookRuns sync.WaitGroup
+
+// SetHooks installs the lifecycle hooks run on recorded events and how many
+// of their commands may run at once.
+func (m *Manager) SetHooks(hooks []appconfig.HookConfig, concurrency int) {
+	m.hookMu.Lock()
+	m.hooks = append([]appconfig.HookConfig(nil), hooks...)
+	m.hookSlots = make(chan struct{}, max(concurrency, 1))
+	m.hookMu.Unlock()
+}
+
+// SetWebhooks installs the endpoints recorded events are posted to. Events
+// still queued from earlier runs are delivered as well.
+func (m *Manager) SetWebhooks(endpoints []appconfig.WebhookConfig) {
+	var d *webhook.Dispatcher
+	if len(endpoints) > 0 {
+		d = webhook.New(endpoints)
+	}
+	m.hookMu.Lock()
+	prev := m.webhooks
+	m.webhooks = d
+	m.hookMu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+}
+
+// WaitHooks blocks until every hook command started by this process has
+// finished and its webhook deliveries have been attempted. Each one is
+// bounded by its timeout, so short-lived commands can call it before exiting
+// without hanging.
+func WaitHooks() {
+	hookRuns.Wait()
+	webhook.Wait()
+}
+
+func (m *Manager) notifyWebhooks(evt events.Event) {
+	m.hookMu.Lock()
+	d := m.webhooks
+	m.hookMu.Unlock()
+	if d != nil {
+		d.Notify(evt)
+	}
+}
+
+// runHooks starts the hooks matching evt in the background. It is called
+// from recordEvent, sometimes with m.mu held, so matching happens later.
+func (m *Manager) runHooks(evt events.Event, rt model.TunnelRuntime) {
+	m.hookMu.Lock()
+	hooks, slots := m.hooks, m.hookSlots
+	m.hookMu.Unlock()
+	if len(hooks) == 0 {
+		return
+	}
+	evt.Version = state.Events.Current
+
+	hookRuns.Add(1)
+	go func() {
+		defer hookRuns.Done()
+		tags := m.tunnelTags(rt)
+		for _, h := range hooks {
+			if !hookMatches(h, evt, tags) {
+				continue
+			}
+			hookRuns.Add(1)
+			go func() {
+				defer hookRuns.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				runHook(h, evt)
+			}()
+		}
+	}()
+}
+
+// tunnelTags returns the tags of rt's forward config entry.
+func (m *Manager) tunnelTags(rt model.TunnelRuntime) []string {
+	if rt.HostAlias == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return appconfig.ForwardTags(m.forwardConfigs, rt.HostAlias, localPortOf(rt))
+}
+
+// hookMatches reports whether hook h applies to evt on a tunnel with tags.
+func hookMatches(h appconfig.HookConfig, evt events.Event, tags []string) bool {
+	if len(h.Events) > 0 && !slices.Contains(h.Events, "*") && !slices.Contains(h.Events, evt.EventType) {
+		return false
+	}
+	if len(h.Hosts) > 0 && !slices.Contains(h.Hosts, evt.HostAlias) {
+		return false
+	}
+	if len(h.Tags) > 0 && !slices.ContainsFunc(h.Tags, func(t string) bool { return slices.Contains(tags, t) }) {
+		return false
+	}
+	return true
+}
+
+// runHook runs one hook command with evt as JSON on stdin and in SSHM_*
+// environment variables. Failures are logged, never returned: a broken hook
+// must not affect the tunnel.
+func runHook(h appconfig.HookConfig, evt events.Event) {
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		slog.Warn("failed to encode event for hook", "event", evt.EventType, "error", err)
+		return
+	}
+	timeout := time.Duration(h.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = appconfig.DefaultHookTimeoutSeconds * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), hookEnv(evt)...)
+	// Don't wait on grandchildren that keep the output pipe open after a kill.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		slog.Warn("tunnel hook failed",
+			"command", h.Command[0], "event", evt.EventType, "tunnel", evt.TunnelID,
+			"error", err, "output", string(bytes.TrimSpace(out)))
+	}
+}
+
+// hookEnv returns the SSHM_* variables describing evt.
+func hookEnv(evt events.Event) []string {
+	return []string{
+		"SSHM_EVENT_TYPE=" + evt.EventType,
+		"SSHM_EVENT_TIME=" + evt.Timestamp.Format(time.RFC3339Nano),
+		"SSHM_TUNNEL_ID=" + evt.TunnelID,
+		"SSHM_HOST_ALIAS=" + evt.HostAlias,
+		"SSHM_STATE=" + string(evt.State),
+		"SSHM_MESSAGE=" + evt.Message,
+		"SSHM_ERROR_CODE=" + evt.ErrorCode,
+		"SSHM_PID=" + strconv.Itoa(evt.PID),
+	}
+}
@@ -0,0 +1,249 @@
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// lifetimePollInterval is how often a supervised tunnel's TTL and client
+// activity are checked.
+var lifetimePollInterval = 5 * time.Second
+
+// applyLifetime records the TTL and idle limits of opts on rt. A restart
+// passes the original deadline in opts.Deadline so the TTL is not renewed.
+func applyLifetime(rt *model.TunnelRuntime, opts ForwardOptions, now time.Time) {
+	rt.IdleTimeoutSec = int64(opts.IdleTimeout / time.Second)
+	rt.TTLSec = int64(opts.TTL / time.Second)
+	rt.ExpiresAt = time.Time{}
+	switch {
+	case !opts.Deadline.IsZero():
+		rt.ExpiresAt = opts.Deadline
+	case opts.TTL > 0:
+		rt.ExpiresAt = now.Add(opts.TTL)
+	}
+	rt.LastActiveAt = now
+}
+
+// needsSupervision reports whether rt has a limit superviseLifetime enforces.
+// On-demand tunnels handle idleness themselves by re-arming.
+func needsSupervision(rt model.TunnelRuntime) bool {
+	return !rt.ExpiresAt.IsZero() || (!rt.OnDemand && rt.IdleTimeoutSec > 0)
+}
+
+// remainingSec returns the seconds until the TTL or idle timeout stops rt,
+// whichever comes first, or 0 when neither applies.
+func remainingSec(rt model.TunnelRuntime, now time.Time) int64 {
+	if !activeState(rt.State) {
+		return 0
+	}
+	var left time.Duration = -1
+	if !rt.ExpiresAt.IsZero() {
+		left = rt.ExpiresAt.Sub(now)
+	}
+	if !rt.OnDemand && rt.IdleTimeoutSec > 0 && !rt.LastActiveAt.IsZero() {
+		idle := rt.LastActiveAt.Add(time.Duration(rt.IdleTimeoutSec) * time.Second).Sub(now)
+		if left < 0 || idle < left {
+			left = idle
+		}
+	}
+	if left <= 0 {
+		return 0
+	}
+	return int64((left + time.Second - 1) / time.Second)
+}
+
+// superviseLifetime starts enforcing the TTL and idle timeout of tunnel id,
+// replacing any previous supervisor for it.
+func (m *Manager) superviseLifetime(id string) {
+	done := make(chan struct{})
+	m.mu.Lock()
+	if prev := m.lifetimes[id]; prev != nil {
+		close(prev)
+	}
+	m.lifetimes[id] = done
+	m.mu.Unlock()
+	go m.runLifetime(id, done)
+}
+
+// endLifetime stops the supervisor of tunnel id. Callers hold m.mu.
+func (m *Manager) endLifetime(id string) {
+	if done := m.lifetimes[id]; done != nil {
+		close(done)
+		delete(m.lifetimes, id)
+	}
+}
+
+func (m *Manager) runLifetime(id string, done chan struct{}) {
+	tick := time.NewTicker(lifetimePollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+		}
+
+		now := time.Now()
+		m.mu.Lock()
+		rt, ok := m.runtime[id]
+		m.mu.Unlock()
+		if !ok || !activeState(rt.State) {
+			// Stopped, or failed and handed to the restart path, which
+			// starts a new supervisor if it succeeds.
+			return
+		}
+		if !rt.ExpiresAt.IsZero() && !now.Before(rt.ExpiresAt) {
+			m.expire(id, "ttl_expired", fmt.Sprintf("ttl of %s expired", time.Duration(rt.TTLSec)*time.Second))
+			return
+		}
+		if rt.OnDemand || rt.IdleTimeoutSec <= 0 || rt.State != model.TunnelUp {
+			continue
+		}
+		if m.clientActive(rt) {
+			m.mu.Lock()
+			if cur, ok := m.runtime[id]; ok {
+				cur.LastActiveAt = now
+				m.runtime[id] = cur
+			}
+			m.mu.Unlock()
+			continue
+		}
+		idle := time.Duration(rt.IdleTimeoutSec) * time.Second
+		if now.Sub(rt.LastActiveAt) >= idle {
+			m.expire(id, "idle_stopped", fmt.Sprintf("no connections for %s", idle))
+			return
+		}
+	}
+}
+
+// clientActive reports whether a client is connected to rt's local port.
+// Relayed tunnels know from their counters (and stamp LastActiveAt on every
+// connect and disconnect); others are checked in /proc. ssh-manager does
+// not probe the local port of such tunnels (see probeAddr), so every
+// connection seen there is a client's. When connections cannot be observed
+// on this platform the tunnel is treated as active, so it is never stopped
+// for idleness by mistake.
+func (m *Manager) clientActive(rt model.TunnelRuntime) bool {
+	m.mu.Lock()
+	tc := m.traffic[rt.ID]
+	m.mu.Unlock()
+	if tc != nil {
+		return tc.active.Load() > 0
+	}
+	_, port, err := splitAddrPort(rt.Local)
+	if err != nil {
+		return true
+	}
+	n, ok := clientSockets(port)
+	if !ok {
+		m.warnIdleUnsupported.Do(func() {
+			slog.Warn("cannot observe tunnel connections on this platform; idle timeouts are not enforced")
+		})
+		return true
+	}
+	return n > 0
+}
+
+// expire stops a tunnel whose TTL or idle timeout ran out and records why.
+func (m *Manager) expire(id, eventType, reason string) {
+	rt, err := m.Get(id)
+	if err != nil {
+		return
+	}
+	m.recordEvent(eventType, rt, reason)
+	if err := m.Stop(id); err != nil {
+		slog.Warn("failed to stop expired tunnel", "id", id, "error", err)
+		return
+	}
+	m.mu.Lock()
+	rt = m.runtime[id]
+	rt.LastError = "stopped: " + reason
+	m.runtime[id] = rt
+	m.mu.Unlock()
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel state after expiry", "error", err)
+	}
+}
+
+// clientSockets counts the TCP sockets of open connections to port:
+// accepted ones (local port is port) and, for clients on this host, the
+// client ends (remote port is port, same address on both sides). Sockets
+// that are listening or already closed (CLOSE, TIME_WAIT) do not count. It
+// reads /proc/net/tcp{,6} and reports ok=false where those do not exist.
+func clientSockets(port int) (int, bool) {
+	total := 0
+	found := false
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		n, err := countClientSockets(path, port)
+		if err != nil {
+			continue
+		}
+		found = true
+		total += n
+	}
+	return total, found
+}
+
+// /proc/net/tcp socket states that do not belong to an open connection.
+const (
+	tcpStateTimeWait = "06"
+	tcpStateClose    = "07"
+	tcpStateListen   = "0A"
+)
+
+func countClientSockets(path string, port int) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n := 0
+	sc := bufio.NewScanner(f)
+	sc.Scan() // header
+	for sc.Scan() {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		switch fields[3] {
+		case tcpStateListen, tcpStateClose, tcpStateTimeWait:
+			continue
+		}
+		local, remote := fields[1], fields[2]
+		switch {
+		case parseHexPort(local) == port:
+			n++
+		case parseHexPort(remote) == port && hexAddr(local) == hexAddr(remote):
+			n++
+		}
+	}
+	return n, sc.Err()
+}
+
+// hexAddr returns the address part of a /proc/net/tcp "addr:port" field.
+func hexAddr(s string) string {
+	addr, _, _ := strings.Cut(s, ":")
+	return addr
+}
+
+// parseHexPort returns the port of a /proc/net/tcp address such as
+// "0100007F:1F90", or -1 for malformed input.
+func parseHexPort(addr string) int {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return -1
+	}
+	p, err := strconv.ParseInt(addr[i+1:], 16, 32)
+	if err != nil {
+		return -1
+	}
+	return int(p)
+}
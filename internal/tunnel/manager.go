@@ -41,7 +41,6 @@ import (
 	"net"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -52,10 +51,13 @@ import (
 	"github.com/treykane/ssh-manager/internal/appconfig"
 	"github.com/treykane/ssh-manager/internal/config"
 	"github.com/treykane/ssh-manager/internal/events"
+	"github.com/treykane/ssh-manager/internal/health"
 	"github.com/treykane/ssh-manager/internal/model"
 	"github.com/treykane/ssh-manager/internal/security"
 	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/state"
 	"github.com/treykane/ssh-manager/internal/util"
+	"github.com/treykane/ssh-manager/internal/webhook"
 )
 
 // Manager coordinates SSH tunnel processes and tracks their runtime state.
@@ -107,12 +109,73 @@ type Manager struct {
 	autoRestart        bool
 	restartMaxAttempts int
 	restartBackoff     time.Duration
+	restartBackoffMax  time.Duration
+	restartJitter      float64
 	restartStable      time.Duration
 	restartAttempts    map[string]int
 	restartStats       map[string]RestartStats
 
+	// breakers holds the auto-restart circuit breaker of each host.
+	breakers         map[string]BreakerStats
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
 	// event journal for lifecycle observability.
 	eventStore *events.Store
+
+	// forwardConfigs holds app-config forward settings (health checks).
+	forwardConfigs []appconfig.ForwardConfig
+
+	// health caches the latest application-level health result per tunnel ID.
+	health map[string]model.HealthResult
+
+	// watches holds the stderr watcher of the most recent process per
+	// tunnel ID, so the in-memory stderr tail outlives the process.
+	watches map[string]*procWatch
+
+	// readyTimeout bounds the readiness phase of Start. Zero disables the
+	// gate: tunnels are reported up as soon as the ssh process has a PID.
+	readyTimeout time.Duration
+
+	// onDemand holds the listener side of armed (on-demand) tunnels.
+	onDemand map[string]*onDemandTunnel
+
+	// onDemandIdle is the default idle timeout for on-demand tunnels.
+	onDemandIdle time.Duration
+
+	// autoPortMin and autoPortMax bound automatic local port allocation.
+	autoPortMin int
+	autoPortMax int
+
+	// defaultTTL and defaultIdle are the lifetime limits of tunnels whose
+	// options and forward config set none (0 = unlimited).
+	defaultTTL  time.Duration
+	defaultIdle time.Duration
+
+	// traffic holds the client counters of relayed and on-demand tunnels
+	// whose listener lives in this process.
+	traffic map[string]*trafficCounter
+
+	// lifetimes holds the stop channel of each tunnel's TTL/idle supervisor.
+	lifetimes map[string]chan struct{}
+
+	// warnIdleUnsupported logs once that connections cannot be observed.
+	warnIdleUnsupported sync.Once
+
+	// multiplex runs forwards over one ControlMaster connection per host by
+	// default (see ForwardOptions.Multiplex).
+	multiplex bool
+
+	// masters holds the shared ControlMaster of each host with multiplexed
+	// forwards.
+	masters map[string]*master
+
+	// hookMu guards hooks, hookSlots and webhooks. It is separate from mu
+	// because events are recorded with mu held.
+	hookMu    sync.Mutex
+	hooks     []appconfig.HookConfig
+	hookSlots chan struct{}
+	webhooks  *webhook.Dispatcher
 }
 
 // PreflightFinding captures one check result in a tunnel preflight run.
@@ -139,6 +202,11 @@ type ReconcileAction struct {
 	ToState   model.TunnelState `json:"to_state"`
 	Reason    string            `json:"reason"`
 	Recovered bool              `json:"recovered"`
+
+	// Adoptable marks a report of an unmanaged ssh process (PID) that
+	// "tunnel adopt" can import; nothing was changed for it.
+	PID       int  `json:"pid,omitempty"`
+	Adoptable bool `json:"adoptable,omitempty"`
 }
 
 // RestartStats tracks auto-restart reliability for one tunnel ID.
@@ -148,6 +216,13 @@ type RestartStats struct {
 	Failures    int       `json:"failures"`
 	LastError   string    `json:"last_error,omitempty"`
 	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+
+	// LastBackoffMS is the delay before the most recent restart attempt.
+	LastBackoffMS int64 `json:"last_backoff_ms,omitempty"`
+
+	// Breaker is the circuit breaker state of the tunnel's host, filled in
+	// by Manager.RestartStats (empty when the host has no breaker).
+	Breaker string `json:"breaker,omitempty"`
 }
 
 // TunnelStarter abstracts SSH tunnel process creation for testing.
@@ -162,6 +237,97 @@ type TunnelStarter interface {
 	StartTunnel(ctx context.Context, host model.HostEntry, fwd model.ForwardSpec) (*sshclient.TunnelProcess, error)
 }
 
+// ForwardOptions carries per-forward settings that are not part of the SSH
+// forward specification. Zero-valued fields fall back to the matching app
+// config forward entry (see SetForwardConfigs).
+type ForwardOptions struct {
+	// HealthCheck is the application-level check to run for this forward.
+	HealthCheck *model.HealthCheck
+
+	// OnDemand arms the tunnel instead of starting ssh: ssh-manager listens
+	// on the local address and starts ssh when the first client connects.
+	OnDemand bool
+
+	// IdleTimeout is how long the tunnel may go without client connections
+	// (0 = manager default). An on-demand tunnel then stops ssh and re-arms;
+	// any other tunnel is stopped.
+	IdleTimeout time.Duration
+
+	// TTL is the maximum lifetime of the tunnel (0 = manager default).
+	TTL time.Duration
+
+	// Relay makes ssh-manager own the local listener and relay clients into
+	// ssh on an internal port, counting connections and bytes.
+	Relay bool
+
+	// Deadline, when set, is used as the TTL expiry instead of now+TTL.
+	// Auto-restarts pass the original deadline so a crash does not renew it.
+	Deadline time.Time
+
+	// AutoPort allocates a free local port when the declared one is taken.
+	// Forwards that declare local port 0 ("auto") are always allocated.
+	AutoPort bool
+
+	// DependsOn names tunnels to bring up first ("host", "host:local_port"
+	// or a runtime ID). Starting refuses dependency cycles.
+	DependsOn []string
+
+	// Multiplex adds the forward to the host's shared ControlMaster
+	// connection instead of running a separate ssh. Ignored for on-demand
+	// and relayed tunnels.
+	Multiplex bool
+
+	// chain holds the tunnels whose start is waiting on this one.
+	chain []string
+}
+
+// OptionsFromRuntime returns the options a tunnel was started with, so that
+// restarts keep per-forward overrides (e.g. from a bundle entry).
+func OptionsFromRuntime(rt model.TunnelRuntime) ForwardOptions {
+	return ForwardOptions{
+		HealthCheck: rt.HealthCheck,
+		OnDemand:    rt.OnDemand,
+		IdleTimeout: time.Duration(rt.IdleTimeoutSec) * time.Second,
+		TTL:         time.Duration(rt.TTLSec) * time.Second,
+		Relay:       rt.Relay,
+		AutoPort:    rt.AutoPort,
+		DependsOn:   rt.DependsOn,
+		Multiplex:   rt.Multiplexed,
+	}
+}
+
+// RequestedForward returns the forward a tunnel was started from: the
+// declared local port (0 for "auto") rather than an allocated one, so that
+// restarting it yields the same runtime ID. Entries restored from disk are
+// rebuilt from their Local and Remote endpoints.
+func RequestedForward(rt model.TunnelRuntime) (model.ForwardSpec, error) {
+	fwd := rt.Forward
+	if fwd.LocalPort == 0 || fwd.RemotePort == 0 {
+		parsed, err := ParseForwardArg(fmt.Sprintf("%s:%s", rt.Local, rt.Remote))
+		if err != nil {
+			return model.ForwardSpec{}, err
+		}
+		fwd = parsed
+	}
+	if rt.AutoPort {
+		fwd.LocalPort = rt.RequestedLocalPort
+	}
+	return fwd, nil
+}
+
+// portAlloc records how a tunnel's local port was chosen.
+type portAlloc struct {
+	auto      bool
+	requested int
+}
+
+func (a portAlloc) apply(rt *model.TunnelRuntime) {
+	if a.auto {
+		rt.AutoPort = true
+		rt.RequestedLocalPort = a.requested
+	}
+}
+
 // NewManager creates a new tunnel manager with the given SSH process launcher.
 //
 // The returned Manager has empty state; call LoadRuntime() after creation to
@@ -176,10 +342,24 @@ func NewManager(client TunnelStarter) *Manager {
 		autoRestart:        true,
 		restartMaxAttempts: 3,
 		restartBackoff:     2 * time.Second,
+		restartBackoffMax:  60 * time.Second,
+		restartJitter:      0.2,
 		restartStable:      30 * time.Second,
 		restartAttempts:    make(map[string]int),
 		restartStats:       make(map[string]RestartStats),
+		breakers:           make(map[string]BreakerStats),
+		breakerThreshold:   5,
+		breakerCooldown:    60 * time.Second,
 		eventStore:         events.NewStore(),
+		health:             make(map[string]model.HealthResult),
+		watches:            make(map[string]*procWatch),
+		onDemand:           make(map[string]*onDemandTunnel),
+		onDemandIdle:       DefaultOnDemandIdle,
+		autoPortMin:        appconfig.DefaultAutoPortMin,
+		autoPortMax:        appconfig.DefaultAutoPortMax,
+		lifetimes:          make(map[string]chan struct{}),
+		traffic:            make(map[string]*trafficCounter),
+		masters:            make(map[string]*master),
 	}
 	_ = m.loadRestartStats()
 	return m
@@ -193,20 +373,23 @@ func (m *Manager) Events(q events.Query) ([]events.Event, error) {
 }
 
 func (m *Manager) recordEvent(eventType string, rt model.TunnelRuntime, message string) {
-	if m.eventStore == nil {
-		return
-	}
-	if err := m.eventStore.Append(events.Event{
+	evt := events.Event{
 		Timestamp: time.Now().UTC(),
 		TunnelID:  rt.ID,
 		HostAlias: rt.HostAlias,
 		EventType: eventType,
 		State:     rt.State,
 		Message:   message,
+		ErrorCode: rt.ErrorCode,
 		PID:       rt.PID,
-	}); err != nil {
-		slog.Warn("failed to append tunnel event", "event", eventType, "error", err)
 	}
+	if m.eventStore != nil {
+		if err := m.eventStore.Append(evt); err != nil {
+			slog.Warn("failed to append tunnel event", "event", eventType, "error", err)
+		}
+	}
+	m.runHooks(evt, rt)
+	m.notifyWebhooks(evt)
 }
 
 func (m *Manager) RestartStats() map[string]RestartStats {
@@ -214,11 +397,18 @@ func (m *Manager) RestartStats() map[string]RestartStats {
 	defer m.mu.Unlock()
 	out := make(map[string]RestartStats, len(m.restartStats))
 	for id, st := range m.restartStats {
+		st.Breaker = m.breakers[hostOfID(id)].State
 		out[id] = st
 	}
 	return out
 }
 
+// hostOfID returns the host alias part of a runtime ID.
+func hostOfID(id string) string {
+	host, _, _ := strings.Cut(id, "|")
+	return host
+}
+
 func (m *Manager) markRestartAttempt(id string) {
 	m.mu.Lock()
 	st := m.restartStats[id]
@@ -262,6 +452,94 @@ func (m *Manager) SetRedactErrors(redact bool) {
 	m.redactErrors = redact
 }
 
+// SetReadyTimeout sets how long Start waits for a tunnel to accept
+// connections on its local port before reporting it up. Zero disables the
+// readiness gate.
+func (m *Manager) SetReadyTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	m.mu.Lock()
+	m.readyTimeout = d
+	m.mu.Unlock()
+}
+
+// SetOnDemandIdle sets the default idle timeout of on-demand tunnels.
+func (m *Manager) SetOnDemandIdle(d time.Duration) {
+	if d <= 0 {
+		d = DefaultOnDemandIdle
+	}
+	m.mu.Lock()
+	m.onDemandIdle = d
+	m.mu.Unlock()
+}
+
+// SetLifetimeDefaults sets the TTL and idle timeout applied to tunnels that
+// configure none. Zero disables the limit.
+func (m *Manager) SetLifetimeDefaults(ttl, idle time.Duration) {
+	m.mu.Lock()
+	m.defaultTTL = max(ttl, 0)
+	m.defaultIdle = max(idle, 0)
+	m.mu.Unlock()
+}
+
+// SetForwardConfigs installs app-config forward entries used to resolve
+// per-forward options such as health checks.
+func (m *Manager) SetForwardConfigs(forwards []appconfig.ForwardConfig) {
+	m.mu.Lock()
+	m.forwardConfigs = append([]appconfig.ForwardConfig(nil), forwards...)
+	m.mu.Unlock()
+}
+
+// resolveOptions fills unset fields of opts from the app config forward entry.
+func (m *Manager) resolveOptions(hostAlias string, localPort int, opts ForwardOptions) ForwardOptions {
+	m.mu.Lock()
+	fc, ok := appconfig.FindForwardConfig(m.forwardConfigs, hostAlias, localPort)
+	onDemandIdle, idle, ttl := m.onDemandIdle, m.defaultIdle, m.defaultTTL
+	multiplex := m.multiplex
+	m.mu.Unlock()
+	if ok {
+		if opts.HealthCheck == nil {
+			opts.HealthCheck = fc.HealthCheck
+		}
+		if !opts.OnDemand {
+			opts.OnDemand = fc.OnDemand
+		}
+		if !opts.Relay {
+			opts.Relay = fc.Relay
+		}
+		if !opts.AutoPort {
+			opts.AutoPort = fc.AutoPort
+		}
+		if opts.IdleTimeout <= 0 && fc.IdleTimeoutSeconds > 0 {
+			opts.IdleTimeout = time.Duration(fc.IdleTimeoutSeconds) * time.Second
+		}
+		if opts.TTL <= 0 && fc.TTLSeconds > 0 {
+			opts.TTL = time.Duration(fc.TTLSeconds) * time.Second
+		}
+		if len(opts.DependsOn) == 0 {
+			opts.DependsOn = fc.DependsOn
+		}
+		if !opts.Multiplex {
+			opts.Multiplex = fc.Multiplex
+		}
+	}
+	if !opts.Multiplex {
+		opts.Multiplex = multiplex
+	}
+	if opts.IdleTimeout <= 0 {
+		if opts.OnDemand {
+			opts.IdleTimeout = onDemandIdle
+		} else {
+			opts.IdleTimeout = idle
+		}
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = ttl
+	}
+	return opts
+}
+
 // SetRestartPolicy updates auto-restart behavior for unexpected tunnel exits.
 func (m *Manager) SetRestartPolicy(autoRestart bool, maxAttempts, backoffSeconds, stableWindowSeconds int) {
 	m.autoRestart = autoRestart
@@ -304,7 +582,9 @@ func (m *Manager) Preflight(host model.HostEntry, fwd model.ForwardSpec) Preflig
 		add("ssh-binary", true, "ssh binary found on PATH")
 	}
 
-	if err := util.ValidatePort(fwd.LocalPort); err != nil {
+	if fwd.LocalPort == 0 {
+		add("local-port", true, "local port is allocated automatically")
+	} else if err := util.ValidatePort(fwd.LocalPort); err != nil {
 		add("local-port", false, fmt.Sprintf("invalid local port: %v", err))
 	} else {
 		add("local-port", true, "local port is valid")
@@ -342,9 +622,15 @@ func (m *Manager) canBindLocal(hostAlias string, fwd model.ForwardSpec) (bool, s
 	m.mu.Lock()
 	rt, ok := m.runtime[id]
 	m.mu.Unlock()
-	if ok && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting) {
+	if ok && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting || rt.State == model.TunnelArmed) {
 		return true, "already active in manager runtime"
 	}
+	if fwd.LocalPort == 0 {
+		m.mu.Lock()
+		lo, hi := m.autoPortMin, m.autoPortMax
+		m.mu.Unlock()
+		return true, fmt.Sprintf("local port will be allocated from %d-%d", lo, hi)
+	}
 
 	local := fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"), fwd.LocalPort)
 	ln, err := net.Listen("tcp", local)
@@ -387,14 +673,23 @@ func RuntimeID(hostAlias string, fwd model.ForwardSpec) string {
 // Returns the TunnelRuntime record for the tunnel (which may be in "error" state
 // if the SSH process failed to start) and any error from the start attempt.
 func (m *Manager) Start(host model.HostEntry, fwd model.ForwardSpec) (model.TunnelRuntime, error) {
+	return m.StartWithOptions(host, fwd, ForwardOptions{})
+}
+
+// StartWithOptions is Start with per-forward options. Unset options are
+// resolved from the app config forward entries.
+func (m *Manager) StartWithOptions(host model.HostEntry, fwd model.ForwardSpec, opts ForwardOptions) (model.TunnelRuntime, error) {
 	defer func() {
 		// One-off override is consumed by a single start attempt.
 		m.allowPublicBind = false
 	}()
 
-	// Validate that both local and remote ports are in the valid TCP range (1-65535).
-	if err := util.ValidatePort(fwd.LocalPort); err != nil {
-		return model.TunnelRuntime{}, fmt.Errorf("invalid local port: %w", err)
+	// Validate that both local and remote ports are in the valid TCP range
+	// (1-65535). Local port 0 asks for an automatically allocated port.
+	if fwd.LocalPort != 0 {
+		if err := util.ValidatePort(fwd.LocalPort); err != nil {
+			return model.TunnelRuntime{}, fmt.Errorf("invalid local port: %w", err)
+		}
 	}
 	if err := util.ValidatePort(fwd.RemotePort); err != nil {
 		return model.TunnelRuntime{}, fmt.Errorf("invalid remote port: %w", err)
@@ -410,12 +705,87 @@ func (m *Manager) Start(host model.HostEntry, fwd model.ForwardSpec) (model.Tunn
 	}
 
 	id := RuntimeID(host.Alias, fwd)
+	opts = m.resolveOptions(host.Alias, fwd.LocalPort, opts)
+
+	m.mu.Lock()
+	if rt, ok := m.runtime[id]; ok && (rt.State == model.TunnelUp || (rt.State == model.TunnelArmed && m.onDemand[id] != nil)) {
+		m.mu.Unlock()
+		return rt, nil
+	}
+	m.mu.Unlock()
+
+	// Dependencies come up first; from here on opts.DependsOn holds their
+	// runtime IDs.
+	deps, err := m.startDependencies(id, opts.DependsOn, opts.chain)
+	if err != nil {
+		return model.TunnelRuntime{}, err
+	}
+	opts.DependsOn = deps
+
+	// The runtime ID keeps the declared forward; from here on fwd is the
+	// forward actually started, with an allocated local port if needed.
+	alloc := portAlloc{requested: fwd.LocalPort}
+	alloc.auto = fwd.LocalPort == 0 ||
+		(opts.AutoPort && !canListen(fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"), fwd.LocalPort)))
+	if alloc.auto {
+		port, err := m.allocatePort(id, fwd.LocalAddr)
+		if err != nil {
+			return model.TunnelRuntime{}, security.NewClassifiedError("no free local port available", err.Error())
+		}
+		fwd.LocalPort = port
+	}
+
+	if !opts.Deadline.IsZero() && !time.Now().Before(opts.Deadline) {
+		return model.TunnelRuntime{}, fmt.Errorf("tunnel %s: ttl already expired", id)
+	}
+
+	if opts.OnDemand {
+		return m.arm(id, host, fwd, opts, alloc)
+	}
+	local := fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"), fwd.LocalPort)
+
+	m.mu.Lock()
+	readyTimeout := m.readyTimeout
+	m.mu.Unlock()
+	if readyTimeout > 0 && !opts.Relay {
+		// With the readiness gate enabled, a port that already accepts
+		// connections would make any tunnel look ready. Refuse up front.
+		if existing, err := m.Get(id); (err != nil || existing.State != model.TunnelUp) && portAccepting(local) {
+			return model.TunnelRuntime{}, security.NewClassifiedError(
+				fmt.Sprintf("local port %s is already in use", local),
+				fmt.Sprintf("dial %s succeeded before ssh was started", local),
+			)
+		}
+	}
+
+	// In relay mode ssh-manager owns the local listener and ssh binds an
+	// internal loopback port, so client traffic passes through this process.
+	sshFwd, readyAddr := fwd, local
+	var rl *relay
+	if opts.Relay {
+		r, err := m.newRelay(id, local)
+		if err != nil {
+			return model.TunnelRuntime{}, err
+		}
+		rl = r
+		bhost, bport, _ := splitAddrPort(r.backend)
+		sshFwd.LocalAddr, sshFwd.LocalPort = bhost, bport
+		readyAddr = r.backend
+		if readyTimeout <= 0 {
+			// Clients are relayed as soon as the tunnel is up, so wait for
+			// ssh to listen even without the readiness gate.
+			readyTimeout = onDemandReadyTimeout
+		}
+	}
 
 	// Check for an already-running tunnel with the same ID. This prevents
 	// duplicate SSH processes for the same host+forward combination.
 	m.mu.Lock()
 	if rt, ok := m.runtime[id]; ok && rt.State == model.TunnelUp {
 		m.mu.Unlock()
+		if rl != nil {
+			rl.close()
+		}
 		return rt, nil
 	}
 
@@ -426,23 +796,52 @@ func (m *Manager) Start(host model.HostEntry, fwd model.ForwardSpec) (model.Tunn
 	// Initialize the runtime record in "starting" state. The local/remote
 	// strings are pre-formatted for display and health-check use.
 	rt := model.TunnelRuntime{
-		ID:        id,
-		HostAlias: host.Alias,
-		Forward:   fwd,
-		Local:     fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"), fwd.LocalPort),
-		Remote:    fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.RemoteAddr, "localhost"), fwd.RemotePort),
-		State:     model.TunnelStarting,
-		StartedAt: time.Now(),
-	}
+		ID:          id,
+		HostAlias:   host.Alias,
+		Forward:     fwd,
+		Local:       local,
+		Remote:      fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.RemoteAddr, "localhost"), fwd.RemotePort),
+		State:       model.TunnelStarting,
+		StartedAt:   time.Now(),
+		HealthCheck: opts.HealthCheck,
+		DependsOn:   opts.DependsOn,
+	}
+	if rl != nil {
+		rt.Relay = true
+		rt.Backend = rl.backend
+		rt.OwnerPID = os.Getpid()
+		rt.Traffic = rl.traffic.stats()
+	}
+	alloc.apply(&rt)
+	applyLifetime(&rt, opts, rt.StartedAt)
 	m.runtime[id] = rt
+	delete(m.health, id)
 	m.cancel[id] = cancel
 	m.mu.Unlock()
-	m.recordEvent("start_requested", rt, "start requested")
+	if alloc.auto {
+		m.recordEvent("start_requested", rt, "start requested on allocated local port "+strconv.Itoa(fwd.LocalPort))
+	} else {
+		m.recordEvent("start_requested", rt, "start requested")
+	}
 
 	// Attempt to launch the SSH tunnel process. This calls the system SSH
 	// binary with -N -L flags (see sshclient.StartTunnel for details).
-	proc, err := m.client.StartTunnel(ctx, host, fwd)
+	// Multiplexed forwards are added to the host's ControlMaster instead.
+	var (
+		proc *sshclient.TunnelProcess
+		ms   *master
+		w    *procWatch
+	)
+	if opts.Multiplex && rl == nil {
+		ms, w, err = m.startMultiplexed(id, host, sshFwd)
+	} else {
+		proc, err = m.client.StartTunnel(ctx, host, sshFwd)
+	}
 	if err != nil {
+		cancel()
+		if rl != nil {
+			rl.close()
+		}
 		// Start failed — update the tunnel state to "error" and record the
 		// error message so it can be displayed in the UI or CLI output.
 		m.mu.Lock()
@@ -459,19 +858,88 @@ func (m *Manager) Start(host model.HostEntry, fwd model.ForwardSpec) (model.Tunn
 		return rt, security.NewClassifiedError("failed to start tunnel", security.DebugMessage(err))
 	}
 
-	// Process started successfully — record the PID and transition to "up" state.
+	// Process started successfully — record the PID.
+	var stop func()
+	if ms != nil {
+		// The forward lives in the master, so the tunnel is identified by
+		// the master process; stopping it only cancels the forward.
+		rt.PID = ms.proc.PID
+		rt.Argv, rt.ProcStart = ms.proc.Argv, ms.proc.ProcStart
+		rt.Multiplexed = true
+		rt.ControlPath = ms.path
+		released := rt
+		var once sync.Once
+		stop = func() {
+			once.Do(func() {
+				cancel()
+				m.releaseMultiplexed(released)
+			})
+		}
+	} else {
+		logPath, logErr := LogPath(id)
+		if logErr != nil {
+			slog.Warn("failed to resolve tunnel log path", "error", logErr)
+		}
+		w = newProcWatch(proc, logPath, func(code sshclient.ErrorCode, line string) {
+			m.noteStderrCode(id, code)
+		})
+		stop = func() {
+			cancel()
+			w.closeStderr()
+			if rl != nil {
+				rl.close()
+			}
+		}
+		rt.PID = proc.Cmd.Process.Pid
+		recordProcess(&rt, proc.Cmd.Args)
+	}
 	m.mu.Lock()
-	rt.PID = proc.Cmd.Process.Pid
+	m.cancel[id] = stop
+	m.watches[id] = w
+	m.runtime[id] = rt
+	m.mu.Unlock()
+
+	// Readiness gate: stay "starting" until the local port accepts
+	// connections, ssh reports a fatal error on stderr, or ssh exits.
+	if readyTimeout > 0 {
+		if persistErr := m.persist(); persistErr != nil {
+			slog.Warn("failed to persist tunnel state while starting", "error", persistErr)
+		}
+		if reason := awaitReady(readyAddr, w, readyTimeout); reason != "" {
+			return m.failReadiness(id, stop, w, reason)
+		}
+	}
+
+	// Transition to "up".
+	m.mu.Lock()
+	cur, ok := m.runtime[id]
+	if ok && cur.State != model.TunnelStarting {
+		// Stopped while the readiness gate was running.
+		m.mu.Unlock()
+		return cur, fmt.Errorf("tunnel %s was stopped before it became ready", id)
+	}
 	rt.State = model.TunnelUp
+	rt.ErrorCode = cur.ErrorCode
 	m.runtime[id] = rt
 	m.mu.Unlock()
 	m.scheduleRestartReset(id, rt.StartedAt)
 	m.recordEvent("start_succeeded", rt, "tunnel started")
+	if needsSupervision(rt) {
+		m.superviseLifetime(id)
+	}
+	if rl != nil {
+		go m.serveRelay(rl)
+		go func() {
+			// The relay has nothing to forward to once ssh is gone.
+			<-w.done
+			rl.close()
+		}()
+	}
 
 	// Spawn a goroutine to wait for the SSH process to exit. This goroutine
 	// will update the tunnel state to "down" or "error" when the process
 	// terminates, and persist the updated state to disk.
-	go m.watchProcess(id, proc)
+	go m.watchProcess(id, w)
 
 	if err := m.persist(); err != nil {
 		slog.Warn("failed to persist tunnel state after start", "error", err)
@@ -479,6 +947,75 @@ func (m *Manager) Start(host model.HostEntry, fwd model.ForwardSpec) (model.Tunn
 	return m.Get(id)
 }
 
+// failReadiness stops a tunnel that did not become ready and records why.
+// The process is killed before the state is updated, so watchProcess never
+// sees this exit.
+func (m *Manager) failReadiness(id string, stop func(), w *procWatch, reason string) (model.TunnelRuntime, error) {
+	stop()
+	<-w.done
+
+	m.mu.Lock()
+	rt := m.runtime[id]
+	if rt.State != model.TunnelStarting {
+		// Stop() won the race; leave its state in place.
+		m.mu.Unlock()
+		return rt, fmt.Errorf("tunnel %s was stopped before it became ready", id)
+	}
+	rt.State = model.TunnelError
+	rt.PID = 0
+	rt.ErrorCode = string(w.code())
+	rt.LastError = security.UserMessage(errors.New("tunnel not ready: "+reason), m.redactErrors)
+	m.runtime[id] = rt
+	delete(m.cancel, id)
+	m.mu.Unlock()
+	m.recordEvent("start_failed", rt, rt.LastError)
+
+	if persistErr := m.persist(); persistErr != nil {
+		slog.Warn("failed to persist tunnel state after readiness failure", "error", persistErr)
+	}
+	return rt, security.NewClassifiedError("tunnel not ready: "+reason, w.stderrTail())
+}
+
+// noteStderrCode records a classified ssh stderr failure on the tunnel.
+// Fatal codes end the process and are reported by the exit path; non-fatal
+// ones (a forwarded connection failing while ssh stays up) get their own
+// "ssh_error" event whenever the code changes.
+func (m *Manager) noteStderrCode(id string, code sshclient.ErrorCode) {
+	m.mu.Lock()
+	rt, ok := m.runtime[id]
+	if !ok || rt.ErrorCode == string(code) {
+		m.mu.Unlock()
+		return
+	}
+	rt.ErrorCode = string(code)
+	m.runtime[id] = rt
+	m.mu.Unlock()
+	if !code.Fatal() {
+		m.recordEvent("ssh_error", rt, code.Describe())
+	}
+}
+
+// StderrTail returns the most recent ssh stderr lines of a tunnel's current
+// (or last) process, oldest first. Earlier output is in the file at LogPath.
+func (m *Manager) StderrTail(id string) []string {
+	m.mu.Lock()
+	w := m.watches[id]
+	m.mu.Unlock()
+	if w == nil {
+		return nil
+	}
+	return w.lines()
+}
+
+// exitReason describes why a tunnel process exited, preferring the
+// classified stderr failure over the bare exit status.
+func exitReason(code sshclient.ErrorCode, fallback string) string {
+	if code == "" {
+		return fallback
+	}
+	return code.Describe()
+}
+
 // watchProcess blocks until the SSH tunnel process exits, then updates the
 // tunnel's runtime state accordingly.
 //
@@ -493,9 +1030,11 @@ func (m *Manager) Start(host model.HostEntry, fwd model.ForwardSpec) (model.Tunn
 //
 //  3. Process exited cleanly (err == nil): the SSH connection closed normally
 //     (e.g., remote server closed the connection) — set state to TunnelDown.
-func (m *Manager) watchProcess(id string, proc *sshclient.TunnelProcess) {
-	// Cmd.Wait() blocks until the process exits and returns its exit status.
-	err := proc.Cmd.Wait()
+func (m *Manager) watchProcess(id string, w *procWatch) {
+	// Block until the process has been reaped and take its exit status.
+	<-w.done
+	err := w.err
+	code := w.code()
 
 	m.mu.Lock()
 	rt, ok := m.runtime[id]
@@ -505,23 +1044,39 @@ func (m *Manager) watchProcess(id string, proc *sshclient.TunnelProcess) {
 		m.mu.Unlock()
 		return
 	}
+	if cur := m.watches[id]; cur != nil && cur != w {
+		// Stopped and started again (e.g. Restart) before this exit was
+		// reaped; the runtime entry belongs to the new process.
+		m.mu.Unlock()
+		return
+	}
+	if code != "" {
+		rt.ErrorCode = string(code)
+	}
 
 	// If the tunnel is already in an intentional terminal/transition state
 	// from Stop(), don't overwrite it with process-exit derived values.
 	if rt.State != model.TunnelStopping && rt.State != model.TunnelDown {
 		if err != nil {
 			if m.autoRestart {
+				// Dying again before the stable window reset the counter
+				// means the last restart failed; that counts against the
+				// host's circuit breaker.
+				restartFailed := m.restartAttempts[id] > 0
 				attempt := m.restartAttempts[id] + 1
 				if attempt <= m.restartMaxAttempts {
 					m.restartAttempts[id] = attempt
 					rt.State = model.TunnelError
-					rt.LastError = fmt.Sprintf("unexpected exit; auto-restart attempt %d/%d", attempt, m.restartMaxAttempts)
+					rt.LastError = fmt.Sprintf("%s; auto-restart attempt %d/%d", exitReason(code, "unexpected exit"), attempt, m.restartMaxAttempts)
 					m.runtime[id] = rt
 					delete(m.cancel, id)
 					m.mu.Unlock()
 					m.recordEvent("unexpected_exit", rt, rt.LastError)
 					m.recordEvent("restart_attempt", rt, fmt.Sprintf("auto-restart attempt %d/%d scheduled", attempt, m.restartMaxAttempts))
 					m.markRestartAttempt(id)
+					if restartFailed {
+						m.noteRestartResult(rt.HostAlias, rt, false)
+					}
 
 					if persistErr := m.persist(); persistErr != nil {
 						slog.Warn("failed to persist tunnel state after restart scheduling", "error", persistErr)
@@ -535,9 +1090,12 @@ func (m *Manager) watchProcess(id string, proc *sshclient.TunnelProcess) {
 				m.runtime[id] = rt
 				delete(m.cancel, id)
 				m.mu.Unlock()
-				m.recordEvent("unexpected_exit", rt, "unexpected tunnel exit")
+				m.recordEvent("unexpected_exit", rt, exitReason(code, "unexpected tunnel exit"))
 				m.recordEvent("quarantine", rt, rt.LastError)
 				m.markRestartFailure(id, rt.LastError)
+				if restartFailed {
+					m.noteRestartResult(rt.HostAlias, rt, false)
+				}
 				if persistErr := m.persist(); persistErr != nil {
 					slog.Warn("failed to persist tunnel state after quarantine", "error", persistErr)
 				}
@@ -545,6 +1103,9 @@ func (m *Manager) watchProcess(id string, proc *sshclient.TunnelProcess) {
 			}
 			rt.State = model.TunnelError
 			rt.LastError = security.UserMessage(err, m.redactErrors)
+			if code != "" {
+				rt.LastError = code.Describe() + " (" + rt.LastError + ")"
+			}
 			m.recordEvent("unexpected_exit", rt, rt.LastError)
 		} else {
 			rt.State = model.TunnelDown
@@ -580,18 +1141,15 @@ func (m *Manager) Recover(id string) (model.TunnelRuntime, error) {
 		m.recordEvent("recover_failed", rt, err.Error())
 		return model.TunnelRuntime{}, err
 	}
-	fwd := rt.Forward
-	if fwd.LocalPort == 0 || fwd.RemotePort == 0 {
-		fwd, err = ParseForwardArg(fmt.Sprintf("%s:%s", rt.Local, rt.Remote))
-		if err != nil {
-			m.recordEvent("recover_failed", rt, err.Error())
-			return model.TunnelRuntime{}, err
-		}
+	fwd, err := RequestedForward(rt)
+	if err != nil {
+		m.recordEvent("recover_failed", rt, err.Error())
+		return model.TunnelRuntime{}, err
 	}
 	m.mu.Lock()
 	m.restartAttempts[id] = 0
 	m.mu.Unlock()
-	next, err := m.Start(host, fwd)
+	next, err := m.StartWithOptions(host, fwd, OptionsFromRuntime(rt))
 	if err != nil {
 		m.recordEvent("recover_failed", rt, security.UserMessage(err, m.redactErrors))
 		return model.TunnelRuntime{}, err
@@ -627,7 +1185,8 @@ func (m *Manager) RecoverByHost(hostAlias string) ([]model.TunnelRuntime, error)
 
 // Reconcile validates runtime entries and quarantines suspicious state.
 // If recoverQuarantined is true, newly quarantined entries are immediately
-// recovered with the normal Recover flow.
+// recovered with the normal Recover flow. Unmanaged ssh tunnels that could
+// be adopted are reported as Adoptable actions.
 func (m *Manager) Reconcile(hostAlias string, recoverQuarantined bool) ([]ReconcileAction, error) {
 	m.mu.Lock()
 	ids := make([]string, 0, len(m.runtime))
@@ -648,6 +1207,9 @@ func (m *Manager) Reconcile(hostAlias string, recoverQuarantined bool) ([]Reconc
 			reason = "invalid runtime metadata"
 		} else if rt.State == model.TunnelUp && (rt.PID <= 0 || !processAlive(rt.PID)) {
 			reason = "runtime shows up with dead or missing PID"
+		} else if rt.State == model.TunnelUp && m.watches[id] == nil && !sameProcess(rt) {
+			// Not a child of this process, so the PID may have been reused.
+			reason = "runtime PID now belongs to a different process"
 		}
 		if reason == "" {
 			continue
@@ -692,6 +1254,24 @@ func (m *Manager) Reconcile(hostAlias string, recoverQuarantined bool) ([]Reconc
 			actions[i].Reason = actions[i].Reason + "; recovered pid=" + strconv.Itoa(next.PID)
 		}
 	}
+
+	// Report tunnels ssh-manager could take over; adopting stays explicit.
+	candidates, err := m.Unmanaged(strings.TrimSpace(hostAlias))
+	if err != nil {
+		slog.Debug("skipping unmanaged tunnel scan", "error", err)
+	}
+	for _, c := range candidates {
+		if !c.Adoptable {
+			continue
+		}
+		actions = append(actions, ReconcileAction{
+			ID:        c.ID,
+			HostAlias: c.HostAlias,
+			PID:       c.PID,
+			Adoptable: true,
+			Reason:    fmt.Sprintf("unmanaged ssh tunnel; adopt with \"ssh-manager tunnel adopt %d\"", c.PID),
+		})
+	}
 	return actions, nil
 }
 
@@ -706,7 +1286,22 @@ func runtimeMetadataInvalid(rt model.TunnelRuntime) bool {
 }
 
 func (m *Manager) restartAfterDelay(id string, prev model.TunnelRuntime, attempt int) {
-	time.Sleep(m.restartBackoff)
+	delay := m.restartDelay(attempt)
+	m.mu.Lock()
+	st := m.restartStats[id]
+	st.LastBackoffMS = delay.Milliseconds()
+	m.restartStats[id] = st
+	m.mu.Unlock()
+	time.Sleep(delay)
+
+	// A host whose breaker is open gets no restarts until its probe succeeds.
+	probe, proceed := m.awaitBreaker(id, prev.HostAlias)
+	if !proceed {
+		if probe {
+			m.abandonProbe(prev.HostAlias)
+		}
+		return
+	}
 
 	host, err := findHostByAlias(prev.HostAlias)
 	if err != nil {
@@ -718,43 +1313,75 @@ func (m *Manager) restartAfterDelay(id string, prev model.TunnelRuntime, attempt
 		m.mu.Unlock()
 		m.recordEvent("restart_failure", rt, rt.LastError)
 		m.markRestartFailure(id, rt.LastError)
+		m.noteRestartResult(prev.HostAlias, rt, false)
 		_ = m.persist()
 		return
 	}
 
-	fwd := prev.Forward
-	if fwd.LocalPort == 0 || fwd.RemotePort == 0 {
-		parsed, perr := ParseForwardArg(fmt.Sprintf("%s:%s", prev.Local, prev.Remote))
-		if perr != nil {
-			m.mu.Lock()
-			rt := m.runtime[id]
-			rt.State = model.TunnelError
-			rt.LastError = fmt.Sprintf("auto-restart attempt %d/%d failed: %v", attempt, m.restartMaxAttempts, perr)
-			m.runtime[id] = rt
-			m.mu.Unlock()
-			m.recordEvent("restart_failure", rt, rt.LastError)
-			m.markRestartFailure(id, rt.LastError)
-			_ = m.persist()
-			return
-		}
-		fwd = parsed
+	fwd, perr := RequestedForward(prev)
+	if perr != nil {
+		m.mu.Lock()
+		rt := m.runtime[id]
+		rt.State = model.TunnelError
+		rt.LastError = fmt.Sprintf("auto-restart attempt %d/%d failed: %v", attempt, m.restartMaxAttempts, perr)
+		m.runtime[id] = rt
+		m.mu.Unlock()
+		m.recordEvent("restart_failure", rt, rt.LastError)
+		m.markRestartFailure(id, rt.LastError)
+		m.noteRestartResult(prev.HostAlias, rt, false)
+		_ = m.persist()
+		return
 	}
 
-	next, serr := m.Start(host, fwd)
+	// Keep the original TTL deadline: a crash must not extend the lifetime.
+	opts := OptionsFromRuntime(prev)
+	opts.Deadline = prev.ExpiresAt
+	next, serr := m.StartWithOptions(host, fwd, opts)
 	if serr != nil {
 		m.mu.Lock()
 		rt := m.runtime[id]
+		if rt.State == model.TunnelStopping || rt.State == model.TunnelDown {
+			// Stopped while the restart was in flight.
+			m.mu.Unlock()
+			if probe {
+				m.abandonProbe(prev.HostAlias)
+			}
+			return
+		}
 		rt.State = model.TunnelError
 		rt.LastError = fmt.Sprintf("auto-restart attempt %d/%d failed: %v", attempt, m.restartMaxAttempts, serr)
+		// With the readiness gate, a restart that never becomes ready fails
+		// here rather than through watchProcess; keep retrying until the
+		// attempt budget is spent.
+		next := attempt + 1
+		retry := m.readyTimeout > 0 && next <= m.restartMaxAttempts
+		if retry {
+			m.restartAttempts[id] = next
+		} else if m.readyTimeout > 0 {
+			rt.State = model.TunnelQuarantined
+			rt.PID = 0
+			rt.LastError = fmt.Sprintf("quarantined after %d failed restart attempts", m.restartMaxAttempts)
+		}
 		m.runtime[id] = rt
 		m.mu.Unlock()
 		m.recordEvent("restart_failure", rt, rt.LastError)
 		m.markRestartFailure(id, rt.LastError)
+		m.noteRestartResult(prev.HostAlias, rt, false)
+		if rt.State == model.TunnelQuarantined {
+			m.recordEvent("quarantine", rt, rt.LastError)
+		}
 		_ = m.persist()
+		if retry {
+			m.recordEvent("restart_attempt", rt, fmt.Sprintf("auto-restart attempt %d/%d scheduled", next, m.restartMaxAttempts))
+			m.markRestartAttempt(id)
+			go m.restartAfterDelay(id, prev, next)
+		}
 		return
 	}
 	m.recordEvent("restart_success", next, fmt.Sprintf("auto-restart attempt %d/%d succeeded", attempt, m.restartMaxAttempts))
 	m.markRestartSuccess(id)
+	m.noteRestartResult(prev.HostAlias, next, true)
+	m.restartDependents(id, next.StartedAt)
 }
 
 func (m *Manager) scheduleRestartReset(id string, startedAt time.Time) {
@@ -794,6 +1421,12 @@ func (m *Manager) Stop(id string) error {
 		m.mu.Unlock()
 		return fmt.Errorf("tunnel not found: %s", id)
 	}
+	if ownedElsewhere(rt) {
+		// The listener lives in another ssh-manager process; stopping only
+		// the ssh child here would leave the port bound.
+		m.mu.Unlock()
+		return fmt.Errorf("tunnel %s is held by ssh-manager process %d; stop it there", id, rt.OwnerPID)
+	}
 
 	// Mark as stopping BEFORE sending signals. This tells the watchProcess
 	// goroutine that this is an intentional shutdown, not an unexpected crash.
@@ -803,16 +1436,24 @@ func (m *Manager) Stop(id string) error {
 	m.mu.Unlock()
 	m.recordEvent("stop_requested", rt, "stop requested")
 
+	// Dependents go first: their connections run through this tunnel.
+	m.stopDependents(id)
+
 	// Cancel the context first. For exec.CommandContext, this sends SIGKILL
 	// to the process group.
 	if cancel != nil {
 		cancel()
+	} else if rt.Multiplexed {
+		// Restored from disk: release the forward on its master directly.
+		m.releaseMultiplexed(rt)
 	}
 
 	// Also send SIGTERM as a courtesy signal. Some SSH processes may have
-	// cleanup to do (e.g., closing control sockets). We check if the process
-	// is still alive first to avoid "no such process" errors.
-	if rt.PID > 0 && processAlive(rt.PID) {
+	// cleanup to do (e.g., closing control sockets). sameProcess checks the
+	// process is still alive and still the tunnel's, so a recycled PID is
+	// never signalled. A multiplexed tunnel's PID is the shared master,
+	// which releaseMultiplexed stops once its last forward is gone.
+	if !rt.Multiplexed && sameProcess(rt) {
 		if p, err := os.FindProcess(rt.PID); err == nil {
 			_ = p.Signal(syscall.SIGTERM)
 		}
@@ -820,12 +1461,20 @@ func (m *Manager) Stop(id string) error {
 
 	// Finalize the state: mark as down and clear the PID.
 	m.mu.Lock()
+	pid := rt.PID
 	rt.State = model.TunnelDown
 	rt.PID = 0
+	rt.OwnerPID = 0
 	m.runtime[id] = rt
 	delete(m.cancel, id)
+	delete(m.onDemand, id)
+	delete(m.traffic, id)
+	m.endLifetime(id)
 	m.mu.Unlock()
 	m.recordEvent("stop_succeeded", rt, "tunnel stopped")
+	if rt.Adopted && pid > 0 {
+		m.stopAdoptedSiblings(id, pid)
+	}
 
 	if err := m.persist(); err != nil {
 		slog.Warn("failed to persist tunnel state after stop", "error", err)
@@ -839,31 +1488,41 @@ func (m *Manager) Stop(id string) error {
 // which allows users to stop all tunnels for a host without specifying each
 // tunnel ID individually.
 //
-// A tunnel is considered "active" if its state is TunnelUp, TunnelStarting, or
-// TunnelError (error tunnels may still have lingering processes).
+// A tunnel is considered "active" if its state is TunnelUp, TunnelStarting,
+// TunnelArmed, or TunnelError (error tunnels may still have lingering
+// processes).
 //
 // Returns an error if no active tunnels are found for the given host alias.
 // Individual stop errors are silently ignored (best-effort cleanup).
 func (m *Manager) StopByHost(hostAlias string) error {
 	// Collect tunnel IDs under the lock, then stop them outside the lock
 	// to avoid holding the lock during potentially slow signal operations.
+	ids, err := m.hostStopIDs(hostAlias)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		_ = m.Stop(id)
+	}
+	return nil
+}
+
+// hostStopIDs returns the tunnels of hostAlias that StopByHost stops.
+func (m *Manager) hostStopIDs(hostAlias string) ([]string, error) {
 	m.mu.Lock()
 	ids := make([]string, 0)
 	for id, rt := range m.runtime {
-		if rt.HostAlias == hostAlias && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting || rt.State == model.TunnelError) {
+		if rt.HostAlias == hostAlias && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting || rt.State == model.TunnelError || rt.State == model.TunnelArmed) {
 			ids = append(ids, id)
 		}
 	}
 	m.mu.Unlock()
 
 	if len(ids) == 0 {
-		return fmt.Errorf("no active tunnel for host %s", hostAlias)
-	}
-
-	for _, id := range ids {
-		_ = m.Stop(id)
+		return nil, fmt.Errorf("no active tunnel for host %s", hostAlias)
 	}
-	return nil
+	sort.Strings(ids)
+	return ids, nil
 }
 
 // StopAll stops all managed tunnels regardless of host or state.
@@ -904,6 +1563,10 @@ func (m *Manager) Get(id string) (model.TunnelRuntime, error) {
 	if !rt.StartedAt.IsZero() {
 		rt.UptimeSec = int64(time.Since(rt.StartedAt).Seconds())
 	}
+	rt.RemainingSec = remainingSec(rt, time.Now())
+	if tr := m.liveTraffic(id); tr != nil {
+		rt.Traffic = tr
+	}
 	return rt, nil
 }
 
@@ -916,13 +1579,17 @@ func (m *Manager) Get(id string) (model.TunnelRuntime, error) {
 //
 // Health check behavior:
 //   - For each tunnel in TunnelUp state, a goroutine attempts a TCP connection
-//     to the tunnel's local endpoint (e.g., "127.0.0.1:8080").
+//     to the tunnel's local endpoint (e.g., "127.0.0.1:8080"). On-demand
+//     tunnels are probed on their internal ssh port instead, so probes do
+//     not count as client activity.
 //   - If the connection succeeds, LatencyMS is set to the round-trip time.
 //   - If the connection fails, a debug log is emitted but the tunnel state is
 //     NOT modified (Snapshot is read-only; actual state changes happen in
 //     watchProcess).
 //   - All probes must complete within TunnelProbeTimeout + 100ms, after which
 //     any remaining probes are abandoned.
+//   - Application-level health (the Health field) is not probed here; the
+//     last result cached by CheckHealth is attached to "up" tunnels.
 //
 // The returned slice is a copy — modifying it does not affect the Manager's
 // internal state.
@@ -930,12 +1597,23 @@ func (m *Manager) Snapshot() []model.TunnelRuntime {
 	// Take a snapshot of current state under the lock.
 	m.mu.Lock()
 	out := make([]model.TunnelRuntime, 0, len(m.runtime))
+	probes := make([]string, 0, len(m.runtime))
+	now := time.Now()
 	for _, rt := range m.runtime {
 		// Compute uptime dynamically for each tunnel.
 		if !rt.StartedAt.IsZero() {
-			rt.UptimeSec = int64(time.Since(rt.StartedAt).Seconds())
+			rt.UptimeSec = int64(now.Sub(rt.StartedAt).Seconds())
+		}
+		rt.RemainingSec = remainingSec(rt, now)
+		if tr := m.liveTraffic(rt.ID); tr != nil {
+			rt.Traffic = tr
 		}
 		out = append(out, rt)
+		probe := ""
+		if rt.State == model.TunnelUp {
+			probe = m.probeAddr(rt)
+		}
+		probes = append(probes, probe)
 	}
 	m.mu.Unlock()
 
@@ -950,8 +1628,8 @@ func (m *Manager) Snapshot() []model.TunnelRuntime {
 	results := make(chan probeResult, len(out))
 
 	// Launch a probe goroutine for each tunnel that is currently "up".
-	for i, rt := range out {
-		if rt.State != model.TunnelUp {
+	for i := range out {
+		if probes[i] == "" {
 			continue
 		}
 		go func(idx int, local string) {
@@ -966,7 +1644,7 @@ func (m *Manager) Snapshot() []model.TunnelRuntime {
 			}
 			_ = conn.Close()
 			results <- probeResult{index: idx, latencyMS: time.Since(start).Milliseconds()}
-		}(i, rt.Local)
+		}(i, probes[i])
 	}
 
 	// Collect probe results with a timeout to prevent the Snapshot call from
@@ -975,7 +1653,7 @@ func (m *Manager) Snapshot() []model.TunnelRuntime {
 	collected := 0
 	expected := 0
 	for i := range out {
-		if out[i].State == model.TunnelUp {
+		if probes[i] != "" {
 			expected++
 		}
 	}
@@ -1001,9 +1679,91 @@ func (m *Manager) Snapshot() []model.TunnelRuntime {
 	}
 done:
 
+	// Attach cached application-level health for tunnels that are up.
+	m.mu.Lock()
+	for i := range out {
+		if out[i].State != model.TunnelUp {
+			continue
+		}
+		if res, ok := m.health[out[i].ID]; ok {
+			out[i].Health = &res
+		}
+	}
+	m.mu.Unlock()
+
 	return out
 }
 
+// CheckHealth runs the application-level health check of every tunnel that
+// is up and has one configured, concurrently, and caches the results for
+// Snapshot. It blocks until every check finishes or times out, so callers on
+// a UI thread should run it in the background.
+func (m *Manager) CheckHealth() {
+	type job struct {
+		id    string
+		local string
+		check model.HealthCheck
+	}
+	m.mu.Lock()
+	var jobs []job
+	for id, rt := range m.runtime {
+		if rt.State != model.TunnelUp {
+			continue
+		}
+		check := rt.HealthCheck
+		if check == nil {
+			// Runtime entries restored from disk may predate the check; fall
+			// back to the current app config.
+			if fc, ok := appconfig.FindForwardConfig(m.forwardConfigs, rt.HostAlias, localPortOf(rt)); ok {
+				check = fc.HealthCheck
+			}
+		}
+		if check == nil {
+			continue
+		}
+		local := m.probeAddr(rt)
+		if local == "" {
+			continue
+		}
+		jobs = append(jobs, job{id: id, local: local, check: *check})
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	results := make([]model.HealthResult, len(jobs))
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j job) {
+			defer wg.Done()
+			results[i] = health.Run(context.Background(), j.check, j.local)
+		}(i, j)
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	for i, j := range jobs {
+		m.health[j.id] = results[i]
+	}
+	m.mu.Unlock()
+}
+
+// localPortOf returns the declared local port of a runtime entry (the one
+// app config forward entries match on), using the parsed forward when
+// available and the Local endpoint string otherwise.
+func localPortOf(rt model.TunnelRuntime) int {
+	if rt.AutoPort {
+		return rt.RequestedLocalPort
+	}
+	if rt.Forward.LocalPort > 0 {
+		return rt.Forward.LocalPort
+	}
+	_, port, err := splitAddrPort(rt.Local)
+	if err != nil {
+		return 0
+	}
+	return port
+}
+
 // LoadRuntime restores tunnel state from the runtime.json file on disk.
 //
 // This method should be called once after creating a new Manager, before any
@@ -1020,12 +1780,8 @@ done:
 // If runtime.json does not exist, this method returns nil (no error) since it
 // simply means no previous state exists.
 func (m *Manager) LoadRuntime() error {
-	path, err := appconfig.RuntimeFilePath()
-	if err != nil {
-		return err
-	}
-
-	b, err := os.ReadFile(path)
+	// state.Runtime upgrades legacy layouts (a bare JSON array) on read.
+	b, err := state.Runtime.Read()
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			// No runtime file yet — this is normal on first run.
@@ -1034,19 +1790,54 @@ func (m *Manager) LoadRuntime() error {
 		return err
 	}
 
-	var arr []model.TunnelRuntime
-	if err := json.Unmarshal(b, &arr); err != nil {
+	var doc runtimeFile
+	if err := json.Unmarshal(b, &doc); err != nil {
 		return err
 	}
 
+	var expired, supervised []string
+	var adopted []model.TunnelRuntime
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	for _, rt := range arr {
+	for _, rt := range doc.Tunnels {
+		if rt.OnDemand || rt.Relay {
+			if ownedElsewhere(rt) {
+				// Held by another ssh-manager process that still owns the
+				// listener; show it as-is.
+				m.runtime[rt.ID] = rt
+				continue
+			}
+			if rt.Relay && rt.PID > 0 && processAlive(rt.PID) {
+				// The relay died with its owner; its ssh is unreachable.
+				if sameProcess(rt) {
+					if p, err := os.FindProcess(rt.PID); err == nil {
+						_ = p.Signal(syscall.SIGTERM)
+					}
+				}
+			}
+			rt.State = model.TunnelDown
+			rt.PID = 0
+			rt.OwnerPID = 0
+			m.runtime[rt.ID] = rt
+			continue
+		}
 		if rt.PID > 0 && processAlive(rt.PID) {
-			cmdline, cmdErr := processCommand(rt.PID)
-			if cmdErr == nil && isManagedTunnelProcess(cmdline, rt) {
+			if rt.Adopted && sameProcess(rt) {
+				m.runtime[rt.ID] = rt
+				adopted = append(adopted, rt)
+				continue
+			}
+			if sameProcess(rt) {
 				// The process from a previous session is still running and appears
 				// to be one of our managed tunnel commands.
+				switch {
+				case !rt.ExpiresAt.IsZero() && !time.Now().Before(rt.ExpiresAt):
+					expired = append(expired, rt.ID)
+				case needsSupervision(rt):
+					// Nobody watched clients while no ssh-manager process
+					// ran, so the idle clock restarts now.
+					rt.LastActiveAt = time.Now()
+					supervised = append(supervised, rt.ID)
+				}
 				m.runtime[rt.ID] = rt
 				continue
 			}
@@ -1065,6 +1856,21 @@ func (m *Manager) LoadRuntime() error {
 			m.runtime[rt.ID] = rt
 		}
 	}
+	m.mu.Unlock()
+
+	// A TTL keeps counting while no ssh-manager process is watching, so
+	// tunnels that outlived it are stopped now and the rest supervised.
+	// Their clients are visible in /proc from any process, so idle
+	// timeouts are enforced here too.
+	for _, id := range expired {
+		m.expire(id, "ttl_expired", "ttl expired while unsupervised")
+	}
+	for _, id := range supervised {
+		m.superviseLifetime(id)
+	}
+	for _, rt := range adopted {
+		go m.watchAdopted(rt.ID, rt.PID, adoptedPollInterval)
+	}
 	return nil
 }
 
@@ -1078,16 +1884,6 @@ func (m *Manager) LoadRuntime() error {
 // Errors are logged by the caller but not propagated — persistence failures
 // should not prevent tunnel operations from succeeding.
 func (m *Manager) persist() error {
-	path, err := appconfig.RuntimeFilePath()
-	if err != nil {
-		return err
-	}
-
-	// Ensure the config directory exists (handles first-run scenario).
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
-	}
-
 	// Snapshot the state under the lock, then write outside the lock
 	// to minimize lock hold time.
 	m.mu.Lock()
@@ -1101,66 +1897,68 @@ func (m *Manager) persist() error {
 	}
 	m.mu.Unlock()
 
-	b, err := json.MarshalIndent(arr, "", "  ")
+	b, err := json.MarshalIndent(runtimeFile{Version: state.Runtime.Current, Tunnels: arr}, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	// Write with 0600 permissions — only the file owner can read/write.
-	// This is slightly more secure than 0644 since the file contains PIDs
-	// and host alias information.
-	return os.WriteFile(path, b, 0o600)
+	// Written with 0600 permissions — the file contains PIDs and host alias
+	// information. state.Runtime refuses to overwrite a file written by a
+	// newer ssh-manager build.
+	return state.Runtime.Write(b)
 }
 
-func restartStatsFilePath() (string, error) {
-	dir, err := appconfig.ConfigDir()
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(dir, "restart_metrics.json"), nil
+// runtimeFile is the on-disk layout of runtime.json (see state.Runtime).
+type runtimeFile struct {
+	Version int                   `json:"version"`
+	Tunnels []model.TunnelRuntime `json:"tunnels"`
+}
+
+// restartStatsFile is the on-disk layout of restart_metrics.json (see
+// state.RestartStats).
+type restartStatsFile struct {
+	Version  int                     `json:"version"`
+	Stats    map[string]RestartStats `json:"stats"`
+	Breakers map[string]BreakerStats `json:"breakers,omitempty"`
 }
 
 func (m *Manager) persistRestartStats() error {
-	path, err := restartStatsFilePath()
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
-		return err
-	}
 	m.mu.Lock()
 	payload := make(map[string]RestartStats, len(m.restartStats))
 	for id, st := range m.restartStats {
 		payload[id] = st
 	}
+	breakers := make(map[string]BreakerStats, len(m.breakers))
+	for host, b := range m.breakers {
+		breakers[host] = b
+	}
 	m.mu.Unlock()
-	b, err := json.MarshalIndent(payload, "", "  ")
+	b, err := json.MarshalIndent(restartStatsFile{Version: state.RestartStats.Current, Stats: payload, Breakers: breakers}, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, 0o600)
+	return state.RestartStats.Write(b)
 }
 
 func (m *Manager) loadRestartStats() error {
-	path, err := restartStatsFilePath()
-	if err != nil {
-		return err
-	}
-	b, err := os.ReadFile(path)
+	b, err := state.RestartStats.Read()
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
 		return err
 	}
-	var payload map[string]RestartStats
-	if err := json.Unmarshal(b, &payload); err != nil {
+	var doc restartStatsFile
+	if err := json.Unmarshal(b, &doc); err != nil {
 		return err
 	}
 	m.mu.Lock()
-	for id, st := range payload {
+	for id, st := range doc.Stats {
 		m.restartStats[id] = st
 	}
+	for host, b := range doc.Breakers {
+		m.breakers[host] = b
+	}
 	m.mu.Unlock()
 	return nil
 }
@@ -1178,7 +1976,8 @@ func (m *Manager) loadRestartStats() error {
 //	  - Explicit local bind address
 //	  - Example: "0.0.0.0:8080:db.internal:5432"
 //
-// All port numbers are validated to be in the 1-65535 range.
+// All port numbers are validated to be in the 1-65535 range, except that the
+// local port may be "auto" (or 0) to have the manager allocate one.
 //
 // Returns the parsed ForwardSpec or an error describing what's wrong with the input.
 //
@@ -1198,14 +1997,15 @@ func ParseForwardArg(s string) (model.ForwardSpec, error) {
 
 	// The remaining left side is either "localPort" or "localAddr:localPort".
 	var localAddr string
-	localPort, err := strconv.Atoi(rest)
-	if err != nil {
-		localAddr, localPort, err = splitAddrPort(rest)
+	localPortStr := rest
+	if strings.Contains(rest, ":") {
+		localAddr, localPortStr, err = splitHostPortString(rest)
 		if err != nil {
 			return model.ForwardSpec{}, fmt.Errorf("invalid local endpoint: %w", err)
 		}
 	}
-	if err := util.ValidatePort(localPort); err != nil {
+	localPort, err := util.ParseLocalPort(localPortStr)
+	if err != nil {
 		return model.ForwardSpec{}, fmt.Errorf("invalid local port: %w", err)
 	}
 	if err := util.ValidatePort(remotePort); err != nil {
@@ -1256,29 +2056,31 @@ func parseAddrPortTail(s string) (addr string, port int, rest string, err error)
 }
 
 func splitAddrPort(s string) (string, int, error) {
+	h, p, err := splitHostPortString(s)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return "", 0, err
+	}
+	return h, port, nil
+}
+
+// splitHostPortString splits "host:port" or "[ipv6]:port" without
+// interpreting the port.
+func splitHostPortString(s string) (string, string, error) {
 	if strings.HasPrefix(s, "[") {
-		h, p, err := net.SplitHostPort(s)
-		if err != nil {
-			return "", 0, err
-		}
-		port, err := strconv.Atoi(p)
-		if err != nil {
-			return "", 0, err
-		}
-		return h, port, nil
+		return net.SplitHostPort(s)
 	}
 	if strings.Count(s, ":") > 1 {
-		return "", 0, fmt.Errorf("IPv6 local bind addresses must be bracketed, e.g. [::1]:8080")
+		return "", "", fmt.Errorf("IPv6 local bind addresses must be bracketed, e.g. [::1]:8080")
 	}
 	idx := strings.LastIndex(s, ":")
 	if idx <= 0 || idx == len(s)-1 {
-		return "", 0, fmt.Errorf("expected host:port")
+		return "", "", fmt.Errorf("expected host:port")
 	}
-	port, err := strconv.Atoi(s[idx+1:])
-	if err != nil {
-		return "", 0, err
-	}
-	return s[:idx], port, nil
+	return s[:idx], s[idx+1:], nil
 }
 
 func validateForwardSpec(fwd model.ForwardSpec) error {
@@ -1346,7 +2148,12 @@ func isManagedTunnelProcess(cmdline string, rt model.TunnelRuntime) bool {
 	if !strings.Contains(cmdline, rt.HostAlias) {
 		return false
 	}
-	if !strings.Contains(cmdline, rt.Local) || !strings.Contains(cmdline, rt.Remote) {
+	local := rt.Local
+	if rt.Relay {
+		// ssh of a relayed tunnel binds the internal backend address.
+		local = rt.Backend
+	}
+	if !strings.Contains(cmdline, local) || !strings.Contains(cmdline, rt.Remote) {
 		return false
 	}
 	return true
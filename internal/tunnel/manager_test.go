@@ -23,12 +23,21 @@ package tunnel
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -36,6 +45,7 @@ import (
 	"github.com/treykane/ssh-manager/internal/events"
 	"github.com/treykane/ssh-manager/internal/model"
 	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/state"
 )
 
 // fakeStarter is a test double that implements the TunnelStarter interface.
@@ -386,7 +396,7 @@ func TestLoadRuntimeQuarantinesMismatchedProcess(t *testing.T) {
 	}
 	defer func() { _ = cmd.Process.Kill() }()
 
-	path, err := appconfig.RuntimeFilePath()
+	path, err := state.Runtime.Path()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -422,6 +432,102 @@ func TestLoadRuntimeQuarantinesMismatchedProcess(t *testing.T) {
 	}
 }
 
+func TestLoadRuntimeVerifiesProcessIdentity(t *testing.T) {
+	if !procAvailable() {
+		t.Skip("needs /proc")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() { _ = cmd.Wait(); close(exited) }()
+	defer func() { _ = cmd.Process.Kill() }()
+	pid := cmd.Process.Pid
+	start, err := processStartTime(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := func(port int, argv []string, procStart uint64) model.TunnelRuntime {
+		fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: port, RemoteAddr: "localhost", RemotePort: 80}
+		return model.TunnelRuntime{
+			ID:        RuntimeID("api", fwd),
+			HostAlias: "api",
+			Local:     fmt.Sprintf("127.0.0.1:%d", port),
+			Remote:    "localhost:80",
+			State:     model.TunnelUp,
+			PID:       pid,
+			Argv:      argv,
+			ProcStart: procStart,
+		}
+	}
+	same := entry(9556, []string{"sleep", "30"}, start)
+	recycled := entry(9557, []string{"sleep", "30"}, start+1)
+	otherArgv := entry(9558, []string{"ssh", "-N", "-L", "127.0.0.1:9558:localhost:80", "api"}, start)
+	b, err := json.Marshal(runtimeFile{Version: 1, Tunnels: []model.TunnelRuntime{same, recycled, otherArgv}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := state.Runtime.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(fakeStarter{})
+	if err := m.LoadRuntime(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Get(same.ID); got.State != model.TunnelUp {
+		t.Fatalf("expected matching process restored as up, got %s", got.State)
+	}
+	for _, id := range []string{recycled.ID, otherArgv.ID} {
+		if got, _ := m.Get(id); got.State != model.TunnelQuarantined {
+			t.Fatalf("expected %s quarantined, got %s", id, got.State)
+		}
+	}
+
+	// A stop must not signal a process whose identity no longer matches.
+	m.mu.Lock()
+	rt := m.runtime[same.ID]
+	rt.ProcStart = start + 1
+	m.runtime[same.ID] = rt
+	m.mu.Unlock()
+	if err := m.Stop(same.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+		t.Fatal("expected a mismatched process not to be signalled")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestProcessStartTime(t *testing.T) {
+	root := t.TempDir()
+	prev := procRoot
+	procRoot = root
+	defer func() { procRoot = prev }()
+	if err := os.MkdirAll(filepath.Join(root, "42"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	stat := "42 (ssh (x) y) S 1 42 42 0 -1 4194560 100 0 0 0 0 0 0 0 20 0 1 0 987654 10000 100"
+	if err := os.WriteFile(filepath.Join(root, "42", "stat"), []byte(stat), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := processStartTime(42)
+	if err != nil || got != 987654 {
+		t.Fatalf("expected start time 987654, got %d (%v)", got, err)
+	}
+}
+
 func TestPreflight_Pass(t *testing.T) {
 	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 	m := NewManager(fakeStarter{})
@@ -472,6 +578,7 @@ func TestManagerAutoRestartUnexpectedExit(t *testing.T) {
 	starter := &flakyStarter{failures: 1}
 	m := NewManager(starter)
 	m.SetRestartPolicy(true, 2, 1, 1)
+	m.SetRestartBackoff(time.Second, 0) // fixed 1s delays
 
 	h := model.HostEntry{Alias: "api"}
 	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9511, RemoteAddr: "localhost", RemotePort: 80}
@@ -484,17 +591,17 @@ func TestManagerAutoRestartUnexpectedExit(t *testing.T) {
 	deadline := time.Now().Add(4 * time.Second)
 	for time.Now().Before(deadline) {
 		got, gerr := m.Get(rt.ID)
-		if gerr == nil && got.State == model.TunnelUp && got.PID > 0 && atomic.LoadInt32(&starter.calls) >= 2 {
-			stats := m.RestartStats()[rt.ID]
-			if stats.Attempts < 1 || stats.Successes < 1 {
-				t.Fatalf("expected restart stats attempts/successes, got %+v", stats)
-			}
+		// Restart success is recorded after the restarted Start returns, so
+		// keep polling until the stats catch up with the observed state.
+		stats := m.RestartStats()[rt.ID]
+		if gerr == nil && got.State == model.TunnelUp && got.PID > 0 && atomic.LoadInt32(&starter.calls) >= 2 &&
+			stats.Attempts >= 1 && stats.Successes >= 1 {
 			return
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
 	got, _ := m.Get(rt.ID)
-	t.Fatalf("expected restarted tunnel to become up; state=%s calls=%d", got.State, starter.calls)
+	t.Fatalf("expected restarted tunnel to become up with restart stats; state=%s calls=%d stats=%+v", got.State, starter.calls, m.RestartStats()[rt.ID])
 }
 
 func TestManagerAutoRestartQuarantinesAtMaxAttempts(t *testing.T) {
@@ -506,6 +613,7 @@ func TestManagerAutoRestartQuarantinesAtMaxAttempts(t *testing.T) {
 	starter := &flakyStarter{failures: 10}
 	m := NewManager(starter)
 	m.SetRestartPolicy(true, 2, 1, 1)
+	m.SetRestartBackoff(time.Second, 0) // fixed 1s delays
 
 	h := model.HostEntry{Alias: "api"}
 	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9512, RemoteAddr: "localhost", RemotePort: 80}
@@ -540,6 +648,7 @@ func TestManagerAutoRestartStableWindowResetsCounter(t *testing.T) {
 	starter := &flakyStarter{failures: 0}
 	m := NewManager(starter)
 	m.SetRestartPolicy(true, 2, 1, 1)
+	m.SetRestartBackoff(time.Second, 0) // fixed 1s delays
 
 	h := model.HostEntry{Alias: "api"}
 	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9513, RemoteAddr: "localhost", RemotePort: 80}
@@ -585,6 +694,7 @@ func TestManagerRecoverQuarantinedTunnel(t *testing.T) {
 	starter := &flakyStarter{failures: 10}
 	m := NewManager(starter)
 	m.SetRestartPolicy(true, 1, 1, 1)
+	m.SetRestartBackoff(time.Second, 0) // fixed 1s delays
 
 	h := model.HostEntry{Alias: "api"}
 	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9514, RemoteAddr: "localhost", RemotePort: 80}
@@ -658,3 +768,1199 @@ func TestManagerRecoverByHost(t *testing.T) {
 		}
 	}
 }
+
+func TestManagerHealthCheckFromConfigAndOverride(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	m := NewManager(fakeStarter{})
+	m.SetForwardConfigs([]appconfig.ForwardConfig{{
+		Host:        "api",
+		HealthCheck: &model.HealthCheck{Type: model.HealthCheckCommand, Command: []string{"true"}},
+	}})
+	h := model.HostEntry{Alias: "api"}
+
+	fromConfig, err := m.Start(h, model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9521, RemoteAddr: "localhost", RemotePort: 80})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer func() { _ = m.Stop(fromConfig.ID) }()
+	override, err := m.StartWithOptions(h, model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9522, RemoteAddr: "localhost", RemotePort: 80},
+		ForwardOptions{HealthCheck: &model.HealthCheck{Type: model.HealthCheckCommand, Command: []string{"false"}}})
+	if err != nil {
+		t.Fatalf("start with options: %v", err)
+	}
+	defer func() { _ = m.Stop(override.ID) }()
+
+	for _, rt := range m.Snapshot() {
+		if rt.Health != nil {
+			t.Fatalf("expected no health before CheckHealth, got %+v", rt.Health)
+		}
+	}
+	m.CheckHealth()
+	got := map[string]model.HealthStatus{}
+	for _, rt := range m.Snapshot() {
+		if rt.Health == nil {
+			t.Fatalf("expected health for %s", rt.ID)
+		}
+		got[rt.ID] = rt.Health.Status
+	}
+	if got[fromConfig.ID] != model.HealthHealthy {
+		t.Fatalf("expected config check healthy, got %s", got[fromConfig.ID])
+	}
+	if got[override.ID] != model.HealthUnhealthy {
+		t.Fatalf("expected override check unhealthy, got %s", got[override.ID])
+	}
+	if rt, _ := m.Get(override.ID); OptionsFromRuntime(rt).HealthCheck == nil || OptionsFromRuntime(rt).HealthCheck.Command[0] != "false" {
+		t.Fatalf("expected override to be kept on runtime for restarts, got %+v", rt.HealthCheck)
+	}
+}
+
+// readyStarter runs script under sh and, when listen is set, opens the
+// forward's local port the way a working ssh -L would.
+type readyStarter struct {
+	script string
+	listen bool
+}
+
+func (f readyStarter) StartTunnel(ctx context.Context, host model.HostEntry, fwd model.ForwardSpec) (*sshclient.TunnelProcess, error) {
+	if f.listen {
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", fwd.LocalPort))
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			<-ctx.Done()
+			_ = ln.Close()
+		}()
+	}
+	// Stdout stays nil: a copying goroutine would make Wait block on the
+	// shell's sleep child after the shell itself is killed.
+	cmd := exec.CommandContext(ctx, "sh", "-c", f.script)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sshclient.TunnelProcess{Cmd: cmd, Stderr: stderr}, nil
+}
+
+func TestManagerReadinessGate(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	h := model.HostEntry{Alias: "api"}
+	fwd := func(port int) model.ForwardSpec {
+		return model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: port, RemoteAddr: "localhost", RemotePort: 80}
+	}
+
+	m := NewManager(readyStarter{script: "sleep 30", listen: true})
+	m.SetReadyTimeout(2 * time.Second)
+	rt, err := m.Start(h, fwd(9531))
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if rt.State != model.TunnelUp {
+		t.Fatalf("expected up once port accepts connections, got %s", rt.State)
+	}
+	_ = m.Stop(rt.ID)
+
+	m = NewManager(readyStarter{script: "sleep 30"})
+	m.SetReadyTimeout(300 * time.Millisecond)
+	rt, err = m.Start(h, fwd(9532))
+	if err == nil || !strings.Contains(err.Error(), "tunnel not ready") {
+		t.Fatalf("expected readiness timeout, got %v", err)
+	}
+	if got, _ := m.Get(rt.ID); got.State != model.TunnelError || !strings.Contains(got.LastError, "did not accept connections") {
+		t.Fatalf("expected error state with reason, got %+v", got)
+	}
+
+	m = NewManager(readyStarter{script: "echo 'bind [127.0.0.1]:9533: Address already in use' >&2; sleep 30"})
+	m.SetReadyTimeout(10 * time.Second)
+	start := time.Now()
+	rt, err = m.Start(h, fwd(9533))
+	if err == nil || err.Error() != "tunnel not ready: local port already in use" {
+		t.Fatalf("expected classified stderr reason, got %v", err)
+	}
+	if got, _ := m.Get(rt.ID); !strings.HasSuffix(got.LastError, "local port already in use") {
+		t.Fatalf("expected classified last error, got %q", got.LastError)
+	}
+	if tail := m.StderrTail(rt.ID); len(tail) != 1 || !strings.Contains(tail[0], "Address already in use") {
+		t.Fatalf("expected raw line in the stderr tail, got %q", tail)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("expected fatal stderr to fail fast, took %s", time.Since(start))
+	}
+}
+
+func TestManagerReadinessRefusesBusyPort(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	ln, err := net.Listen("tcp", "127.0.0.1:9534")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	m := NewManager(fakeStarter{})
+	m.SetReadyTimeout(time.Second)
+	_, err = m.Start(model.HostEntry{Alias: "api"}, model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9534, RemoteAddr: "localhost", RemotePort: 80})
+	if err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Fatalf("expected busy port to be refused, got %v", err)
+	}
+}
+
+func TestManagerClassifiesStderrOnExit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	m := NewManager(readyStarter{script: "sleep 0.2; echo 'user@db: Permission denied (publickey).' >&2; exit 255"})
+	m.SetRestartPolicy(false, 0, 1, 30)
+	rt, err := m.Start(model.HostEntry{Alias: "api"}, model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9535, RemoteAddr: "localhost", RemotePort: 80})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	var got model.TunnelRuntime
+	for time.Now().Before(deadline) {
+		got, _ = m.Get(rt.ID)
+		if got.State == model.TunnelError {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got.State != model.TunnelError || got.ErrorCode != string(sshclient.CodeAuthFailed) {
+		t.Fatalf("expected auth_failed error, got state=%s code=%q", got.State, got.ErrorCode)
+	}
+	if !strings.Contains(got.LastError, "authentication failed") {
+		t.Fatalf("expected classified last error, got %q", got.LastError)
+	}
+	if tail := m.StderrTail(rt.ID); len(tail) != 1 || !strings.Contains(tail[0], "Permission denied") {
+		t.Fatalf("unexpected stderr tail: %q", tail)
+	}
+
+	path, err := LogPath(rt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), "Permission denied (publickey)") {
+		t.Fatalf("expected stderr in log file, got %q (%v)", b, err)
+	}
+
+	evts, err := m.Events(events.Query{TunnelID: rt.ID, EventType: "unexpected_exit"})
+	if err != nil || len(evts) != 1 || evts[0].ErrorCode != string(sshclient.CodeAuthFailed) {
+		t.Fatalf("expected unexpected_exit event with error code, got %+v (%v)", evts, err)
+	}
+}
+
+// echoStarter stands in for ssh -L by serving an echo server on the forward's
+// local port for as long as the fake process runs.
+type echoStarter struct {
+	calls    int32
+	accepted int32
+}
+
+func (f *echoStarter) StartTunnel(ctx context.Context, host model.HostEntry, fwd model.ForwardSpec) (*sshclient.TunnelProcess, error) {
+	atomic.AddInt32(&f.calls, 1)
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", fwd.LocalAddr, fwd.LocalPort))
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&f.accepted, 1)
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+	proc, err := readyStarter{script: "sleep 30"}.StartTunnel(ctx, host, fwd)
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	// Stop closes the tunnel's stderr synchronously, so closing the listener
+	// with it frees the port before Stop returns, as a restart needs.
+	proc.Stderr = closeAlso{ReadCloser: proc.Stderr, also: ln}
+	return proc, nil
+}
+
+// closeAlso is a ReadCloser that closes also along with itself.
+type closeAlso struct {
+	io.ReadCloser
+	also io.Closer
+}
+
+func (c closeAlso) Close() error {
+	_ = c.also.Close()
+	return c.ReadCloser.Close()
+}
+
+// freePort returns a loopback port that was free a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestManagerOnDemandTunnel(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	starter := &echoStarter{}
+	m := NewManager(starter)
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9536, RemoteAddr: "localhost", RemotePort: 80}
+
+	rt, err := m.StartWithOptions(model.HostEntry{Alias: "api"}, fwd, ForwardOptions{OnDemand: true, IdleTimeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("arm: %v", err)
+	}
+	if rt.State != model.TunnelArmed || rt.PID != 0 || atomic.LoadInt32(&starter.calls) != 0 {
+		t.Fatalf("expected armed tunnel without ssh, got %+v calls=%d", rt, starter.calls)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:9536")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expected echo through on-demand tunnel, got %q (%v)", buf, err)
+	}
+	if got, _ := m.Get(rt.ID); got.State != model.TunnelUp || got.PID == 0 {
+		t.Fatalf("expected up with ssh running, got %+v", got)
+	}
+	_ = conn.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if got, _ := m.Get(rt.ID); got.State == model.TunnelArmed {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got, _ := m.Get(rt.ID); got.State != model.TunnelArmed || got.PID != 0 {
+		t.Fatalf("expected tunnel re-armed after idle timeout, got %+v", got)
+	}
+	if evts, _ := m.Events(events.Query{TunnelID: rt.ID, EventType: "on_demand_idle"}); len(evts) != 1 {
+		t.Fatalf("expected one on_demand_idle event, got %d", len(evts))
+	}
+
+	if err := m.Stop(rt.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if _, err := net.DialTimeout("tcp", "127.0.0.1:9536", 200*time.Millisecond); err == nil {
+		t.Fatal("expected listener closed after stop")
+	}
+}
+
+func TestManagerAutoPortStableAcrossRestarts(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	h := model.HostEntry{Alias: "api"}
+	fwd, err := ParseForwardArg("auto:localhost:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fwd.LocalPort != 0 {
+		t.Fatalf("expected auto local port to parse as 0, got %d", fwd.LocalPort)
+	}
+
+	m := NewManager(fakeStarter{})
+	m.SetAutoPortRange(9537, 9540)
+	rt, err := m.Start(h, fwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rt.AutoPort || rt.RequestedLocalPort != 0 || rt.ID != RuntimeID("api", fwd) {
+		t.Fatalf("expected auto-port runtime keyed by declared forward, got %+v", rt)
+	}
+	_, port, err := splitAddrPort(rt.Local)
+	if err != nil || port < 9537 || port > 9540 {
+		t.Fatalf("expected allocated port in range, got %q", rt.Local)
+	}
+	if req, err := RequestedForward(rt); err != nil || req.LocalPort != 0 {
+		t.Fatalf("expected requested forward to keep auto port, got %+v (%v)", req, err)
+	}
+	if err := m.Stop(rt.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh manager (e.g. the next CLI invocation) gets the same port back.
+	m2 := NewManager(fakeStarter{})
+	m2.SetAutoPortRange(9537, 9540)
+	again, err := m2.Start(h, fwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m2.Stop(again.ID) }()
+	if again.Local != rt.Local {
+		t.Fatalf("expected stable allocation %s, got %s", rt.Local, again.Local)
+	}
+}
+
+func TestManagerAutoPortFallbackWhenPortBusy(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	busy := ln.Addr().(*net.TCPAddr).Port
+
+	m := NewManager(fakeStarter{})
+	m.SetAutoPortRange(9541, 9542)
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: busy, RemoteAddr: "localhost", RemotePort: 80}
+	rt, err := m.StartWithOptions(model.HostEntry{Alias: "api"}, fwd, ForwardOptions{AutoPort: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m.Stop(rt.ID) }()
+	if rt.ID != RuntimeID("api", fwd) || !rt.AutoPort || rt.RequestedLocalPort != busy {
+		t.Fatalf("expected fallback allocation recorded against declared port, got %+v", rt)
+	}
+	if rt.Local != "127.0.0.1:9541" && rt.Local != "127.0.0.1:9542" {
+		t.Fatalf("expected port from auto range, got %s", rt.Local)
+	}
+	if !OptionsFromRuntime(rt).AutoPort {
+		t.Fatal("expected restarts to keep --auto-port")
+	}
+
+	// An SSH config forward opts in through its forwards entry instead.
+	m.SetForwardConfigs([]appconfig.ForwardConfig{{Host: "web", LocalPort: busy, AutoPort: true}})
+	web, err := m.Start(model.HostEntry{Alias: "web"}, fwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m.Stop(web.ID) }()
+	if !web.AutoPort || web.Local == fmt.Sprintf("127.0.0.1:%d", busy) {
+		t.Fatalf("expected forwards entry auto_port to allocate, got %+v", web)
+	}
+}
+
+func TestRenderEnv(t *testing.T) {
+	rt := model.TunnelRuntime{ID: "db|x", HostAlias: "db", Local: "127.0.0.1:20001", Remote: "pg.internal:5432"}
+	env, err := RenderEnv(rt, map[string]string{
+		"DATABASE_URL": "postgres://{local_host}:{local_port}/app?target={remote_host}:{remote_port}",
+		"SSH_HOST":     "{host}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["DATABASE_URL"] != "postgres://127.0.0.1:20001/app?target=pg.internal:5432" || env["SSH_HOST"] != "db" {
+		t.Fatalf("unexpected env: %+v", env)
+	}
+	if _, err := RenderEnv(rt, map[string]string{"URL": "{nope}"}); err == nil {
+		t.Fatal("expected unknown placeholder to fail")
+	}
+	if _, err := RenderEnv(rt, map[string]string{"BAD-NAME": "x"}); err == nil {
+		t.Fatal("expected invalid variable name to fail")
+	}
+}
+
+// waitForEvent polls the event log until eventType is recorded for id.
+func waitForEvent(t *testing.T, m *Manager, id, eventType string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		recs, err := m.Events(events.Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, evt := range recs {
+			if evt.TunnelID == id && evt.EventType == eventType {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s event on %s", eventType, id)
+}
+
+// waitForStopped polls until tunnel id is down with its stop reason recorded.
+func waitForStopped(t *testing.T, m *Manager, id string) model.TunnelRuntime {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rt, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rt.State == model.TunnelDown && rt.LastError != "" {
+			return rt
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s to stop", id)
+	return model.TunnelRuntime{}
+}
+
+func TestManagerStopsTunnelWhenTTLExpires(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	prev := lifetimePollInterval
+	lifetimePollInterval = 20 * time.Millisecond
+	defer func() { lifetimePollInterval = prev }()
+
+	m := NewManager(fakeStarter{})
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9543, RemoteAddr: "localhost", RemotePort: 80}
+	rt, err := m.StartWithOptions(model.HostEntry{Alias: "api"}, fwd, ForwardOptions{TTL: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m.Stop(rt.ID) }()
+	if rt.TTLSec != 1 || rt.ExpiresAt.IsZero() || rt.RemainingSec != 1 {
+		t.Fatalf("expected ttl recorded on runtime, got %+v", rt)
+	}
+
+	waitForEvent(t, m, rt.ID, "ttl_expired")
+	got := waitForStopped(t, m, rt.ID)
+	if !strings.Contains(got.LastError, "ttl") {
+		t.Fatalf("expected tunnel stopped by ttl, got %+v", got)
+	}
+}
+
+func TestManagerStopsIdleTunnel(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, ok := clientSockets(0); !ok {
+		t.Skip("connections cannot be observed on this platform")
+	}
+	prev := lifetimePollInterval
+	lifetimePollInterval = 20 * time.Millisecond
+	defer func() { lifetimePollInterval = prev }()
+
+	m := NewManager(fakeStarter{})
+	m.SetLifetimeDefaults(0, time.Second)
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9544, RemoteAddr: "localhost", RemotePort: 80}
+	rt, err := m.Start(model.HostEntry{Alias: "api"}, fwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m.Stop(rt.ID) }()
+	if rt.IdleTimeoutSec != 1 || !rt.ExpiresAt.IsZero() {
+		t.Fatalf("expected idle timeout from manager default, got %+v", rt)
+	}
+
+	waitForEvent(t, m, rt.ID, "idle_stopped")
+	waitForStopped(t, m, rt.ID)
+}
+
+func TestManagerIdleTunnelStopsWhileSnapshotted(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, ok := clientSockets(0); !ok {
+		t.Skip("connections cannot be observed on this platform")
+	}
+	prev := lifetimePollInterval
+	lifetimePollInterval = 20 * time.Millisecond
+	defer func() { lifetimePollInterval = prev }()
+
+	starter := &echoStarter{}
+	m := NewManager(starter)
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: freePort(t), RemoteAddr: "localhost", RemotePort: 80}
+	rt, err := m.StartWithOptions(model.HostEntry{Alias: "api"}, fwd, ForwardOptions{
+		IdleTimeout: time.Second,
+		HealthCheck: &model.HealthCheck{Type: model.HealthCheckTCP},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = m.Stop(rt.ID) }()
+
+	// The TUI and "tunnel status" probe every refresh; those probes must not
+	// count as clients.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+			m.Snapshot()
+			m.CheckHealth()
+		}
+	}()
+
+	waitForEvent(t, m, rt.ID, "idle_stopped")
+	waitForStopped(t, m, rt.ID)
+	if n := atomic.LoadInt32(&starter.accepted); n != 0 {
+		t.Fatalf("expected no probe connections to the local port, got %d", n)
+	}
+}
+
+func TestCountClientSockets(t *testing.T) {
+	// Port 8080 (1F90): a listener, an accepted connection, a local client
+	// that is connected, one that closed (TIME_WAIT), and an outbound
+	// connection to another host's port 8080, which is not a client of the
+	// tunnel.
+	table := "  sl  local_address rem_address   st\n" +
+		"   0: 0100007F:1F90 00000000:0000 0A\n" +
+		"   1: 0100007F:1F90 0100007F:D431 01\n" +
+		"   2: 0100007F:D431 0100007F:1F90 01\n" +
+		"   3: 0100007F:D432 0100007F:1F90 06\n" +
+		"   4: 0A00000F:D433 0A000063:1F90 01\n" +
+		"   5: 0100007F:0016 0100007F:D434 01\n"
+	path := filepath.Join(t.TempDir(), "tcp")
+	if err := os.WriteFile(path, []byte(table), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	n, err := countClientSockets(path, 8080)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 client sockets, got %d (%v)", n, err)
+	}
+}
+
+func TestParseHexPort(t *testing.T) {
+	if got := parseHexPort("0100007F:1F90"); got != 8080 {
+		t.Fatalf("expected 8080, got %d", got)
+	}
+	if got := parseHexPort("garbage"); got != -1 {
+		t.Fatalf("expected -1 for malformed address, got %d", got)
+	}
+}
+
+func TestManagerRelayCountsTraffic(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	m := NewManager(&echoStarter{})
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9545, RemoteAddr: "localhost", RemotePort: 80}
+
+	rt, err := m.StartWithOptions(model.HostEntry{Alias: "api"}, fwd, ForwardOptions{Relay: true})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer func() { _ = m.Stop(rt.ID) }()
+	if !rt.Relay || rt.Backend == "" || rt.Backend == rt.Local || rt.Local != "127.0.0.1:9545" {
+		t.Fatalf("expected relay on the declared port with an internal backend, got %+v", rt)
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:9545")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 5)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("expected echo through relay, got %q (%v)", buf, err)
+	}
+	if got, _ := m.Get(rt.ID); got.Traffic == nil || got.Traffic.Active != 1 || got.Traffic.Connections != 1 {
+		t.Fatalf("expected one active connection, got %+v", got.Traffic)
+	}
+	_ = conn.Close()
+
+	// A second client that sends nothing gets its own event.
+	second, err := net.Dial("tcp", "127.0.0.1:9545")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_ = second.Close()
+
+	var evts []events.Event
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		evts, err = m.Events(events.Query{TunnelID: rt.ID, EventType: "client_disconnected"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(evts) == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(evts) != 2 {
+		t.Fatalf("expected one client_disconnected event per client, got %+v", evts)
+	}
+	var withData, empty int
+	for _, evt := range evts {
+		if !strings.Contains(evt.Message, "client 127.0.0.1:") || !strings.Contains(evt.Message, "disconnected after ") {
+			t.Fatalf("expected source address and duration, got %q", evt.Message)
+		}
+		switch {
+		case strings.Contains(evt.Message, "(in 5B, out 5B)"):
+			withData++
+		case strings.Contains(evt.Message, "(in 0B, out 0B)"):
+			empty++
+		}
+	}
+	if withData != 1 || empty != 1 {
+		t.Fatalf("expected per-client byte counts, got %+v", evts)
+	}
+	got, err := m.Get(rt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr := got.Traffic; tr == nil || tr.Connections != 2 || tr.Active != 0 || tr.BytesIn != 5 || tr.BytesOut != 5 {
+		t.Fatalf("unexpected traffic counters: %+v", got.Traffic)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	for i, w := range want {
+		if got := backoffDelay(time.Second, 8*time.Second, 0, i+1, 0.3); got != w {
+			t.Fatalf("attempt %d: expected %s, got %s", i+1, w, got)
+		}
+	}
+	if got := backoffDelay(2*time.Second, time.Minute, 0.5, 1, 0); got != time.Second {
+		t.Fatalf("expected lowest jitter to halve the delay, got %s", got)
+	}
+	if got := backoffDelay(2*time.Second, time.Minute, 0.5, 1, 0.5); got != 2*time.Second {
+		t.Fatalf("expected mid jitter to keep the delay, got %s", got)
+	}
+}
+
+func TestCircuitBreakerPausesRestartsUntilProbeSucceeds(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	prev := breakerPollInterval
+	breakerPollInterval = 10 * time.Millisecond
+	defer func() { breakerPollInterval = prev }()
+
+	m := NewManager(fakeStarter{})
+	m.SetCircuitBreaker(2, 100*time.Millisecond)
+	a := model.TunnelRuntime{ID: "api|127.0.0.1:9546|localhost:80", HostAlias: "api", State: model.TunnelError}
+	b := model.TunnelRuntime{ID: "api|127.0.0.1:9547|localhost:80", HostAlias: "api", State: model.TunnelError}
+	m.runtime[a.ID] = a
+	m.runtime[b.ID] = b
+
+	m.noteRestartResult("api", a, false)
+	if st := m.Breakers()["api"]; st.State != BreakerClosed || st.ConsecutiveFailures != 1 {
+		t.Fatalf("expected closed breaker below threshold, got %+v", st)
+	}
+	m.noteRestartResult("api", b, false)
+	if st := m.Breakers()["api"]; st.State != BreakerOpen || st.Trips != 1 {
+		t.Fatalf("expected breaker open at threshold, got %+v", st)
+	}
+
+	// The first restart after the cooldown is the probe; the other waits.
+	probe, proceed := m.awaitBreaker(a.ID, "api")
+	if !probe || !proceed {
+		t.Fatalf("expected first restart to probe, got probe=%v proceed=%v", probe, proceed)
+	}
+	waited := make(chan bool, 1)
+	go func() {
+		p, ok := m.awaitBreaker(b.ID, "api")
+		waited <- !p && ok
+	}()
+	select {
+	case <-waited:
+		t.Fatal("expected restart to wait while the probe runs")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	m.noteRestartResult("api", a, true)
+	select {
+	case ok := <-waited:
+		if !ok {
+			t.Fatal("expected waiting restart to proceed without probing")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected waiting restart to resume after the probe succeeded")
+	}
+	if st := m.Breakers()["api"]; st.State != BreakerClosed || st.ConsecutiveFailures != 0 {
+		t.Fatalf("expected breaker closed after probe, got %+v", st)
+	}
+	for _, typ := range []string{"breaker_open", "breaker_half_open", "breaker_closed"} {
+		if evts, _ := m.Events(events.Query{EventType: typ}); len(evts) != 1 {
+			t.Fatalf("expected one %s event, got %d", typ, len(evts))
+		}
+	}
+}
+
+func TestCircuitBreakerReopensWhenProbeFails(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	m := NewManager(fakeStarter{})
+	m.SetCircuitBreaker(1, 0)
+	rt := model.TunnelRuntime{ID: "api|127.0.0.1:9548|localhost:80", HostAlias: "api", State: model.TunnelError}
+	m.runtime[rt.ID] = rt
+
+	m.noteRestartResult("api", rt, false)
+	if probe, _ := m.awaitBreaker(rt.ID, "api"); !probe {
+		t.Fatal("expected probe once the cooldown passed")
+	}
+	m.noteRestartResult("api", rt, false)
+	st := m.Breakers()["api"]
+	if st.State != BreakerOpen || st.Trips != 2 {
+		t.Fatalf("expected failed probe to reopen the breaker, got %+v", st)
+	}
+	m.markRestartFailure(rt.ID, "probe failed")
+	if got := m.RestartStats()[rt.ID].Breaker; got != BreakerOpen {
+		t.Fatalf("expected restart stats to report the host breaker, got %q", got)
+	}
+}
+
+// writeDependencySSHConfig declares a bastion and a db host that is
+// reached through it, each with one forward on a free port, and returns
+// those ports.
+func writeDependencySSHConfig(t *testing.T, home string) (bastionPort, dbPort int) {
+	t.Helper()
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	bastionPort, dbPort = freePort(t), freePort(t)
+	content := fmt.Sprintf("Host bastion\n  HostName 127.0.0.1\n  LocalForward 127.0.0.1:%d localhost:22\n"+
+		"Host db\n  HostName 127.0.0.1\n  LocalForward 127.0.0.1:%d localhost:5432\n", bastionPort, dbPort)
+	if err := os.WriteFile(filepath.Join(sshDir, "config"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return bastionPort, dbPort
+}
+
+func TestManagerStartsDependenciesAndCascadesStop(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	bastionPort, dbPort := writeDependencySSHConfig(t, home)
+
+	m := NewManager(&echoStarter{})
+	defer m.StopAll()
+	m.SetForwardConfigs([]appconfig.ForwardConfig{{Host: "db", DependsOn: []string{fmt.Sprintf("bastion:%d", bastionPort)}}})
+	db := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: dbPort, RemoteAddr: "localhost", RemotePort: 5432}
+	rt, err := m.Start(model.HostEntry{Alias: "db"}, db)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	bastionID := fmt.Sprintf("bastion|127.0.0.1:%d|localhost:22", bastionPort)
+	if len(rt.DependsOn) != 1 || rt.DependsOn[0] != bastionID {
+		t.Fatalf("expected db to depend on %s, got %v", bastionID, rt.DependsOn)
+	}
+	if b, err := m.Get(bastionID); err != nil || b.State != model.TunnelUp {
+		t.Fatalf("expected bastion up before db, got %+v (%v)", b, err)
+	}
+
+	tree := DependencyTree(m.Snapshot())
+	if len(tree) != 1 || tree[0].Tunnel.ID != bastionID || len(tree[0].Dependents) != 1 || tree[0].Dependents[0].Tunnel.ID != rt.ID {
+		t.Fatalf("unexpected dependency tree: %+v", tree)
+	}
+
+	before := rt.StartedAt
+	next, err := m.Restart(bastionID)
+	if err != nil || next.State != model.TunnelUp {
+		t.Fatalf("restart bastion: %+v (%v)", next, err)
+	}
+	if got, _ := m.Get(rt.ID); got.State != model.TunnelUp || !got.StartedAt.After(before) {
+		t.Fatalf("expected db restarted with its dependency, got %+v", got)
+	}
+
+	if err := m.Stop(bastionID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got, _ := m.Get(rt.ID); got.State != model.TunnelDown {
+		t.Fatalf("expected db stopped with its dependency, got %s", got.State)
+	}
+	waitForEvent(t, m, rt.ID, "dependency_stop")
+}
+
+func TestManagerRefusesDependencyCycle(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	_, dbPort := writeDependencySSHConfig(t, home)
+
+	m := NewManager(&echoStarter{})
+	defer m.StopAll()
+	m.SetForwardConfigs([]appconfig.ForwardConfig{
+		{Host: "db", DependsOn: []string{"bastion"}},
+		{Host: "bastion", DependsOn: []string{"db"}},
+	})
+	db := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: dbPort, RemoteAddr: "localhost", RemotePort: 5432}
+	_, err := m.Start(model.HostEntry{Alias: "db"}, db)
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Fatalf("expected dependency cycle error, got %v", err)
+	}
+	for _, rt := range m.Snapshot() {
+		if rt.State == model.TunnelUp {
+			t.Fatalf("expected nothing started, got %s up", rt.ID)
+		}
+	}
+}
+
+func TestParseDependency(t *testing.T) {
+	cases := []struct {
+		in   string
+		host string
+		port int
+		ok   bool
+	}{
+		{"bastion", "bastion", 0, true},
+		{" bastion:2222 ", "bastion", 2222, true},
+		{"bastion:", "", 0, false},
+		{":2222", "", 0, false},
+		{"bastion:70000", "", 0, false},
+	}
+	for _, tc := range cases {
+		host, port, err := ParseDependency(tc.in)
+		if (err == nil) != tc.ok || host != tc.host || port != tc.port {
+			t.Fatalf("ParseDependency(%q) = %q, %d, %v", tc.in, host, port, err)
+		}
+	}
+}
+
+func TestManagerRunsMatchingHooks(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	script := `cat > "$0.json"; echo "$SSHM_EVENT_TYPE $SSHM_HOST_ALIAS $SSHM_STATE" > "$0.env"`
+
+	m := NewManager(fakeStarter{})
+	defer WaitHooks()
+	defer m.StopAll()
+	m.SetForwardConfigs([]appconfig.ForwardConfig{{Host: "api", Tags: []string{"prod"}}})
+	m.SetHooks([]appconfig.HookConfig{
+		{Events: []string{"start_succeeded"}, Tags: []string{"prod"}, Command: []string{"sh", "-c", script, filepath.Join(dir, "tagged")}},
+		{Events: []string{"start_succeeded"}, Hosts: []string{"db"}, Command: []string{"sh", "-c", script, filepath.Join(dir, "other-host")}},
+		{Events: []string{"stop_succeeded"}, Command: []string{"sh", "-c", script, filepath.Join(dir, "stop")}},
+	}, 2)
+
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9551, RemoteAddr: "localhost", RemotePort: 80}
+	rt, err := m.Start(model.HostEntry{Alias: "api"}, fwd)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	WaitHooks()
+
+	b, err := os.ReadFile(filepath.Join(dir, "tagged.json"))
+	if err != nil {
+		t.Fatalf("expected tagged hook to run: %v", err)
+	}
+	var evt events.Event
+	if err := json.Unmarshal(b, &evt); err != nil {
+		t.Fatalf("hook stdin is not an event: %v (%s)", err, b)
+	}
+	if evt.EventType != "start_succeeded" || evt.TunnelID != rt.ID {
+		t.Fatalf("unexpected event on stdin: %+v", evt)
+	}
+	env, err := os.ReadFile(filepath.Join(dir, "tagged.env"))
+	if err != nil || strings.TrimSpace(string(env)) != "start_succeeded api up" {
+		t.Fatalf("unexpected hook env: %q (%v)", env, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other-host.json")); !os.IsNotExist(err) {
+		t.Fatal("expected hook scoped to another host not to run")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stop.json")); !os.IsNotExist(err) {
+		t.Fatal("expected stop hook not to run before a stop")
+	}
+}
+
+func TestManagerPostsWebhooks(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	got := make(chan events.Event, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var evt events.Event
+		_ = json.NewDecoder(r.Body).Decode(&evt)
+		got <- evt
+	}))
+	defer srv.Close()
+
+	m := NewManager(fakeStarter{})
+	defer WaitHooks()
+	defer m.StopAll()
+	m.SetWebhooks([]appconfig.WebhookConfig{{URL: srv.URL, Events: []string{"start_succeeded"}}})
+	defer m.SetWebhooks(nil)
+
+	fwd := model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: 9552, RemoteAddr: "localhost", RemotePort: 80}
+	rt, err := m.Start(model.HostEntry{Alias: "api"}, fwd)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	select {
+	case evt := <-got:
+		if evt.EventType != "start_succeeded" || evt.TunnelID != rt.ID {
+			t.Fatalf("unexpected webhook event: %+v", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a webhook delivery")
+	}
+}
+
+func TestParseSSHCommand(t *testing.T) {
+	cases := []struct {
+		argv []string
+		dest string
+		fwds []sshForward
+		ok   bool
+	}{
+		{argv: []string{"/usr/bin/ssh", "-fN", "-L", "8080:localhost:80", "api"}, dest: "api", fwds: []sshForward{{ForwardLocal, "8080:localhost:80"}}, ok: true},
+		{argv: []string{"ssh", "-fNL5432:db:5432", "-p", "2222", "-D1080", "deploy@bastion", "sleep", "-L", "1:x:1"}, dest: "deploy@bastion", fwds: []sshForward{{ForwardLocal, "5432:db:5432"}, {ForwardDynamic, "1080"}}, ok: true},
+		{argv: []string{"ssh", "-R", "9000:localhost:22", "--", "host"}, dest: "host", fwds: []sshForward{{ForwardRemote, "9000:localhost:22"}}, ok: true},
+		{argv: []string{"sshd", "-D"}, ok: false},
+	}
+	for _, tc := range cases {
+		inv, ok := parseSSHCommand(tc.argv)
+		if ok != tc.ok || inv.destination != tc.dest || !slices.Equal(inv.forwards, tc.fwds) {
+			t.Fatalf("parseSSHCommand(%q) = %+v, %v", tc.argv, inv, ok)
+		}
+	}
+	if got := destinationHost("ssh://deploy@bastion:2222"); got != "bastion" {
+		t.Fatalf("unexpected destination host %q", got)
+	}
+}
+
+func TestManagerAdoptsUnmanagedTunnel(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeSSHConfig(t, home, "api")
+
+	// A hand-started "ssh -fN" stand-in, described to the scanner by a fake /proc.
+	proc := exec.Command("sleep", "30")
+	if err := proc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() { _ = proc.Wait(); close(exited) }()
+	defer func() { _ = proc.Process.Kill() }()
+
+	root := t.TempDir()
+	prevRoot, prevPoll := procRoot, adoptedPollInterval
+	procRoot, adoptedPollInterval = root, 20*time.Millisecond
+	defer func() { procRoot, adoptedPollInterval = prevRoot, prevPoll }()
+	writeCmdline := func(pid int, argv ...string) {
+		dir := filepath.Join(root, strconv.Itoa(pid))
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cmdline"), []byte(strings.Join(argv, "\x00")+"\x00"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pid := proc.Process.Pid
+	writeCmdline(pid, "ssh", "-fNL", "9553:localhost:80", "-L", "9554:db:5432", "-R", "9000:localhost:22", "me@api")
+	writeCmdline(pid+100000, "ssh", "-fN", "-L", "9555:localhost:80", "elsewhere")
+	writeCmdline(pid+100001, "vim", "-L", "notes")
+
+	m := NewManager(fakeStarter{})
+	defer m.StopAll()
+
+	actions, err := m.Reconcile("", false)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(actions) != 2 || !actions[0].Adoptable || actions[0].PID != pid {
+		t.Fatalf("expected two adoptable forwards reported, got %+v", actions)
+	}
+
+	candidates, err := m.Unmanaged("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 4 {
+		t.Fatalf("expected 4 forwards found, got %+v", candidates)
+	}
+	if _, err := m.Adopt(pid + 100000); err == nil || !strings.Contains(err.Error(), "no configured host") {
+		t.Fatalf("expected unknown destination to be refused, got %v", err)
+	}
+
+	adopted, err := m.Adopt(pid)
+	if err != nil {
+		t.Fatalf("adopt: %v", err)
+	}
+	if len(adopted) != 2 || adopted[0].State != model.TunnelUp || !adopted[0].Adopted || adopted[0].PID != pid {
+		t.Fatalf("unexpected adopted tunnels: %+v", adopted)
+	}
+	if candidates, _ := m.Unmanaged("api"); len(candidates) != 0 {
+		t.Fatalf("expected adopted process to be tracked, got %+v", candidates)
+	}
+
+	// A later ssh-manager run keeps tracking it.
+	m2 := NewManager(fakeStarter{})
+	if err := m2.LoadRuntime(); err != nil {
+		t.Fatal(err)
+	}
+	if rt, err := m2.Get(adopted[1].ID); err != nil || rt.State != model.TunnelUp {
+		t.Fatalf("expected adopted tunnel restored as up, got %+v (%v)", rt, err)
+	}
+
+	// Stopping one forward ends the shared process and so its sibling.
+	if err := m.Stop(adopted[0].ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected adopted process to be terminated")
+	}
+	if rt, _ := m.Get(adopted[1].ID); rt.State != model.TunnelDown || rt.PID != 0 {
+		t.Fatalf("expected sibling forward down, got %+v", rt)
+	}
+}
+
+// muxStarter is a Multiplexer: its master is a "sleep 30" that creates the
+// control socket, and each added forward listens on its local port.
+type muxStarter struct {
+	fakeStarter
+	mu        sync.Mutex
+	masters   int
+	lastPID   int
+	listeners map[string]net.Listener
+
+	// failForward makes every forward request fail, as "ssh -O forward"
+	// does when the server refuses the forward.
+	failForward bool
+}
+
+func (f *muxStarter) StartMaster(ctx context.Context, host model.HostEntry, controlPath string) (*sshclient.TunnelProcess, error) {
+	cmd := exec.CommandContext(ctx, "sleep", "30")
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.masters++
+	f.lastPID = cmd.Process.Pid
+	f.mu.Unlock()
+	if err := os.WriteFile(controlPath, nil, 0o600); err != nil {
+		return nil, err
+	}
+	return &sshclient.TunnelProcess{Cmd: cmd}, nil
+}
+
+func (f *muxStarter) Control(ctx context.Context, op string, host model.HostEntry, controlPath string, fwd model.ForwardSpec) error {
+	if _, err := os.Stat(controlPath); err != nil {
+		return err
+	}
+	addr := fmt.Sprintf("%s:%d", fwd.LocalAddr, fwd.LocalPort)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch op {
+	case sshclient.OpForward:
+		if f.failForward {
+			return errors.New("mux_client_forward: forwarding request failed")
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		f.listeners[addr] = ln
+	case sshclient.OpCancel:
+		if ln := f.listeners[addr]; ln != nil {
+			_ = ln.Close()
+			delete(f.listeners, addr)
+		}
+	}
+	return nil
+}
+
+func (f *muxStarter) forwarding(addr string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.listeners[addr] != nil
+}
+
+func TestManagerMultiplexesForwardsOverOneMaster(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeSSHConfig(t, home, "api")
+
+	starter := &muxStarter{listeners: make(map[string]net.Listener)}
+	defer func() {
+		// Forwards that ended with their master still hold the fake's ports.
+		for _, ln := range starter.listeners {
+			_ = ln.Close()
+		}
+	}()
+	m := NewManager(starter)
+	defer m.StopAll()
+	m.SetMultiplex(true)
+	m.SetRestartPolicy(false, 0, 1, 1)
+	m.SetReadyTimeout(5 * time.Second)
+
+	h := model.HostEntry{Alias: "api"}
+	start := func(port int) model.TunnelRuntime {
+		t.Helper()
+		rt, err := m.Start(h, model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: port, RemoteAddr: "localhost", RemotePort: 80})
+		if err != nil {
+			t.Fatalf("start %d: %v", port, err)
+		}
+		return rt
+	}
+	a, b := start(9559), start(9560)
+	if !a.Multiplexed || a.State != model.TunnelUp || b.PID != a.PID || starter.masters != 1 {
+		t.Fatalf("expected both forwards up on one master, got %+v and %+v (%d masters)", a, b, starter.masters)
+	}
+
+	// Stopping one forward cancels it and leaves the master to the other.
+	if err := m.Stop(a.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if starter.forwarding(a.Local) || !starter.forwarding(b.Local) || !processAlive(a.PID) {
+		t.Fatal("expected only the stopped forward to be cancelled")
+	}
+
+	// The master failing takes every forward on it down.
+	if err := syscall.Kill(b.PID, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, m, b.ID, "unexpected_exit")
+	if got, _ := m.Get(b.ID); got.State != model.TunnelError {
+		t.Fatalf("expected forward to fail with its master, got %s", got.State)
+	}
+
+	// A later forward gets a new master, which stops with its last forward.
+	c := start(9561)
+	if c.PID == a.PID || starter.masters != 2 {
+		t.Fatalf("expected a new master, got pid %d (%d masters)", c.PID, starter.masters)
+	}
+	if err := m.Stop(c.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	// The socket is removed once the master has been reaped, just after it
+	// stops being alive.
+	socketGone := func() bool {
+		_, err := os.Stat(c.ControlPath)
+		return os.IsNotExist(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for processAlive(c.PID) || !socketGone() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected master stopped and control socket removed with its last forward (alive=%v)", processAlive(c.PID))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestManagerStopsMasterWhenForwardFails(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeSSHConfig(t, home, "api")
+
+	starter := &muxStarter{listeners: make(map[string]net.Listener), failForward: true}
+	m := NewManager(starter)
+	defer m.StopAll()
+	m.SetMultiplex(true)
+	m.SetReadyTimeout(5 * time.Second)
+
+	rt, err := m.Start(model.HostEntry{Alias: "api"}, model.ForwardSpec{LocalAddr: "127.0.0.1", LocalPort: freePort(t), RemoteAddr: "localhost", RemotePort: 80})
+	if err == nil {
+		t.Fatal("expected the forward to fail")
+	}
+	if rt.State != model.TunnelError || starter.masters != 1 {
+		t.Fatalf("expected error state after starting one master, got %s (%d masters)", rt.State, starter.masters)
+	}
+	m.mu.Lock()
+	left := len(m.masters)
+	m.mu.Unlock()
+	if left != 0 {
+		t.Fatalf("expected the unused master forgotten, %d left", left)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for processAlive(starter.lastPID) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the unused master stopped")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
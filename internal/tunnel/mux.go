@@ -0,0 +1,370 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/security"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+)
+
+// Multiplexer is implemented by TunnelStarters that can run the forwards of
+// a host over one shared ControlMaster connection (*sshclient.Client does).
+type Multiplexer interface {
+	StartMaster(ctx context.Context, host model.HostEntry, controlPath string) (*sshclient.TunnelProcess, error)
+	Control(ctx context.Context, op string, host model.HostEntry, controlPath string, fwd model.ForwardSpec) error
+}
+
+// controlOpTimeout bounds one "ssh -O forward/cancel" request.
+const controlOpTimeout = 10 * time.Second
+
+// masterSeq numbers the control sockets created by this process.
+var masterSeq atomic.Int64
+
+// master is the ControlMaster connection shared by the multiplexed forwards
+// of one host.
+type master struct {
+	host model.HostEntry
+	path string
+
+	// proc identifies the master process (PID, Argv, ProcStart).
+	proc model.TunnelRuntime
+
+	// watch ends when the master exits; every forward's watch follows it.
+	watch *procWatch
+	stop  func()
+
+	// ready is closed once the master accepts control requests, or its
+	// start failed with err.
+	ready chan struct{}
+	err   error
+
+	// forwards holds the watch of each forward on the master by runtime ID.
+	forwards map[string]*procWatch
+
+	// pending counts starts that acquired the master but have not added
+	// their forward yet; the master is not stopped while any is pending.
+	pending int
+}
+
+// idle reports whether no forward uses or is being added to ms. Callers
+// hold m.mu.
+func (ms *master) idle() bool {
+	return len(ms.forwards) == 0 && ms.pending == 0
+}
+
+func (ms *master) exited() bool {
+	if ms.watch == nil {
+		return false
+	}
+	select {
+	case <-ms.watch.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetMultiplex sets whether forwards run over one ControlMaster connection
+// per host unless their options say otherwise. On-demand and relayed
+// tunnels always run their own ssh.
+func (m *Manager) SetMultiplex(enabled bool) {
+	m.mu.Lock()
+	m.multiplex = enabled
+	m.mu.Unlock()
+}
+
+// MasterLogID is the ID under which LogPath keeps the stderr of a host's
+// ControlMaster; its multiplexed forwards have no ssh process of their own.
+func MasterLogID(hostAlias string) string {
+	return hostAlias + "|master"
+}
+
+// controlPath returns a new control socket path for a master of hostAlias.
+// Every master gets its own socket, so one that is still shutting down
+// never removes the socket of its successor. The name is kept short since
+// socket paths are limited to about 100 bytes.
+func controlPath(hostAlias string) (string, error) {
+	dir, err := appconfig.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(hostAlias))
+	return filepath.Join(dir, "cm", fmt.Sprintf("%x-%d-%d", sum[:5], os.Getpid(), masterSeq.Add(1))), nil
+}
+
+// startMultiplexed adds fwd, the ssh side of tunnel id, to the master of
+// host and returns that master's control path and a watch that ends when
+// the master exits or the forward is released.
+func (m *Manager) startMultiplexed(id string, host model.HostEntry, fwd model.ForwardSpec) (*master, *procWatch, error) {
+	ms, err := m.acquireMaster(host)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controlOpTimeout)
+	defer cancel()
+	if err := m.client.(Multiplexer).Control(ctx, sshclient.OpForward, host, ms.path, fwd); err != nil {
+		m.mu.Lock()
+		ms.pending--
+		m.mu.Unlock()
+		m.stopIdleMaster(ms)
+		return nil, nil, err
+	}
+	w := followWatch(ms.watch)
+	m.mu.Lock()
+	ms.pending--
+	ms.forwards[id] = w
+	m.mu.Unlock()
+	return ms, w, nil
+}
+
+// stopIdleMaster stops ms and forgets it once no forward uses it, as
+// releaseMultiplexed does when the last forward is stopped.
+func (m *Manager) stopIdleMaster(ms *master) {
+	m.mu.Lock()
+	idle := ms.idle()
+	if idle && m.masters[ms.host.Alias] == ms {
+		delete(m.masters, ms.host.Alias)
+	}
+	m.mu.Unlock()
+	if idle {
+		ms.stop()
+	}
+}
+
+// acquireMaster returns the master of host, attaching to one started by an
+// earlier ssh-manager run or starting a new one when there is none.
+// Concurrent starts of the same host share one master. The caller is
+// counted in the master's pending starts until it adds its forward.
+func (m *Manager) acquireMaster(host model.HostEntry) (*master, error) {
+	mux, ok := m.client.(Multiplexer)
+	if !ok {
+		return nil, errors.New("multiplexing is not supported by this ssh client")
+	}
+	m.mu.Lock()
+	ms := m.masters[host.Alias]
+	if ms != nil && ms.exited() {
+		delete(m.masters, host.Alias)
+		ms = nil
+	}
+	if ms != nil {
+		ms.pending++
+		m.mu.Unlock()
+		<-ms.ready
+		if ms.err != nil {
+			return nil, ms.err
+		}
+		return ms, nil
+	}
+	ms = &master{host: host, ready: make(chan struct{}), forwards: make(map[string]*procWatch), pending: 1}
+	m.masters[host.Alias] = ms
+	restored := m.restoredForwards(host.Alias)
+	m.mu.Unlock()
+
+	if len(restored) > 0 {
+		m.attachMaster(ms, restored)
+	} else {
+		ms.err = m.startMaster(mux, ms)
+	}
+	if ms.err != nil {
+		m.mu.Lock()
+		if m.masters[host.Alias] == ms {
+			delete(m.masters, host.Alias)
+		}
+		m.mu.Unlock()
+	}
+	close(ms.ready)
+	if ms.err != nil {
+		return nil, ms.err
+	}
+	return ms, nil
+}
+
+// startMaster runs a new ControlMaster for ms.host and waits until its
+// control socket appears.
+func (m *Manager) startMaster(mux Multiplexer, ms *master) error {
+	path, err := controlPath(ms.host.Alias)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := mux.StartMaster(ctx, ms.host, path)
+	if err != nil {
+		cancel()
+		return security.NewClassifiedError("failed to start control master", security.DebugMessage(err))
+	}
+	logPath, logErr := LogPath(MasterLogID(ms.host.Alias))
+	if logErr != nil {
+		slog.Warn("failed to resolve control master log path", "error", logErr)
+	}
+	w := newProcWatch(proc, logPath, nil)
+	stop := func() {
+		cancel()
+		w.closeStderr()
+	}
+
+	m.mu.Lock()
+	timeout := m.readyTimeout
+	m.mu.Unlock()
+	if timeout <= 0 {
+		timeout = onDemandReadyTimeout
+	}
+	if reason := awaitSocket(path, w, timeout); reason != "" {
+		stop()
+		<-w.done
+		_ = os.Remove(path)
+		return security.NewClassifiedError("control master not ready: "+reason, w.stderrTail())
+	}
+
+	ms.path = path
+	ms.watch = w
+	ms.stop = stop
+	ms.proc = model.TunnelRuntime{PID: proc.Cmd.Process.Pid}
+	recordProcess(&ms.proc, proc.Cmd.Args)
+	go m.watchMaster(ms)
+	return nil
+}
+
+// restoredForwards returns the multiplexed tunnels of hostAlias restored
+// from runtime.json whose master (started by an earlier ssh-manager run)
+// is still running. Callers hold m.mu.
+func (m *Manager) restoredForwards(hostAlias string) []model.TunnelRuntime {
+	var out []model.TunnelRuntime
+	for id, rt := range m.runtime {
+		if rt.HostAlias != hostAlias || !rt.Multiplexed || rt.ControlPath == "" || rt.State != model.TunnelUp || m.watches[id] != nil {
+			continue
+		}
+		if len(out) > 0 && rt.ControlPath != out[0].ControlPath {
+			continue
+		}
+		if sameProcess(rt) {
+			out = append(out, rt)
+		}
+	}
+	return out
+}
+
+// attachMaster adopts the master of restored forwards, so that new
+// forwards of the host share it and its exit cascades to all of them.
+func (m *Manager) attachMaster(ms *master, restored []model.TunnelRuntime) {
+	first := restored[0]
+	ms.path = first.ControlPath
+	ms.proc = model.TunnelRuntime{PID: first.PID, Argv: first.Argv, ProcStart: first.ProcStart}
+	ms.watch = externalWatch(ms.proc, adoptedPollInterval)
+	ms.stop = func() {
+		if sameProcess(ms.proc) {
+			if p, err := os.FindProcess(ms.proc.PID); err == nil {
+				_ = p.Signal(syscall.SIGTERM)
+			}
+		}
+	}
+	m.mu.Lock()
+	for _, rt := range restored {
+		w := followWatch(ms.watch)
+		ms.forwards[rt.ID] = w
+		m.watches[rt.ID] = w
+		go m.watchProcess(rt.ID, w)
+	}
+	m.mu.Unlock()
+	go m.watchMaster(ms)
+}
+
+// externalWatch returns a watch that ends, with an error, once proc is no
+// longer running. It stands in for Cmd.Wait on processes that are not
+// children of this one.
+func externalWatch(proc model.TunnelRuntime, every time.Duration) *procWatch {
+	w := &procWatch{done: make(chan struct{}), fatal: make(chan string, 1)}
+	go func() {
+		for sameProcess(proc) {
+			time.Sleep(every)
+		}
+		w.finish(fmt.Errorf("process %d exited", proc.PID))
+	}()
+	return w
+}
+
+// watchMaster forgets a master once it exits. Its forwards' watches end
+// with it, so each forward goes through the usual exit handling
+// (auto-restart, quarantine) in watchProcess.
+func (m *Manager) watchMaster(ms *master) {
+	<-ms.watch.done
+	m.mu.Lock()
+	if m.masters[ms.host.Alias] == ms {
+		delete(m.masters, ms.host.Alias)
+	}
+	m.mu.Unlock()
+	_ = os.Remove(ms.path)
+}
+
+// releaseMultiplexed removes the forward of tunnel rt from its master, and
+// stops the master once no forward uses it any more.
+func (m *Manager) releaseMultiplexed(rt model.TunnelRuntime) {
+	m.mu.Lock()
+	ms := m.masters[rt.HostAlias]
+	if ms != nil && ms.path != rt.ControlPath {
+		ms = nil
+	}
+	var w *procWatch
+	last := true
+	if ms != nil {
+		w = ms.forwards[rt.ID]
+		delete(ms.forwards, rt.ID)
+		last = ms.idle()
+		if last {
+			delete(m.masters, rt.HostAlias)
+		}
+	} else {
+		// A master of an earlier run nobody attached to: it is shared with
+		// the restored forwards that still use its socket.
+		for id, other := range m.runtime {
+			if id != rt.ID && other.Multiplexed && other.ControlPath == rt.ControlPath && activeState(other.State) {
+				last = false
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if w != nil {
+		w.finish(nil)
+	}
+	switch {
+	case last && ms != nil:
+		ms.stop()
+	case last:
+		if sameProcess(rt) {
+			if p, err := os.FindProcess(rt.PID); err == nil {
+				_ = p.Signal(syscall.SIGTERM)
+			}
+		}
+		_ = os.Remove(rt.ControlPath)
+	default:
+		fwd, err := ParseForwardArg(rt.Local + ":" + rt.Remote)
+		if err != nil {
+			slog.Warn("failed to cancel multiplexed forward", "id", rt.ID, "error", err)
+			return
+		}
+		mux, ok := m.client.(Multiplexer)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), controlOpTimeout)
+		defer cancel()
+		if err := mux.Control(ctx, sshclient.OpCancel, model.HostEntry{Alias: rt.HostAlias}, rt.ControlPath, fwd); err != nil {
+			slog.Warn("failed to cancel multiplexed forward", "id", rt.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/security"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// DefaultOnDemandIdle is how long an on-demand tunnel keeps ssh running after
+// its last client disconnects when no idle timeout is configured.
+const DefaultOnDemandIdle = 5 * time.Minute
+
+// onDemandReadyTimeout bounds the backend start of an on-demand tunnel when
+// the manager's readiness gate is disabled. Connections are spliced only
+// after ssh listens, so on-demand tunnels always wait for readiness.
+const onDemandReadyTimeout = 10 * time.Second
+
+// onDemandTunnel is the listener side of an on-demand tunnel. ssh-manager
+// accepts clients on the forward's local address; the first client starts
+// `ssh -L` on an internal loopback port and every client is spliced through
+// to it. When the last client has been gone for idle, ssh is stopped and the
+// tunnel is armed again.
+type onDemandTunnel struct {
+	id   string
+	host model.HostEntry
+	fwd  model.ForwardSpec
+	idle time.Duration
+	ln   net.Listener
+
+	traffic *trafficCounter
+
+	mu sync.Mutex
+	// backend is the internal ssh -L address while ssh is up.
+	backend string
+	// starting is non-nil while a backend start is in flight; it is closed
+	// when the attempt finishes and startErr holds its result.
+	starting chan struct{}
+	startErr error
+	// stopBackend kills the running ssh process; watch is its watcher.
+	stopBackend func()
+	watch       *procWatch
+	active      int
+	conns       map[net.Conn]struct{}
+	idleTimer   *time.Timer
+	closed      bool
+}
+
+// arm registers an on-demand tunnel: it binds the forward's local address and
+// serves it until the tunnel is stopped. No ssh process runs until a client
+// connects. fwd carries the allocated local port when alloc.auto is set; id
+// is derived from the declared forward.
+func (m *Manager) arm(id string, host model.HostEntry, fwd model.ForwardSpec, opts ForwardOptions, alloc portAlloc) (model.TunnelRuntime, error) {
+	m.mu.Lock()
+	if rt, ok := m.runtime[id]; ok && rt.OnDemand && m.onDemand[id] != nil &&
+		(rt.State == model.TunnelArmed || rt.State == model.TunnelStarting || rt.State == model.TunnelUp) {
+		m.mu.Unlock()
+		return rt, nil
+	}
+	m.mu.Unlock()
+
+	local := fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"), fwd.LocalPort)
+	ln, err := net.Listen("tcp", local)
+	if err != nil {
+		return model.TunnelRuntime{}, security.NewClassifiedError(
+			fmt.Sprintf("local port %s is already in use", local),
+			err.Error(),
+		)
+	}
+
+	idle := opts.IdleTimeout
+	if idle <= 0 {
+		idle = DefaultOnDemandIdle
+	}
+	t := &onDemandTunnel{
+		id:      id,
+		host:    host,
+		fwd:     fwd,
+		idle:    idle,
+		ln:      ln,
+		traffic: m.trafficFor(id),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	rt := model.TunnelRuntime{
+		ID:          id,
+		HostAlias:   host.Alias,
+		Forward:     fwd,
+		Local:       local,
+		Remote:      fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.RemoteAddr, "localhost"), fwd.RemotePort),
+		State:       model.TunnelArmed,
+		HealthCheck: opts.HealthCheck,
+		OnDemand:    true,
+		OwnerPID:    os.Getpid(),
+		Traffic:     t.traffic.stats(),
+		DependsOn:   opts.DependsOn,
+	}
+	opts.IdleTimeout = idle
+	applyLifetime(&rt, opts, time.Now())
+	alloc.apply(&rt)
+	m.mu.Lock()
+	m.runtime[id] = rt
+	m.onDemand[id] = t
+	m.cancel[id] = t.close
+	delete(m.health, id)
+	m.mu.Unlock()
+	m.recordEvent("armed", rt, "listening on "+local+"; ssh starts on first connection")
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel state after arming", "error", err)
+	}
+
+	go m.serveOnDemand(t)
+	if needsSupervision(rt) {
+		m.superviseLifetime(id)
+	}
+	return m.Get(id)
+}
+
+func (m *Manager) serveOnDemand(t *onDemandTunnel) {
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Warn("on-demand listener failed", "id", t.id, "error", err)
+			}
+			return
+		}
+		go m.handleOnDemandConn(t, conn)
+	}
+}
+
+// handleOnDemandConn splices one client connection through to ssh, starting
+// ssh first if it is not running.
+func (m *Manager) handleOnDemandConn(t *onDemandTunnel, client net.Conn) {
+	if !t.connOpened(client) {
+		_ = client.Close()
+		return
+	}
+	defer func() {
+		if t.connClosed(client) {
+			t.mu.Lock()
+			t.idleTimer = time.AfterFunc(t.idle, func() { m.idleOnDemand(t) })
+			t.mu.Unlock()
+		}
+	}()
+	defer client.Close()
+
+	var in, out int64
+	done := m.clientOpened(t.id, t.traffic)
+	defer func() { done(client.RemoteAddr(), in, out) }()
+
+	backend, err := m.ensureBackend(t)
+	if err != nil {
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", backend, onDemandReadyTimeout)
+	if err != nil {
+		slog.Warn("on-demand backend dial failed", "id", t.id, "error", err)
+		return
+	}
+	t.mu.Lock()
+	t.conns[upstream] = struct{}{}
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, upstream)
+		t.mu.Unlock()
+		_ = upstream.Close()
+	}()
+	in, out = splice(client, upstream, t.traffic)
+}
+
+// splice copies between client and upstream until both directions are done,
+// half-closing each side as its peer finishes writing. It returns the bytes
+// sent each way and adds them to tc as they flow.
+func splice(client, upstream net.Conn, tc *trafficCounter) (in, out int64) {
+	var wg sync.WaitGroup
+	pipe := func(dst, src net.Conn, cw *countingWriter) {
+		defer wg.Done()
+		_, _ = io.Copy(cw, src)
+		if tc, ok := dst.(*net.TCPConn); ok {
+			_ = tc.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	up := &countingWriter{w: upstream, total: &tc.bytesIn}
+	down := &countingWriter{w: client, total: &tc.bytesOut}
+	wg.Add(2)
+	go pipe(upstream, client, up)
+	go pipe(client, upstream, down)
+	wg.Wait()
+	return up.n, down.n
+}
+
+// connOpened registers a client. It reports false once the tunnel is closed.
+func (t *onDemandTunnel) connOpened(c net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return false
+	}
+	t.active++
+	t.conns[c] = struct{}{}
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+		t.idleTimer = nil
+	}
+	return true
+}
+
+// connClosed unregisters a client and reports whether it was the last one
+// of a still-open tunnel, i.e. whether the idle timer should start.
+func (t *onDemandTunnel) connClosed(c net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	delete(t.conns, c)
+	return t.active == 0 && !t.closed
+}
+
+// ensureBackend returns the address of the running ssh -L process, starting
+// it if needed. Concurrent callers share one start attempt.
+func (m *Manager) ensureBackend(t *onDemandTunnel) (string, error) {
+	t.mu.Lock()
+	if t.backend != "" {
+		addr := t.backend
+		t.mu.Unlock()
+		return addr, nil
+	}
+	if ch := t.starting; ch != nil {
+		t.mu.Unlock()
+		<-ch
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.backend == "" {
+			if t.startErr != nil {
+				return "", t.startErr
+			}
+			return "", errors.New("on-demand tunnel stopped")
+		}
+		return t.backend, nil
+	}
+	if t.closed {
+		t.mu.Unlock()
+		return "", errors.New("on-demand tunnel stopped")
+	}
+	ch := make(chan struct{})
+	t.starting = ch
+	t.mu.Unlock()
+
+	addr, stop, w, err := m.startBackend(t)
+
+	t.mu.Lock()
+	t.starting = nil
+	t.startErr = err
+	if err == nil {
+		if t.closed {
+			// Stopped while ssh was starting.
+			t.mu.Unlock()
+			stop()
+			close(ch)
+			return "", errors.New("on-demand tunnel stopped")
+		}
+		t.backend = addr
+		t.stopBackend = stop
+		t.watch = w
+	}
+	t.mu.Unlock()
+	close(ch)
+	if err == nil {
+		go m.watchOnDemandBackend(t, w)
+	}
+	return addr, err
+}
+
+// startBackend launches ssh -L on a free loopback port and waits for it to
+// accept connections. The runtime entry goes starting -> up, or back to armed
+// with the failure recorded.
+func (m *Manager) startBackend(t *onDemandTunnel) (string, func(), *procWatch, error) {
+	port, err := freeLoopbackPort()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	bfwd := t.fwd
+	bfwd.LocalAddr = "127.0.0.1"
+	bfwd.LocalPort = port
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	rt, ok := m.setOnDemandState(t.id, func(rt *model.TunnelRuntime) {
+		rt.State = model.TunnelStarting
+		rt.StartedAt = time.Now()
+		rt.LastError = ""
+		rt.ErrorCode = ""
+	})
+	if !ok {
+		return "", nil, nil, errors.New("on-demand tunnel stopped")
+	}
+	m.recordEvent("start_requested", rt, "client connected; starting ssh")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := m.client.StartTunnel(ctx, t.host, bfwd)
+	if err != nil {
+		cancel()
+		return "", nil, nil, m.failOnDemandStart(t.id, security.UserMessage(err, m.redactErrors), "")
+	}
+	logPath, logErr := LogPath(t.id)
+	if logErr != nil {
+		slog.Warn("failed to resolve tunnel log path", "error", logErr)
+	}
+	w := newProcWatch(proc, logPath, func(code sshclient.ErrorCode, line string) {
+		m.noteStderrCode(t.id, code)
+	})
+	stop := func() {
+		cancel()
+		w.closeStderr()
+	}
+	m.mu.Lock()
+	m.watches[t.id] = w
+	timeout := m.readyTimeout
+	m.mu.Unlock()
+	if timeout <= 0 {
+		timeout = onDemandReadyTimeout
+	}
+	m.setOnDemandState(t.id, func(rt *model.TunnelRuntime) {
+		rt.PID = proc.Cmd.Process.Pid
+		recordProcess(rt, proc.Cmd.Args)
+	})
+
+	if reason := awaitReady(addr, w, timeout); reason != "" {
+		stop()
+		<-w.done
+		return "", nil, nil, m.failOnDemandStart(t.id, "tunnel not ready: "+reason, w.code())
+	}
+
+	rt, _ = m.setOnDemandState(t.id, func(rt *model.TunnelRuntime) { rt.State = model.TunnelUp })
+	m.recordEvent("start_succeeded", rt, "on-demand tunnel started")
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel state after on-demand start", "error", err)
+	}
+	return addr, stop, w, nil
+}
+
+// failOnDemandStart returns an on-demand tunnel to armed after a failed
+// backend start and records why.
+func (m *Manager) failOnDemandStart(id, reason string, code sshclient.ErrorCode) error {
+	rt, _ := m.setOnDemandState(id, func(rt *model.TunnelRuntime) {
+		rt.State = model.TunnelArmed
+		rt.PID = 0
+		rt.LastError = reason
+		rt.ErrorCode = string(code)
+	})
+	m.recordEvent("start_failed", rt, rt.LastError)
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel state after on-demand start error", "error", err)
+	}
+	return errors.New(reason)
+}
+
+// watchOnDemandBackend returns the tunnel to armed if its ssh process exits
+// on its own. Idle shutdowns and stops detach the watcher first.
+func (m *Manager) watchOnDemandBackend(t *onDemandTunnel, w *procWatch) {
+	<-w.done
+	t.mu.Lock()
+	if t.watch != w {
+		t.mu.Unlock()
+		return
+	}
+	t.backend = ""
+	t.stopBackend = nil
+	t.watch = nil
+	t.mu.Unlock()
+
+	code := w.code()
+	rt, ok := m.setOnDemandState(t.id, func(rt *model.TunnelRuntime) {
+		rt.State = model.TunnelArmed
+		rt.PID = 0
+		rt.LastError = exitReason(code, "ssh exited")
+		if code != "" {
+			rt.ErrorCode = string(code)
+		}
+	})
+	if !ok {
+		return
+	}
+	m.recordEvent("unexpected_exit", rt, rt.LastError)
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel state after on-demand exit", "error", err)
+	}
+}
+
+// idleOnDemand stops ssh once no client has been connected for t.idle.
+func (m *Manager) idleOnDemand(t *onDemandTunnel) {
+	t.mu.Lock()
+	if t.closed || t.active > 0 || t.stopBackend == nil {
+		t.mu.Unlock()
+		return
+	}
+	stop, w := t.stopBackend, t.watch
+	t.backend = ""
+	t.stopBackend = nil
+	t.watch = nil
+	t.idleTimer = nil
+	t.mu.Unlock()
+
+	stop()
+	<-w.done
+	rt, ok := m.setOnDemandState(t.id, func(rt *model.TunnelRuntime) {
+		rt.State = model.TunnelArmed
+		rt.PID = 0
+	})
+	if !ok {
+		return
+	}
+	m.recordEvent("on_demand_idle", rt, fmt.Sprintf("no connections for %s; ssh stopped", t.idle))
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel state after on-demand idle", "error", err)
+	}
+}
+
+// close stops listening, drops clients and stops ssh. It is installed as the
+// tunnel's cancel func, so Stop handles on-demand tunnels like any other.
+func (t *onDemandTunnel) close() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	stop := t.stopBackend
+	t.backend = ""
+	t.stopBackend = nil
+	t.watch = nil
+	if t.idleTimer != nil {
+		t.idleTimer.Stop()
+		t.idleTimer = nil
+	}
+	conns := make([]net.Conn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	_ = t.ln.Close()
+	for _, c := range conns {
+		_ = c.Close()
+	}
+	if stop != nil {
+		stop()
+	}
+}
+
+// setOnDemandState applies fn to the runtime entry of an on-demand tunnel
+// that is still owned by this manager. It reports false when the tunnel has
+// been stopped in the meantime.
+func (m *Manager) setOnDemandState(id string, fn func(*model.TunnelRuntime)) (model.TunnelRuntime, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rt, ok := m.runtime[id]
+	if !ok || m.onDemand[id] == nil || rt.State == model.TunnelStopping || rt.State == model.TunnelDown {
+		return rt, false
+	}
+	fn(&rt)
+	m.runtime[id] = rt
+	return rt, true
+}
+
+// probeAddr returns the address to probe for latency and health checks.
+// Probing an on-demand tunnel's public listener would count as client
+// activity and keep ssh alive forever, so its internal ssh port is used and
+// "" is returned while ssh is not running. Relayed tunnels are probed on
+// their backend so probes are not counted as clients. A plain tunnel with
+// an idle timeout has no other port, so it is not probed at all: a probe
+// would look like a client and keep it from ever going idle. Callers hold
+// m.mu.
+func (m *Manager) probeAddr(rt model.TunnelRuntime) string {
+	if rt.Relay {
+		return rt.Backend
+	}
+	if !rt.OnDemand {
+		if rt.IdleTimeoutSec > 0 {
+			return ""
+		}
+		return rt.Local
+	}
+	t := m.onDemand[rt.ID]
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.backend
+}
+
+// freeLoopbackPort asks the kernel for an unused loopback TCP port.
+func freeLoopbackPort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
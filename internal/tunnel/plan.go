@@ -0,0 +1,180 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+	"github.com/treykane/ssh-manager/internal/state"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// Plan is what starting one forward would run, as reported by --dry-run.
+type Plan struct {
+	ID        string          `json:"id"`
+	HostAlias string          `json:"host_alias"`
+	Preflight PreflightReport `json:"preflight"`
+
+	// Commands holds the argv of each process that would run, in order.
+	Commands [][]string `json:"commands"`
+
+	// Notes explains what is only decided at start time (allocated ports,
+	// on-demand starts) and what else the start would do.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// commandBuilder is implemented by TunnelStarters that can report the argv
+// they would run (*sshclient.Client does).
+type commandBuilder interface {
+	BuildTunnelArgs(hostAlias string, fwd model.ForwardSpec) []string
+	BuildMasterArgs(hostAlias, controlPath string) []string
+}
+
+// Plan returns what StartWithOptions(host, fwd, opts) would run. Options
+// are resolved the same way and Preflight is run, but no process is started
+// and no state is written. A tunnel that is already up runs nothing.
+func (m *Manager) Plan(host model.HostEntry, fwd model.ForwardSpec, opts ForwardOptions) (Plan, error) {
+	id := RuntimeID(host.Alias, fwd)
+	m.mu.Lock()
+	rt, ok := m.runtime[id]
+	m.mu.Unlock()
+	if ok && rt.State == model.TunnelUp {
+		return Plan{
+			ID:        id,
+			HostAlias: host.Alias,
+			Preflight: m.Preflight(host, fwd),
+			Notes:     []string{fmt.Sprintf("already up (pid %d); nothing would run", rt.PID)},
+		}, nil
+	}
+	return m.plan(host, fwd, opts)
+}
+
+func (m *Manager) plan(host model.HostEntry, fwd model.ForwardSpec, opts ForwardOptions) (Plan, error) {
+	b, ok := m.client.(commandBuilder)
+	if !ok {
+		return Plan{}, errors.New("dry run is not supported by this ssh client")
+	}
+	opts = m.resolveOptions(host.Alias, fwd.LocalPort, opts)
+	p := Plan{
+		ID:        RuntimeID(host.Alias, fwd),
+		HostAlias: host.Alias,
+		Preflight: m.Preflight(host, fwd),
+	}
+	if len(opts.DependsOn) > 0 {
+		p.Notes = append(p.Notes, "starts its dependencies first: "+strings.Join(opts.DependsOn, ", "))
+	}
+
+	m.mu.Lock()
+	lo, hi := m.autoPortMin, m.autoPortMax
+	m.mu.Unlock()
+	local := fmt.Sprintf("%s:%d", util.NormalizeAddr(fwd.LocalAddr, "127.0.0.1"), fwd.LocalPort)
+	if fwd.LocalPort == 0 || (opts.AutoPort && !canListen(local)) {
+		fwd.LocalPort = 0
+		p.Notes = append(p.Notes, fmt.Sprintf("local port 0 stands for a port allocated from %d-%d at start", lo, hi))
+	}
+
+	switch {
+	case opts.OnDemand:
+		fwd.LocalAddr, fwd.LocalPort = "127.0.0.1", 0
+		p.Notes = append(p.Notes, "on demand: ssh-manager listens on "+local+" and runs ssh on an internal port (shown as 0) when the first client connects")
+	case opts.Relay:
+		fwd.LocalAddr, fwd.LocalPort = "127.0.0.1", 0
+		p.Notes = append(p.Notes, "relayed: ssh-manager listens on "+local+" and ssh binds an internal port (shown as 0)")
+	case opts.Multiplex:
+		path, err := controlPath(host.Alias)
+		if err != nil {
+			return Plan{}, err
+		}
+		p.Commands = append(p.Commands,
+			append([]string{"ssh"}, b.BuildMasterArgs(host.Alias, path)...),
+			append([]string{"ssh"}, sshclient.BuildControlArgs(sshclient.OpForward, host.Alias, path, fwd)...),
+		)
+		p.Notes = append(p.Notes, "multiplexed: the master is only started when the host has none running")
+		return p, nil
+	}
+	p.Commands = append(p.Commands, append([]string{"ssh"}, b.BuildTunnelArgs(host.Alias, fwd)...))
+	return p, nil
+}
+
+// PlanRuntime returns what restarting or recovering tunnel rt would run,
+// with the options it was started with.
+func (m *Manager) PlanRuntime(rt model.TunnelRuntime) (Plan, error) {
+	host, err := findHostByAlias(rt.HostAlias)
+	if err != nil {
+		return Plan{}, err
+	}
+	fwd, err := RequestedForward(rt)
+	if err != nil {
+		return Plan{}, err
+	}
+	p, err := m.plan(host, fwd, OptionsFromRuntime(rt))
+	if err != nil {
+		return Plan{}, err
+	}
+	if activeState(rt.State) && rt.PID > 0 {
+		p.Notes = append([]string{fmt.Sprintf("stops pid %d first", rt.PID)}, p.Notes...)
+	}
+	return p, nil
+}
+
+// PlanStop returns the tunnels "tunnel down idOrHost" would stop, in the
+// order it stops them: each tunnel after the tunnels that depend on it.
+// Nothing is stopped.
+func (m *Manager) PlanStop(idOrHost string) ([]model.TunnelRuntime, error) {
+	ids := []string{idOrHost}
+	if !strings.Contains(idOrHost, "|") {
+		var err error
+		if ids, err = m.hostStopIDs(idOrHost); err != nil {
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []model.TunnelRuntime
+	seen := map[string]bool{}
+	var visit func(id string)
+	visit = func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		for _, dep := range m.activeDependents(id) {
+			visit(dep.ID)
+		}
+		out = append(out, m.runtime[id])
+	}
+	for _, id := range ids {
+		if _, ok := m.runtime[id]; !ok {
+			return nil, fmt.Errorf("tunnel not found: %s", id)
+		}
+		visit(id)
+	}
+	return out, nil
+}
+
+// InspectRuntime loads runtime.json as recorded, for --dry-run. Unlike
+// LoadRuntime it does not check processes, quarantine, expire or supervise
+// anything, so it has no side effects.
+func (m *Manager) InspectRuntime() error {
+	b, err := state.Runtime.Read()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var doc runtimeFile
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	for _, rt := range doc.Tunnels {
+		m.runtime[rt.ID] = rt
+	}
+	m.mu.Unlock()
+	return nil
+}
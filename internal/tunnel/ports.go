@@ -0,0 +1,152 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/state"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// portsFile is the on-disk layout of ports.json (see state.Ports).
+type portsFile struct {
+	Version int            `json:"version"`
+	Ports   map[string]int `json:"ports"`
+}
+
+// SetAutoPortRange sets the range automatic local ports are allocated from.
+// An invalid range falls back to the defaults.
+func (m *Manager) SetAutoPortRange(lo, hi int) {
+	if lo < util.MinPort || hi > util.MaxPort || lo > hi {
+		lo, hi = appconfig.DefaultAutoPortMin, appconfig.DefaultAutoPortMax
+	}
+	m.mu.Lock()
+	m.autoPortMin, m.autoPortMax = lo, hi
+	m.mu.Unlock()
+}
+
+// allocatePort picks a free local port on localAddr for tunnel id. The port
+// recorded for id in ports.json is reused when it is still free, so a tunnel
+// keeps its port across restarts; otherwise the range is scanned starting at
+// an offset derived from id. Ports held by other active tunnels are skipped,
+// and ports recorded for other IDs are only handed out when nothing else is
+// free. The choice is saved back to ports.json.
+func (m *Manager) allocatePort(id, localAddr string) (int, error) {
+	saved, err := loadPorts()
+	if err != nil {
+		slog.Warn("failed to load port assignments", "error", err)
+		saved = map[string]int{}
+	}
+
+	m.mu.Lock()
+	lo, hi := m.autoPortMin, m.autoPortMax
+	busy := make(map[int]bool)
+	for otherID, rt := range m.runtime {
+		if otherID == id || !activeState(rt.State) {
+			continue
+		}
+		if _, port, err := splitAddrPort(rt.Local); err == nil {
+			busy[port] = true
+		}
+	}
+	m.mu.Unlock()
+	if lo == 0 {
+		lo, hi = appconfig.DefaultAutoPortMin, appconfig.DefaultAutoPortMax
+	}
+
+	host := util.NormalizeAddr(localAddr, "127.0.0.1")
+	free := func(port int) bool {
+		return !busy[port] && canListen(net.JoinHostPort(host, strconv.Itoa(port)))
+	}
+
+	port := 0
+	if p := saved[id]; p >= lo && p <= hi && free(p) {
+		port = p
+	}
+	if port == 0 {
+		reserved := make(map[int]bool, len(saved))
+		for otherID, p := range saved {
+			if otherID != id {
+				reserved[p] = true
+			}
+		}
+		size := hi - lo + 1
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(id))
+		start := int(h.Sum32() % uint32(size))
+		// First pass keeps other tunnels' recorded ports for them; the second
+		// takes anything free.
+		for pass := 0; pass < 2 && port == 0; pass++ {
+			for i := 0; i < size; i++ {
+				p := lo + (start+i)%size
+				if pass == 0 && reserved[p] {
+					continue
+				}
+				if free(p) {
+					port = p
+					break
+				}
+			}
+		}
+	}
+	if port == 0 {
+		return 0, fmt.Errorf("no free local port in range %d-%d", lo, hi)
+	}
+
+	if saved[id] != port {
+		saved[id] = port
+		if err := savePorts(saved); err != nil {
+			slog.Warn("failed to persist port assignment", "error", err)
+		}
+	}
+	return port, nil
+}
+
+// activeState reports whether a tunnel in state s holds its local port.
+func activeState(s model.TunnelState) bool {
+	return s == model.TunnelUp || s == model.TunnelStarting || s == model.TunnelArmed
+}
+
+// canListen reports whether addr can be bound right now.
+func canListen(addr string) bool {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	_ = ln.Close()
+	return true
+}
+
+func loadPorts() (map[string]int, error) {
+	b, err := state.Ports.Read()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]int{}, nil
+		}
+		return nil, err
+	}
+	var doc portsFile
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Ports == nil {
+		doc.Ports = map[string]int{}
+	}
+	return doc.Ports, nil
+}
+
+func savePorts(ports map[string]int) error {
+	b, err := json.MarshalIndent(portsFile{Version: state.Ports.Current, Ports: ports}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.Ports.Write(b)
+}
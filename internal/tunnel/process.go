@@ -0,0 +1,313 @@
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+)
+
+// stderrTailLines is how many recent stderr lines a procWatch keeps in
+// memory. The full output goes to the tunnel's log file (see LogPath).
+const stderrTailLines = 50
+
+// maxLogBytes is the size at which a tunnel log is rotated to "<name>.1"
+// before a new process starts writing to it.
+const maxLogBytes = 1 << 20
+
+// procWatch tracks one running tunnel process: its exit status and its
+// stderr output. Stderr is drained continuously so ssh never blocks on a
+// full pipe, and the process is only reaped once stderr reaches EOF (as
+// exec.Cmd requires).
+type procWatch struct {
+	// done is closed once the process has exited and been reaped.
+	done chan struct{}
+
+	// err is the Cmd.Wait result; valid after done is closed.
+	err error
+
+	// fatal receives the first stderr line that reports a fatal ssh error.
+	fatal chan string
+
+	// onCode is called (outside any lock) for each classified stderr line.
+	onCode func(code sshclient.ErrorCode, line string)
+
+	stderr    io.Closer
+	closeOnce sync.Once
+
+	// parent is the ControlMaster watch a multiplexed forward follows (see
+	// followWatch); stderr and error codes are the master's.
+	parent     *procWatch
+	finishOnce sync.Once
+
+	mu sync.Mutex
+	// ring holds the last stderrTailLines lines; next is the slot the
+	// following line goes into once the ring is full.
+	ring []string
+	next int
+	// firstFatal is the first fatal code seen; lastCode the latest code.
+	firstFatal sshclient.ErrorCode
+	lastCode   sshclient.ErrorCode
+}
+
+// newProcWatch starts draining proc's stderr into memory and, when logPath
+// is non-empty, into that log file. onCode may be nil.
+func newProcWatch(proc *sshclient.TunnelProcess, logPath string, onCode func(sshclient.ErrorCode, string)) *procWatch {
+	w := &procWatch{
+		done:   make(chan struct{}),
+		fatal:  make(chan string, 1),
+		onCode: onCode,
+		stderr: proc.Stderr,
+	}
+	stderrDone := make(chan struct{})
+	if proc.Stderr != nil {
+		go w.readStderr(proc.Stderr, openTunnelLog(logPath), stderrDone)
+	} else {
+		close(stderrDone)
+	}
+	go func() {
+		<-stderrDone
+		w.err = proc.Cmd.Wait()
+		close(w.done)
+	}()
+	return w
+}
+
+// followWatch returns a watch for one forward multiplexed over the master
+// watched by parent. It ends when the master exits (with its exit status)
+// or when the forward alone is released (see finish).
+func followWatch(parent *procWatch) *procWatch {
+	w := &procWatch{
+		done:   make(chan struct{}),
+		fatal:  make(chan string, 1),
+		parent: parent,
+	}
+	go func() {
+		<-parent.done
+		w.finish(parent.err)
+	}()
+	return w
+}
+
+// finish ends a follower watch with err, once.
+func (w *procWatch) finish(err error) {
+	w.finishOnce.Do(func() {
+		w.err = err
+		close(w.done)
+	})
+}
+
+func (w *procWatch) readStderr(r io.Reader, log *os.File, done chan<- struct{}) {
+	defer close(done)
+	if log != nil {
+		defer log.Close()
+	}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if log != nil {
+			_, _ = fmt.Fprintf(log, "%s %s\n", time.Now().UTC().Format(time.RFC3339), line)
+		}
+		code := sshclient.ClassifyStderr(line)
+		w.mu.Lock()
+		w.push(line)
+		if code != "" {
+			w.lastCode = code
+			if code.Fatal() && w.firstFatal == "" {
+				w.firstFatal = code
+			}
+		}
+		w.mu.Unlock()
+		if code == "" {
+			continue
+		}
+		if code.Fatal() {
+			select {
+			case w.fatal <- line:
+			default:
+			}
+		}
+		if w.onCode != nil {
+			w.onCode(code, line)
+		}
+	}
+}
+
+// push appends line to the ring buffer. Callers hold w.mu.
+func (w *procWatch) push(line string) {
+	if len(w.ring) < stderrTailLines {
+		w.ring = append(w.ring, line)
+		return
+	}
+	w.ring[w.next] = line
+	w.next = (w.next + 1) % stderrTailLines
+}
+
+// lines returns the buffered stderr lines, oldest first.
+func (w *procWatch) lines() []string {
+	if w.parent != nil {
+		return w.parent.lines()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]string, 0, len(w.ring))
+	out = append(out, w.ring[w.next:]...)
+	return append(out, w.ring[:w.next]...)
+}
+
+// closeStderr closes the stderr pipe so a stopped tunnel is reaped even if
+// a child process (e.g. a ProxyCommand) still holds the write end open.
+func (w *procWatch) closeStderr() {
+	if w.stderr == nil {
+		return
+	}
+	w.closeOnce.Do(func() { _ = w.stderr.Close() })
+}
+
+// stderrTail returns the most recent stderr lines joined for display.
+func (w *procWatch) stderrTail() string {
+	return strings.Join(w.lines(), "\n")
+}
+
+// lastStderr returns the most recent stderr line, if any.
+func (w *procWatch) lastStderr() string {
+	lines := w.lines()
+	if len(lines) == 0 {
+		return ""
+	}
+	return lines[len(lines)-1]
+}
+
+// code returns the classification that best explains a failure: the first
+// fatal code if ssh reported one, otherwise the most recent code.
+func (w *procWatch) code() sshclient.ErrorCode {
+	if w.parent != nil {
+		return w.parent.code()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.firstFatal != "" {
+		return w.firstFatal
+	}
+	return w.lastCode
+}
+
+// LogPath returns the stderr log file for a tunnel ID:
+// <config dir>/logs/<sanitized id>.log.
+func LogPath(id string) (string, error) {
+	dir, err := appconfig.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, id)
+	return filepath.Join(dir, "logs", name+".log"), nil
+}
+
+// openTunnelLog opens path for appending, rotating it first when it has
+// grown past maxLogBytes. Failures are logged and yield nil: a tunnel must
+// not fail to start because its log cannot be written.
+func openTunnelLog(path string) *os.File {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		slog.Warn("failed to create tunnel log directory", "error", err)
+		return nil
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Size() > maxLogBytes {
+		_ = os.Rename(path, path+".1")
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.Warn("failed to open tunnel log", "path", path, "error", err)
+		return nil
+	}
+	return f
+}
+
+// readyPollInterval is how often awaitReady dials the local port.
+const readyPollInterval = 100 * time.Millisecond
+
+// awaitReady waits until local accepts TCP connections. It returns "" when
+// the tunnel is ready, or the reason it never became ready: a fatal ssh
+// error, the process exiting, or the timeout expiring.
+func awaitReady(local string, w *procWatch, timeout time.Duration) string {
+	return awaitCondition(w, timeout, func() bool { return portAccepting(local) },
+		"local port "+local+" did not accept connections within "+timeout.String())
+}
+
+// awaitSocket waits until a ControlMaster has created its control socket
+// at path, which it does once the connection is authenticated.
+func awaitSocket(path string, w *procWatch, timeout time.Duration) string {
+	return awaitCondition(w, timeout, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, "control socket did not appear within "+timeout.String())
+}
+
+// awaitCondition polls ready until it holds, returning "" then, or the
+// reason the process watched by w failed first (timedOut on timeout).
+func awaitCondition(w *procWatch, timeout time.Duration, ready func() bool, timedOut string) string {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(readyPollInterval)
+	defer tick.Stop()
+	for {
+		if ready() {
+			return ""
+		}
+		select {
+		case line := <-w.fatal:
+			return describeStderr(line)
+		case <-w.done:
+			if line := w.lastStderr(); line != "" {
+				return describeStderr(line)
+			}
+			if w.err != nil {
+				return "ssh exited: " + w.err.Error()
+			}
+			return "ssh exited"
+		case <-deadline.C:
+			return timedOut
+		case <-tick.C:
+		}
+	}
+}
+
+// describeStderr returns the description of a classified ssh stderr line,
+// or the line itself when it matches no known failure. The raw line stays
+// in the stderr tail.
+func describeStderr(line string) string {
+	if code := sshclient.ClassifyStderr(line); code != "" {
+		return code.Describe()
+	}
+	return line
+}
+
+// portAccepting reports whether something accepts TCP connections on addr.
+func portAccepting(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, readyPollInterval)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
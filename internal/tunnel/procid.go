@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+// procAvailable reports whether processes can be inspected through procRoot
+// (Linux). Elsewhere the ps-based checks are used.
+func procAvailable() bool {
+	fi, err := os.Stat(procRoot)
+	return err == nil && fi.IsDir()
+}
+
+// readCmdline returns the argv of pid, or nil if it cannot be read.
+func readCmdline(pid int) []string {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return strings.Split(string(bytes.TrimRight(b, "\x00")), "\x00")
+}
+
+// processStartTime returns when pid started, in clock ticks since boot
+// (field 22 of /proc/<pid>/stat). Together with the PID it identifies a
+// process across PID reuse.
+func processStartTime(pid int) (uint64, error) {
+	b, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// The command name in field 2 may contain spaces and parentheses, so
+	// fields are counted from its closing parenthesis; field 3 comes next.
+	end := bytes.LastIndexByte(b, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(b[end+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// recordProcess stores the identity of the process rt.PID runs in: argv as
+// started and, where /proc is available, its start time.
+func recordProcess(rt *model.TunnelRuntime, argv []string) {
+	rt.Argv = slices.Clone(argv)
+	rt.ProcStart = 0
+	if procAvailable() {
+		if start, err := processStartTime(rt.PID); err == nil {
+			rt.ProcStart = start
+		}
+	}
+}
+
+// sameProcess reports whether rt.PID is still the process the tunnel was
+// started (or adopted) as, so it is safe to signal. With /proc, argv and
+// start time must match exactly; a recycled PID fails both. Entries written
+// before they were recorded, and systems without /proc, fall back to
+// matching the ps command line.
+func sameProcess(rt model.TunnelRuntime) bool {
+	if rt.PID <= 0 || !processAlive(rt.PID) {
+		return false
+	}
+	if procAvailable() {
+		argv := readCmdline(rt.PID)
+		if argv == nil {
+			return false
+		}
+		if rt.ProcStart != 0 {
+			start, err := processStartTime(rt.PID)
+			if err != nil || start != rt.ProcStart {
+				return false
+			}
+		}
+		switch {
+		case len(rt.Argv) > 0:
+			return slices.Equal(argv, rt.Argv)
+		case rt.Adopted:
+			return adoptedProcessMatches(argv, rt)
+		default:
+			return isManagedTunnelProcess(strings.Join(argv, " "), rt)
+		}
+	}
+	if rt.Adopted {
+		// Adopted tunnels are only ever found through /proc.
+		return false
+	}
+	cmdline, err := processCommand(rt.PID)
+	if err != nil {
+		return false
+	}
+	if len(rt.Argv) > 0 {
+		return cmdline == strings.Join(rt.Argv, " ")
+	}
+	return isManagedTunnelProcess(cmdline, rt)
+}
@@ -0,0 +1,274 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/security"
+	"github.com/treykane/ssh-manager/internal/util"
+)
+
+// trafficPersistInterval bounds how often client activity rewrites
+// runtime.json; a change inside the interval is written when it ends.
+var trafficPersistInterval = 2 * time.Second
+
+// trafficCounter counts client traffic through a listener owned by
+// ssh-manager (relayed and on-demand tunnels). Counters survive auto-restarts
+// and are reset when the tunnel is stopped.
+type trafficCounter struct {
+	connections atomic.Int64
+	active      atomic.Int64
+	bytesIn     atomic.Int64
+	bytesOut    atomic.Int64
+
+	mu        sync.Mutex
+	persisted time.Time   // last runtime.json write for a traffic change
+	flush     *time.Timer // pending write of a throttled change
+}
+
+func (c *trafficCounter) stats() *model.TrafficStats {
+	return &model.TrafficStats{
+		Connections: c.connections.Load(),
+		Active:      c.active.Load(),
+		BytesIn:     c.bytesIn.Load(),
+		BytesOut:    c.bytesOut.Load(),
+	}
+}
+
+// countingWriter adds the bytes written through it to total and n.
+type countingWriter struct {
+	w     io.Writer
+	total *atomic.Int64
+	n     int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	if cw.total != nil {
+		cw.total.Add(int64(n))
+	}
+	return n, err
+}
+
+// relay is the listener side of a relayed tunnel: ssh-manager accepts clients
+// on the forward's local address and splices them into ssh, which listens on
+// the internal backend address.
+type relay struct {
+	id      string
+	ln      net.Listener
+	backend string
+	traffic *trafficCounter
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+// newRelay binds local for tunnel id and picks the internal backend port.
+func (m *Manager) newRelay(id, local string) (*relay, error) {
+	ln, err := net.Listen("tcp", local)
+	if err != nil {
+		return nil, security.NewClassifiedError(
+			fmt.Sprintf("local port %s is already in use", local),
+			err.Error(),
+		)
+	}
+	port, err := freeLoopbackPort()
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return &relay{
+		id:      id,
+		ln:      ln,
+		backend: fmt.Sprintf("127.0.0.1:%d", port),
+		traffic: m.trafficFor(id),
+		conns:   make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// trafficFor returns the counter of tunnel id, creating it if needed.
+func (m *Manager) trafficFor(id string) *trafficCounter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tc := m.traffic[id]
+	if tc == nil {
+		tc = &trafficCounter{}
+		m.traffic[id] = tc
+	}
+	return tc
+}
+
+func (m *Manager) serveRelay(r *relay) {
+	for {
+		conn, err := r.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Warn("relay listener failed", "id", r.id, "error", err)
+			}
+			return
+		}
+		go m.handleRelayConn(r, conn)
+	}
+}
+
+func (m *Manager) handleRelayConn(r *relay, client net.Conn) {
+	if !r.track(client) {
+		_ = client.Close()
+		return
+	}
+	defer r.untrack(client)
+	defer client.Close()
+
+	var in, out int64
+	done := m.clientOpened(r.id, r.traffic)
+	defer func() { done(client.RemoteAddr(), in, out) }()
+
+	upstream, err := net.DialTimeout("tcp", r.backend, onDemandReadyTimeout)
+	if err != nil {
+		slog.Warn("relay backend dial failed", "id", r.id, "error", err)
+		return
+	}
+	if !r.track(upstream) {
+		_ = upstream.Close()
+		return
+	}
+	defer r.untrack(upstream)
+	defer upstream.Close()
+	in, out = splice(client, upstream, r.traffic)
+}
+
+// track registers a connection. It reports false once the relay is closed.
+func (r *relay) track(c net.Conn) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.conns[c] = struct{}{}
+	return true
+}
+
+func (r *relay) untrack(c net.Conn) {
+	r.mu.Lock()
+	delete(r.conns, c)
+	r.mu.Unlock()
+}
+
+// close stops listening and drops all clients. It is safe to call repeatedly.
+func (r *relay) close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	conns := make([]net.Conn, 0, len(r.conns))
+	for c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.Unlock()
+
+	_ = r.ln.Close()
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// clientOpened counts a new client of tunnel id. The returned func must be
+// called when the client is gone; it records a client_disconnected event with
+// the client's address, connection duration and bytes transferred.
+func (m *Manager) clientOpened(id string, tc *trafficCounter) func(addr net.Addr, in, out int64) {
+	tc.connections.Add(1)
+	tc.active.Add(1)
+	opened := time.Now()
+	m.noteTraffic(id, tc, opened)
+	return func(addr net.Addr, in, out int64) {
+		tc.active.Add(-1)
+		now := time.Now()
+		rt := m.noteTraffic(id, tc, now)
+		source := "unknown"
+		if addr != nil {
+			source = addr.String()
+		}
+		m.recordEvent("client_disconnected", rt, fmt.Sprintf("client %s disconnected after %s (in %s, out %s)",
+			source, now.Sub(opened).Round(time.Millisecond), util.Bytes(in), util.Bytes(out)))
+	}
+}
+
+// noteTraffic copies tc into the runtime entry of tunnel id and marks the
+// tunnel active at now, which idle detection reads. The entry is persisted
+// at most once per trafficPersistInterval, so other ssh-manager processes
+// see current counters without a rewrite per connection.
+func (m *Manager) noteTraffic(id string, tc *trafficCounter, now time.Time) model.TunnelRuntime {
+	m.mu.Lock()
+	rt, ok := m.runtime[id]
+	if ok {
+		rt.Traffic = tc.stats()
+		rt.LastActiveAt = now
+		m.runtime[id] = rt
+	}
+	m.mu.Unlock()
+	if !ok {
+		return rt
+	}
+
+	tc.mu.Lock()
+	if tc.flush != nil {
+		tc.mu.Unlock()
+		return rt
+	}
+	if wait := trafficPersistInterval - now.Sub(tc.persisted); wait > 0 {
+		tc.flush = time.AfterFunc(wait, func() {
+			tc.mu.Lock()
+			tc.flush = nil
+			tc.persisted = time.Now()
+			tc.mu.Unlock()
+			m.persistTraffic(id, tc)
+		})
+		tc.mu.Unlock()
+		return rt
+	}
+	tc.persisted = now
+	tc.mu.Unlock()
+	m.persistTraffic(id, tc)
+	return rt
+}
+
+// persistTraffic writes runtime.json for a traffic change of tunnel id,
+// unless the tunnel was stopped meanwhile (Stop persists on its own).
+func (m *Manager) persistTraffic(id string, tc *trafficCounter) {
+	m.mu.Lock()
+	current := m.traffic[id] == tc
+	m.mu.Unlock()
+	if !current {
+		return
+	}
+	if err := m.persist(); err != nil {
+		slog.Warn("failed to persist tunnel traffic", "error", err)
+	}
+}
+
+// liveTraffic returns the current counters of tunnel id when its listener
+// lives in this process, or nil. Callers hold m.mu.
+func (m *Manager) liveTraffic(id string) *model.TrafficStats {
+	if tc := m.traffic[id]; tc != nil {
+		return tc.stats()
+	}
+	return nil
+}
+
+// ownedElsewhere reports whether rt's listener is held by another live
+// ssh-manager process, which alone can stop it.
+func ownedElsewhere(rt model.TunnelRuntime) bool {
+	return (rt.OnDemand || rt.Relay) && rt.OwnerPID > 0 && rt.OwnerPID != os.Getpid() && processAlive(rt.OwnerPID)
+}
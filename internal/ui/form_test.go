@@ -2,6 +2,8 @@ package ui
 
 import (
 	"testing"
+
+	"github.com/treykane/ssh-manager/internal/model"
 )
 
 func TestParseQuickConnect(t *testing.T) {
@@ -103,3 +105,26 @@ func TestParseQuickConnect(t *testing.T) {
 		})
 	}
 }
+
+func TestSendFileFormRequest(t *testing.T) {
+	dir := t.TempDir()
+	f := newSendFileForm(model.HostEntry{Alias: "prod"})
+	if _, err := f.request(); err == nil {
+		t.Fatal("expected an error without a local path")
+	}
+
+	f.fields[0].SetValue(dir)
+	f.fields[1].SetValue(" /srv/app ")
+	req, err := f.request()
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if !req.opts.Recursive || req.src.Path != dir || req.dst.Host.Alias != "prod" || req.dst.Path != "/srv/app" {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+
+	f.fields[0].SetValue(dir + "/missing")
+	if _, err := f.request(); err == nil {
+		t.Fatal("expected an error for a missing local path")
+	}
+}
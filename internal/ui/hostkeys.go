@@ -0,0 +1,141 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/treykane/ssh-manager/internal/hostkeys"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+)
+
+// hostKeyScanTimeout bounds the ssh-keyscan run of the "fix host key"
+// action.
+const hostKeyScanTimeout = 15 * time.Second
+
+// hostKeyFix is a pending fix of a "remote host identification has
+// changed" failure: the keys the host presents now, shown in the details
+// panel until the user confirms replacing its known_hosts entries.
+type hostKeyFix struct {
+	host model.HostEntry
+	path string
+
+	// old are the known_hosts entries that would be removed; keys the
+	// scanned keys that replace them.
+	old  []hostkeys.Entry
+	keys []hostkeys.Entry
+
+	// refused explains why the keys cannot be accepted here (they do not
+	// match the host's pins); empty when they can.
+	refused string
+}
+
+// hostKeyScanMsg carries the result of scanning a host for the fix.
+type hostKeyScanMsg struct {
+	fix *hostKeyFix
+	err error
+}
+
+// hostKeyFixedMsg reports that a host's known_hosts entries were replaced.
+type hostKeyFixedMsg struct {
+	alias  string
+	status string
+}
+
+// hostKeyChanged reports whether the last tunnel start or health check of
+// alias failed because its host key changed.
+func (m dashboardModel) hostKeyChanged(alias string) bool {
+	code := string(sshclient.CodeHostKeyChanged)
+	if m.hostHealth[alias].ErrorCode == code {
+		return true
+	}
+	for _, rt := range m.tunnels {
+		if rt.HostAlias == alias && rt.ErrorCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// scanHostKeyCmd scans h with ssh-keyscan and compares the result with its
+// known_hosts entries and pins.
+func scanHostKeyCmd(h model.HostEntry) tea.Cmd {
+	return func() tea.Msg {
+		if err := hostkeys.EnsureKeyscanBinary(); err != nil {
+			return hostKeyScanMsg{err: err}
+		}
+		path, err := hostkeys.DefaultPath()
+		if err != nil {
+			return hostKeyScanMsg{err: err}
+		}
+		name, port := hostkeys.Target(h)
+		old, err := hostkeys.Lookup(path, name, port)
+		if err != nil {
+			return hostKeyScanMsg{err: err}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), hostKeyScanTimeout)
+		defer cancel()
+		keys, err := hostkeys.Scan(ctx, h, nil)
+		if err != nil {
+			return hostKeyScanMsg{err: err}
+		}
+		fix := &hostKeyFix{host: h, path: path, keys: keys}
+		for _, e := range old {
+			if e.Marker == "" {
+				fix.old = append(fix.old, e)
+			}
+		}
+		pins, err := hostkeys.Pins()
+		if err != nil {
+			return hostKeyScanMsg{err: err}
+		}
+		if status, _ := hostkeys.Verify(pins[h.Alias], keys); status == hostkeys.StatusMismatch {
+			fix.refused = "the new key does not match the pinned fingerprints; check it, then use ssh-manager hostkeys"
+		}
+		return hostKeyScanMsg{fix: fix}
+	}
+}
+
+// applyHostKeyFixCmd replaces the host's known_hosts entries with the
+// scanned keys, keeping a backup of the file.
+func applyHostKeyFixCmd(fix *hostKeyFix) tea.Cmd {
+	return func() tea.Msg {
+		name, port := hostkeys.Target(fix.host)
+		backup := ""
+		if len(fix.old) > 0 {
+			var err error
+			if _, backup, err = hostkeys.Remove(fix.path, name, port); err != nil {
+				return statusMsg("Fix host key failed: " + err.Error())
+			}
+		}
+		if err := hostkeys.Append(fix.path, fix.keys); err != nil {
+			return statusMsg("Fix host key failed: " + err.Error())
+		}
+		status := fmt.Sprintf("Replaced the host key of %s in %s", fix.host.Alias, fix.path)
+		if backup != "" {
+			status += " (backup: " + backup + ")"
+		}
+		return hostKeyFixedMsg{alias: fix.host.Alias, status: status}
+	}
+}
+
+// view renders the pending fix for the details panel.
+func (f *hostKeyFix) view() string {
+	var b strings.Builder
+	b.WriteString("Host key fix:\n")
+	for _, e := range f.old {
+		b.WriteString(fmt.Sprintf("  known_hosts line %d: %s %s\n", e.Line, e.KeyType, e.Fingerprint))
+	}
+	for _, k := range f.keys {
+		b.WriteString(fmt.Sprintf("  presented now:   %s %s\n", k.KeyType, k.Fingerprint))
+	}
+	if f.refused != "" {
+		b.WriteString("  Refused: " + f.refused + ".\n  Press n to close.\n")
+		return b.String()
+	}
+	b.WriteString("  Verify the fingerprint out of band. Press y to replace the\n  known_hosts entries (a backup is kept), n to cancel.\n")
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package ui
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/treykane/ssh-manager/internal/history"
+	"github.com/treykane/ssh-manager/internal/hostkeys"
+	"github.com/treykane/ssh-manager/internal/model"
+)
+
+func TestHostKeyFixFlow(t *testing.T) {
+	api := model.HostEntry{Alias: "api"}
+	m := dashboardModel{
+		hosts:      []model.HostEntry{api, {Alias: "db"}},
+		filtered:   []model.HostEntry{api, {Alias: "db"}},
+		tunnels:    []model.TunnelRuntime{{HostAlias: "api", ErrorCode: "host_key_changed"}},
+		hostHealth: map[string]history.HealthRecord{"db": {ErrorCode: "host_key_changed"}},
+	}
+	if !m.hostKeyChanged("api") || !m.hostKeyChanged("db") {
+		t.Fatal("expected changed host keys from the tunnel and the health check")
+	}
+
+	key := hostkeys.Entry{KeyType: "ssh-ed25519", Fingerprint: "SHA256:new"}
+	next, _ := m.Update(hostKeyScanMsg{fix: &hostKeyFix{host: api, keys: []hostkeys.Entry{key}, refused: "pinned"}})
+	m = next.(dashboardModel)
+	if m.hostKeyFix == nil {
+		t.Fatal("expected a pending fix")
+	}
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	m = next.(dashboardModel)
+	if cmd != nil || m.hostKeyFix == nil {
+		t.Fatal("expected a refused fix not to be applied")
+	}
+	next, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	m = next.(dashboardModel)
+	if m.hostKeyFix != nil {
+		t.Fatal("expected the fix cancelled")
+	}
+
+	next, _ = m.Update(hostKeyFixedMsg{alias: "db", status: "done"})
+	m = next.(dashboardModel)
+	if m.hostKeyChanged("db") || m.status != "done" {
+		t.Fatalf("expected the health failure cleared, got %+v", m.hostHealth["db"])
+	}
+}
@@ -0,0 +1,107 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/sshclient"
+)
+
+// sendFileForm holds the state of the "send file" action, which copies a
+// local file or directory to the selected host with scp.
+type sendFileForm struct {
+	host model.HostEntry
+
+	// fields are the local and the remote path; focusIdx is the focused one.
+	fields   []textinput.Model
+	focusIdx int
+
+	errMsg string
+}
+
+// sendFileRequest is returned when the user submits the form.
+type sendFileRequest struct {
+	src, dst sshclient.CopyPath
+	opts     sshclient.CopyOptions
+}
+
+func newSendFileForm(host model.HostEntry) *sendFileForm {
+	f := &sendFileForm{host: host}
+	placeholders := []string{"./file or ./dir (required)", "remote path (default: home directory)"}
+	f.fields = make([]textinput.Model, len(placeholders))
+	for i, p := range placeholders {
+		ti := textinput.New()
+		ti.Placeholder = p
+		ti.CharLimit = 1024
+		ti.Width = 50
+		f.fields[i] = ti
+	}
+	f.fields[0].Focus()
+	return f
+}
+
+// update processes a key message and returns a request once the form is
+// submitted.
+func (f *sendFileForm) update(msg tea.KeyMsg) (*sendFileRequest, tea.Cmd) {
+	switch msg.String() {
+	case "tab", "shift+tab":
+		f.fields[f.focusIdx].Blur()
+		f.focusIdx = (f.focusIdx + 1) % len(f.fields)
+		f.fields[f.focusIdx].Focus()
+		return nil, f.fields[f.focusIdx].Cursor.BlinkCmd()
+	case "enter":
+		req, err := f.request()
+		if err != nil {
+			f.errMsg = err.Error()
+			return nil, nil
+		}
+		return req, nil
+	default:
+		var cmd tea.Cmd
+		f.fields[f.focusIdx], cmd = f.fields[f.focusIdx].Update(msg)
+		f.errMsg = ""
+		return nil, cmd
+	}
+}
+
+// request validates the form. Directories are copied recursively.
+func (f *sendFileForm) request() (*sendFileRequest, error) {
+	local := strings.TrimSpace(f.fields[0].Value())
+	if local == "" {
+		return nil, errors.New("local path is required")
+	}
+	fi, err := os.Stat(local)
+	if err != nil {
+		return nil, err
+	}
+	return &sendFileRequest{
+		src:  sshclient.CopyPath{Path: local},
+		dst:  sshclient.CopyPath{Host: f.host, Path: strings.TrimSpace(f.fields[1].Value())},
+		opts: sshclient.CopyOptions{Recursive: fi.IsDir()},
+	}, nil
+}
+
+func (f *sendFileForm) view(renderPanel func(string, string, int, lipgloss.Color) string, width int) string {
+	labels := []string{"Local:", "Remote:"}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Copy to %s with scp:\n\n", f.host.Alias))
+	for i, label := range labels {
+		cursor := "  "
+		if i == f.focusIdx {
+			cursor = "> "
+		}
+		b.WriteString(fmt.Sprintf("%s%-8s %s\n", cursor, label, f.fields[i].View()))
+	}
+	if f.errMsg != "" {
+		errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+		b.WriteString("\n" + errStyle.Render("Error: "+f.errMsg) + "\n")
+	}
+	b.WriteString("\nTab switch field | Enter send | Esc cancel")
+	return renderPanel("Send File", b.String(), width, lipgloss.Color("214"))
+}
@@ -33,7 +33,9 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"sort"
 	"strconv"
@@ -48,6 +50,7 @@ import (
 	"github.com/treykane/ssh-manager/internal/events"
 	"github.com/treykane/ssh-manager/internal/history"
 	"github.com/treykane/ssh-manager/internal/model"
+	"github.com/treykane/ssh-manager/internal/remoteexec"
 	"github.com/treykane/ssh-manager/internal/security"
 	"github.com/treykane/ssh-manager/internal/sshclient"
 	"github.com/treykane/ssh-manager/internal/tunnel"
@@ -58,6 +61,24 @@ import (
 // When received in Update(), it triggers a tunnel status snapshot refresh.
 type tickMsg time.Time
 
+// healthMsg is emitted when a background application-level health check
+// round (tunnel.Manager.CheckHealth) completes.
+type healthMsg struct{}
+
+// hostHealthMsg is emitted when a round of remote host health checks
+// (remoteexec.CheckHealth) completes.
+type hostHealthMsg struct {
+	records map[string]history.HealthRecord
+	err     error
+
+	// report shows the results in the status bar (checks started with H).
+	report bool
+}
+
+// tunnelActionMsg carries the status line of a tunnel action that ran in the
+// background (see tunnelActionCmd).
+type tunnelActionMsg string
+
 // statusMsg is a Bubble Tea message used to update the status bar text.
 // It is typically sent after an asynchronous operation completes (e.g., an
 // SSH session ending) to communicate the result back to the dashboard.
@@ -134,6 +155,12 @@ type dashboardModel struct {
 	// nil when the form is not active.
 	form *newConnForm
 
+	// sendFile holds the state of the "send file" form; nil when closed.
+	sendFile *sendFileForm
+
+	// hostKeyFix is the pending "fix host key" action; nil when none.
+	hostKeyFix *hostKeyFix
+
 	// adHocHosts stores session-only hosts created via the form so they
 	// survive config reloads (press 'r').
 	adHocHosts []model.HostEntry
@@ -147,6 +174,16 @@ type dashboardModel struct {
 	showEvents        bool
 	recentEvents      []events.Event
 	tunnelStateFilter string
+
+	// healthRunning is true while a background CheckHealth round is in flight.
+	healthRunning bool
+
+	// hostHealth holds the latest remote health check of each host alias.
+	// hostHealthRunning is true while a round is in flight, and
+	// hostHealthAt is when the last background round started.
+	hostHealth        map[string]history.HealthRecord
+	hostHealthRunning bool
+	hostHealthAt      time.Time
 }
 
 // initialModel creates the initial dashboardModel with loaded configuration,
@@ -175,7 +212,22 @@ func initialModel() dashboardModel {
 		cfg.Tunnel.RestartBackoffSeconds,
 		cfg.Tunnel.RestartStableWindowSeconds,
 	)
+	mgr.SetRestartBackoff(time.Duration(cfg.Tunnel.RestartBackoffMaxSeconds)*time.Second, cfg.Tunnel.RestartJitter)
+	mgr.SetCircuitBreaker(cfg.Tunnel.BreakerThreshold, time.Duration(cfg.Tunnel.BreakerCooldownSeconds)*time.Second)
+	mgr.SetForwardConfigs(cfg.Forwards)
+	mgr.SetReadyTimeout(time.Duration(cfg.Tunnel.ReadyTimeoutSeconds) * time.Second)
+	mgr.SetOnDemandIdle(time.Duration(cfg.Tunnel.OnDemandIdleSeconds) * time.Second)
+	mgr.SetAutoPortRange(cfg.Tunnel.AutoPortMin, cfg.Tunnel.AutoPortMax)
+	mgr.SetLifetimeDefaults(
+		time.Duration(cfg.Tunnel.TTLSeconds)*time.Second,
+		time.Duration(cfg.Tunnel.IdleTimeoutSeconds)*time.Second,
+	)
+	mgr.SetMultiplex(cfg.Tunnel.Multiplex)
+	mgr.SetHooks(cfg.Hooks, cfg.Tunnel.HookConcurrency)
+	mgr.SetWebhooks(cfg.Webhooks)
 	ssh.SetHostKeyPolicy(cfg.Security.HostKeyPolicy)
+	ssh.SetSSHOptions(cfg.SSH, cfg.Forwards)
+	ssh.SetRecording(cfg.Recording)
 
 	// Restore tunnel state from a previous session. If the runtime file
 	// doesn't exist or can't be read, we proceed with an empty state.
@@ -184,6 +236,10 @@ func initialModel() dashboardModel {
 	}
 
 	m := dashboardModel{cfg: cfg, mgr: mgr, ssh: ssh}
+	if m.hostHealth, err = history.LatestHealth(); err != nil {
+		slog.Warn("failed to load host health", "error", err)
+		m.hostHealth = map[string]history.HealthRecord{}
+	}
 	m.reloadConfig()
 	m.refreshEvents(20)
 	m.tunnelStateFilter = "all"
@@ -247,6 +303,86 @@ func (m *dashboardModel) applyFilter() {
 	}
 }
 
+// tunnelActionCmd runs a tunnel action off the UI thread. Starting a tunnel
+// can block for the readiness timeout, so start/stop/recover actions report
+// back with a tunnelActionMsg instead of running inside Update.
+func tunnelActionCmd(fn func() string) tea.Cmd {
+	return func() tea.Msg { return tunnelActionMsg(fn()) }
+}
+
+// checkHealthCmd runs one round of application-level health checks in the
+// background and reports completion with a healthMsg.
+func checkHealthCmd(mgr *tunnel.Manager) tea.Cmd {
+	return func() tea.Msg {
+		mgr.CheckHealth()
+		return healthMsg{}
+	}
+}
+
+// checkHostHealthCmd runs the health command on hosts in the background and
+// reports the results with a hostHealthMsg.
+func checkHostHealthCmd(ssh *sshclient.Client, cfg appconfig.Config, hosts []model.HostEntry) tea.Cmd {
+	return func() tea.Msg {
+		records, err := remoteexec.CheckHealth(context.Background(), ssh, cfg, hosts)
+		return hostHealthMsg{records: records, err: err}
+	}
+}
+
+// sendFileCmd runs the copy of req with the terminal handed over to scp, so
+// its progress meter and any prompts are shown, like an ssh session.
+func (m dashboardModel) sendFileCmd(req *sendFileRequest) tea.Cmd {
+	alias := req.dst.Host.Alias
+	if err := sshclient.EnsureCopyBinary(req.opts); err != nil {
+		return func() tea.Msg { return statusMsg("Send file failed: " + err.Error()) }
+	}
+	cmd, err := m.ssh.CopyCommand(context.Background(), req.src, req.dst, req.opts)
+	if err != nil {
+		return func() tea.Msg { return statusMsg("Send file failed: " + err.Error()) }
+	}
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		if err != nil {
+			return statusMsg("Send file to " + alias + " failed: " + security.UserMessage(err, m.cfg.Security.RedactErrors))
+		}
+		_ = history.Touch(alias)
+		return statusMsg("Sent " + req.src.Path + " to " + alias)
+	})
+}
+
+// recordedSession runs a recorded interactive session under tea.Exec.
+// RunInteractive reads and writes the terminal itself, so the standard
+// streams Bubble Tea offers are not used.
+type recordedSession struct {
+	ssh  *sshclient.Client
+	host model.HostEntry
+}
+
+func (s recordedSession) Run() error {
+	return s.ssh.RunInteractive(context.Background(), s.host)
+}
+
+func (recordedSession) SetStdin(io.Reader)  {}
+func (recordedSession) SetStdout(io.Writer) {}
+func (recordedSession) SetStderr(io.Writer) {}
+
+// hostHealthDue reports whether a background host health round should start:
+// one is configured, none is running, and the interval has passed.
+func (m dashboardModel) hostHealthDue(now time.Time) bool {
+	interval := time.Duration(m.cfg.HostHealth.IntervalSeconds) * time.Second
+	return interval > 0 && !m.hostHealthRunning && now.Sub(m.hostHealthAt) >= interval
+}
+
+// configHosts returns the hosts from ~/.ssh/config, leaving out ad-hoc ones,
+// whose aliases ssh cannot resolve.
+func (m dashboardModel) configHosts() []model.HostEntry {
+	var out []model.HostEntry
+	for _, h := range m.hosts {
+		if !h.IsAdHoc {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
 // tickCmd returns a Bubble Tea command that emits a tickMsg after the configured
 // refresh interval. This drives the periodic tunnel status refresh in the UI.
 //
@@ -290,7 +426,63 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.showEvents {
 			m.refreshEvents(20)
 		}
-		return m, tickCmd(m.cfg.UI.RefreshSeconds)
+		cmds := []tea.Cmd{tickCmd(m.cfg.UI.RefreshSeconds)}
+		// Application-level checks can take seconds, so run them off the
+		// UI thread and refresh the table when they finish.
+		if !m.healthRunning {
+			m.healthRunning = true
+			cmds = append(cmds, checkHealthCmd(m.mgr))
+		}
+		if now := time.Time(msg); m.hostHealthDue(now) {
+			if hosts := m.configHosts(); len(hosts) > 0 {
+				m.hostHealthRunning = true
+				m.hostHealthAt = now
+				cmds = append(cmds, checkHostHealthCmd(m.ssh, m.cfg, hosts))
+			}
+		}
+		return m, tea.Batch(cmds...)
+
+	case healthMsg:
+		m.healthRunning = false
+		m.tunnels = m.mgr.Snapshot()
+		return m, nil
+
+	case hostHealthMsg:
+		m.hostHealthRunning = false
+		if m.hostHealth == nil {
+			m.hostHealth = map[string]history.HealthRecord{}
+		}
+		for alias, rec := range msg.records {
+			m.hostHealth[alias] = rec
+			if msg.report {
+				m.status = fmt.Sprintf("Health of %s: %s %s", alias, rec.Label(), rec.Summary)
+			}
+		}
+		if msg.err != nil {
+			m.status = "Failed to record host health: " + msg.err.Error()
+		}
+		return m, nil
+
+	case hostKeyScanMsg:
+		if msg.err != nil {
+			m.status = "Host key scan failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.hostKeyFix = msg.fix
+		if msg.fix.refused != "" {
+			m.status = "Host key of " + msg.fix.host.Alias + " not replaced: " + msg.fix.refused
+		} else {
+			m.status = "Review the new host key of " + msg.fix.host.Alias + ": y replaces it, n cancels"
+		}
+		return m, nil
+
+	case hostKeyFixedMsg:
+		if rec, ok := m.hostHealth[msg.alias]; ok {
+			rec.ErrorCode = ""
+			m.hostHealth[msg.alias] = rec
+		}
+		m.status = msg.status
+		return m, nil
 
 	case tea.WindowSizeMsg:
 		// Terminal was resized — store new dimensions for layout calculations.
@@ -341,6 +533,40 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+		// --- Send file form ---
+		if m.sendFile != nil {
+			if msg.String() == "esc" {
+				m.sendFile = nil
+				m.status = "Send file cancelled"
+				return m, nil
+			}
+			req, cmd := m.sendFile.update(msg)
+			if req == nil {
+				return m, cmd
+			}
+			m.sendFile = nil
+			return m, m.sendFileCmd(req)
+		}
+
+		// --- Host key fix confirmation ---
+		if m.hostKeyFix != nil {
+			fix := m.hostKeyFix
+			switch msg.String() {
+			case "y":
+				if fix.refused != "" {
+					m.status = "Host key of " + fix.host.Alias + " not replaced: " + fix.refused
+					return m, nil
+				}
+				m.hostKeyFix = nil
+				m.status = "Replacing the host key of " + fix.host.Alias + "..."
+				return m, applyHostKeyFixCmd(fix)
+			case "n", "esc":
+				m.hostKeyFix = nil
+				m.status = "Host key fix cancelled"
+			}
+			return m, nil
+		}
+
 		// --- Bundle runner mode ---
 		if m.bundleMode {
 			switch msg.String() {
@@ -364,10 +590,10 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.status = "No bundles saved"
 					return m, nil
 				}
-				m.status = m.runBundle(m.bundles[m.bundleSel])
+				def := m.bundles[m.bundleSel]
 				m.bundleMode = false
-				m.tunnels = m.mgr.Snapshot()
-				return m, nil
+				m.status = "Running bundle " + def.Name + "..."
+				return m, tunnelActionCmd(func() string { return m.runBundle(def) })
 			}
 		}
 
@@ -410,6 +636,28 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.status = "Recent-first sorting disabled"
 			}
 
+		case "H":
+			if len(m.filtered) == 0 {
+				break
+			}
+			h := m.filtered[m.sel]
+			if h.IsAdHoc {
+				m.status = "Health checks need a host from ~/.ssh/config"
+				break
+			}
+			if m.hostHealthRunning {
+				m.status = "A host health check is already running"
+				break
+			}
+			m.hostHealthRunning = true
+			m.status = "Checking health of " + h.Alias + "..."
+			check := checkHostHealthCmd(m.ssh, m.cfg, []model.HostEntry{h})
+			return m, func() tea.Msg {
+				msg := check().(hostHealthMsg)
+				msg.report = true
+				return msg
+			}
+
 		case "s":
 			m.tunnelStateFilter = nextTunnelFilter(m.tunnelStateFilter)
 			m.status = "Tunnel filter: " + m.tunnelStateFilter
@@ -441,14 +689,42 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// ExecProcess, which suspends the TUI, gives the SSH process
 			// full control of the terminal, and resumes the TUI when the
 			// SSH session ends.
-			cmd := m.ssh.ConnectCommand(h)
-			return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+			// Recorded sessions run through RunInteractive instead, which
+			// copies the terminal into the recording.
+			done := func(err error) tea.Msg {
 				if err != nil {
 					return statusMsg("ssh exited: " + security.UserMessage(err, m.cfg.Security.RedactErrors))
 				}
 				_ = history.Touch(h.Alias)
 				return statusMsg("ssh session closed")
-			})
+			}
+			if m.ssh.Records(h) {
+				return m, tea.Exec(recordedSession{ssh: m.ssh, host: h}, done)
+			}
+			return m, tea.ExecProcess(m.ssh.ConnectCommand(h), done)
+
+		case "K":
+			// Offer to fix a changed host key: scan the host and show the
+			// new fingerprint for confirmation.
+			if len(m.filtered) == 0 {
+				break
+			}
+			h := m.filtered[m.sel]
+			if !m.hostKeyChanged(h.Alias) {
+				m.status = "No host key change recorded for " + h.Alias + "; see ssh-manager hostkeys"
+				break
+			}
+			m.status = "Scanning the host key of " + h.Alias + "..."
+			return m, scanHostKeyCmd(h)
+
+		case "u":
+			// Open the "send file" form for the selected host.
+			if len(m.filtered) == 0 {
+				break
+			}
+			m.sendFile = newSendFileForm(m.filtered[m.sel])
+			m.status = "Send file: enter the local and remote path"
+			return m, m.sendFile.fields[0].Cursor.BlinkCmd()
 
 		case "n":
 			// Open the new connection configurator form.
@@ -484,8 +760,25 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Use the first forward for the toggle action. Users who need
 			// to manage specific forwards can use the CLI:
 			//   ssh-manager tunnel up <host> --forward <index>
-			m.status = m.toggleForward(h, 0)
-			m.tunnels = m.mgr.Snapshot()
+			m.status = "Toggling tunnel for " + h.Alias + "..."
+			return m, tunnelActionCmd(func() string { return m.toggleForward(h, 0) })
+
+		case "o":
+			// Arm the first LocalForward on demand: ssh-manager holds the
+			// port and starts ssh when a client connects. Toggles off when
+			// the tunnel is already active.
+			if len(m.filtered) == 0 {
+				break
+			}
+			h := m.filtered[m.sel]
+			if len(h.Forwards) == 0 {
+				m.status = "No LocalForward entries for host " + h.Alias
+				break
+			}
+			m.status = "Arming tunnel for " + h.Alias + "..."
+			return m, tunnelActionCmd(func() string {
+				return m.toggleForwardWith(h, 0, tunnel.ForwardOptions{OnDemand: true})
+			})
 
 		case "c":
 			if len(m.filtered) == 0 {
@@ -514,32 +807,35 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.status = "No LocalForward entries for host " + h.Alias
 				break
 			}
-			stopped := 0
-			started := 0
-			for i := range h.Forwards {
-				status := m.toggleForward(h, i)
-				if strings.HasPrefix(status, "Tunnel stopped:") {
-					stopped++
-				}
-				if strings.HasPrefix(status, "Tunnel started:") {
-					started++
+			m.status = "Processing forwards for " + h.Alias + "..."
+			return m, tunnelActionCmd(func() string {
+				stopped := 0
+				started := 0
+				for i := range h.Forwards {
+					status := m.toggleForward(h, i)
+					if strings.HasPrefix(status, "Tunnel stopped:") {
+						stopped++
+					}
+					if strings.HasPrefix(status, "Tunnel started:") {
+						started++
+					}
 				}
-			}
-			m.status = fmt.Sprintf("Processed %d forwards for %s (started=%d, stopped=%d)", len(h.Forwards), h.Alias, started, stopped)
-			m.tunnels = m.mgr.Snapshot()
+				return fmt.Sprintf("Processed %d forwards for %s (started=%d, stopped=%d)", len(h.Forwards), h.Alias, started, stopped)
+			})
 
 		case "C":
 			if len(m.filtered) == 0 {
 				break
 			}
 			h := m.filtered[m.sel]
-			recovered, err := m.mgr.RecoverByHost(h.Alias)
-			if err != nil {
-				m.status = "Recover failed: " + security.UserMessage(err, m.cfg.Security.RedactErrors)
-				break
-			}
-			m.status = fmt.Sprintf("Recovered %d quarantined tunnel(s) for %s", len(recovered), h.Alias)
-			m.tunnels = m.mgr.Snapshot()
+			m.status = "Recovering tunnels for " + h.Alias + "..."
+			return m, tunnelActionCmd(func() string {
+				recovered, err := m.mgr.RecoverByHost(h.Alias)
+				if err != nil {
+					return "Recover failed: " + security.UserMessage(err, m.cfg.Security.RedactErrors)
+				}
+				return fmt.Sprintf("Recovered %d quarantined tunnel(s) for %s", len(recovered), h.Alias)
+			})
 
 		case "R":
 			if len(m.filtered) == 0 {
@@ -551,9 +847,11 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				break
 			}
 			id := tunnel.RuntimeID(h.Alias, h.Forwards[0])
-			_ = m.mgr.Stop(id)
-			m.status = m.toggleForward(h, 0)
-			m.tunnels = m.mgr.Snapshot()
+			m.status = "Restarting tunnel for " + h.Alias + "..."
+			return m, tunnelActionCmd(func() string {
+				_ = m.mgr.Stop(id)
+				return m.toggleForward(h, 0)
+			})
 
 		case "x":
 			host := ""
@@ -566,13 +864,28 @@ func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				break
 			}
 			m.tunnels = m.mgr.Snapshot()
-			if len(actions) == 0 {
+			applied, adoptable := 0, 0
+			for _, a := range actions {
+				if a.Adoptable {
+					adoptable++
+				} else {
+					applied++
+				}
+			}
+			switch {
+			case applied == 0 && adoptable == 0:
 				m.status = "Reconcile: no actions needed"
-			} else {
-				m.status = fmt.Sprintf("Reconcile: applied %d action(s)", len(actions))
+			case adoptable == 0:
+				m.status = fmt.Sprintf("Reconcile: applied %d action(s)", applied)
+			default:
+				m.status = fmt.Sprintf("Reconcile: applied %d action(s); %d unmanaged tunnel(s) can be adopted with `ssh-manager tunnel adopt`", applied, adoptable)
 			}
 		}
 
+	case tunnelActionMsg:
+		m.status = string(msg)
+		m.tunnels = m.mgr.Snapshot()
+
 	case statusMsg:
 		// Update the status bar with a message from an async operation
 		// (e.g., SSH session completion).
@@ -614,7 +927,7 @@ func (m dashboardModel) View() string {
 	// --- Hosts panel (left side) ---
 
 	left := strings.Builder{}
-	left.WriteString("j/k to navigate; [T] active, [Q] quarantined.\n")
+	left.WriteString("j/k to navigate; [T] active, [Q] quarantined; last health check.\n")
 	for i, h := range m.filtered {
 		// Selection cursor: ">" for the selected host, " " for others.
 		cursor := " "
@@ -629,7 +942,7 @@ func (m dashboardModel) View() string {
 		if m.hostHasQuarantinedTunnel(h.Alias) {
 			tunnelMark = "Q"
 		}
-		left.WriteString(fmt.Sprintf("%s[%s] %-22s %-22s\n", cursor, tunnelMark, h.Alias, h.DisplayTarget()))
+		left.WriteString(fmt.Sprintf("%s[%s] %-22s %-22s %s\n", cursor, tunnelMark, h.Alias, h.DisplayTarget(), m.hostHealth[h.Alias].Label()))
 	}
 	if len(m.filtered) == 0 {
 		left.WriteString("  (no hosts matched)\n")
@@ -644,6 +957,16 @@ func (m dashboardModel) View() string {
 		// Show key configuration fields for the selected host.
 		detail.WriteString(fmt.Sprintf("Alias: %s\nHost: %s\nUser: %s\nPort: %d\nProxyJump: %s\n",
 			h.Alias, h.DisplayTarget(), util.EmptyDash(h.User), h.Port, util.EmptyDash(h.ProxyJump)))
+		if rec, ok := m.hostHealth[h.Alias]; ok {
+			detail.WriteString(fmt.Sprintf("Health: %s (%s, %s) %s\n",
+				rec.Label(), rec.Command, time.Unix(rec.At, 0).Format(time.TimeOnly), util.EmptyDash(rec.Summary)))
+		}
+
+		if m.hostKeyFix != nil && m.hostKeyFix.host.Alias == h.Alias {
+			detail.WriteString(m.hostKeyFix.view())
+		} else if m.hostKeyChanged(h.Alias) {
+			detail.WriteString("Host key: CHANGED since it was recorded in known_hosts.\n  Press K to review the new key and fix known_hosts.\n")
+		}
 
 		// List all LocalForward entries with their index numbers.
 		detail.WriteString("Forwards:\n")
@@ -651,7 +974,21 @@ func (m dashboardModel) View() string {
 			detail.WriteString("  (none)\n")
 		}
 		for i, fwd := range h.Forwards {
-			detail.WriteString(fmt.Sprintf("  [%d] %s:%d -> %s:%d\n", i, fwd.LocalString(), fwd.LocalPort, fwd.RemoteString(), fwd.RemotePort))
+			detail.WriteString(fmt.Sprintf("  [%d] %s:%s -> %s:%d\n", i, fwd.LocalString(), fwd.LocalPortString(), fwd.RemoteString(), fwd.RemotePort))
+		}
+
+		// Client traffic of the host's relayed and on-demand tunnels.
+		traffic := strings.Builder{}
+		for _, rt := range m.tunnels {
+			if rt.HostAlias != h.Alias || rt.Traffic == nil {
+				continue
+			}
+			traffic.WriteString(fmt.Sprintf("  %s conns=%d active=%d in=%s out=%s\n",
+				rt.Local, rt.Traffic.Connections, rt.Traffic.Active, util.Bytes(rt.Traffic.BytesIn), util.Bytes(rt.Traffic.BytesOut)))
+		}
+		if traffic.Len() > 0 {
+			detail.WriteString("Traffic:\n")
+			detail.WriteString(traffic.String())
 		}
 
 		// Contextual guidance telling the user what actions are available
@@ -665,9 +1002,9 @@ func (m dashboardModel) View() string {
 	// --- Tunnels table ---
 
 	tbl := strings.Builder{}
-	tbl.WriteString(fmt.Sprintf("%-24s %-20s %-20s %-10s %-8s %-8s\n", "HOST", "LOCAL", "REMOTE", "STATE", "PID", "LAT"))
+	tbl.WriteString(fmt.Sprintf("%-24s %-20s %-20s %-10s %-8s %-8s %-10s %-10s\n", "HOST", "LOCAL", "REMOTE", "STATE", "PID", "LAT", "HEALTH", "REMAINING"))
 	for _, rt := range visibleTunnels {
-		tbl.WriteString(fmt.Sprintf("%-24s %-20s %-20s %-10s %-8d %-8d\n", rt.HostAlias, rt.Local, rt.Remote, rt.State, rt.PID, rt.LatencyMS))
+		tbl.WriteString(fmt.Sprintf("%-24s %-20s %-20s %-10s %-8d %-8d %-10s %-10s\n", rt.HostAlias, rt.Local, rt.Remote, rt.State, rt.PID, rt.LatencyMS, healthLabel(rt), util.Countdown(rt.RemainingSec)))
 	}
 	if len(visibleTunnels) == 0 {
 		tbl.WriteString("(none)\n")
@@ -689,7 +1026,7 @@ func (m dashboardModel) View() string {
 
 	// --- Quick-reference keybinding bar ---
 
-	quickHelp := "Keys: Enter connect | n new | b bundles | h recent-sort | s tunnel-filter | c preflight | t first tunnel | T all tunnels | C recover quarantined | R restart first | x reconcile | e events | / filter | r refresh | ? help | q quit"
+	quickHelp := "Keys: Enter connect | n new | b bundles | h recent-sort | s tunnel-filter | c preflight | H host health | K fix host key | u send file | t first tunnel | o on-demand first | T all tunnels | C recover quarantined | R restart first | x reconcile | e events | / filter | r refresh | ? help | q quit"
 
 	// --- Compose the final layout ---
 
@@ -697,6 +1034,8 @@ func (m dashboardModel) View() string {
 	var main string
 	if m.form != nil {
 		main = m.form.view(m.renderPanel, m.effectiveWidth())
+	} else if m.sendFile != nil {
+		main = m.sendFile.view(m.renderPanel, m.effectiveWidth())
 	} else if m.bundleMode {
 		main = m.renderPanel("Bundle Runner", m.bundleView(), m.effectiveWidth(), lipgloss.Color("214"))
 	} else {
@@ -771,14 +1110,14 @@ func clampRefresh(seconds int) int {
 }
 
 // hostHasActiveTunnel checks whether any tunnel for the given host alias is
-// currently in the "up" or "starting" state. Used to display the "[T]" indicator
+// currently in the "up", "starting" or "armed" state. Used to display the "[T]" indicator
 // next to hosts in the host list panel.
 func (m dashboardModel) hostHasActiveTunnel(alias string) bool {
 	for _, rt := range m.tunnels {
 		if rt.HostAlias != alias {
 			continue
 		}
-		if rt.State == model.TunnelUp || rt.State == model.TunnelStarting {
+		if rt.State == model.TunnelUp || rt.State == model.TunnelStarting || rt.State == model.TunnelArmed {
 			return true
 		}
 	}
@@ -812,6 +1151,8 @@ func nextTunnelFilter(curr string) string {
 	case "all":
 		return "up"
 	case "up":
+		return "armed"
+	case "armed":
 		return "error"
 	case "error":
 		return "quarantined"
@@ -843,11 +1184,11 @@ func (m dashboardModel) guidanceForHost(h model.HostEntry) string {
 
 	// Check the state of the first forward's tunnel to provide accurate guidance.
 	id := tunnel.RuntimeID(h.Alias, h.Forwards[0])
-	if rt, err := m.mgr.Get(id); err == nil && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting) {
+	if rt, err := m.mgr.Get(id); err == nil && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting || rt.State == model.TunnelArmed) {
 		lines = append(lines, "  - Press t to stop the first LocalForward tunnel.")
 		lines = append(lines, fmt.Sprintf("  - Current tunnel state: %s (pid=%d).", rt.State, rt.PID))
 	} else {
-		lines = append(lines, "  - Press t to start the first LocalForward tunnel.")
+		lines = append(lines, "  - Press t to start the first LocalForward tunnel, or o to arm it on demand.")
 	}
 	lines = append(lines, "  - Press T to process all forwards, C to recover quarantined tunnels, or R to restart the first forward.")
 
@@ -897,13 +1238,16 @@ func (m dashboardModel) helpBlock() string {
 	return strings.Join([]string{
 		"  Navigation: j/k or arrow keys move selection.",
 		"  Sorting: press h to toggle recent-first host ordering.",
-		"  Tunnel filter: press s to cycle all/up/error/quarantined.",
+		"  Tunnel filter: press s to cycle all/up/armed/error/quarantined.",
 		"  Filtering: press /, type alias/host text, then Enter.",
 		"  Connect: press Enter on selected host.",
 		"  New: press n to configure a new SSH connection.",
 		"  Bundles: press b to open the bundle runner.",
 		"  Preflight: press c to validate selected host forwards before start.",
-		"  Tunnel: t toggles first forward; T processes all forwards; R restarts first forward.",
+		"  Host health: press H to run the health command on the selected host.",
+		"  Send file: press u to copy a local file or directory to the selected host.",
+		"  Host key: press K after a \"host identification changed\" failure to review and replace the host's known_hosts entry.",
+		"  Tunnel: t toggles first forward; o arms it on demand; T processes all forwards; R restarts first forward.",
 		"  Events: press e to toggle recent tunnel lifecycle events.",
 		"  Reconcile: press x to quarantine suspicious runtime state for selected host.",
 		"  Recovery: press C to recover quarantined tunnels for selected host.",
@@ -940,11 +1284,14 @@ func (m dashboardModel) eventsView() string {
 
 func (m dashboardModel) metricsLine() string {
 	up := 0
+	armed := 0
 	errs := 0
 	quarantined := 0
 	var lat []int64
 	for _, rt := range m.tunnels {
 		switch rt.State {
+		case model.TunnelArmed:
+			armed++
 		case model.TunnelUp:
 			up++
 			lat = append(lat, rt.LatencyMS)
@@ -955,7 +1302,31 @@ func (m dashboardModel) metricsLine() string {
 		}
 	}
 	avg, p95 := latencyAggUI(lat)
-	return fmt.Sprintf("up=%d error=%d quarantined=%d avg-lat=%.1fms p95=%dms", up, errs, quarantined, avg, p95)
+	line := fmt.Sprintf("up=%d armed=%d error=%d quarantined=%d avg-lat=%.1fms p95=%dms", up, armed, errs, quarantined, avg, p95)
+	healthy, unhealthy := 0, 0
+	for _, rt := range m.tunnels {
+		if rt.Health == nil {
+			continue
+		}
+		if rt.Health.Status == model.HealthHealthy {
+			healthy++
+		} else {
+			unhealthy++
+		}
+	}
+	if healthy+unhealthy > 0 {
+		line += fmt.Sprintf(" healthy=%d unhealthy=%d", healthy, unhealthy)
+	}
+	return line
+}
+
+// healthLabel renders the application-level health of a tunnel; "-" when no
+// check is configured or no result is available yet.
+func healthLabel(rt model.TunnelRuntime) string {
+	if rt.Health == nil {
+		return "-"
+	}
+	return string(rt.Health.Status)
 }
 
 func latencyAggUI(vals []int64) (float64, int64) {
@@ -997,9 +1368,13 @@ func (m dashboardModel) bundleView() string {
 }
 
 func (m *dashboardModel) runBundle(def bundle.Definition) string {
+	entries, err := def.Ordered()
+	if err != nil {
+		return fmt.Sprintf("Bundle %s failed: %v", def.Name, err)
+	}
 	started := 0
 	failed := 0
-	for _, entry := range def.Entries {
+	for _, entry := range entries {
 		host, ok := m.hostByAlias(entry.HostAlias)
 		if !ok {
 			failed++
@@ -1011,7 +1386,7 @@ func (m *dashboardModel) runBundle(def bundle.Definition) string {
 			continue
 		}
 		for _, fwd := range forwards {
-			if _, err := m.mgr.Start(host, fwd); err != nil {
+			if _, err := m.mgr.StartWithOptions(host, fwd, entry.Options()); err != nil {
 				failed++
 			} else {
 				_ = history.Touch(host.Alias)
@@ -1053,21 +1428,30 @@ func resolveBundleForwards(host model.HostEntry, selector string) ([]model.Forwa
 }
 
 func (m *dashboardModel) toggleForward(host model.HostEntry, idx int) string {
+	return m.toggleForwardWith(host, idx, tunnel.ForwardOptions{})
+}
+
+// toggleForwardWith stops the forward's tunnel if it is active and otherwise
+// starts (or, with opts.OnDemand, arms) it.
+func (m *dashboardModel) toggleForwardWith(host model.HostEntry, idx int, opts tunnel.ForwardOptions) string {
 	if idx < 0 || idx >= len(host.Forwards) {
 		return "Tunnel index out of range"
 	}
 	fwd := host.Forwards[idx]
 	id := tunnel.RuntimeID(host.Alias, fwd)
 	rt, err := m.mgr.Get(id)
-	if err == nil && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting) {
+	if err == nil && (rt.State == model.TunnelUp || rt.State == model.TunnelStarting || rt.State == model.TunnelArmed) {
 		_ = m.mgr.Stop(id)
 		return "Tunnel stopped: " + id
 	}
-	newRT, serr := m.mgr.Start(host, fwd)
+	newRT, serr := m.mgr.StartWithOptions(host, fwd, opts)
 	if serr != nil {
 		return "Tunnel start failed: " + security.UserMessage(serr, m.cfg.Security.RedactErrors)
 	}
 	_ = history.Touch(host.Alias)
+	if newRT.State == model.TunnelArmed {
+		return "Tunnel armed: " + newRT.ID + " (ssh starts on first connection)"
+	}
 	return fmt.Sprintf("Tunnel started: %s (pid=%d)", newRT.ID, newRT.PID)
 }
 
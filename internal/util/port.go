@@ -4,7 +4,11 @@
 // without introducing circular dependencies.
 package util
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 const (
 	// MinPort is the lowest valid TCP/UDP port number. Port 0 is reserved and
@@ -15,6 +19,10 @@ const (
 	// MaxPort is the highest valid TCP/UDP port number. TCP and UDP use 16-bit
 	// unsigned integers for port numbers, giving a maximum value of 65535.
 	MaxPort = 65535
+
+	// AutoPort is the local port keyword that asks ssh-manager to pick a free
+	// port for a forward. A literal 0 means the same thing.
+	AutoPort = "auto"
 )
 
 // ValidatePort checks whether the given port number falls within the valid
@@ -38,3 +46,23 @@ func ValidatePort(port int) error {
 	}
 	return nil
 }
+
+// ParseLocalPort parses the local port of a forward. It accepts a port in the
+// valid range, or AutoPort / "0", which yield 0 (allocate automatically).
+func ParseLocalPort(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, AutoPort) {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	if p == 0 {
+		return 0, nil
+	}
+	if err := ValidatePort(p); err != nil {
+		return 0, err
+	}
+	return p, nil
+}
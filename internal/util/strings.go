@@ -4,7 +4,11 @@
 // without introducing circular dependencies.
 package util
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // DefaultString returns the fallback value if v is empty or consists entirely
 // of whitespace; otherwise it returns v unchanged.
@@ -48,3 +52,26 @@ func DefaultString(v, fallback string) string {
 func EmptyDash(s string) string {
 	return DefaultString(s, "-")
 }
+
+// Countdown formats a number of remaining seconds for tables, e.g. "1h59m0s",
+// or "-" when sec is not positive.
+func Countdown(sec int64) string {
+	if sec <= 0 {
+		return "-"
+	}
+	return (time.Duration(sec) * time.Second).String()
+}
+
+// Bytes formats a byte count with a binary unit, e.g. "512B" or "1.5MiB".
+func Bytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
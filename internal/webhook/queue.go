@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/events"
+	"github.com/treykane/ssh-manager/internal/state"
+)
+
+// maxQueued caps the queue; the oldest deliveries are dropped beyond it.
+const maxQueued = 500
+
+// delivery is one event waiting to be POSTed to one endpoint.
+type delivery struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Event         events.Event `json:"event"`
+	Attempts      int          `json:"attempts"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	LastError     string       `json:"last_error,omitempty"`
+
+	// ClaimedBy is the PID of the process delivering it right now, until
+	// ClaimedUntil; claims of crashed processes simply expire.
+	ClaimedBy    int       `json:"claimed_by,omitempty"`
+	ClaimedUntil time.Time `json:"claimed_until,omitzero"`
+}
+
+// queueFile is the on-disk layout of webhook_queue.json (see state.Webhooks).
+type queueFile struct {
+	Version    int        `json:"version"`
+	Deliveries []delivery `json:"deliveries"`
+}
+
+// updateQueue runs fn on the queue and saves the result. Several ssh-manager
+// processes share the file, so the read-modify-write holds an exclusive lock.
+func updateQueue(fn func(q *queueFile)) error {
+	unlock, err := lockQueue()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	q, err := loadQueue()
+	if err != nil {
+		return err
+	}
+	fn(&q)
+	if over := len(q.Deliveries) - maxQueued; over > 0 {
+		q.Deliveries = append([]delivery(nil), q.Deliveries[over:]...)
+	}
+	q.Version = state.Webhooks.Current
+	b, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.Webhooks.Write(b)
+}
+
+func loadQueue() (queueFile, error) {
+	b, err := state.Webhooks.Read()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return queueFile{}, nil
+		}
+		return queueFile{}, err
+	}
+	var q queueFile
+	if err := json.Unmarshal(b, &q); err != nil {
+		return queueFile{}, fmt.Errorf("parse %s: %w", state.Webhooks.Name, err)
+	}
+	return q, nil
+}
+
+// lockQueue takes an exclusive flock on the queue's lock file.
+func lockQueue() (func(), error) {
+	path, err := state.Webhooks.Path()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
@@ -0,0 +1,353 @@
+// Package webhook posts tunnel lifecycle events to HTTP endpoints.
+//
+// Each matching event is queued in webhook_queue.json (see state.Webhooks)
+// before it is sent, and failed deliveries are retried with exponential
+// backoff, so notifications survive restarts of ssh-manager. Any process
+// with webhooks configured drains the queue.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/events"
+	"github.com/treykane/ssh-manager/internal/state"
+)
+
+// Request headers set on every delivery.
+const (
+	SignatureHeader = "X-SSHM-Signature"
+	EventHeader     = "X-SSHM-Event"
+	DeliveryHeader  = "X-SSHM-Delivery"
+)
+
+var (
+	// retryBase and retryMax bound the exponential delay between attempts.
+	retryBase = 2 * time.Second
+	retryMax  = 5 * time.Minute
+
+	// pollInterval is how often a dispatcher looks for deliveries that are
+	// due for a retry.
+	pollInterval = time.Second
+)
+
+// busy counts enqueues and delivery passes in flight in this process (see Wait).
+var busy struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	n    int
+}
+
+func init() {
+	busy.cond = sync.NewCond(&busy.mu)
+}
+
+func busyAdd(delta int) {
+	busy.mu.Lock()
+	busy.n += delta
+	if busy.n == 0 {
+		busy.cond.Broadcast()
+	}
+	busy.mu.Unlock()
+}
+
+// Wait blocks until no event is being queued or delivered by this process.
+// Failed deliveries stay queued for a later attempt rather than being waited
+// for, and each attempt is bounded by its endpoint's timeout.
+func Wait() {
+	busy.mu.Lock()
+	for busy.n > 0 {
+		busy.cond.Wait()
+	}
+	busy.mu.Unlock()
+}
+
+// Dispatcher queues events for the configured endpoints and delivers them.
+type Dispatcher struct {
+	endpoints []appconfig.WebhookConfig
+	client    *http.Client
+
+	mu      sync.Mutex
+	passing bool // a delivery pass is running
+	again   bool // another pass was requested while it ran
+	closed  bool
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup // retry loop and delivery passes
+}
+
+// New returns a dispatcher for endpoints and starts delivering whatever is
+// already queued. Call Close to stop its retry loop.
+func New(endpoints []appconfig.WebhookConfig) *Dispatcher {
+	d := &Dispatcher{
+		client: &http.Client{},
+		stop:   make(chan struct{}),
+	}
+	for _, ep := range endpoints {
+		if ep.TimeoutSeconds <= 0 {
+			ep.TimeoutSeconds = appconfig.DefaultWebhookTimeoutSeconds
+		}
+		if ep.MaxAttempts <= 0 {
+			ep.MaxAttempts = appconfig.DefaultWebhookMaxAttempts
+		}
+		d.endpoints = append(d.endpoints, ep)
+	}
+	d.startPass()
+	t := time.NewTicker(pollInterval)
+	d.running.Add(1)
+	go d.retryLoop(t)
+	return d
+}
+
+// Close stops the retry loop and waits for a running delivery pass. Queued
+// deliveries are kept on disk.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() {
+		d.mu.Lock()
+		d.closed = true
+		d.mu.Unlock()
+		close(d.stop)
+	})
+	d.running.Wait()
+}
+
+// Notify queues evt for every endpoint whose filters match and starts
+// delivering. It does not block on disk or network I/O.
+func (d *Dispatcher) Notify(evt events.Event) {
+	var urls []string
+	for _, ep := range d.endpoints {
+		if matches(ep, evt) {
+			urls = append(urls, ep.URL)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+	evt.Version = state.Events.Current
+
+	busyAdd(1)
+	go func() {
+		defer busyAdd(-1)
+		now := time.Now().UTC()
+		err := updateQueue(func(q *queueFile) {
+			for _, u := range urls {
+				q.Deliveries = append(q.Deliveries, delivery{ID: newID(), URL: u, Event: evt, NextAttemptAt: now})
+			}
+		})
+		if err != nil {
+			slog.Warn("failed to queue webhook delivery", "event", evt.EventType, "error", err)
+			return
+		}
+		d.startPass()
+	}()
+}
+
+// matches reports whether endpoint ep wants evt.
+func matches(ep appconfig.WebhookConfig, evt events.Event) bool {
+	if len(ep.Events) > 0 && !slices.Contains(ep.Events, "*") && !slices.Contains(ep.Events, evt.EventType) {
+		return false
+	}
+	return len(ep.Hosts) == 0 || slices.Contains(ep.Hosts, evt.HostAlias)
+}
+
+func (d *Dispatcher) retryLoop(t *time.Ticker) {
+	defer d.running.Done()
+	defer t.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-t.C:
+			if q, err := loadQueue(); err == nil && hasDue(q, time.Now()) {
+				d.startPass()
+			}
+		}
+	}
+}
+
+// startPass runs a delivery pass in the background, or asks the running
+// one to go again.
+func (d *Dispatcher) startPass() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	if d.passing {
+		d.again = true
+		d.mu.Unlock()
+		return
+	}
+	d.passing = true
+	d.running.Add(1)
+	d.mu.Unlock()
+
+	busyAdd(1)
+	go func() {
+		defer busyAdd(-1)
+		defer d.running.Done()
+		for {
+			d.deliverDue()
+			d.mu.Lock()
+			if !d.again {
+				d.passing = false
+				d.mu.Unlock()
+				return
+			}
+			d.again = false
+			d.mu.Unlock()
+		}
+	}()
+}
+
+func hasDue(q queueFile, now time.Time) bool {
+	return slices.ContainsFunc(q.Deliveries, func(dl delivery) bool { return due(dl, now) })
+}
+
+func due(dl delivery, now time.Time) bool {
+	return !dl.NextAttemptAt.After(now) && (dl.ClaimedBy == 0 || !dl.ClaimedUntil.After(now))
+}
+
+// deliverDue claims the deliveries that are due, sends them, and records
+// the outcome of each.
+func (d *Dispatcher) deliverDue() {
+	now := time.Now().UTC()
+	var claimed []delivery
+	err := updateQueue(func(q *queueFile) {
+		for i := range q.Deliveries {
+			dl := &q.Deliveries[i]
+			if !due(*dl, now) {
+				continue
+			}
+			timeout := appconfig.DefaultWebhookTimeoutSeconds
+			if ep, ok := d.endpoint(dl.URL); ok {
+				timeout = ep.TimeoutSeconds
+			}
+			dl.ClaimedBy = os.Getpid()
+			dl.ClaimedUntil = now.Add(time.Duration(timeout)*time.Second + time.Minute)
+			claimed = append(claimed, *dl)
+		}
+	})
+	if err != nil {
+		slog.Warn("failed to read webhook queue", "error", err)
+		return
+	}
+
+	for _, dl := range claimed {
+		ep, ok := d.endpoint(dl.URL)
+		var sendErr error
+		if ok {
+			sendErr = d.send(ep, dl)
+		}
+		d.finish(dl, ep, ok, sendErr)
+	}
+}
+
+// finish removes a sent (or no longer configured) delivery, or schedules
+// its next attempt; deliveries out of attempts are dropped.
+func (d *Dispatcher) finish(dl delivery, ep appconfig.WebhookConfig, configured bool, sendErr error) {
+	err := updateQueue(func(q *queueFile) {
+		i := slices.IndexFunc(q.Deliveries, func(x delivery) bool { return x.ID == dl.ID })
+		if i < 0 {
+			return
+		}
+		cur := &q.Deliveries[i]
+		switch {
+		case !configured:
+			slog.Warn("dropping webhook delivery for an endpoint no longer configured", "url", dl.URL, "event", dl.Event.EventType)
+		case sendErr == nil:
+		case cur.Attempts+1 >= ep.MaxAttempts:
+			slog.Warn("dropping webhook delivery after repeated failures",
+				"url", dl.URL, "event", dl.Event.EventType, "attempts", cur.Attempts+1, "error", sendErr)
+		default:
+			cur.Attempts++
+			cur.LastError = sendErr.Error()
+			cur.NextAttemptAt = time.Now().UTC().Add(retryDelay(cur.Attempts))
+			cur.ClaimedBy = 0
+			cur.ClaimedUntil = time.Time{}
+			return
+		}
+		q.Deliveries = slices.Delete(q.Deliveries, i, i+1)
+	})
+	if err != nil {
+		slog.Warn("failed to update webhook queue", "error", err)
+	}
+}
+
+// retryDelay is the wait after the n-th failed attempt.
+func retryDelay(n int) time.Duration {
+	d := retryBase
+	for i := 1; i < n && d < retryMax; i++ {
+		d *= 2
+	}
+	return min(d, retryMax)
+}
+
+func (d *Dispatcher) endpoint(url string) (appconfig.WebhookConfig, bool) {
+	i := slices.IndexFunc(d.endpoints, func(ep appconfig.WebhookConfig) bool { return ep.URL == url })
+	if i < 0 {
+		return appconfig.WebhookConfig{}, false
+	}
+	return d.endpoints[i], true
+}
+
+// send POSTs one delivery. Any 2xx response counts as delivered.
+func (d *Dispatcher) send(ep appconfig.WebhookConfig, dl delivery) error {
+	body, err := json.Marshal(dl.Event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ep.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ssh-manager")
+	req.Header.Set(EventHeader, dl.Event.EventType)
+	req.Header.Set(DeliveryHeader, dl.ID)
+	if secret := ep.SigningSecret(); secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the X-SSHM-Signature value of body: "sha256=" followed by the
+// hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
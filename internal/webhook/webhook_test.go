@@ -0,0 +1,181 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/treykane/ssh-manager/internal/appconfig"
+	"github.com/treykane/ssh-manager/internal/events"
+)
+
+type received struct {
+	event     events.Event
+	body      []byte
+	signature string
+}
+
+// recorder is a webhook endpoint that fails the first `fail` requests.
+type recorder struct {
+	mu   sync.Mutex
+	fail int
+	got  []received
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var evt events.Event
+	_ = json.Unmarshal(body, &evt)
+	r.got = append(r.got, received{event: evt, body: body, signature: req.Header.Get(SignatureHeader)})
+}
+
+func (r *recorder) received() []received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]received(nil), r.got...)
+}
+
+func waitForDeliveries(t *testing.T, r *recorder, n int) []received {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got := r.received(); len(got) >= n {
+			return got
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected %d deliveries, got %d", n, len(r.received()))
+	return nil
+}
+
+func fastRetries(t *testing.T) {
+	t.Helper()
+	base, poll := retryBase, pollInterval
+	retryBase, pollInterval = 10*time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() { retryBase, pollInterval = base, poll })
+}
+
+func TestDispatcherSignsAndFilters(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	d := New([]appconfig.WebhookConfig{{
+		URL:    srv.URL,
+		Events: []string{"quarantine"},
+		Hosts:  []string{"prod"},
+		Secret: "s3cret",
+	}})
+	defer d.Close()
+	d.Notify(events.Event{EventType: "start_succeeded", HostAlias: "prod"})
+	d.Notify(events.Event{EventType: "quarantine", HostAlias: "staging"})
+	d.Notify(events.Event{EventType: "quarantine", HostAlias: "prod", TunnelID: "prod|5432"})
+	Wait()
+
+	got := waitForDeliveries(t, rec, 1)
+	if len(got) != 1 || got[0].event.TunnelID != "prod|5432" {
+		t.Fatalf("expected only the matching event, got %+v", got)
+	}
+	if got[0].signature != Sign("s3cret", got[0].body) {
+		t.Fatalf("bad signature %q", got[0].signature)
+	}
+	if got[0].event.Version == 0 {
+		t.Fatal("expected the event schema version to be set")
+	}
+}
+
+func TestDispatcherRetriesFailedDeliveries(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	fastRetries(t)
+	rec := &recorder{fail: 2}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	d := New([]appconfig.WebhookConfig{{URL: srv.URL}})
+	defer d.Close()
+	d.Notify(events.Event{EventType: "unexpected_exit", HostAlias: "db"})
+
+	waitForDeliveries(t, rec, 1)
+	Wait()
+	q, err := loadQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Deliveries) != 0 {
+		t.Fatalf("expected the queue to be drained, got %+v", q.Deliveries)
+	}
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	fastRetries(t)
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	addr := srv.URL
+	srv.Close()
+
+	d := New([]appconfig.WebhookConfig{{URL: addr, TimeoutSeconds: 1}})
+	d.Notify(events.Event{EventType: "stop_requested", HostAlias: "db"})
+	Wait()
+	d.Close()
+
+	q, err := loadQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Deliveries) != 1 || q.Deliveries[0].Attempts == 0 || q.Deliveries[0].LastError == "" {
+		t.Fatalf("expected a failed delivery to stay queued, got %+v", q.Deliveries)
+	}
+
+	// Bring the endpoint back on the same address and start a new dispatcher,
+	// as a later ssh-manager run would.
+	srv = httptest.NewUnstartedServer(rec)
+	l, err := listenOn(addr)
+	if err != nil {
+		t.Skipf("cannot rebind %s: %v", addr, err)
+	}
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	d = New([]appconfig.WebhookConfig{{URL: addr}})
+	defer d.Close()
+	got := waitForDeliveries(t, rec, 1)
+	if got[0].event.EventType != "stop_requested" {
+		t.Fatalf("unexpected delivery %+v", got[0])
+	}
+}
+
+func TestRetryDelayIsCapped(t *testing.T) {
+	if got := retryDelay(1); got != retryBase {
+		t.Fatalf("expected first retry after %s, got %s", retryBase, got)
+	}
+	if got := retryDelay(3); got != 4*retryBase {
+		t.Fatalf("expected third retry after %s, got %s", 4*retryBase, got)
+	}
+	if got := retryDelay(50); got != retryMax {
+		t.Fatalf("expected retries capped at %s, got %s", retryMax, got)
+	}
+}
+
+func listenOn(rawURL string) (net.Listener, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return net.Listen("tcp", u.Host)
+}